@@ -5,16 +5,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda/xrayconfig"
 	"go.opentelemetry.io/contrib/propagators/aws/xray"
@@ -27,16 +33,39 @@ import (
 const (
 	OTEL_STATUS_ERROR_DESCRIPTION = "Check Lambda is failed."
 	CUSTOM_OTEL_SPAN_EVENT_NAME   = "LambdaCheckEvent"
+	DEFAULT_BATCH_KEY_PREFIX      = "batches"
+	DEFAULT_BATCH_CONCURRENCY     = 5
+
+	// The instrumentation scope names the code which creates the spans and
+	// stays the same across deployments. The service name belongs on the
+	// resource.
+	INSTRUMENTATION_SCOPE_NAME = "github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/check"
 )
 
 var (
 	randomizer        = rand.New(rand.NewSource(time.Now().UnixNano()))
 	OTEL_SERVICE_NAME string
+	BATCH_WRITE       bool
+	BATCH_KEY_PREFIX  string
+	BATCH_CONCURRENCY int
 
-	uploader   *s3manager.Uploader
-	downloader *s3manager.Downloader
+	uploader s3Uploader
+	s3Client s3iface.S3API
 )
 
+// s3Uploader is the part of the s3manager.Uploader which the handler
+// depends on, so that the upload can be replaced without talking to AWS.
+type s3Uploader interface {
+	UploadWithContext(
+		ctx aws.Context,
+		input *s3manager.UploadInput,
+		opts ...func(*s3manager.Uploader),
+	) (
+		*s3manager.UploadOutput,
+		error,
+	)
+}
+
 type CustomObject struct {
 	Item      string `json:"item"`
 	IsUpdated bool   `json:"isUpdated"`
@@ -47,10 +76,19 @@ func main() {
 
 	// Parse environment variables
 	OTEL_SERVICE_NAME = os.Getenv("OTEL_SERVICE_NAME")
+	BATCH_WRITE = os.Getenv("BATCH_WRITE") == "true"
+	BATCH_KEY_PREFIX = os.Getenv("BATCH_KEY_PREFIX")
+	if BATCH_KEY_PREFIX == "" {
+		BATCH_KEY_PREFIX = DEFAULT_BATCH_KEY_PREFIX
+	}
+	BATCH_CONCURRENCY, _ = strconv.Atoi(os.Getenv("BATCH_CONCURRENCY"))
+	if BATCH_CONCURRENCY < 1 {
+		BATCH_CONCURRENCY = DEFAULT_BATCH_CONCURRENCY
+	}
 
-	// Create a s3 downloader & uploader
+	// Create a s3 client & uploader
 	sess := session.Must(session.NewSession())
-	downloader = s3manager.NewDownloader(sess)
+	s3Client = s3.New(sess)
 	uploader = s3manager.NewUploader(sess)
 
 	// Get context
@@ -79,73 +117,185 @@ func main() {
 	lambda.Start(otellambda.InstrumentHandler(handler, xrayconfig.WithRecommendedOptions(tp)...))
 }
 
+// batchRecord is a checked object which waits to be written with the
+// other objects of its bucket. The message id reports the record as
+// failed if the batch cannot be written.
+type batchRecord struct {
+	messageID string
+	body      []byte
+}
+
 func handler(
+	invocationCtx context.Context,
 	sqsEvent events.SQSEvent,
+) (
+	events.SQSEventResponse,
+	error,
 ) {
 
 	ctx := context.Background()
-
-	// Loop over all s3 records
+	invocationLink := trace.LinkFromContext(invocationCtx)
+
+	// Collect the failed records for a partial batch response and the
+	// checked objects per bucket, which are stored together once all
+	// records are processed. Both are shared by the workers.
+	mutex := sync.Mutex{}
+	failures := []events.SQSBatchItemFailure{}
+	batches := map[string][]batchRecord{}
+	objectsStored := 0
+
+	// Process the records concurrently, the semaphore bounds the number
+	// of records in flight
+	semaphore := make(chan struct{}, BATCH_CONCURRENCY)
+	wg := sync.WaitGroup{}
 	for _, record := range sqsEvent.Records {
+		record := record
+
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			bucketName, customObjectCheckedAsBytes, err := processRecord(ctx, invocationLink, record)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			switch {
+			case err != nil:
+				failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+			case BATCH_WRITE:
+				batches[bucketName] = append(batches[bucketName], batchRecord{
+					messageID: record.MessageId,
+					body:      customObjectCheckedAsBytes,
+				})
+			default:
+				objectsStored++
+			}
+		}()
+	}
+	wg.Wait()
 
-		// Start parent span
-		ctx, parentSpan := startParentSpan(ctx, record)
-		defer parentSpan.End()
+	if BATCH_WRITE {
+		stored, batchFailures := storeBatchesInS3(ctx, invocationRequestID(invocationCtx), batches)
+		objectsStored += stored
+		failures = append(failures, batchFailures...)
+	}
 
-		// Parse SQS message
-		message, err := parseSqsMessage(parentSpan, record)
-		if err != nil {
-			enrichSpanWithEvent(parentSpan, false)
-			return
-		}
-		bucketName := (*message)["bucket"]
-		keyName := (*message)["key"]
+	// Summarize the batch on the invocation span
+	trace.SpanFromContext(invocationCtx).SetAttributes([]attribute.KeyValue{
+		attribute.Int("objects.stored", objectsStored),
+		attribute.Int("batch.failed", len(failures)),
+	}...)
 
-		// Get the object from S3
-		customObjectAsBytes, err := getObjectFromS3(ctx, parentSpan, bucketName, keyName)
-		if err != nil {
-			enrichSpanWithEvent(parentSpan, false)
-			return
-		}
+	return events.SQSEventResponse{
+		BatchItemFailures: failures,
+	}, nil
+}
 
-		// Update custom object
-		customObject, err := checkCustomObject(parentSpan, customObjectAsBytes)
-		if err != nil {
-			enrichSpanWithEvent(parentSpan, false)
-			return
-		}
+// processRecord checks the object of a single record within its own
+// parent span, which is linked to the invocation span. Without batch
+// writes, the checked object is stored right away, otherwise it is
+// returned along with its bucket. The span is owned here: it is ended on
+// every return and a panic of the record fails only this record.
+func processRecord(
+	ctx context.Context,
+	invocationLink trace.Link,
+	record events.SQSMessage,
+) (
+	bucketName string,
+	customObjectCheckedAsBytes []byte,
+	err error,
+) {
 
-		// Convert updated custom object to bytes
-		customObjectCheckedAsBytes, err := convertCustomObjectUpdatedIntoBytes(parentSpan, customObject)
-		if err != nil {
-			enrichSpanWithEvent(parentSpan, false)
-			return
-		}
+	// Start parent span
+	ctx, parentSpan := startParentSpan(ctx, record, invocationLink)
+	defer parentSpan.End()
 
-		// Store the custom object in output S3
-		err = storeCustomObjectInS3(ctx, parentSpan, bucketName, keyName, customObjectCheckedAsBytes)
-		if err != nil {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recordPanic(parentSpan, r)
 			enrichSpanWithEvent(parentSpan, false)
-			return
 		}
+	}()
 
+	return checkRecord(ctx, parentSpan, record)
+}
+
+func checkRecord(
+	ctx context.Context,
+	parentSpan trace.Span,
+	record events.SQSMessage,
+) (
+	string,
+	[]byte,
+	error,
+) {
+
+	// Parse SQS message
+	message, err := parseSqsMessage(parentSpan, record)
+	if err != nil {
+		enrichSpanWithEvent(parentSpan, false)
+		return "", nil, err
+	}
+	bucketName := (*message)["bucket"]
+	keyName := (*message)["key"]
+
+	// Get the object from S3
+	customObjectAsBytes, err := getObjectFromS3(ctx, parentSpan, bucketName, keyName)
+	if err != nil {
+		enrichSpanWithEvent(parentSpan, false)
+		return "", nil, err
+	}
+
+	// Update custom object
+	customObject, err := checkCustomObject(parentSpan, customObjectAsBytes)
+	if err != nil {
+		enrichSpanWithEvent(parentSpan, false)
+		return "", nil, err
+	}
+
+	// Convert updated custom object to bytes
+	customObjectCheckedAsBytes, err := convertCustomObjectUpdatedIntoBytes(parentSpan, customObject)
+	if err != nil {
+		enrichSpanWithEvent(parentSpan, false)
+		return "", nil, err
+	}
+
+	// Leave the custom object to the batch
+	if BATCH_WRITE {
 		enrichSpanWithEvent(parentSpan, true)
+		return bucketName, customObjectCheckedAsBytes, nil
+	}
+
+	// Store the custom object in output S3
+	err = storeCustomObjectInS3(ctx, parentSpan, bucketName, keyName, customObjectCheckedAsBytes)
+	if err != nil {
+		enrichSpanWithEvent(parentSpan, false)
+		return "", nil, err
 	}
+
+	enrichSpanWithEvent(parentSpan, true)
+	return bucketName, nil, nil
 }
 
 func startParentSpan(
 	ctx context.Context,
 	record events.SQSMessage,
+	invocationLink trace.Link,
 ) (
 	context.Context,
 	trace.Span,
 ) {
 	// Create tracer
-	tracer := otel.Tracer(OTEL_SERVICE_NAME)
+	tracer := otel.Tracer(INSTRUMENTATION_SCOPE_NAME)
 
 	// Start parent span
 	return tracer.Start(ctx, "main.handler",
 		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(invocationLink),
 		trace.WithAttributes([]attribute.KeyValue{
 			semconv.FaaSTriggerPubsub,
 			semconv.MessagingOperationProcess,
@@ -203,23 +353,29 @@ func getObjectFromS3(
 	ctx, s3GetSpan := startS3GetSpan(ctx, parentSpan)
 	defer s3GetSpan.End()
 
-	// Create a writer
-	buff := &aws.WriteAtBuffer{}
-
 	// Cause error?
 	if causeError() {
 		keyName = "wrong-bucket-name"
 	}
 
-	// Get object from S3
-	_, err := downloader.DownloadWithContext(
+	// Get object from S3, large objects are stored compressed
+	output, err := s3Client.GetObjectWithContext(
 		ctx,
-		buff,
 		&s3.GetObjectInput{
 			Bucket: aws.String(bucketName),
 			Key:    aws.String(keyName),
 		})
 
+	var customObjectAsBytes []byte
+	if err == nil {
+		defer output.Body.Close()
+		customObjectAsBytes, err = io.ReadAll(output.Body)
+	}
+	if err == nil {
+		s3GetSpan.SetAttributes(attribute.String("aws.s3.content_encoding", aws.StringValue(output.ContentEncoding)))
+		customObjectAsBytes, err = commons.DecodeObjectBody(aws.StringValue(output.ContentEncoding), customObjectAsBytes)
+	}
+
 	if err != nil {
 		msg := "Getting custom object from the S3 is failed."
 
@@ -237,7 +393,7 @@ func getObjectFromS3(
 	}
 
 	fmt.Println("Getting custom object from the S3 is succeeded.")
-	return buff.Bytes(), err
+	return customObjectAsBytes, nil
 }
 
 func startS3GetSpan(
@@ -248,7 +404,7 @@ func startS3GetSpan(
 	trace.Span,
 ) {
 	// Start S3 get span
-	return parentSpan.TracerProvider().Tracer(OTEL_SERVICE_NAME).
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
 		Start(ctx, "S3.GetObject",
 			trace.WithSpanKind(trace.SpanKindClient),
 			trace.WithAttributes([]attribute.KeyValue{
@@ -355,6 +511,98 @@ func storeCustomObjectInS3(
 	return nil
 }
 
+// invocationRequestID returns the id of the Lambda request which the
+// context belongs to.
+func invocationRequestID(
+	invocationCtx context.Context,
+) string {
+	lc, ok := lambdacontext.FromContext(invocationCtx)
+	if !ok {
+		return "local"
+	}
+	return lc.AwsRequestID
+}
+
+// storeBatchesInS3 stores the checked objects of every bucket as a single
+// newline delimited JSON object instead of one object per record. It
+// returns the number of stored objects and the records of the batches
+// which could not be stored.
+func storeBatchesInS3(
+	ctx context.Context,
+	requestID string,
+	batches map[string][]batchRecord,
+) (
+	int,
+	[]events.SQSBatchItemFailure,
+) {
+	stored := 0
+	failures := []events.SQSBatchItemFailure{}
+	sequence := 0
+	for bucketName, records := range batches {
+		keyName := batchKey(requestID, sequence, time.Now())
+		sequence++
+
+		err := storeBatchInS3(ctx, bucketName, keyName, records)
+		if err == nil {
+			stored++
+			continue
+		}
+		for _, record := range records {
+			failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: record.messageID})
+		}
+	}
+	return stored, failures
+}
+
+// batchKey names the object of a batch. Several instances of the Lambda
+// write at the same time, so the timestamp is followed by the request id
+// of the invocation and the sequence of the batch within it.
+func batchKey(
+	requestID string,
+	sequence int,
+	now time.Time,
+) string {
+	return BATCH_KEY_PREFIX + "/" + strconv.FormatInt(now.UTC().UnixMilli(), 10) +
+		"-" + requestID + "-" + strconv.Itoa(sequence) + ".ndjson"
+}
+
+// storeBatchInS3 writes the records of one bucket as a single object
+// within its own span. The span is ended even when the write panics.
+func storeBatchInS3(
+	ctx context.Context,
+	bucketName string,
+	keyName string,
+	records []batchRecord,
+) (
+	err error,
+) {
+
+	// Start batch span
+	ctx, batchSpan := otel.Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "main.batchWrite",
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithAttributes([]attribute.KeyValue{
+				attribute.Int("batch.record.count", len(records)),
+				attribute.String("aws.s3.key", keyName),
+			}...))
+	defer batchSpan.End()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = recordPanic(batchSpan, r)
+		}
+		enrichSpanWithEvent(batchSpan, err == nil)
+	}()
+
+	bodies := make([][]byte, 0, len(records))
+	for _, record := range records {
+		bodies = append(bodies, record.body)
+	}
+	batchAsBytes := append(bytes.Join(bodies, []byte("\n")), '\n')
+
+	return storeCustomObjectInS3(ctx, batchSpan, bucketName, keyName, batchAsBytes)
+}
+
 func startS3PutSpan(
 	ctx context.Context,
 	parentSpan trace.Span,
@@ -363,7 +611,7 @@ func startS3PutSpan(
 	trace.Span,
 ) {
 	// Start S3 put span
-	return parentSpan.TracerProvider().Tracer(OTEL_SERVICE_NAME).
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
 		Start(ctx, "S3.PutObject",
 			trace.WithSpanKind(trace.SpanKindClient),
 			trace.WithAttributes([]attribute.KeyValue{
@@ -375,6 +623,28 @@ func causeError() bool {
 	return randomizer.Intn(15) == 1
 }
 
+// recordPanic marks the span of a panicked record or batch as failed and
+// returns the panic as an error.
+func recordPanic(
+	span trace.Span,
+	r interface{},
+) error {
+	err := fmt.Errorf("panic: %v", r)
+	fmt.Println("Processing record has panicked: " + err.Error())
+
+	span.SetAttributes([]attribute.KeyValue{
+		semconv.OtelStatusCodeError,
+		semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+	}...)
+
+	span.RecordError(err,
+		trace.WithStackTrace(true),
+		trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+	return err
+}
+
 func enrichSpanWithEvent(
 	span trace.Span,
 	isSuccesful bool,
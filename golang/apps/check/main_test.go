@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeS3 answers every GetObject with a custom object named after its key
+// and records how many calls are in flight at once.
+type fakeS3 struct {
+	s3iface.S3API
+
+	delay    time.Duration
+	panicKey string
+
+	inFlight int32
+	peak     int32
+}
+
+func (s *fakeS3) GetObjectWithContext(
+	_ aws.Context,
+	input *s3.GetObjectInput,
+	_ ...request.Option,
+) (
+	*s3.GetObjectOutput,
+	error,
+) {
+	inFlight := atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+	for {
+		peak := atomic.LoadInt32(&s.peak)
+		if inFlight <= peak || atomic.CompareAndSwapInt32(&s.peak, peak, inFlight) {
+			break
+		}
+	}
+	time.Sleep(s.delay)
+
+	key := aws.StringValue(input.Key)
+	if key == s.panicKey {
+		panic("S3 client has panicked")
+	}
+	return &s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader(`{"item":"` + key + `"}`)),
+	}, nil
+}
+
+// fakeUploader records the uploaded objects by their key.
+type fakeUploader struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+}
+
+func (u *fakeUploader) UploadWithContext(
+	_ aws.Context,
+	input *s3manager.UploadInput,
+	_ ...func(*s3manager.Uploader),
+) (
+	*s3manager.UploadOutput,
+	error,
+) {
+	body, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.objects[aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)] = body
+	return &s3manager.UploadOutput{}, nil
+}
+
+// noFaultSource lets causeError never inject a fault.
+type noFaultSource struct{}
+
+func (noFaultSource) Int63() int64 { return 0 }
+func (noFaultSource) Seed(int64)   {}
+
+// withFakeS3 replaces the S3 client and the uploader, lets no fault be
+// injected and records the spans of the handler.
+func withFakeS3(
+	t *testing.T,
+	fake *fakeS3,
+	concurrency int,
+) (
+	*fakeUploader,
+	*sdktrace.TracerProvider,
+	*tracetest.SpanRecorder,
+) {
+	previousClient, previousUploader, previousRandomizer := s3Client, uploader, randomizer
+	previousConcurrency, previousProvider := BATCH_CONCURRENCY, otel.GetTracerProvider()
+	t.Cleanup(func() {
+		s3Client, uploader, randomizer = previousClient, previousUploader, previousRandomizer
+		BATCH_CONCURRENCY = previousConcurrency
+		otel.SetTracerProvider(previousProvider)
+	})
+
+	fakeUploader := &fakeUploader{objects: map[string][]byte{}}
+	s3Client = fake
+	uploader = fakeUploader
+	randomizer = rand.New(noFaultSource{})
+	BATCH_CONCURRENCY = concurrency
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	return fakeUploader, tp, recorder
+}
+
+func newSQSEvent(
+	count int,
+) events.SQSEvent {
+	sqsEvent := events.SQSEvent{}
+	for index := 0; index < count; index++ {
+		sqsEvent.Records = append(sqsEvent.Records, events.SQSMessage{
+			MessageId: fmt.Sprintf("message-%d", index),
+			Body:      fmt.Sprintf(`{"bucket":"output","key":"2026/03/07/item-%d"}`, index),
+		})
+	}
+	return sqsEvent
+}
+
+func spanAttribute(
+	span sdktrace.ReadOnlySpan,
+	key attribute.Key,
+) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestHandlerConcurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		records     int
+		concurrency int
+	}{
+		{
+			name:        "bounded",
+			records:     20,
+			concurrency: 4,
+		},
+		{
+			name:        "sequential",
+			records:     5,
+			concurrency: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeS3{delay: 10 * time.Millisecond}
+			uploader, tp, recorder := withFakeS3(t, fake, tt.concurrency)
+
+			invocationCtx, invocationSpan := tp.Tracer("test").Start(context.Background(), "invocation")
+			response, err := handler(invocationCtx, newSQSEvent(tt.records))
+			invocationSpan.End()
+			if err != nil {
+				t.Fatalf("handler() error = %v", err)
+			}
+
+			if len(response.BatchItemFailures) != 0 {
+				t.Errorf("failed records = %v, want none", response.BatchItemFailures)
+			}
+			if fake.peak > int32(tt.concurrency) {
+				t.Errorf("%d records were in flight, want at most %d", fake.peak, tt.concurrency)
+			}
+			if tt.concurrency > 1 && fake.peak < 2 {
+				t.Error("records were processed one at a time")
+			}
+			if len(uploader.objects) != tt.records {
+				t.Errorf("%d objects are stored, want %d", len(uploader.objects), tt.records)
+			}
+			for index := 0; index < tt.records; index++ {
+				key := fmt.Sprintf("output/2026/03/07/item-%d", index)
+				if _, ok := uploader.objects[key]; !ok {
+					t.Errorf("object %s is not stored", key)
+				}
+			}
+
+			// Every record has its own span which is linked to the
+			// invocation
+			recordSpans := 0
+			for _, span := range recorder.Ended() {
+				if span.Name() != "main.handler" {
+					continue
+				}
+				recordSpans++
+				if span.Parent().IsValid() {
+					t.Errorf("record span has the parent %s, want none", span.Parent().SpanID())
+				}
+				links := span.Links()
+				if len(links) != 1 || !links[0].SpanContext.Equal(invocationSpan.SpanContext()) {
+					t.Errorf("record span links = %v, want the invocation span", links)
+				}
+			}
+			if recordSpans != tt.records {
+				t.Errorf("%d record spans are ended, want %d", recordSpans, tt.records)
+			}
+		})
+	}
+}
+
+func TestHandlerRecordPanic(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+	}{
+		{
+			name:        "concurrent",
+			concurrency: 4,
+		},
+		{
+			name:        "sequential",
+			concurrency: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeS3{panicKey: "2026/03/07/item-2"}
+			uploader, tp, recorder := withFakeS3(t, fake, tt.concurrency)
+
+			invocationCtx, invocationSpan := tp.Tracer("test").Start(context.Background(), "invocation")
+			response, err := handler(invocationCtx, newSQSEvent(5))
+			invocationSpan.End()
+			if err != nil {
+				t.Fatalf("handler() error = %v", err)
+			}
+
+			// Only the panicked record is retried
+			if len(response.BatchItemFailures) != 1 || response.BatchItemFailures[0].ItemIdentifier != "message-2" {
+				t.Errorf("failed records = %v, want message-2", response.BatchItemFailures)
+			}
+			if len(uploader.objects) != 4 {
+				t.Errorf("%d objects are stored, want 4", len(uploader.objects))
+			}
+
+			var failedSpans int
+			for _, span := range recorder.Ended() {
+				if span.Name() != "main.handler" || spanAttribute(span, "otel.status_code").AsString() != "ERROR" {
+					continue
+				}
+				failedSpans++
+				if got := spanAttribute(span, "messaging.message.id").AsString(); got != "message-2" {
+					t.Errorf("failed span belongs to %q, want message-2", got)
+				}
+				var exceptions int
+				for _, event := range span.Events() {
+					if event.Name == "exception" {
+						exceptions++
+					}
+				}
+				if exceptions != 1 {
+					t.Errorf("failed span has %d exception events, want 1", exceptions)
+				}
+			}
+			if failedSpans != 1 {
+				t.Errorf("%d record spans are ended as failed, want 1", failedSpans)
+			}
+		})
+	}
+}
+
+func TestHandlerBatchWrite(t *testing.T) {
+	tests := []struct {
+		name        string
+		batchWrite  bool
+		invocations []string
+		wantObjects int
+	}{
+		{
+			name:        "single objects",
+			batchWrite:  false,
+			invocations: []string{"request-1"},
+			wantObjects: 3,
+		},
+		{
+			name:        "batched",
+			batchWrite:  true,
+			invocations: []string{"request-1"},
+			wantObjects: 1,
+		},
+		{
+			name:        "batches of concurrent invocations",
+			batchWrite:  true,
+			invocations: []string{"request-1", "request-2"},
+			wantObjects: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploader, _, _ := withFakeS3(t, &fakeS3{}, DEFAULT_BATCH_CONCURRENCY)
+
+			previousBatchWrite, previousPrefix := BATCH_WRITE, BATCH_KEY_PREFIX
+			t.Cleanup(func() { BATCH_WRITE, BATCH_KEY_PREFIX = previousBatchWrite, previousPrefix })
+			BATCH_WRITE = tt.batchWrite
+			BATCH_KEY_PREFIX = DEFAULT_BATCH_KEY_PREFIX
+
+			// The invocations run one after the other but usually write
+			// their batches within the same millisecond
+			for _, requestID := range tt.invocations {
+				invocationCtx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: requestID})
+				response, err := handler(invocationCtx, newSQSEvent(3))
+				if err != nil || len(response.BatchItemFailures) != 0 {
+					t.Fatalf("handler() = %v, %v", response, err)
+				}
+			}
+
+			if len(uploader.objects) != tt.wantObjects {
+				t.Fatalf("%d objects are stored, want %d: %v", len(uploader.objects), tt.wantObjects, uploader.objects)
+			}
+
+			for key, body := range uploader.objects {
+				if !tt.batchWrite {
+					if !strings.HasPrefix(key, "output/2026/03/07/item-") {
+						t.Errorf("object is stored as %s, want its own key", key)
+					}
+					continue
+				}
+
+				if !strings.HasPrefix(key, "output/"+DEFAULT_BATCH_KEY_PREFIX+"/") || !strings.HasSuffix(key, ".ndjson") {
+					t.Errorf("batch is stored as %s", key)
+				}
+				lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+				if len(lines) != 3 {
+					t.Errorf("batch %s has %d lines, want 3", key, len(lines))
+				}
+				for _, line := range lines {
+					customObject := &CustomObject{}
+					if err := json.Unmarshal([]byte(line), customObject); err != nil || !customObject.IsChecked {
+						t.Errorf("line %q is no checked object: %v", line, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBatchKey(t *testing.T) {
+	previous := BATCH_KEY_PREFIX
+	t.Cleanup(func() { BATCH_KEY_PREFIX = previous })
+	BATCH_KEY_PREFIX = DEFAULT_BATCH_KEY_PREFIX
+
+	now := time.UnixMilli(1772841600000)
+
+	tests := []struct {
+		name      string
+		requestID string
+		sequence  int
+		want      string
+	}{
+		{
+			name:      "first batch",
+			requestID: "request-1",
+			sequence:  0,
+			want:      "batches/1772841600000-request-1-0.ndjson",
+		},
+		{
+			name:      "second batch",
+			requestID: "request-1",
+			sequence:  1,
+			want:      "batches/1772841600000-request-1-1.ndjson",
+		},
+		{
+			name:      "another invocation",
+			requestID: "request-2",
+			sequence:  0,
+			want:      "batches/1772841600000-request-2-0.ndjson",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := batchKey(tt.requestID, tt.sequence, now); got != tt.want {
+				t.Errorf("batchKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerObjectsStored(t *testing.T) {
+	tests := []struct {
+		name        string
+		batchWrite  bool
+		panicKey    string
+		wantStored  int64
+		wantFailed  int64
+		wantObjects int
+	}{
+		{
+			name:        "all records",
+			wantStored:  5,
+			wantFailed:  0,
+			wantObjects: 5,
+		},
+		{
+			name:        "failed record",
+			panicKey:    "2026/03/07/item-0",
+			wantStored:  4,
+			wantFailed:  1,
+			wantObjects: 4,
+		},
+		{
+			name:        "batched",
+			batchWrite:  true,
+			wantStored:  1,
+			wantFailed:  0,
+			wantObjects: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploader, tp, recorder := withFakeS3(t, &fakeS3{panicKey: tt.panicKey}, DEFAULT_BATCH_CONCURRENCY)
+
+			previous := BATCH_WRITE
+			t.Cleanup(func() { BATCH_WRITE = previous })
+			BATCH_WRITE = tt.batchWrite
+
+			invocationCtx, invocationSpan := tp.Tracer("test").Start(context.Background(), "invocation")
+			if _, err := handler(invocationCtx, newSQSEvent(5)); err != nil {
+				t.Fatalf("handler() error = %v", err)
+			}
+			invocationSpan.End()
+
+			if len(uploader.objects) != tt.wantObjects {
+				t.Errorf("%d objects are stored, want %d", len(uploader.objects), tt.wantObjects)
+			}
+
+			var root sdktrace.ReadOnlySpan
+			for _, span := range recorder.Ended() {
+				if span.Name() == "invocation" {
+					root = span
+				}
+			}
+			if got := spanAttribute(root, "objects.stored").AsInt64(); got != tt.wantStored {
+				t.Errorf("objects.stored = %d, want %d", got, tt.wantStored)
+			}
+			if got := spanAttribute(root, "batch.failed").AsInt64(); got != tt.wantFailed {
+				t.Errorf("batch.failed = %d, want %d", got, tt.wantFailed)
+			}
+		})
+	}
+}
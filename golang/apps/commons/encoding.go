@@ -0,0 +1,58 @@
+package commons
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+const (
+	ContentEncodingGzip = "gzip"
+
+	// UncompressedSizeMetadataKey is the object metadata which keeps the
+	// size of a compressed body before compression.
+	UncompressedSizeMetadataKey = "uncompressed-size"
+)
+
+// CompressObjectBody gzips the body of an object.
+func CompressObjectBody(
+	body []byte,
+) (
+	[]byte,
+	error,
+) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeObjectBody decompresses the body of an object stored with the
+// gzip content encoding. The HTTP client may have decompressed the body
+// already, therefore only bodies starting with the gzip header are
+// decompressed. Other bodies are returned unchanged.
+func DecodeObjectBody(
+	contentEncoding string,
+	body []byte,
+) (
+	[]byte,
+	error,
+) {
+	if !strings.EqualFold(strings.TrimSpace(contentEncoding), ContentEncodingGzip) ||
+		len(body) < 2 || body[0] != 0x1f || body[1] != 0x8b {
+		return body, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
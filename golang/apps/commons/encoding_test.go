@@ -0,0 +1,111 @@
+package commons
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressObjectBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{
+			name: "empty",
+			body: []byte{},
+		},
+		{
+			name: "object",
+			body: []byte(`{"item":"x"}`),
+		},
+		{
+			name: "repetitive object",
+			body: bytes.Repeat([]byte(`{"item":"x"}`), 1024),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, err := CompressObjectBody(tt.body)
+			if err != nil {
+				t.Fatalf("CompressObjectBody() error = %v", err)
+			}
+			if len(compressed) < 2 || compressed[0] != 0x1f || compressed[1] != 0x8b {
+				t.Fatalf("CompressObjectBody() = %x, want the gzip header", compressed)
+			}
+
+			decoded, err := DecodeObjectBody(ContentEncodingGzip, compressed)
+			if err != nil {
+				t.Fatalf("DecodeObjectBody() error = %v", err)
+			}
+			if !bytes.Equal(decoded, tt.body) {
+				t.Errorf("DecodeObjectBody() = %q, want %q", decoded, tt.body)
+			}
+		})
+	}
+}
+
+func TestDecodeObjectBody(t *testing.T) {
+	body := []byte(`{"item":"x"}`)
+	compressed, err := CompressObjectBody(body)
+	if err != nil {
+		t.Fatalf("CompressObjectBody() error = %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+		want            []byte
+		wantErr         bool
+	}{
+		{
+			name:            "compressed",
+			contentEncoding: "gzip",
+			body:            compressed,
+			want:            body,
+		},
+		{
+			name:            "encoding in other case",
+			contentEncoding: " GZIP ",
+			body:            compressed,
+			want:            body,
+		},
+		{
+			name:            "decompressed by the client",
+			contentEncoding: "gzip",
+			body:            body,
+			want:            body,
+		},
+		{
+			name:            "not compressed",
+			contentEncoding: "",
+			body:            body,
+			want:            body,
+		},
+		{
+			name:            "other encoding",
+			contentEncoding: "br",
+			body:            compressed,
+			want:            compressed,
+		},
+		{
+			name:            "truncated",
+			contentEncoding: "gzip",
+			body:            compressed[:4],
+			wantErr:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeObjectBody(tt.contentEncoding, tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeObjectBody() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.want) {
+				t.Errorf("DecodeObjectBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons
+
+go 1.20
@@ -0,0 +1,56 @@
+package commons
+
+import (
+	"strings"
+	"time"
+)
+
+// BuildObjectKey creates the S3 object key of a custom object in the form
+// <prefix>/<yyyy>/<mm>/<dd>/<id>. The date is taken in UTC so that an
+// object always lands in the same partition regardless of the Lambda
+// region. The prefix is expected to be sanitized already and is left out
+// when empty.
+func BuildObjectKey(
+	prefix string,
+	t time.Time,
+	id string,
+) string {
+	partition := t.UTC().Format("2006/01/02")
+	if prefix == "" {
+		return partition + "/" + id
+	}
+	return prefix + "/" + partition + "/" + id
+}
+
+// SanitizeKeyPrefix makes a configured key prefix safe to use in S3 keys.
+// Leading, trailing and repeated slashes as well as "." and ".." segments
+// are removed and every character outside of the URL safe set
+// [A-Za-z0-9-_.~] is replaced with a dash.
+func SanitizeKeyPrefix(
+	prefix string,
+) string {
+	segments := []string{}
+	for _, segment := range strings.Split(prefix, "/") {
+		segment = strings.Map(func(r rune) rune {
+			if isURLSafe(r) {
+				return r
+			}
+			return '-'
+		}, strings.TrimSpace(segment))
+
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func isURLSafe(
+	r rune,
+) bool {
+	return (r >= 'a' && r <= 'z') ||
+		(r >= 'A' && r <= 'Z') ||
+		(r >= '0' && r <= '9') ||
+		r == '-' || r == '_' || r == '.' || r == '~'
+}
@@ -0,0 +1,69 @@
+package commons
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildObjectKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		t      time.Time
+		id     string
+		want   string
+	}{
+		{
+			name: "without prefix",
+			t:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+			id:   "id",
+			want: "2026/01/02/id",
+		},
+		{
+			name:   "with prefix",
+			prefix: "items/raw",
+			t:      time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+			id:     "id",
+			want:   "items/raw/2026/01/02/id",
+		},
+		{
+			name: "partitioned in UTC",
+			t:    time.Date(2026, 1, 2, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60)),
+			id:   "id",
+			want: "2026/01/03/id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildObjectKey(tt.prefix, tt.t, tt.id); got != tt.want {
+				t.Errorf("BuildObjectKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeKeyPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{name: "empty", prefix: "", want: ""},
+		{name: "plain", prefix: "items", want: "items"},
+		{name: "surrounding slashes", prefix: "/items/", want: "items"},
+		{name: "repeated slashes", prefix: "a//b///c", want: "a/b/c"},
+		{name: "dot segments", prefix: "./a/../b/.", want: "a/b"},
+		{name: "unsafe characters", prefix: "my items/ü+x", want: "my-items/--x"},
+		{name: "whitespace around segments", prefix: " a / b ", want: "a/b"},
+		{name: "URL safe characters", prefix: "a-b_c.d~e", want: "a-b_c.d~e"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeKeyPrefix(tt.prefix); got != tt.want {
+				t.Errorf("SanitizeKeyPrefix(%q) = %q, want %q", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
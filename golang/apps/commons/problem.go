@@ -0,0 +1,40 @@
+package commons
+
+import (
+	"net/http"
+)
+
+const (
+	// ProblemContentType is the media type of RFC 7807 problem details.
+	ProblemContentType = "application/problem+json"
+
+	// ProblemTypeDefault states that the problem has no further semantics
+	// than its HTTP status code.
+	ProblemTypeDefault = "about:blank"
+)
+
+// Problem is an RFC 7807 problem details object. The trace id extension
+// lets callers hand over the trace of a failed request.
+type Problem struct {
+	Type    string `json:"type"`
+	Title   string `json:"title"`
+	Status  int    `json:"status"`
+	Detail  string `json:"detail,omitempty"`
+	TraceID string `json:"traceId,omitempty"`
+}
+
+// NewProblem creates the problem details of the status code. The title is
+// the reason phrase of the status code.
+func NewProblem(
+	status int,
+	detail string,
+	traceID string,
+) *Problem {
+	return &Problem{
+		Type:    ProblemTypeDefault,
+		Title:   http.StatusText(status),
+		Status:  status,
+		Detail:  detail,
+		TraceID: traceID,
+	}
+}
@@ -0,0 +1,46 @@
+package commons
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewProblem(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		detail  string
+		traceID string
+		want    string
+	}{
+		{
+			name:    "with detail and trace id",
+			status:  400,
+			detail:  "Request body is not a valid custom object.",
+			traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			want:    `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Request body is not a valid custom object.","traceId":"4bf92f3577b34da6a3ce929d0e0e4736"}`,
+		},
+		{
+			name:   "without detail and trace id",
+			status: 500,
+			want:   `{"type":"about:blank","title":"Internal Server Error","status":500}`,
+		},
+		{
+			name:   "unknown status code",
+			status: 599,
+			want:   `{"type":"about:blank","title":"","status":599}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(NewProblem(tt.status, tt.detail, tt.traceID))
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("NewProblem() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package commons
+
+import (
+	"context"
+)
+
+// PutMetadata describes where and how an object is written. Backends
+// ignore the fields which do not apply to them.
+type PutMetadata struct {
+	// Bucket is the container the object is written to, e.g. the S3
+	// bucket or the DynamoDB table.
+	Bucket string
+	Tags   []ObjectTag
+	// CreateOnly fails the write when an object exists under the key
+	// already instead of overwriting it.
+	CreateOnly bool
+}
+
+type PutResult struct {
+	VersionID string
+	// Bucket is the bucket which holds the object. It differs from the
+	// requested one when the write has failed over to another bucket.
+	Bucket string
+	// Checksum is the base64 encoded SHA-256 digest of the bytes as the
+	// backend stores them, i.e. after compression. It matches the checksum
+	// which S3 keeps for the object.
+	Checksum string
+}
+
+// Storage persists the objects of the apps. Implementations create their
+// own client spans from the span in the context, so that every backend is
+// traced with its own operations and attributes.
+type Storage interface {
+	Put(
+		ctx context.Context,
+		key string,
+		body []byte,
+		metadata PutMetadata,
+	) (
+		PutResult,
+		error,
+	)
+}
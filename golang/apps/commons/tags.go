@@ -0,0 +1,93 @@
+package commons
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	// MaxObjectTags is the number of tags S3 allows per object.
+	MaxObjectTags = 10
+
+	ServiceTagKey        = "service.name"
+	EnvironmentTagKey    = "deployment.environment"
+	TraceTagKey          = "trace.id"
+	UpdatedByTraceTagKey = "updated_by.trace.id"
+)
+
+type ObjectTag struct {
+	Key   string
+	Value string
+}
+
+// TraceTags returns the tags which link an object to the service and the
+// trace which have created it. Tags without a value are left out.
+func TraceTags(
+	service string,
+	environment string,
+	traceID string,
+) []ObjectTag {
+	tags := []ObjectTag{}
+	for _, tag := range []ObjectTag{
+		{Key: TraceTagKey, Value: traceID},
+		{Key: ServiceTagKey, Value: service},
+		{Key: EnvironmentTagKey, Value: environment},
+	} {
+		if tag.Value != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// MergeObjectTags overrides the base tags with the given tags of the same
+// key and appends the others. Base tags are dropped from the end once the
+// S3 limit is exceeded, except for the trace tag which links the object
+// to its origin.
+func MergeObjectTags(
+	base []ObjectTag,
+	tags ...ObjectTag,
+) []ObjectTag {
+	merged := append([]ObjectTag{}, base...)
+	for _, tag := range tags {
+		replaced := false
+		for i := range merged {
+			if merged[i].Key == tag.Key {
+				merged[i].Value = tag.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, tag)
+		}
+	}
+
+	for i := len(base) - 1; i >= 0 && len(merged) > MaxObjectTags; i-- {
+		if merged[i].Key != TraceTagKey {
+			merged = append(merged[:i], merged[i+1:]...)
+		}
+	}
+	if len(merged) > MaxObjectTags {
+		merged = merged[:MaxObjectTags]
+	}
+	return merged
+}
+
+// EncodeObjectTags encodes the tags as URL query parameters as expected by
+// the Tagging field of uploads.
+func EncodeObjectTags(
+	tags []ObjectTag,
+) string {
+	pairs := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		pairs = append(pairs, escapeTag(tag.Key)+"="+escapeTag(tag.Value))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// escapeTag encodes spaces as %20 as S3 does not decode + in tags.
+func escapeTag(
+	value string,
+) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
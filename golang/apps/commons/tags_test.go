@@ -0,0 +1,140 @@
+package commons
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestTraceTags(t *testing.T) {
+	tests := []struct {
+		name        string
+		service     string
+		environment string
+		traceID     string
+		want        []ObjectTag
+	}{
+		{
+			name:        "all tags",
+			service:     "create",
+			environment: "prod",
+			traceID:     "4bf92f3577b34da6a3ce929d0e0e4736",
+			want: []ObjectTag{
+				{Key: TraceTagKey, Value: "4bf92f3577b34da6a3ce929d0e0e4736"},
+				{Key: ServiceTagKey, Value: "create"},
+				{Key: EnvironmentTagKey, Value: "prod"},
+			},
+		},
+		{
+			name:    "tags without a value are left out",
+			service: "create",
+			want:    []ObjectTag{{Key: ServiceTagKey, Value: "create"}},
+		},
+		{
+			name: "no tags",
+			want: []ObjectTag{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TraceTags(tt.service, tt.environment, tt.traceID); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TraceTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeObjectTags(t *testing.T) {
+	numbered := func(count int) []ObjectTag {
+		tags := []ObjectTag{}
+		for i := 0; i < count; i++ {
+			tags = append(tags, ObjectTag{Key: "key" + strconv.Itoa(i), Value: "value"})
+		}
+		return tags
+	}
+
+	tests := []struct {
+		name string
+		base []ObjectTag
+		tags []ObjectTag
+		want []ObjectTag
+	}{
+		{
+			name: "tags are appended",
+			base: []ObjectTag{{Key: "env", Value: "prod"}},
+			tags: []ObjectTag{{Key: TraceTagKey, Value: "trace"}},
+			want: []ObjectTag{{Key: "env", Value: "prod"}, {Key: TraceTagKey, Value: "trace"}},
+		},
+		{
+			name: "tags override the base tags",
+			base: []ObjectTag{{Key: ServiceTagKey, Value: "configured"}, {Key: "env", Value: "prod"}},
+			tags: []ObjectTag{{Key: ServiceTagKey, Value: "create"}},
+			want: []ObjectTag{{Key: ServiceTagKey, Value: "create"}, {Key: "env", Value: "prod"}},
+		},
+		{
+			name: "last base tags are dropped beyond the limit",
+			base: numbered(MaxObjectTags),
+			tags: []ObjectTag{{Key: ServiceTagKey, Value: "create"}},
+			want: append(numbered(MaxObjectTags-1), ObjectTag{Key: ServiceTagKey, Value: "create"}),
+		},
+		{
+			name: "trace tag of the base is kept",
+			base: append(numbered(MaxObjectTags-1), ObjectTag{Key: TraceTagKey, Value: "trace"}),
+			tags: []ObjectTag{{Key: UpdatedByTraceTagKey, Value: "update"}},
+			want: append(numbered(MaxObjectTags-2),
+				ObjectTag{Key: TraceTagKey, Value: "trace"},
+				ObjectTag{Key: UpdatedByTraceTagKey, Value: "update"}),
+		},
+		{
+			name: "too many tags are cut",
+			tags: numbered(MaxObjectTags + 1),
+			want: numbered(MaxObjectTags),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := append(tt.base[:0:0], tt.base...)
+
+			got := MergeObjectTags(tt.base, tt.tags...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeObjectTags() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.base, base) {
+				t.Errorf("MergeObjectTags() has changed the base tags to %v", tt.base)
+			}
+		})
+	}
+}
+
+func TestEncodeObjectTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []ObjectTag
+		want string
+	}{
+		{
+			name: "no tags",
+			want: "",
+		},
+		{
+			name: "tags in order",
+			tags: []ObjectTag{{Key: "env", Value: "prod"}, {Key: TraceTagKey, Value: "trace"}},
+			want: "env=prod&trace.id=trace",
+		},
+		{
+			name: "spaces and reserved characters are escaped",
+			tags: []ObjectTag{{Key: "team name", Value: "a&b=c+d"}},
+			want: "team%20name=a%26b%3Dc%2Bd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EncodeObjectTags(tt.tags); got != tt.want {
+				t.Errorf("EncodeObjectTags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
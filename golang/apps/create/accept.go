@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RESPONSE_VERSION_V1 = "v1"
+	RESPONSE_VERSION_V2 = "v2"
+
+	ITEM_MEDIA_TYPE_PREFIX = "application/vnd.item."
+	ITEM_MEDIA_TYPE_SUFFIX = "+json"
+)
+
+type responseVersionContextKey struct{}
+
+// CreateResponseV2 adds the creation time and the trace id to the v1
+// response.
+type CreateResponseV2 struct {
+	*CreateResponse
+	CreatedAt string `json:"createdAt"`
+	TraceID   string `json:"traceId,omitempty"`
+}
+
+func isSupportedResponseVersion(
+	version string,
+) bool {
+	return version == RESPONSE_VERSION_V1 || version == RESPONSE_VERSION_V2
+}
+
+func itemMediaType(
+	version string,
+) string {
+	return ITEM_MEDIA_TYPE_PREFIX + version + ITEM_MEDIA_TYPE_SUFFIX
+}
+
+// negotiateResponseVersion picks the response version from the Accept
+// header. Vendor media types select their version, plain JSON and
+// wildcards select the default version. Among several acceptable media
+// types the one with the highest quality wins. It reports false when none
+// of the media types is supported.
+func negotiateResponseVersion(
+	accept string,
+) (
+	string,
+	bool,
+) {
+	if strings.TrimSpace(accept) == "" {
+		return RESPONSE_VERSION_DEFAULT, true
+	}
+
+	version := ""
+	quality := 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q <= quality {
+			continue
+		}
+
+		candidate := ""
+		switch {
+		case mediaType == "application/json" || mediaType == "application/*" || mediaType == "*/*":
+			candidate = RESPONSE_VERSION_DEFAULT
+		case strings.HasPrefix(mediaType, ITEM_MEDIA_TYPE_PREFIX) && strings.HasSuffix(mediaType, ITEM_MEDIA_TYPE_SUFFIX):
+			candidate = strings.TrimSuffix(strings.TrimPrefix(mediaType, ITEM_MEDIA_TYPE_PREFIX), ITEM_MEDIA_TYPE_SUFFIX)
+		}
+		if !isSupportedResponseVersion(candidate) {
+			continue
+		}
+
+		version = candidate
+		quality = q
+	}
+	return version, version != ""
+}
+
+func responseVersion(
+	ctx context.Context,
+) string {
+	if version, ok := ctx.Value(responseVersionContextKey{}).(string); ok {
+		return version
+	}
+	return RESPONSE_VERSION_DEFAULT
+}
+
+// acceptMiddleware negotiates the version of the created object responses
+// before anything is written and rejects unsupported versions with a 406.
+func acceptMiddleware(
+	next Handler,
+) Handler {
+	return func(
+		ctx context.Context,
+		req *Request,
+	) *createResult {
+		if req.Method != "POST" && req.Method != "PUT" {
+			return next(ctx, req)
+		}
+
+		parentSpan := trace.SpanFromContext(ctx)
+
+		accept := getHeader(req.Headers, "Accept")
+		version, ok := negotiateResponseVersion(accept)
+		if !ok {
+			logger.warn("Accepted media types are not supported.", "accept", accept)
+			countError(parentSpan, ERROR_TYPE_VALIDATION)
+			return failRequest(parentSpan, 406, "Accept must allow "+itemMediaType(RESPONSE_VERSION_V1)+", "+itemMediaType(RESPONSE_VERSION_V2)+" or application/json.")
+		}
+		parentSpan.SetAttributes(attribute.String("response.version", version))
+
+		return next(context.WithValue(ctx, responseVersionContextKey{}, version), req)
+	}
+}
+
+// versionResponse shapes the created object response according to the
+// negotiated version.
+func versionResponse(
+	ctx context.Context,
+	parentSpan trace.Span,
+	response *CreateResponse,
+) interface{} {
+	if responseVersion(ctx) == RESPONSE_VERSION_V2 {
+		return &CreateResponseV2{
+			CreateResponse: response,
+			CreatedAt:      time.Now().UTC().Format(time.RFC3339Nano),
+			TraceID:        traceIDOf(parentSpan),
+		}
+	}
+	return response
+}
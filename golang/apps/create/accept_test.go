@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNegotiateResponseVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		wantVersion string
+		wantOK      bool
+	}{
+		{name: "missing", accept: "", wantVersion: RESPONSE_VERSION_V1, wantOK: true},
+		{name: "plain JSON", accept: "application/json", wantVersion: RESPONSE_VERSION_V1, wantOK: true},
+		{name: "wildcard", accept: "*/*", wantVersion: RESPONSE_VERSION_V1, wantOK: true},
+		{name: "vendor media type", accept: "application/vnd.item.v2+json", wantVersion: RESPONSE_VERSION_V2, wantOK: true},
+		{name: "highest quality wins", accept: "application/vnd.item.v2+json;q=0.5, application/vnd.item.v1+json;q=0.9", wantVersion: RESPONSE_VERSION_V1, wantOK: true},
+		{name: "first of equal quality wins", accept: "application/vnd.item.v2+json, application/json", wantVersion: RESPONSE_VERSION_V2, wantOK: true},
+		{name: "unsupported version is skipped", accept: "application/vnd.item.v3+json, application/vnd.item.v2+json;q=0.1", wantVersion: RESPONSE_VERSION_V2, wantOK: true},
+		{name: "invalid quality is skipped", accept: "application/vnd.item.v2+json;q=high, application/json;q=0.1", wantVersion: RESPONSE_VERSION_V1, wantOK: true},
+		{name: "unsupported version only", accept: "application/vnd.item.v3+json", wantOK: false},
+		{name: "other media type", accept: "text/html", wantOK: false},
+		{name: "zero quality", accept: "application/json;q=0", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, ok := negotiateResponseVersion(tt.accept)
+			if version != tt.wantVersion || ok != tt.wantOK {
+				t.Errorf("negotiateResponseVersion(%q) = %q, %v, want %q, %v", tt.accept, version, ok, tt.wantVersion, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAcceptMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		accept         string
+		wantStatusCode int
+		wantVersion    string
+	}{
+		{
+			name:           "negotiated version is passed on",
+			method:         "POST",
+			accept:         "application/vnd.item.v2+json",
+			wantStatusCode: 201,
+			wantVersion:    RESPONSE_VERSION_V2,
+		},
+		{
+			name:           "unsupported version is rejected",
+			method:         "PUT",
+			accept:         "text/html",
+			wantStatusCode: 406,
+		},
+		{
+			name:           "other methods are not negotiated",
+			method:         "GET",
+			accept:         "text/html",
+			wantStatusCode: 201,
+			wantVersion:    RESPONSE_VERSION_V1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version := ""
+			handler := acceptMiddleware(func(ctx context.Context, req *Request) *createResult {
+				version = responseVersion(ctx)
+				return &createResult{StatusCode: 201}
+			})
+
+			result := handler(context.Background(), &Request{
+				Method:  tt.method,
+				Headers: map[string]string{"Accept": tt.accept},
+			})
+			if result.StatusCode != tt.wantStatusCode {
+				t.Errorf("status code = %d, want %d: %s", result.StatusCode, tt.wantStatusCode, result.Body)
+			}
+			if version != tt.wantVersion {
+				t.Errorf("response version = %q, want %q", version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestVersionResponse(t *testing.T) {
+	tp, _ := newRecordingTracerProvider()
+	_, parentSpan := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+	defer parentSpan.End()
+
+	response := &CreateResponse{Key: "2026/01/01/id", Bucket: "bucket"}
+
+	tests := []struct {
+		name    string
+		version string
+	}{
+		{name: "v1", version: RESPONSE_VERSION_V1},
+		{name: "v2", version: RESPONSE_VERSION_V2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), responseVersionContextKey{}, tt.version)
+
+			switch got := versionResponse(ctx, parentSpan, response).(type) {
+			case *CreateResponse:
+				if tt.version != RESPONSE_VERSION_V1 || got != response {
+					t.Errorf("versionResponse() = %+v for %s", got, tt.version)
+				}
+			case *CreateResponseV2:
+				if tt.version != RESPONSE_VERSION_V2 || got.CreateResponse != response {
+					t.Errorf("versionResponse() = %+v for %s", got, tt.version)
+				}
+				if got.CreatedAt == "" || got.TraceID != parentSpan.SpanContext().TraceID().String() {
+					t.Errorf("versionResponse() = %+v, want creation time and trace id", got)
+				}
+			default:
+				t.Errorf("versionResponse() = %T", got)
+			}
+		})
+	}
+}
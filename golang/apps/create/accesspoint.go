@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	ACCESS_POINT_RESOURCE_PREFIX = "accesspoint"
+	WRONG_BUCKET_NAME            = "wrong-bucket-name"
+)
+
+var (
+	errNotAccessPointARN = errors.New("ARN is not an S3 access point ARN")
+)
+
+// accessPoint is an S3 access point given by its ARN in place of a bucket
+// name.
+type accessPoint struct {
+	arn  arn.ARN
+	name string
+}
+
+// parseAccessPoint parses the bucket parameter as an access point ARN of
+// the form arn:<partition>:s3:<region>:<account>:accesspoint/<name>. It
+// reports false for plain bucket names and an error for ARNs which do not
+// point to an access point.
+func parseAccessPoint(
+	bucket string,
+) (
+	*accessPoint,
+	bool,
+	error,
+) {
+	if !arn.IsARN(bucket) {
+		return nil, false, nil
+	}
+
+	parsed, err := arn.Parse(bucket)
+	if err != nil {
+		return nil, true, err
+	}
+
+	resourceType, name, ok := strings.Cut(parsed.Resource, "/")
+	if !ok {
+		resourceType, name, ok = strings.Cut(parsed.Resource, ":")
+	}
+	if parsed.Service != "s3" || resourceType != ACCESS_POINT_RESOURCE_PREFIX || !ok || name == "" || parsed.Region == "" || parsed.AccountID == "" {
+		return nil, true, errNotAccessPointARN
+	}
+
+	return &accessPoint{
+		arn:  parsed,
+		name: name,
+	}, true, nil
+}
+
+// s3BucketAttributes describes the bucket parameter on the spans. For
+// access points, aws.s3.bucket carries the access point name so that it
+// groups like a bucket name and the ARN is recorded separately.
+func s3BucketAttributes(
+	bucket string,
+) []attribute.KeyValue {
+	ap, isARN, err := parseAccessPoint(bucket)
+	if !isARN || err != nil {
+		return append([]attribute.KeyValue{
+			attribute.String("aws.s3.bucket", bucket),
+		}, storageClassAttributes(bucket)...)
+	}
+
+	return []attribute.KeyValue{
+		attribute.String("aws.s3.bucket", ap.name),
+		attribute.String("aws.s3.access_point.arn", bucket),
+		attribute.Bool("aws.s3.express", false),
+	}
+}
+
+// wrongBucketName returns the bucket parameter of an injected fault. It
+// keeps the shape of the configured value, so that an access point ARN
+// fails on a missing access point instead of on a malformed ARN.
+func wrongBucketName(
+	bucket string,
+) string {
+	ap, isARN, err := parseAccessPoint(bucket)
+	if !isARN || err != nil {
+		return WRONG_BUCKET_NAME
+	}
+
+	wrong := ap.arn
+	wrong.Resource = ACCESS_POINT_RESOURCE_PREFIX + "/" + WRONG_BUCKET_NAME
+	return wrong.String()
+}
+
+// accessPointHost returns the endpoint host of an access point.
+func accessPointHost(
+	ap *accessPoint,
+) string {
+	return ap.name + "-" + ap.arn.AccountID + ".s3-accesspoint." + ap.arn.Region + ".amazonaws.com"
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+const testAccessPointARN = "arn:aws:s3:eu-west-1:123456789012:accesspoint/objects"
+
+func TestParseAccessPoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		bucket    string
+		wantName  string
+		wantIsARN bool
+		wantErr   error
+		wantHost  string
+	}{
+		{
+			name:      "bucket name",
+			bucket:    "bucket",
+			wantIsARN: false,
+		},
+		{
+			name:      "access point",
+			bucket:    testAccessPointARN,
+			wantName:  "objects",
+			wantIsARN: true,
+			wantHost:  "objects-123456789012.s3-accesspoint.eu-west-1.amazonaws.com",
+		},
+		{
+			name:      "access point with colon",
+			bucket:    "arn:aws:s3:eu-west-1:123456789012:accesspoint:objects",
+			wantName:  "objects",
+			wantIsARN: true,
+			wantHost:  "objects-123456789012.s3-accesspoint.eu-west-1.amazonaws.com",
+		},
+		{
+			name:      "other service",
+			bucket:    "arn:aws:sqs:eu-west-1:123456789012:accesspoint/objects",
+			wantIsARN: true,
+			wantErr:   errNotAccessPointARN,
+		},
+		{
+			name:      "bucket arn",
+			bucket:    "arn:aws:s3:::bucket",
+			wantIsARN: true,
+			wantErr:   errNotAccessPointARN,
+		},
+		{
+			name:      "name missing",
+			bucket:    "arn:aws:s3:eu-west-1:123456789012:accesspoint/",
+			wantIsARN: true,
+			wantErr:   errNotAccessPointARN,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ap, isARN, err := parseAccessPoint(tt.bucket)
+
+			if isARN != tt.wantIsARN {
+				t.Errorf("parseAccessPoint(%q) isARN = %v, want %v", tt.bucket, isARN, tt.wantIsARN)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("parseAccessPoint(%q) error = %v, want %v", tt.bucket, err, tt.wantErr)
+			}
+			if tt.wantName == "" {
+				if ap != nil {
+					t.Errorf("parseAccessPoint(%q) = %+v, want nil", tt.bucket, ap)
+				}
+				return
+			}
+			if ap.name != tt.wantName {
+				t.Errorf("name = %q, want %q", ap.name, tt.wantName)
+			}
+			if got := accessPointHost(ap); got != tt.wantHost {
+				t.Errorf("accessPointHost() = %q, want %q", got, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestS3BucketAttributes(t *testing.T) {
+	tests := []struct {
+		name       string
+		bucket     string
+		wantBucket string
+		wantARN    string
+	}{
+		{
+			name:       "bucket name",
+			bucket:     "bucket",
+			wantBucket: "bucket",
+		},
+		{
+			name:       "access point",
+			bucket:     testAccessPointARN,
+			wantBucket: "objects",
+			wantARN:    testAccessPointARN,
+		},
+		{
+			name:       "malformed arn",
+			bucket:     "arn:aws:s3:::bucket",
+			wantBucket: "arn:aws:s3:::bucket",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attributes := map[string]string{}
+			for _, attr := range s3BucketAttributes(tt.bucket) {
+				attributes[string(attr.Key)] = attr.Value.Emit()
+			}
+
+			if got := attributes["aws.s3.bucket"]; got != tt.wantBucket {
+				t.Errorf("aws.s3.bucket = %q, want %q", got, tt.wantBucket)
+			}
+			if got := attributes["aws.s3.access_point.arn"]; got != tt.wantARN {
+				t.Errorf("aws.s3.access_point.arn = %q, want %q", got, tt.wantARN)
+			}
+		})
+	}
+}
+
+func TestWrongBucketName(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket string
+		want   string
+	}{
+		{
+			name:   "bucket name",
+			bucket: "bucket",
+			want:   WRONG_BUCKET_NAME,
+		},
+		{
+			name:   "access point",
+			bucket: testAccessPointARN,
+			want:   "arn:aws:s3:eu-west-1:123456789012:accesspoint/" + WRONG_BUCKET_NAME,
+		},
+		{
+			name:   "malformed arn",
+			bucket: "arn:aws:s3:::bucket",
+			want:   WRONG_BUCKET_NAME,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wrongBucketName(tt.bucket); got != tt.want {
+				t.Errorf("wrongBucketName(%q) = %q, want %q", tt.bucket, got, tt.want)
+			}
+		})
+	}
+}
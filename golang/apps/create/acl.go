@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// parseObjectACL validates the canned ACL of the uploaded objects, e.g.
+// bucket-owner-full-control for writes into buckets of another account.
+// Unknown values are ignored, the objects then get the bucket default.
+func parseObjectACL(
+	value string,
+) string {
+	acl := strings.ToLower(strings.TrimSpace(value))
+	if acl == "" {
+		return ""
+	}
+
+	for _, cannedACL := range s3.ObjectCannedACL_Values() {
+		if acl == cannedACL {
+			return acl
+		}
+	}
+
+	logger.error("Object ACL is not a canned ACL, ignoring.", "acl", value)
+	return ""
+}
+
+// objectACL returns nil without a configured ACL, so that the upload does
+// not send the header at all.
+func objectACL() *string {
+	if S3_OBJECT_ACL == "" {
+		return nil
+	}
+	return aws.String(S3_OBJECT_ACL)
+}
+
+func recordACLAttribute(
+	span trace.Span,
+) {
+	if S3_OBJECT_ACL == "" {
+		return
+	}
+	span.SetAttributes(attribute.String("aws.s3.acl", S3_OBJECT_ACL))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestParseObjectACL(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{
+			name:  "empty",
+			value: "",
+			want:  "",
+		},
+		{
+			name:  "canned acl",
+			value: "bucket-owner-full-control",
+			want:  "bucket-owner-full-control",
+		},
+		{
+			name:  "canned acl in other case",
+			value: " Private ",
+			want:  "private",
+		},
+		{
+			name:  "unknown",
+			value: "everyone",
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseObjectACL(tt.value); got != tt.want {
+				t.Errorf("parseObjectACL(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectACL(t *testing.T) {
+	tests := []struct {
+		name string
+		acl  string
+		want *string
+	}{
+		{
+			name: "not configured",
+			acl:  "",
+			want: nil,
+		},
+		{
+			name: "configured",
+			acl:  "bucket-owner-full-control",
+			want: aws.String("bucket-owner-full-control"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := S3_OBJECT_ACL
+			t.Cleanup(func() { S3_OBJECT_ACL = previous })
+			S3_OBJECT_ACL = tt.acl
+
+			if got := objectACL(); aws.StringValue(got) != aws.StringValue(tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("objectACL() = %v, want %v", got, tt.want)
+			}
+
+			tp, recorder := newRecordingTracerProvider()
+			_, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "S3.PutObject")
+			recordACLAttribute(span)
+			span.End()
+
+			if got := spanAttribute(recorder.Ended()[0], "aws.s3.acl").AsString(); got != tt.acl {
+				t.Errorf("aws.s3.acl = %q, want %q", got, tt.acl)
+			}
+		})
+	}
+}
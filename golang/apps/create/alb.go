@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+func albHandler(
+	ctx context.Context,
+	req events.ALBTargetGroupRequest,
+) (
+	events.ALBTargetGroupResponse,
+	error,
+) {
+
+	// Target groups with multi-value headers enabled leave the single
+	// value headers empty and expect multi-value headers in return.
+	isMultiValue := len(req.MultiValueHeaders) > 0
+	headers := req.Headers
+	queryParameters := req.QueryStringParameters
+	if isMultiValue {
+		headers = flattenMultiValueHeaders(req.MultiValueHeaders)
+		queryParameters = firstQueryParameterValues(req.MultiValueQueryStringParameters)
+	}
+
+	// Process request
+	result := serveRequest(ctx, albRequestAttributes(req, headers), &Request{
+		Method:          req.HTTPMethod,
+		RouteKey:        req.HTTPMethod + " " + req.Path,
+		Path:            req.Path,
+		SourceIP:        firstForwardedFor(headers),
+		Headers:         headers,
+		QueryParameters: unescapeQueryParameters(queryParameters),
+		Body:            req.Body,
+		IsBase64Encoded: req.IsBase64Encoded,
+	})
+
+	response := events.ALBTargetGroupResponse{
+		StatusCode:        result.StatusCode,
+		StatusDescription: strconv.Itoa(result.StatusCode) + " " + http.StatusText(result.StatusCode),
+		Body:              result.Body,
+	}
+
+	if !isMultiValue {
+		response.Headers = result.Headers
+		return response, nil
+	}
+
+	response.MultiValueHeaders = map[string][]string{}
+	for key, value := range result.Headers {
+		response.MultiValueHeaders[key] = []string{value}
+	}
+	if len(result.Cookies) > 0 {
+		response.MultiValueHeaders["Set-Cookie"] = result.Cookies
+	}
+	return response, nil
+}
+
+// flattenMultiValueHeaders joins repeated headers into a single comma
+// separated value as allowed by RFC 9110.
+func flattenMultiValueHeaders(
+	multiValueHeaders map[string][]string,
+) map[string]string {
+	headers := map[string]string{}
+	for key, values := range multiValueHeaders {
+		headers[key] = strings.Join(values, ",")
+	}
+	return headers
+}
+
+func firstQueryParameterValues(
+	multiValueQueryParameters map[string][]string,
+) map[string]string {
+	queryParameters := map[string]string{}
+	for key, values := range multiValueQueryParameters {
+		if len(values) > 0 {
+			queryParameters[key] = values[0]
+		}
+	}
+	return queryParameters
+}
+
+// unescapeQueryParameters decodes the query parameters which, unlike
+// API Gateway, ALB passes on percent-encoded.
+func unescapeQueryParameters(
+	queryParameters map[string]string,
+) map[string]string {
+	unescaped := map[string]string{}
+	for key, value := range queryParameters {
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		unescaped[key] = value
+	}
+	return unescaped
+}
+
+func firstForwardedFor(
+	headers map[string]string,
+) string {
+	forwardedFor, _, _ := strings.Cut(getHeader(headers, "X-Forwarded-For"), ",")
+	return strings.TrimSpace(forwardedFor)
+}
+
+func albRequestAttributes(
+	req events.ALBTargetGroupRequest,
+	headers map[string]string,
+) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.FaaSTriggerHTTP,
+		semconv.NetTransportTCP,
+		semconv.HTTPMethod(req.HTTPMethod),
+		semconv.HTTPTarget(req.Path),
+		semconv.HTTPScheme(getHeader(headers, "X-Forwarded-Proto")),
+		semconv.HTTPUserAgent(getHeader(headers, "User-Agent")),
+		semconv.HTTPClientIP(firstForwardedFor(headers)),
+		semconv.NetHostName(getHeader(headers, "Host")),
+		attribute.String("aws.alb.target_group_arn", req.RequestContext.ELB.TargetGroupArn),
+	}
+}
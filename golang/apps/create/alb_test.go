@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestFlattenMultiValueHeaders(t *testing.T) {
+	got := flattenMultiValueHeaders(map[string][]string{
+		"Accept":          {"application/json", "text/plain"},
+		"X-Forwarded-For": {"192.0.2.1"},
+		"X-Empty":         {},
+	})
+	want := map[string]string{
+		"Accept":          "application/json,text/plain",
+		"X-Forwarded-For": "192.0.2.1",
+		"X-Empty":         "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flattenMultiValueHeaders() = %v, want %v", got, want)
+	}
+}
+
+func TestFirstQueryParameterValues(t *testing.T) {
+	got := firstQueryParameterValues(map[string][]string{
+		"dryRun": {"true", "false"},
+		"empty":  {},
+	})
+	want := map[string]string{"dryRun": "true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("firstQueryParameterValues() = %v, want %v", got, want)
+	}
+}
+
+func TestUnescapeQueryParameters(t *testing.T) {
+	tests := []struct {
+		name            string
+		queryParameters map[string]string
+		want            map[string]string
+	}{
+		{
+			name:            "plain",
+			queryParameters: map[string]string{"dryRun": "true"},
+			want:            map[string]string{"dryRun": "true"},
+		},
+		{
+			name:            "percent-encoded",
+			queryParameters: map[string]string{"tenant%20id": "a%2Fb+c"},
+			want:            map[string]string{"tenant id": "a/b c"},
+		},
+		{
+			name:            "malformed escape is kept",
+			queryParameters: map[string]string{"key": "100%"},
+			want:            map[string]string{"key": "100%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unescapeQueryParameters(tt.queryParameters); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unescapeQueryParameters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirstForwardedFor(t *testing.T) {
+	tests := []struct {
+		name         string
+		forwardedFor string
+		want         string
+	}{
+		{name: "missing", forwardedFor: "", want: ""},
+		{name: "single address", forwardedFor: "192.0.2.1", want: "192.0.2.1"},
+		{name: "proxied address", forwardedFor: " 192.0.2.1 , 198.51.100.1", want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firstForwardedFor(map[string]string{"x-forwarded-for": tt.forwardedFor}); got != tt.want {
+				t.Errorf("firstForwardedFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestALBHandler(t *testing.T) {
+	withHealthyConfig(t)
+
+	tests := []struct {
+		name               string
+		req                events.ALBTargetGroupRequest
+		wantStatusCode     int
+		wantDescription    string
+		wantMultiValue     bool
+		wantContentType    string
+		wantSingleValueNil bool
+	}{
+		{
+			name: "single value headers",
+			req: events.ALBTargetGroupRequest{
+				HTTPMethod: "GET",
+				Path:       "/health",
+				Headers:    map[string]string{"x-forwarded-for": "192.0.2.1"},
+			},
+			wantStatusCode:  200,
+			wantDescription: "200 OK",
+			wantContentType: "application/json",
+		},
+		{
+			name: "multi-value headers",
+			req: events.ALBTargetGroupRequest{
+				HTTPMethod:        "GET",
+				Path:              "/health",
+				MultiValueHeaders: map[string][]string{"x-forwarded-for": {"192.0.2.1"}},
+			},
+			wantStatusCode:     200,
+			wantDescription:    "200 OK",
+			wantMultiValue:     true,
+			wantContentType:    "application/json",
+			wantSingleValueNil: true,
+		},
+		{
+			name: "method outside of the allowlist",
+			req: events.ALBTargetGroupRequest{
+				HTTPMethod: "DELETE",
+				Path:       "/items",
+			},
+			wantStatusCode:  405,
+			wantDescription: "405 Method Not Allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := albHandler(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("albHandler() error = %v", err)
+			}
+			if res.StatusCode != tt.wantStatusCode {
+				t.Errorf("status code = %d, want %d: %s", res.StatusCode, tt.wantStatusCode, res.Body)
+			}
+			if res.StatusDescription != tt.wantDescription {
+				t.Errorf("status description = %q, want %q", res.StatusDescription, tt.wantDescription)
+			}
+
+			// The response answers in the header format of the request
+			if (len(res.MultiValueHeaders) > 0) != tt.wantMultiValue {
+				t.Errorf("multi-value headers = %v, want %v", res.MultiValueHeaders, tt.wantMultiValue)
+			}
+			if tt.wantSingleValueNil && res.Headers != nil {
+				t.Errorf("headers = %v, want none", res.Headers)
+			}
+			if tt.wantContentType == "" {
+				return
+			}
+			contentType := res.Headers["Content-Type"]
+			if tt.wantMultiValue {
+				contentType = res.MultiValueHeaders["Content-Type"][0]
+			}
+			if contentType != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", contentType, tt.wantContentType)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+func apiGatewayV2Handler(
+	ctx context.Context,
+	req events.APIGatewayV2HTTPRequest,
+) (
+	events.APIGatewayV2HTTPResponse,
+	error,
+) {
+
+	// Process request
+	result := serveRequest(ctx, apiGatewayV2RequestAttributes(req), &Request{
+		Method:          req.RequestContext.HTTP.Method,
+		RouteKey:        req.RouteKey,
+		Path:            req.RawPath,
+		SourceIP:        req.RequestContext.HTTP.SourceIP,
+		Headers:         req.Headers,
+		Cookies:         req.Cookies,
+		PathParameters:  req.PathParameters,
+		QueryParameters: req.QueryStringParameters,
+		Claims:          apiGatewayV2AuthorizerClaims(req.RequestContext.Authorizer),
+		Body:            req.Body,
+		IsBase64Encoded: req.IsBase64Encoded,
+	})
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: result.StatusCode,
+		Headers:    result.Headers,
+		Cookies:    result.Cookies,
+		Body:       result.Body,
+	}, nil
+}
+
+func apiGatewayV2RequestAttributes(
+	req events.APIGatewayV2HTTPRequest,
+) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.FaaSTriggerHTTP,
+		semconv.NetTransportTCP,
+		semconv.HTTPMethod(req.RequestContext.HTTP.Method),
+		semconv.HTTPFlavorKey.String(req.RequestContext.HTTP.Protocol),
+		semconv.HTTPRoute(req.RouteKey),
+		semconv.HTTPTarget(req.RawPath),
+		semconv.HTTPScheme(req.Headers["x-forwarded-proto"]),
+		semconv.HTTPUserAgent(req.RequestContext.HTTP.UserAgent),
+		semconv.HTTPClientIP(req.RequestContext.HTTP.SourceIP),
+		semconv.NetHostName(req.RequestContext.DomainName),
+	}
+}
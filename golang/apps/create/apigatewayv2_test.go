@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestAPIGatewayV2RequestAttributes(t *testing.T) {
+	req := events.APIGatewayV2HTTPRequest{
+		RouteKey: "POST /items",
+		RawPath:  "/prod/items",
+		Headers:  map[string]string{"x-forwarded-proto": "https"},
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			DomainName: "abc.execute-api.eu-west-1.amazonaws.com",
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    "POST",
+				Protocol:  "HTTP/1.1",
+				SourceIP:  "192.0.2.1",
+				UserAgent: "curl/8.0",
+			},
+		},
+	}
+
+	attributes := map[attribute.Key]string{}
+	for _, kv := range apiGatewayV2RequestAttributes(req) {
+		attributes[kv.Key] = kv.Value.Emit()
+	}
+
+	tests := []struct {
+		key  attribute.Key
+		want string
+	}{
+		{key: "faas.trigger", want: "http"},
+		{key: "http.method", want: "POST"},
+		{key: "http.flavor", want: "HTTP/1.1"},
+		{key: "http.route", want: "POST /items"},
+		{key: "http.target", want: "/prod/items"},
+		{key: "http.scheme", want: "https"},
+		{key: "http.user_agent", want: "curl/8.0"},
+		{key: "http.client_ip", want: "192.0.2.1"},
+		{key: "net.host.name", want: "abc.execute-api.eu-west-1.amazonaws.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.key), func(t *testing.T) {
+			if got := attributes[tt.key]; got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIGatewayV2Handler(t *testing.T) {
+	withHealthyConfig(t)
+
+	tests := []struct {
+		name           string
+		method         string
+		routeKey       string
+		rawPath        string
+		wantStatusCode int
+	}{
+		{
+			name:           "health check",
+			method:         "GET",
+			routeKey:       "GET /health",
+			rawPath:        "/health",
+			wantStatusCode: 200,
+		},
+		{
+			name:           "method outside of the allowlist",
+			method:         "DELETE",
+			routeKey:       "DELETE /items",
+			rawPath:        "/items",
+			wantStatusCode: 405,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := apiGatewayV2Handler(context.Background(), events.APIGatewayV2HTTPRequest{
+				RouteKey: tt.routeKey,
+				RawPath:  tt.rawPath,
+				RequestContext: events.APIGatewayV2HTTPRequestContext{
+					HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+						Method:   tt.method,
+						Path:     tt.rawPath,
+						SourceIP: "192.0.2.1",
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("apiGatewayV2Handler() error = %v", err)
+			}
+			if res.StatusCode != tt.wantStatusCode {
+				t.Errorf("status code = %d, want %d: %s", res.StatusCode, tt.wantStatusCode, res.Body)
+			}
+		})
+	}
+}
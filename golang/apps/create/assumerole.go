@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ASSUME_ROLE_PROVIDER_NAME = "AssumeRoleProvider"
+
+	// Credentials are refreshed this long before they expire, so that an
+	// upload does not start with credentials which expire midway.
+	ASSUME_ROLE_EXPIRY_WINDOW = 5 * time.Minute
+)
+
+// stsRoleAssumer is the part of the STS client which the role provider
+// depends on, so that STS can be replaced without talking to AWS.
+type stsRoleAssumer interface {
+	AssumeRoleWithContext(
+		ctx aws.Context,
+		input *sts.AssumeRoleInput,
+		opts ...request.Option,
+	) (
+		*sts.AssumeRoleOutput,
+		error,
+	)
+}
+
+// assumeRoleProvider provides the temporary credentials of the role which
+// may write into the buckets of another account. The SDK calls it for the
+// first request and again once the credentials are about to expire.
+type assumeRoleProvider struct {
+	credentials.Expiry
+
+	mutex       sync.Mutex
+	client      stsRoleAssumer
+	roleARN     string
+	sessionName string
+	externalID  string
+	expiration  time.Time
+}
+
+func newAssumeRoleProvider(
+	client stsRoleAssumer,
+	roleARN string,
+	sessionName string,
+	externalID string,
+) *assumeRoleProvider {
+	return &assumeRoleProvider{
+		client:      client,
+		roleARN:     roleARN,
+		sessionName: sessionName,
+		externalID:  externalID,
+	}
+}
+
+func (p *assumeRoleProvider) Retrieve() (
+	credentials.Value,
+	error,
+) {
+	return p.RetrieveWithContext(context.Background())
+}
+
+// RetrieveWithContext assumes the role within its own client span. The
+// SDK passes the context of the request which needs the credentials, at
+// cold start there is no parent span so the span is started from the
+// global tracer provider.
+func (p *assumeRoleProvider) RetrieveWithContext(
+	ctx credentials.Context,
+) (
+	credentials.Value,
+	error,
+) {
+	ctx, span := otel.Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "STS.AssumeRole",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes([]attribute.KeyValue{
+				semconv.RPCSystemKey.String("aws-api"),
+				semconv.RPCService("STS"),
+				semconv.RPCMethod("AssumeRole"),
+				attribute.String("aws.sts.role_arn", p.roleARN),
+			}...))
+	defer span.End()
+
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(p.roleARN),
+		RoleSessionName: aws.String(p.sessionName),
+	}
+	if p.externalID != "" {
+		input.ExternalId = aws.String(p.externalID)
+	}
+
+	output, err := p.client.AssumeRoleWithContext(ctx, input)
+	if err != nil {
+		span.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		span.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+
+		logger.error("Assuming target role is failed.", "roleArn", p.roleARN, "error", err)
+		return credentials.Value{ProviderName: ASSUME_ROLE_PROVIDER_NAME}, err
+	}
+
+	expiration := aws.TimeValue(output.Credentials.Expiration)
+	p.SetExpiration(expiration, ASSUME_ROLE_EXPIRY_WINDOW)
+
+	p.mutex.Lock()
+	p.expiration = expiration
+	p.mutex.Unlock()
+
+	span.SetAttributes(attribute.String("aws.sts.credentials.expiration", expiration.UTC().Format(time.RFC3339)))
+	logger.info("Assuming target role is succeeded.", "roleArn", p.roleARN, "expiration", expiration)
+
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(output.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(output.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(output.Credentials.SessionToken),
+		ProviderName:    ASSUME_ROLE_PROVIDER_NAME,
+	}, nil
+}
+
+// assumedRoleAttributes describes the credentials which the S3 calls are
+// signed with, so that cross-account writes can be told apart. Nothing is
+// recorded without a target role.
+func assumedRoleAttributes() []attribute.KeyValue {
+	if assumedRole == nil {
+		return nil
+	}
+
+	assumedRole.mutex.Lock()
+	expiration := assumedRole.expiration
+	assumedRole.mutex.Unlock()
+
+	attributes := []attribute.KeyValue{
+		attribute.String("aws.sts.role_arn", assumedRole.roleARN),
+	}
+	if !expiration.IsZero() {
+		attributes = append(attributes, attribute.String("aws.sts.credentials.expiration", expiration.UTC().Format(time.RFC3339)))
+	}
+	return attributes
+}
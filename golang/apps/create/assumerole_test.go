@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"go.opentelemetry.io/otel"
+)
+
+// fakeRoleAssumer answers AssumeRole with the scripted error or with
+// credentials which expire at the given time.
+type fakeRoleAssumer struct {
+	err        error
+	expiration time.Time
+	input      *sts.AssumeRoleInput
+}
+
+func (f *fakeRoleAssumer) AssumeRoleWithContext(
+	_ aws.Context,
+	input *sts.AssumeRoleInput,
+	_ ...request.Option,
+) (
+	*sts.AssumeRoleOutput,
+	error,
+) {
+	f.input = input
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sts.AssumeRoleOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("ASIAEXAMPLE"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(f.expiration),
+		},
+	}, nil
+}
+
+func TestAssumeRoleProvider(t *testing.T) {
+	const roleARN = "arn:aws:iam::123456789012:role/writer"
+
+	tests := []struct {
+		name           string
+		externalID     string
+		expiresIn      time.Duration
+		err            error
+		wantExpired    bool
+		wantExternalID *string
+		wantStatus     string
+	}{
+		{
+			name:        "assumed",
+			expiresIn:   time.Hour,
+			wantExpired: false,
+		},
+		{
+			name:           "assumed with external id",
+			externalID:     "tenant-a",
+			expiresIn:      time.Hour,
+			wantExpired:    false,
+			wantExternalID: aws.String("tenant-a"),
+		},
+		{
+			name:        "expiring within the window",
+			expiresIn:   ASSUME_ROLE_EXPIRY_WINDOW / 2,
+			wantExpired: true,
+		},
+		{
+			name:        "failed",
+			err:         errors.New("AccessDenied: not authorized to perform sts:AssumeRole"),
+			wantExpired: true,
+			wantStatus:  OTEL_STATUS_ERROR_DESCRIPTION,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousProvider, previousRole := otel.GetTracerProvider(), assumedRole
+			t.Cleanup(func() {
+				otel.SetTracerProvider(previousProvider)
+				assumedRole = previousRole
+			})
+			tp, recorder := newRecordingTracerProvider()
+			otel.SetTracerProvider(tp)
+
+			expiration := time.Now().Add(tt.expiresIn).Truncate(time.Second)
+			client := &fakeRoleAssumer{err: tt.err, expiration: expiration}
+			provider := newAssumeRoleProvider(client, roleARN, "create", tt.externalID)
+			assumedRole = provider
+
+			value, err := provider.RetrieveWithContext(context.Background())
+
+			if (err != nil) != (tt.err != nil) {
+				t.Fatalf("RetrieveWithContext() error = %v, want %v", err, tt.err)
+			}
+			if value.ProviderName != ASSUME_ROLE_PROVIDER_NAME {
+				t.Errorf("provider name = %q, want %q", value.ProviderName, ASSUME_ROLE_PROVIDER_NAME)
+			}
+			if got := provider.IsExpired(); got != tt.wantExpired {
+				t.Errorf("IsExpired() = %v, want %v", got, tt.wantExpired)
+			}
+			if aws.StringValue(client.input.RoleArn) != roleARN || aws.StringValue(client.input.RoleSessionName) != "create" {
+				t.Errorf("AssumeRole input = %v", client.input)
+			}
+			if aws.StringValue(client.input.ExternalId) != aws.StringValue(tt.wantExternalID) {
+				t.Errorf("external id = %v, want %v", client.input.ExternalId, tt.wantExternalID)
+			}
+
+			span := recorder.Ended()[0]
+			if got := spanAttribute(span, "otel.status_description").AsString(); got != tt.wantStatus {
+				t.Errorf("otel.status_description = %q, want %q", got, tt.wantStatus)
+			}
+
+			attributes := map[string]string{}
+			for _, attr := range assumedRoleAttributes() {
+				attributes[string(attr.Key)] = attr.Value.AsString()
+			}
+			if attributes["aws.sts.role_arn"] != roleARN {
+				t.Errorf("aws.sts.role_arn = %q, want %q", attributes["aws.sts.role_arn"], roleARN)
+			}
+			wantExpiration := ""
+			if tt.err == nil {
+				wantExpiration = expiration.UTC().Format(time.RFC3339)
+				if value.AccessKeyID != "ASIAEXAMPLE" || value.SessionToken != "token" {
+					t.Errorf("RetrieveWithContext() = %+v", value)
+				}
+			}
+			if got := attributes["aws.sts.credentials.expiration"]; got != wantExpiration {
+				t.Errorf("aws.sts.credentials.expiration = %q, want %q", got, wantExpiration)
+			}
+		})
+	}
+}
+
+func TestAssumedRoleAttributesWithoutRole(t *testing.T) {
+	previous := assumedRole
+	t.Cleanup(func() { assumedRole = previous })
+	assumedRole = nil
+
+	if got := assumedRoleAttributes(); got != nil {
+		t.Errorf("assumedRoleAttributes() = %v, want nil", got)
+	}
+}
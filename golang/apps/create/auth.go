@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	JWKS_FETCH_TIMEOUT = 3 * time.Second
+	JWT_CLOCK_SKEW     = 30 * time.Second
+	JWKS_REFETCH_AFTER = time.Minute
+
+	AUTH_OUTCOME_VALID             = "valid"
+	AUTH_OUTCOME_MISSING           = "missing"
+	AUTH_OUTCOME_MALFORMED         = "malformed"
+	AUTH_OUTCOME_UNKNOWN_KEY       = "unknown_key"
+	AUTH_OUTCOME_INVALID_SIGNATURE = "invalid_signature"
+	AUTH_OUTCOME_EXPIRED           = "expired"
+	AUTH_OUTCOME_NOT_YET_VALID     = "not_yet_valid"
+	AUTH_OUTCOME_WRONG_ISSUER      = "wrong_issuer"
+	AUTH_OUTCOME_WRONG_AUDIENCE    = "wrong_audience"
+)
+
+// tokenError carries the outcome of a failed token validation which is
+// recorded on the span.
+type tokenError struct {
+	outcome string
+}
+
+func (e *tokenError) Error() string {
+	return "token is invalid: " + e.outcome
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+}
+
+// hasAudience reports whether the audience claim, which may either be a
+// single string or a list of strings, contains the given audience.
+func (c *jwtClaims) hasAudience(
+	audience string,
+) bool {
+	var single string
+	if json.Unmarshal(c.Audience, &single) == nil {
+		return single == audience
+	}
+
+	var list []string
+	if json.Unmarshal(c.Audience, &list) == nil {
+		for _, value := range list {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jwks caches the RSA keys of the configured JWKS URL. The keys are fetched
+// at cold start and fetched again when a token refers to an unknown key id,
+// as the issuer might have rotated its keys.
+type jwks struct {
+	mutex     sync.Mutex
+	url       string
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newJWKS(
+	url string,
+) *jwks {
+	return &jwks{
+		url:  url,
+		keys: map[string]*rsa.PublicKey{},
+	}
+}
+
+// fetch downloads the key set within its own client span. At cold start
+// there is no parent span yet, so the span is started from the global
+// tracer provider.
+func (j *jwks) fetch(
+	ctx context.Context,
+) error {
+	ctx, fetchSpan := otel.Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "JWKS.Fetch",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes([]attribute.KeyValue{
+				semconv.HTTPMethod("GET"),
+				semconv.HTTPURL(j.url),
+			}...))
+	defer fetchSpan.End()
+
+	j.mutex.Lock()
+	j.fetchedAt = time.Now()
+	j.mutex.Unlock()
+
+	keys, err := fetchJWKS(ctx, j.url)
+	if err != nil {
+		fetchSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		fetchSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(false),
+		))
+
+		logger.error("Fetching JWKS is failed.", "url", j.url, "error", err)
+		return err
+	}
+	fetchSpan.SetAttributes(attribute.Int("jwks.keys", len(keys)))
+
+	j.mutex.Lock()
+	j.keys = keys
+	j.mutex.Unlock()
+	return nil
+}
+
+// key looks up the key of the given id. A token without key id is accepted
+// as long as the set holds a single key.
+func (j *jwks) key(
+	keyID string,
+) (
+	*rsa.PublicKey,
+	bool,
+) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if keyID == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+	key, ok := j.keys[keyID]
+	return key, ok
+}
+
+func (j *jwks) canRefetch() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return time.Since(j.fetchedAt) > JWKS_REFETCH_AFTER
+}
+
+func fetchJWKS(
+	ctx context.Context,
+	url string,
+) (
+	map[string]*rsa.PublicKey,
+	error,
+) {
+	ctx, cancel := context.WithTimeout(ctx, JWKS_FETCH_TIMEOUT)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	keySet := struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&keySet); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range keySet.Keys {
+		if key.KeyType != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			continue
+		}
+
+		keys[key.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("key set holds no RSA signing keys")
+	}
+	return keys, nil
+}
+
+// validateToken checks the RS256 signature of the token as well as its
+// expiry, issuer and audience and returns its claims.
+func validateToken(
+	ctx context.Context,
+	token string,
+) (
+	*jwtClaims,
+	error,
+) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, &tokenError{AUTH_OUTCOME_MALFORMED}
+	}
+
+	header := &jwtHeader{}
+	if err := decodeTokenPart(parts[0], header); err != nil || header.Algorithm != "RS256" {
+		return nil, &tokenError{AUTH_OUTCOME_MALFORMED}
+	}
+
+	claims := &jwtClaims{}
+	if err := decodeTokenPart(parts[1], claims); err != nil {
+		return nil, &tokenError{AUTH_OUTCOME_MALFORMED}
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, &tokenError{AUTH_OUTCOME_MALFORMED}
+	}
+
+	// Refetch the key set for unknown keys, at most once a minute
+	key, ok := keySet.key(header.KeyID)
+	if !ok {
+		if keySet.canRefetch() && keySet.fetch(ctx) == nil {
+			key, ok = keySet.key(header.KeyID)
+		}
+		if !ok {
+			return nil, &tokenError{AUTH_OUTCOME_UNKNOWN_KEY}
+		}
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, &tokenError{AUTH_OUTCOME_INVALID_SIGNATURE}
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == nil || now.Add(-JWT_CLOCK_SKEW).After(unixTime(*claims.ExpiresAt)) {
+		return claims, &tokenError{AUTH_OUTCOME_EXPIRED}
+	}
+	if claims.NotBefore != nil && now.Add(JWT_CLOCK_SKEW).Before(unixTime(*claims.NotBefore)) {
+		return claims, &tokenError{AUTH_OUTCOME_NOT_YET_VALID}
+	}
+	if JWT_ISSUER != "" && claims.Issuer != JWT_ISSUER {
+		return claims, &tokenError{AUTH_OUTCOME_WRONG_ISSUER}
+	}
+	if JWT_AUDIENCE != "" && !claims.hasAudience(JWT_AUDIENCE) {
+		return claims, &tokenError{AUTH_OUTCOME_WRONG_AUDIENCE}
+	}
+	return claims, nil
+}
+
+func decodeTokenPart(
+	part string,
+	v interface{},
+) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, v)
+}
+
+func unixTime(
+	seconds float64,
+) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// authMiddleware validates the bearer token of every request as soon as a
+// JWKS URL is configured. Health checks and CORS preflights stay open.
+// The outcome and the subject are recorded on the parent span, the token
+// itself never is.
+func authMiddleware(
+	next Handler,
+) Handler {
+	return func(
+		ctx context.Context,
+		req *Request,
+	) *createResult {
+		if keySet == nil || req.Method == "OPTIONS" || isHealthRequest(req) {
+			return next(ctx, req)
+		}
+
+		parentSpan := trace.SpanFromContext(ctx)
+
+		token, ok := strings.CutPrefix(getHeader(req.Headers, "Authorization"), "Bearer ")
+		token = strings.TrimSpace(token)
+		if !ok || token == "" {
+			parentSpan.SetAttributes(attribute.String("auth.outcome", AUTH_OUTCOME_MISSING))
+			return rejectUnauthorized(parentSpan, "Bearer token is missing.")
+		}
+
+		claims, err := validateToken(ctx, token)
+		if claims != nil && claims.Subject != "" {
+			parentSpan.SetAttributes(semconv.EnduserID(claims.Subject))
+		}
+
+		var tokenErr *tokenError
+		if errors.As(err, &tokenErr) {
+			logger.warn("Bearer token is invalid.", "outcome", tokenErr.outcome)
+			parentSpan.SetAttributes(attribute.String("auth.outcome", tokenErr.outcome))
+			return rejectUnauthorized(parentSpan, "Bearer token is invalid.")
+		}
+
+		parentSpan.SetAttributes(attribute.String("auth.outcome", AUTH_OUTCOME_VALID))
+		return next(ctx, req)
+	}
+}
+
+func rejectUnauthorized(
+	parentSpan trace.Span,
+	detail string,
+) *createResult {
+	countError(parentSpan, ERROR_TYPE_AUTH)
+
+	result := failRequest(parentSpan, 401, detail)
+	result.Headers["WWW-Authenticate"] = "Bearer"
+	return result
+}
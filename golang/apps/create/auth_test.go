@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testSigner signs RS256 tokens with a key which the JWKS server of the
+// test publishes.
+type testSigner struct {
+	keyID string
+	key   *rsa.PrivateKey
+}
+
+func newTestSigner(
+	t *testing.T,
+	keyID string,
+) *testSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	return &testSigner{keyID: keyID, key: key}
+}
+
+func (s *testSigner) jwk() map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": s.keyID,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+	}
+}
+
+func (s *testSigner) sign(
+	t *testing.T,
+	header map[string]interface{},
+	claims map[string]interface{},
+) string {
+	headerAsBytes, _ := json.Marshal(header)
+	claimsAsBytes, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerAsBytes) + "." + base64.RawURLEncoding.EncodeToString(claimsAsBytes)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15() error = %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// withJWKS publishes the keys of the signers and configures the key set,
+// issuer and audience which the tokens are validated against.
+func withJWKS(
+	t *testing.T,
+	signers ...*testSigner,
+) *int {
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		keys := []map[string]string{}
+		for _, signer := range signers {
+			keys = append(keys, signer.jwk())
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(server.Close)
+
+	previousKeySet, previousIssuer, previousAudience := keySet, JWT_ISSUER, JWT_AUDIENCE
+	t.Cleanup(func() { keySet, JWT_ISSUER, JWT_AUDIENCE = previousKeySet, previousIssuer, previousAudience })
+	keySet = newJWKS(server.URL)
+	JWT_ISSUER = "https://issuer.example.com"
+	JWT_AUDIENCE = "items"
+
+	if err := keySet.fetch(context.Background()); err != nil {
+		t.Fatalf("fetch() error = %v", err)
+	}
+	return &fetches
+}
+
+func TestValidateToken(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	other := newTestSigner(t, "key-1")
+	unknown := newTestSigner(t, "key-2")
+	withJWKS(t, signer)
+
+	now := time.Now()
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "user",
+			"iss": "https://issuer.example.com",
+			"aud": "items",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for key, value := range overrides {
+			if value == nil {
+				delete(c, key)
+				continue
+			}
+			c[key] = value
+		}
+		return c
+	}
+	header := map[string]interface{}{"alg": "RS256", "kid": "key-1"}
+
+	tests := []struct {
+		name        string
+		token       string
+		wantOutcome string
+	}{
+		{
+			name:  "valid token",
+			token: signer.sign(t, header, claims(nil)),
+		},
+		{
+			name:  "audience list",
+			token: signer.sign(t, header, claims(map[string]interface{}{"aud": []string{"other", "items"}})),
+		},
+		{
+			name:  "token without key id of a single key set",
+			token: signer.sign(t, map[string]interface{}{"alg": "RS256"}, claims(nil)),
+		},
+		{
+			name:  "expired within the clock skew",
+			token: signer.sign(t, header, claims(map[string]interface{}{"exp": now.Add(-JWT_CLOCK_SKEW / 2).Unix()})),
+		},
+		{
+			name:        "not a JWT",
+			token:       "token",
+			wantOutcome: AUTH_OUTCOME_MALFORMED,
+		},
+		{
+			name:        "other algorithm",
+			token:       signer.sign(t, map[string]interface{}{"alg": "HS256", "kid": "key-1"}, claims(nil)),
+			wantOutcome: AUTH_OUTCOME_MALFORMED,
+		},
+		{
+			name:        "unknown key",
+			token:       unknown.sign(t, map[string]interface{}{"alg": "RS256", "kid": "key-2"}, claims(nil)),
+			wantOutcome: AUTH_OUTCOME_UNKNOWN_KEY,
+		},
+		{
+			name:        "invalid signature",
+			token:       other.sign(t, header, claims(nil)),
+			wantOutcome: AUTH_OUTCOME_INVALID_SIGNATURE,
+		},
+		{
+			name:        "expired",
+			token:       signer.sign(t, header, claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()})),
+			wantOutcome: AUTH_OUTCOME_EXPIRED,
+		},
+		{
+			name:        "missing expiry",
+			token:       signer.sign(t, header, claims(map[string]interface{}{"exp": nil})),
+			wantOutcome: AUTH_OUTCOME_EXPIRED,
+		},
+		{
+			name:        "not yet valid",
+			token:       signer.sign(t, header, claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()})),
+			wantOutcome: AUTH_OUTCOME_NOT_YET_VALID,
+		},
+		{
+			name:        "wrong issuer",
+			token:       signer.sign(t, header, claims(map[string]interface{}{"iss": "https://other.example.com"})),
+			wantOutcome: AUTH_OUTCOME_WRONG_ISSUER,
+		},
+		{
+			name:        "wrong audience",
+			token:       signer.sign(t, header, claims(map[string]interface{}{"aud": []string{"other"}})),
+			wantOutcome: AUTH_OUTCOME_WRONG_AUDIENCE,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateToken(context.Background(), tt.token)
+
+			outcome := ""
+			if err != nil {
+				tokenErr, ok := err.(*tokenError)
+				if !ok {
+					t.Fatalf("validateToken() error = %v, want a token error", err)
+				}
+				outcome = tokenErr.outcome
+			}
+			if outcome != tt.wantOutcome {
+				t.Errorf("validateToken() outcome = %q, want %q", outcome, tt.wantOutcome)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRefetchesRotatedKeys(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	rotated := newTestSigner(t, "key-2")
+	fetches := withJWKS(t, signer, rotated)
+
+	// The key set is known without the rotated key at first
+	keySet.keys = map[string]*rsa.PublicKey{"key-1": &signer.key.PublicKey}
+	keySet.fetchedAt = time.Now().Add(-2 * JWKS_REFETCH_AFTER)
+
+	token := rotated.sign(t, map[string]interface{}{"alg": "RS256", "kid": "key-2"}, map[string]interface{}{
+		"iss": JWT_ISSUER,
+		"aud": JWT_AUDIENCE,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if _, err := validateToken(context.Background(), token); err != nil {
+		t.Fatalf("validateToken() error = %v", err)
+	}
+	if *fetches != 2 {
+		t.Errorf("fetches = %d, want 2", *fetches)
+	}
+
+	// Another unknown key within a minute does not fetch again
+	unknown := newTestSigner(t, "key-3")
+	token = unknown.sign(t, map[string]interface{}{"alg": "RS256", "kid": "key-3"}, map[string]interface{}{})
+	if _, err := validateToken(context.Background(), token); err == nil {
+		t.Fatal("validateToken() error = nil, want unknown key")
+	}
+	if *fetches != 2 {
+		t.Errorf("fetches = %d, want 2", *fetches)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	withJWKS(t, signer)
+
+	valid := signer.sign(t, map[string]interface{}{"alg": "RS256", "kid": "key-1"}, map[string]interface{}{
+		"sub": "user",
+		"iss": JWT_ISSUER,
+		"aud": JWT_AUDIENCE,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	tests := []struct {
+		name           string
+		req            *Request
+		wantStatusCode int
+		wantOutcome    string
+		wantSubject    string
+	}{
+		{
+			name:           "valid token",
+			req:            &Request{Method: "POST", Path: "/items", Headers: map[string]string{"authorization": "Bearer " + valid}},
+			wantStatusCode: 201,
+			wantOutcome:    AUTH_OUTCOME_VALID,
+			wantSubject:    "user",
+		},
+		{
+			name:           "missing token",
+			req:            &Request{Method: "POST", Path: "/items"},
+			wantStatusCode: 401,
+			wantOutcome:    AUTH_OUTCOME_MISSING,
+		},
+		{
+			name:           "other scheme",
+			req:            &Request{Method: "POST", Path: "/items", Headers: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}},
+			wantStatusCode: 401,
+			wantOutcome:    AUTH_OUTCOME_MISSING,
+		},
+		{
+			name:           "invalid token",
+			req:            &Request{Method: "POST", Path: "/items", Headers: map[string]string{"Authorization": "Bearer token"}},
+			wantStatusCode: 401,
+			wantOutcome:    AUTH_OUTCOME_MALFORMED,
+		},
+		{
+			name:           "health check stays open",
+			req:            &Request{Method: "GET", Path: HEALTH_PATH},
+			wantStatusCode: 201,
+		},
+		{
+			name:           "preflight stays open",
+			req:            &Request{Method: "OPTIONS", Path: "/items"},
+			wantStatusCode: 201,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, recorder := newRecordingTracerProvider()
+			ctx, parentSpan := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+
+			result := authMiddleware(func(ctx context.Context, req *Request) *createResult {
+				return &createResult{StatusCode: 201}
+			})(ctx, tt.req)
+			parentSpan.End()
+
+			if result.StatusCode != tt.wantStatusCode {
+				t.Fatalf("status code = %d, want %d: %s", result.StatusCode, tt.wantStatusCode, result.Body)
+			}
+			if tt.wantStatusCode == 401 && result.Headers["WWW-Authenticate"] != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", result.Headers["WWW-Authenticate"])
+			}
+
+			handler := recorder.Ended()[0]
+			if got := spanAttribute(handler, "auth.outcome").AsString(); got != tt.wantOutcome {
+				t.Errorf("auth.outcome = %q, want %q", got, tt.wantOutcome)
+			}
+			if got := spanAttribute(handler, "enduser.id").AsString(); got != tt.wantSubject {
+				t.Errorf("enduser.id = %q, want %q", got, tt.wantSubject)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+// BatchItemResponse reports the outcome of one item of a batch. Status
+// carries the status code which a single create of the item would have
+// been answered with.
+type BatchItemResponse struct {
+	Index     int    `json:"index"`
+	Status    int    `json:"status"`
+	Key       string `json:"key,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	VersionID string `json:"versionId,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func isBatchBody(
+	body string,
+) bool {
+	return strings.HasPrefix(strings.TrimSpace(body), "[")
+}
+
+// createObjects uploads every custom object of a JSON array concurrently.
+// The number of parallel uploads is capped by BATCH_CONCURRENCY and a
+// failing item does not cancel its siblings. The response reports the
+// outcome of every item and is 200 when all of them succeeded, 207 when
+// some of them failed and 500 when none succeeded.
+func createObjects(
+	ctx context.Context,
+	bucket string,
+	body string,
+) *createResult {
+
+	parentSpan := trace.SpanFromContext(ctx)
+
+	// Parse custom objects
+	customObjects := []*CustomObject{}
+	err := json.Unmarshal([]byte(body), &customObjects)
+	if err != nil || len(customObjects) == 0 {
+		logger.error("Parsing custom objects is failed.", "error", err)
+		return failRequest(parentSpan, 400, "Request body is not a valid array of custom objects.")
+	}
+
+	parentSpan.SetAttributes(attribute.Int("batch.size", len(customObjects)))
+
+	// Upload custom objects in parallel
+	responses := make([]*BatchItemResponse, len(customObjects))
+	group := errgroup.Group{}
+	group.SetLimit(BATCH_CONCURRENCY)
+	for index, customObject := range customObjects {
+		index, customObject := index, customObject
+		group.Go(func() error {
+			responses[index] = createBatchItem(ctx, parentSpan, bucket, index, customObject)
+			return nil
+		})
+	}
+	group.Wait()
+
+	succeeded := 0
+	for _, response := range responses {
+		if response.Error == "" {
+			succeeded++
+		}
+	}
+
+	statusCode := 207
+	switch succeeded {
+	case len(responses):
+		statusCode = 200
+	case 0:
+		statusCode = 500
+	}
+
+	// Create response body
+	responseAsBytes, err := json.Marshal(responses)
+	if err != nil {
+		return failRequest(parentSpan, 500, "Creating the response is failed.")
+	}
+
+	parentSpan.SetAttributes([]attribute.KeyValue{
+		semconv.HTTPStatusCode(statusCode),
+		attribute.Int("batch.succeeded", succeeded),
+		attribute.Int("batch.failed", len(responses)-succeeded),
+		attribute.Int("objects.stored", succeeded),
+	}...)
+
+	enrichSpanWithEvent(parentSpan, succeeded == len(responses))
+
+	return &createResult{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: string(responseAsBytes),
+	}
+}
+
+// createBatchItem owns the span of one item. The span is ended on every
+// return, and a panic fails only its item instead of the whole process as
+// the item runs in its own goroutine.
+func createBatchItem(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	index int,
+	customObject *CustomObject,
+) (
+	response *BatchItemResponse,
+) {
+
+	// Start item span
+	ctx, itemSpan := startBatchItemSpan(ctx, parentSpan, index)
+	defer itemSpan.End()
+
+	defer func() {
+		if r := recover(); r != nil {
+			recordPanic(itemSpan, r)
+			response = failBatchItem(itemSpan, &BatchItemResponse{
+				Index:  index,
+				Status: 500,
+				Error:  "processing the item is failed unexpectedly",
+			})
+		}
+	}()
+
+	return storeBatchItem(ctx, itemSpan, bucket, index, customObject)
+}
+
+func storeBatchItem(
+	ctx context.Context,
+	itemSpan trace.Span,
+	bucket string,
+	index int,
+	customObject *CustomObject,
+) *BatchItemResponse {
+
+	response := &BatchItemResponse{
+		Index: index,
+	}
+
+	if customObject == nil {
+		response.Status = 400
+		response.Error = "item is null"
+		return failBatchItem(itemSpan, response)
+	}
+	customObject.IsUpdated = false
+	customObject.IsChecked = false
+
+	// Convert custom object to bytes
+	customObjectAsBytes, err := convertCustomObjectIntoBytes(itemSpan, customObject)
+	if err != nil {
+		response.Status = 500
+		response.Error = err.Error()
+		return failBatchItem(itemSpan, response)
+	}
+
+	// Generate object key
+	id, err := keyGenerator.Generate(ctx, customObjectAsBytes)
+	if err != nil {
+		itemSpan.RecordError(err)
+		response.Status = 500
+		response.Error = err.Error()
+		return failBatchItem(itemSpan, response)
+	}
+	key := commons.BuildObjectKey(OBJECT_KEY_PREFIX, time.Now(), id)
+	itemSpan.SetAttributes(attribute.String("aws.s3.key", key))
+
+	// Directory buckets reject keys which cannot be mapped to directories
+	if isS3Storage() && isDirectoryBucket(bucket) {
+		if err := validateDirectoryBucketKey(key); err != nil {
+			logger.warn("Object key is not valid for a directory bucket.", "key", key, "bucket", bucket)
+			countError(itemSpan, ERROR_TYPE_VALIDATION)
+			response.Status = 400
+			response.Error = err.Error()
+			return failBatchItem(itemSpan, response)
+		}
+	}
+
+	// Store object in S3
+	result, err := storeObject(ctx, itemSpan, bucket, key, customObjectAsBytes, false)
+	if err != nil {
+		response.Status = storeErrorStatusCode(err)
+		if errors.Is(err, errCircuitOpen) {
+			response.Status = 503
+		}
+		response.Error = err.Error()
+		return failBatchItem(itemSpan, response)
+	}
+
+	// Index the stored object like a single write, an item without an
+	// entry is deleted again
+	if isManifestEnabled(ctx) && result.Bucket == bucket {
+		err := writeManifestEntry(ctx, itemSpan, bucket, key, result.VersionID, result.Checksum)
+		if err != nil {
+			response.Status = 500
+			response.Error = compensateManifestWrite(ctx, itemSpan, bucket, key, result.VersionID, false, err)
+			return failBatchItem(itemSpan, response)
+		}
+	}
+
+	response.Status = 201
+	response.Key = key
+	response.Bucket = result.Bucket
+	response.VersionID = result.VersionID
+	itemSpan.SetAttributes(semconv.HTTPStatusCode(response.Status))
+	return response
+}
+
+// failBatchItem marks the span of a failed item, so that the failed items
+// of a partially successful batch can be found in the trace.
+func failBatchItem(
+	itemSpan trace.Span,
+	response *BatchItemResponse,
+) *BatchItemResponse {
+	itemSpan.SetAttributes([]attribute.KeyValue{
+		semconv.OtelStatusCodeError,
+		semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		semconv.HTTPStatusCode(response.Status),
+	}...)
+	return response
+}
+
+func startBatchItemSpan(
+	ctx context.Context,
+	parentSpan trace.Span,
+	index int,
+) (
+	context.Context,
+	trace.Span,
+) {
+	// Start batch item span
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "main.createBatchItem",
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithAttributes([]attribute.KeyValue{
+				attribute.Int("batch.item.index", index),
+			}...))
+}
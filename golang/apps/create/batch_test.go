@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+// scriptedStorage answers every write with the given function, so that
+// the storage can be replaced without talking to AWS.
+type scriptedStorage struct {
+	calls int32
+	put   func(key string, body []byte, metadata commons.PutMetadata) (commons.PutResult, error)
+}
+
+func (s *scriptedStorage) Put(
+	ctx context.Context,
+	key string,
+	body []byte,
+	metadata commons.PutMetadata,
+) (
+	commons.PutResult,
+	error,
+) {
+	atomic.AddInt32(&s.calls, 1)
+	return s.put(key, body, metadata)
+}
+
+// withScriptedStorage replaces the storage and lets the breaker stay
+// closed for the whole test.
+func withScriptedStorage(
+	t *testing.T,
+	put func(key string, body []byte, metadata commons.PutMetadata) (commons.PutResult, error),
+) *scriptedStorage {
+	previousStorage, previousBreaker, previousKeys := storage, breaker, keyGenerator
+	t.Cleanup(func() { storage, breaker, keyGenerator = previousStorage, previousBreaker, previousKeys })
+
+	scripted := &scriptedStorage{put: put}
+	storage = scripted
+	breaker, _ = newTestCircuitBreaker(1000, time.Minute)
+	keyGenerator = newKeyGenerator(KEY_STRATEGY_UUID)
+	return scripted
+}
+
+// withBatchConcurrency sets the number of items which are stored in
+// parallel, main sets it from BATCH_CONCURRENCY.
+func withBatchConcurrency(
+	t *testing.T,
+	concurrency int,
+) {
+	previous := BATCH_CONCURRENCY
+	t.Cleanup(func() { BATCH_CONCURRENCY = previous })
+	BATCH_CONCURRENCY = concurrency
+}
+
+func TestCreateObjects(t *testing.T) {
+	withBatchConcurrency(t, DEFAULT_BATCH_CONCURRENCY)
+	errStorage := errors.New("storage is down")
+
+	tests := []struct {
+		name           string
+		body           string
+		wantStatusCode int
+		wantItems      []int
+	}{
+		{
+			name:           "all items succeed",
+			body:           `[{"item":"a"},{"item":"b"}]`,
+			wantStatusCode: 200,
+			wantItems:      []int{201, 201},
+		},
+		{
+			name:           "some items fail",
+			body:           `[{"item":"a"},{"item":"fail"}]`,
+			wantStatusCode: 207,
+			wantItems:      []int{201, 500},
+		},
+		{
+			name:           "all items fail",
+			body:           `[{"item":"fail"},{"item":"fail"}]`,
+			wantStatusCode: 500,
+			wantItems:      []int{500, 500},
+		},
+		{
+			name:           "null item",
+			body:           `[{"item":"a"},null]`,
+			wantStatusCode: 207,
+			wantItems:      []int{201, 400},
+		},
+		{
+			name:           "panicking item fails alone",
+			body:           `[{"item":"panic"},{"item":"a"}]`,
+			wantStatusCode: 207,
+			wantItems:      []int{500, 201},
+		},
+		{
+			name:           "empty array",
+			body:           `[]`,
+			wantStatusCode: 400,
+		},
+		{
+			name:           "invalid array",
+			body:           `[{"item":`,
+			wantStatusCode: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withScriptedStorage(t, func(key string, body []byte, metadata commons.PutMetadata) (commons.PutResult, error) {
+				switch {
+				case bytes.Contains(body, []byte(`"item":"fail"`)):
+					return commons.PutResult{}, errStorage
+				case bytes.Contains(body, []byte(`"item":"panic"`)):
+					panic("storage has panicked")
+				}
+				return commons.PutResult{Bucket: metadata.Bucket, VersionID: "v1"}, nil
+			})
+
+			result := createObjects(context.Background(), "bucket", tt.body)
+			if result.StatusCode != tt.wantStatusCode {
+				t.Fatalf("status code = %d, want %d: %s", result.StatusCode, tt.wantStatusCode, result.Body)
+			}
+			if tt.wantItems == nil {
+				return
+			}
+
+			responses := []*BatchItemResponse{}
+			if err := json.Unmarshal([]byte(result.Body), &responses); err != nil {
+				t.Fatalf("body = %s, error = %v", result.Body, err)
+			}
+			if len(responses) != len(tt.wantItems) {
+				t.Fatalf("%d items are reported, want %d", len(responses), len(tt.wantItems))
+			}
+			for i, response := range responses {
+				if response.Index != i || response.Status != tt.wantItems[i] {
+					t.Errorf("item %d = %+v, want status %d", i, response, tt.wantItems[i])
+				}
+				if (response.Status == 201) != (response.Key != "" && response.Bucket == "bucket" && response.Error == "") {
+					t.Errorf("item %d = %+v, want a key only for stored items", i, response)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateObjectsConcurrency(t *testing.T) {
+	withBatchConcurrency(t, 2)
+
+	var mutex sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	withScriptedStorage(t, func(key string, body []byte, metadata commons.PutMetadata) (commons.PutResult, error) {
+		mutex.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+		return commons.PutResult{Bucket: metadata.Bucket}, nil
+	})
+
+	result := createObjects(context.Background(), "bucket", `[{"item":"a"},{"item":"b"},{"item":"c"},{"item":"d"},{"item":"e"}]`)
+	if result.StatusCode != 200 {
+		t.Fatalf("status code = %d, want 200: %s", result.StatusCode, result.Body)
+	}
+	if maxInFlight != BATCH_CONCURRENCY {
+		t.Errorf("%d items are stored concurrently, want %d", maxInFlight, BATCH_CONCURRENCY)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	CIRCUIT_BREAKER_STATE_CHANGE_EVENT_NAME = "CircuitBreakerStateChange"
+)
+
+var (
+	errCircuitOpen = errors.New("circuit breaker is open")
+)
+
+type circuitBreakerState int
+
+const (
+	circuitBreakerStateClosed circuitBreakerState = iota
+	circuitBreakerStateOpen
+	circuitBreakerStateHalfOpen
+)
+
+func (s circuitBreakerState) String() string {
+	switch s {
+	case circuitBreakerStateOpen:
+		return "open"
+	case circuitBreakerStateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker short-circuits S3 writes after a number of consecutive
+// failures. It lives in a package variable so that its state survives
+// across warm invocations of the same Lambda instance.
+type circuitBreaker struct {
+	mutex               sync.Mutex
+	state               circuitBreakerState
+	consecutiveFailures int
+	failureThreshold    int
+	cooldown            time.Duration
+	openedAt            time.Time
+	trialInFlight       bool
+	now                 func() time.Time
+}
+
+func newCircuitBreaker(
+	failureThreshold int,
+	cooldown time.Duration,
+) *circuitBreaker {
+	return &circuitBreaker{
+		state:            circuitBreakerStateClosed,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		now:              time.Now,
+	}
+}
+
+// allow reports whether a call may go through and whether it is the trial
+// call. An open breaker moves to half-open once the cooldown has elapsed and
+// lets a single trial call pass; every other call is rejected until the
+// outcome of the trial is recorded.
+func (cb *circuitBreaker) allow(
+	span trace.Span,
+) (
+	bool,
+	bool,
+) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state {
+	case circuitBreakerStateClosed:
+		return true, false
+	case circuitBreakerStateHalfOpen:
+		return false, false
+	}
+
+	if cb.now().Sub(cb.openedAt) < cb.cooldown {
+		return false, false
+	}
+
+	cb.transition(span, circuitBreakerStateHalfOpen)
+	cb.trialInFlight = true
+	return true, true
+}
+
+// endTrial frees the trial slot of a half-open breaker whose trial call
+// ended without an outcome, e.g. because it was canceled, so that the next
+// call may try again.
+func (cb *circuitBreaker) endTrial() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if !cb.trialInFlight {
+		return
+	}
+	cb.trialInFlight = false
+	cb.state = circuitBreakerStateOpen
+	cb.openedAt = cb.now().Add(-cb.cooldown)
+}
+
+func (cb *circuitBreaker) recordSuccess(
+	span trace.Span,
+) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.consecutiveFailures = 0
+	cb.trialInFlight = false
+	if cb.state != circuitBreakerStateClosed {
+		cb.transition(span, circuitBreakerStateClosed)
+	}
+}
+
+func (cb *circuitBreaker) recordFailure(
+	span trace.Span,
+) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.consecutiveFailures++
+	cb.trialInFlight = false
+	if cb.state == circuitBreakerStateHalfOpen ||
+		(cb.state == circuitBreakerStateClosed && cb.consecutiveFailures >= cb.failureThreshold) {
+		cb.openedAt = cb.now()
+		cb.transition(span, circuitBreakerStateOpen)
+	}
+}
+
+func (cb *circuitBreaker) transition(
+	span trace.Span,
+	to circuitBreakerState,
+) {
+	from := cb.state
+	cb.state = to
+
+	span.AddEvent(CIRCUIT_BREAKER_STATE_CHANGE_EVENT_NAME,
+		trace.WithAttributes(
+			attribute.String("circuit_breaker.state.from", from.String()),
+			attribute.String("circuit_breaker.state.to", to.String()),
+			attribute.Int("circuit_breaker.consecutive_failures", cb.consecutiveFailures),
+		))
+}
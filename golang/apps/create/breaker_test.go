@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestCircuitBreaker(
+	failureThreshold int,
+	cooldown time.Duration,
+) (
+	*circuitBreaker,
+	*time.Time,
+) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := newCircuitBreaker(failureThreshold, cooldown)
+	cb.now = func() time.Time { return now }
+	return cb, &now
+}
+
+func TestCircuitBreakerStateMachine(t *testing.T) {
+	type step struct {
+		action      string // "allow", "success", "failure", "endTrial" or "advance"
+		advance     time.Duration
+		wantAllowed bool
+		wantTrial   bool
+		wantState   circuitBreakerState
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "closed allows calls below the threshold",
+			steps: []step{
+				{action: "failure", wantState: circuitBreakerStateClosed},
+				{action: "failure", wantState: circuitBreakerStateClosed},
+				{action: "allow", wantAllowed: true, wantState: circuitBreakerStateClosed},
+			},
+		},
+		{
+			name: "success resets the consecutive failures",
+			steps: []step{
+				{action: "failure", wantState: circuitBreakerStateClosed},
+				{action: "failure", wantState: circuitBreakerStateClosed},
+				{action: "success", wantState: circuitBreakerStateClosed},
+				{action: "failure", wantState: circuitBreakerStateClosed},
+				{action: "allow", wantAllowed: true, wantState: circuitBreakerStateClosed},
+			},
+		},
+		{
+			name: "opens at the threshold and rejects during the cooldown",
+			steps: []step{
+				{action: "failure", wantState: circuitBreakerStateClosed},
+				{action: "failure", wantState: circuitBreakerStateClosed},
+				{action: "failure", wantState: circuitBreakerStateOpen},
+				{action: "allow", wantAllowed: false, wantState: circuitBreakerStateOpen},
+				{action: "advance", advance: 29 * time.Second, wantState: circuitBreakerStateOpen},
+				{action: "allow", wantAllowed: false, wantState: circuitBreakerStateOpen},
+			},
+		},
+		{
+			name: "half-open lets a single trial through",
+			steps: []step{
+				{action: "failure"}, {action: "failure"}, {action: "failure", wantState: circuitBreakerStateOpen},
+				{action: "advance", advance: 30 * time.Second, wantState: circuitBreakerStateOpen},
+				{action: "allow", wantAllowed: true, wantTrial: true, wantState: circuitBreakerStateHalfOpen},
+				{action: "allow", wantAllowed: false, wantState: circuitBreakerStateHalfOpen},
+				{action: "allow", wantAllowed: false, wantState: circuitBreakerStateHalfOpen},
+			},
+		},
+		{
+			name: "successful trial closes",
+			steps: []step{
+				{action: "failure"}, {action: "failure"}, {action: "failure", wantState: circuitBreakerStateOpen},
+				{action: "advance", advance: 30 * time.Second, wantState: circuitBreakerStateOpen},
+				{action: "allow", wantAllowed: true, wantTrial: true, wantState: circuitBreakerStateHalfOpen},
+				{action: "success", wantState: circuitBreakerStateClosed},
+				{action: "allow", wantAllowed: true, wantState: circuitBreakerStateClosed},
+				{action: "allow", wantAllowed: true, wantState: circuitBreakerStateClosed},
+			},
+		},
+		{
+			name: "failed trial reopens",
+			steps: []step{
+				{action: "failure"}, {action: "failure"}, {action: "failure", wantState: circuitBreakerStateOpen},
+				{action: "advance", advance: 30 * time.Second, wantState: circuitBreakerStateOpen},
+				{action: "allow", wantAllowed: true, wantTrial: true, wantState: circuitBreakerStateHalfOpen},
+				{action: "failure", wantState: circuitBreakerStateOpen},
+				{action: "allow", wantAllowed: false, wantState: circuitBreakerStateOpen},
+				{action: "advance", advance: 30 * time.Second, wantState: circuitBreakerStateOpen},
+				{action: "allow", wantAllowed: true, wantTrial: true, wantState: circuitBreakerStateHalfOpen},
+			},
+		},
+		{
+			name: "abandoned trial frees the slot",
+			steps: []step{
+				{action: "failure"}, {action: "failure"}, {action: "failure", wantState: circuitBreakerStateOpen},
+				{action: "advance", advance: 30 * time.Second, wantState: circuitBreakerStateOpen},
+				{action: "allow", wantAllowed: true, wantTrial: true, wantState: circuitBreakerStateHalfOpen},
+				{action: "endTrial", wantState: circuitBreakerStateOpen},
+				{action: "allow", wantAllowed: true, wantTrial: true, wantState: circuitBreakerStateHalfOpen},
+			},
+		},
+		{
+			name: "ending a recorded trial is a no-op",
+			steps: []step{
+				{action: "failure"}, {action: "failure"}, {action: "failure", wantState: circuitBreakerStateOpen},
+				{action: "advance", advance: 30 * time.Second, wantState: circuitBreakerStateOpen},
+				{action: "allow", wantAllowed: true, wantTrial: true, wantState: circuitBreakerStateHalfOpen},
+				{action: "success", wantState: circuitBreakerStateClosed},
+				{action: "endTrial", wantState: circuitBreakerStateClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, now := newTestCircuitBreaker(3, 30*time.Second)
+			span := trace.SpanFromContext(context.Background())
+
+			for i, s := range tt.steps {
+				switch s.action {
+				case "allow":
+					allowed, trial := cb.allow(span)
+					if allowed != s.wantAllowed || trial != s.wantTrial {
+						t.Fatalf("step %d: allow() = (%v, %v), want (%v, %v)", i, allowed, trial, s.wantAllowed, s.wantTrial)
+					}
+				case "success":
+					cb.recordSuccess(span)
+				case "failure":
+					cb.recordFailure(span)
+				case "endTrial":
+					cb.endTrial()
+				case "advance":
+					*now = now.Add(s.advance)
+				}
+
+				if cb.state != s.wantState {
+					t.Fatalf("step %d: state = %v, want %v", i, cb.state, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsSingleConcurrentTrial(t *testing.T) {
+	cb, now := newTestCircuitBreaker(1, 30*time.Second)
+	span := trace.SpanFromContext(context.Background())
+
+	cb.recordFailure(span)
+	*now = now.Add(30 * time.Second)
+
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := cb.allow(span); ok {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 1 {
+		t.Fatalf("allowed %d concurrent calls through a half-open breaker, want 1", allowed)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var (
+	_ propagation.TextMapCarrier = headerCarrier{}
+	_ propagation.TextMapCarrier = multiValueHeaderCarrier{}
+)
+
+// headerCarrier adapts the single value headers of the triggers to the
+// propagators. Header names are case-insensitive, and the triggers differ
+// in their casing (API Gateway keeps it, Function URLs lowercase it), so
+// the lookup folds the case instead of relying on the stored key.
+type headerCarrier map[string]string
+
+func (c headerCarrier) Get(
+	key string,
+) string {
+	if value, ok := c[key]; ok {
+		return value
+	}
+	return getHeader(c, key)
+}
+
+// Set replaces the header regardless of the casing it has been stored with.
+func (c headerCarrier) Set(
+	key string,
+	value string,
+) {
+	for existing := range c {
+		if strings.EqualFold(existing, key) {
+			delete(c, existing)
+		}
+	}
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// multiValueHeaderCarrier adapts the multi-value headers of API Gateway
+// REST APIs and ALBs. Get returns the first value like http.Header does.
+type multiValueHeaderCarrier map[string][]string
+
+func (c multiValueHeaderCarrier) Get(
+	key string,
+) string {
+	values, ok := c[key]
+	if !ok {
+		for existing, existingValues := range c {
+			if strings.EqualFold(existing, key) {
+				values = existingValues
+				break
+			}
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c multiValueHeaderCarrier) Set(
+	key string,
+	value string,
+) {
+	for existing := range c {
+		if strings.EqualFold(existing, key) {
+			delete(c, existing)
+		}
+	}
+	c[key] = []string{value}
+}
+
+func (c multiValueHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHeaderCarrier(t *testing.T) {
+	tests := []struct {
+		name      string
+		carrier   propagation.TextMapCarrier
+		wantGet   string
+		wantAfter map[string]string
+	}{
+		{
+			name:      "single value headers",
+			carrier:   headerCarrier{"Traceparent": "before", "Content-Type": "application/json"},
+			wantGet:   "before",
+			wantAfter: map[string]string{"traceparent": "after", "Content-Type": "application/json"},
+		},
+		{
+			name:      "multi-value headers",
+			carrier:   multiValueHeaderCarrier{"Traceparent": {"before", "other"}, "Content-Type": {"application/json"}},
+			wantGet:   "before",
+			wantAfter: map[string]string{"traceparent": "after", "Content-Type": "application/json"},
+		},
+		{
+			name:      "empty multi-value header",
+			carrier:   multiValueHeaderCarrier{"traceparent": {}},
+			wantGet:   "",
+			wantAfter: map[string]string{"traceparent": "after"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Lookups fold the case
+			if got := tt.carrier.Get("traceparent"); got != tt.wantGet {
+				t.Errorf("Get(traceparent) = %q, want %q", got, tt.wantGet)
+			}
+			if got := tt.carrier.Get("missing"); got != "" {
+				t.Errorf("Get(missing) = %q, want none", got)
+			}
+
+			// Set replaces the header in any casing
+			tt.carrier.Set("traceparent", "after")
+
+			after := map[string]string{}
+			for _, key := range tt.carrier.Keys() {
+				after[key] = tt.carrier.Get(key)
+			}
+			if !reflect.DeepEqual(after, tt.wantAfter) {
+				t.Errorf("headers = %v, want %v", after, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestHeaderCarrierPropagation(t *testing.T) {
+	propagator := propagation.TraceContext{}
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	tests := []struct {
+		name    string
+		carrier propagation.TextMapCarrier
+	}{
+		{name: "single value headers", carrier: headerCarrier{"TraceParent": "stale"}},
+		{name: "multi-value headers", carrier: multiValueHeaderCarrier{"TraceParent": {"stale"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			propagator.Inject(trace.ContextWithSpanContext(context.Background(), spanContext), tt.carrier)
+
+			keys := tt.carrier.Keys()
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, []string{"traceparent"}) {
+				t.Errorf("keys = %v, want the injected traceparent only", keys)
+			}
+
+			extracted := trace.SpanContextFromContext(propagator.Extract(context.Background(), tt.carrier))
+			if extracted.TraceID() != spanContext.TraceID() || extracted.SpanID() != spanContext.SpanID() {
+				t.Errorf("extracted span context = %v, want %v", extracted, spanContext)
+			}
+		})
+	}
+}
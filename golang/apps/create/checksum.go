@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	ERROR_CODE_BAD_DIGEST = "BadDigest"
+)
+
+// checksumSHA256 returns the base64 encoded SHA-256 digest of the body in
+// the form S3 expects for x-amz-checksum-sha256. S3 recomputes the digest
+// and rejects the upload when the body has been altered on the way.
+func checksumSHA256(
+	body []byte,
+) string {
+	sum := sha256.Sum256(body)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// objectChecksum returns the checksum which is sent with the upload, none
+// is sent for multipart uploads.
+func objectChecksum(
+	checksum string,
+) *string {
+	if checksum == "" {
+		return nil
+	}
+	return aws.String(checksum)
+}
+
+// isChecksumMismatch reports whether S3 rejected the upload because the
+// received body does not match the checksum.
+func isChecksumMismatch(
+	err error,
+) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code() == ERROR_CODE_BAD_DIGEST
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+// newTestS3Client creates a client which talks to the given endpoint by
+// path style addressing.
+func newTestS3Client(
+	endpoint string,
+	transport http.RoundTripper,
+) *s3.S3 {
+	config := &aws.Config{
+		Region:           aws.String("eu-west-1"),
+		Endpoint:         aws.String(endpoint),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:       aws.Int(3),
+	}
+	sess := session.Must(session.NewSession(config))
+	if transport != nil {
+		return s3.New(sess, aws.NewConfig().WithHTTPClient(&http.Client{Transport: transport}))
+	}
+	return s3.New(sess)
+}
+
+// checksumVerifyingS3 stores the PutObject bodies and rejects them with
+// BadDigest like S3 does when they do not match their SHA-256 checksum.
+type checksumVerifyingS3 struct {
+	mutex     sync.Mutex
+	bodies    map[string][]byte
+	checksums map[string]string
+}
+
+func (s *checksumVerifyingS3) ServeHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	body, _ := io.ReadAll(r.Body)
+	checksum := r.Header.Get("X-Amz-Checksum-Sha256")
+
+	sum := sha256.Sum256(body)
+	if checksum != base64.StdEncoding.EncodeToString(sum[:]) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `<Error><Code>BadDigest</Code><Message>The SHA256 you specified did not match the calculated checksum.</Message></Error>`)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.bodies[r.URL.Path] = body
+	s.checksums[r.URL.Path] = checksum
+	w.Header().Set("ETag", `"etag"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// tamperingTransport flips the last byte of every request body on the way.
+type tamperingTransport struct{}
+
+func (tamperingTransport) RoundTrip(
+	r *http.Request,
+) (
+	*http.Response,
+	error,
+) {
+	if r.Body != nil && r.ContentLength > 0 {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		body[len(body)-1] ^= 0xff
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestS3StoragePutChecksum(t *testing.T) {
+	body := []byte(`{"item":"` + strings.Repeat("x", 512) + `"}`)
+
+	tests := []struct {
+		name                string
+		compressionBytes    int
+		transport           http.RoundTripper
+		wantChecksumMatches bool
+	}{
+		{
+			name:                "uncompressed",
+			wantChecksumMatches: true,
+		},
+		{
+			name:                "compressed",
+			compressionBytes:    64,
+			wantChecksumMatches: true,
+		},
+		{
+			name:                "tampered",
+			transport:           tamperingTransport{},
+			wantChecksumMatches: false,
+		},
+		{
+			name:                "tampered compressed",
+			compressionBytes:    64,
+			transport:           tamperingTransport{},
+			wantChecksumMatches: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withoutFaults(t)
+			withUploadRetries(t, 1)
+
+			previous := COMPRESSION_THRESHOLD_BYTES
+			t.Cleanup(func() { COMPRESSION_THRESHOLD_BYTES = previous })
+			COMPRESSION_THRESHOLD_BYTES = tt.compressionBytes
+
+			s3Server := &checksumVerifyingS3{bodies: map[string][]byte{}, checksums: map[string]string{}}
+			server := httptest.NewServer(s3Server)
+			defer server.Close()
+
+			client := newTestS3Client(server.URL, tt.transport)
+			storage := newS3Storage(newS3Uploader(client), client, s3manager.MinUploadPartSize)
+			result, err := storage.Put(context.Background(), "2026/01/01/id", body, commons.PutMetadata{Bucket: "bucket"})
+
+			if !tt.wantChecksumMatches {
+				if err == nil || !isChecksumMismatch(err) {
+					t.Fatalf("Put() error = %v, want a checksum mismatch", err)
+				}
+				if len(s3Server.bodies) != 0 {
+					t.Error("tampered body is stored")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+
+			stored := s3Server.bodies["/bucket/2026/01/01/id"]
+			if result.Checksum != s3Server.checksums["/bucket/2026/01/01/id"] || result.Checksum != checksumSHA256(stored) {
+				t.Errorf("result checksum = %q, want the checksum of the stored bytes %q", result.Checksum, checksumSHA256(stored))
+			}
+
+			encoding := ""
+			if tt.compressionBytes > 0 {
+				encoding = commons.ContentEncodingGzip
+			}
+			decoded, err := commons.DecodeObjectBody(encoding, stored)
+			if err != nil || !bytes.Equal(decoded, body) {
+				t.Errorf("stored body does not decode to the request body: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DEFAULT_AUTHORIZER_CLAIM_ATTRIBUTES = "sub=enduser.id,custom:tenant=tenant.id"
+)
+
+// parseClaimAttributes parses a mapping of authorizer claims onto span
+// attributes in the form sub=enduser.id,custom:tenant=tenant.id.
+// Malformed entries are skipped.
+func parseClaimAttributes(
+	value string,
+) map[string]string {
+	claimAttributes := map[string]string{}
+	for _, entry := range strings.Split(value, ",") {
+		claim, key, ok := strings.Cut(entry, "=")
+		claim = strings.TrimSpace(claim)
+		key = strings.TrimSpace(key)
+		if !ok || claim == "" || key == "" {
+			continue
+		}
+		claimAttributes[claim] = key
+	}
+	return claimAttributes
+}
+
+// apiGatewayAuthorizerClaims flattens the authorizer of a REST API request.
+// Cognito authorizers nest their claims under "claims" while custom
+// authorizers put their context right into the authorizer map.
+func apiGatewayAuthorizerClaims(
+	authorizer map[string]interface{},
+) map[string]string {
+	if claims, ok := authorizer["claims"].(map[string]interface{}); ok {
+		return stringifyClaims(claims)
+	}
+	return stringifyClaims(authorizer)
+}
+
+// apiGatewayV2AuthorizerClaims flattens the JWT claims or the Lambda
+// authorizer context of an HTTP API request.
+func apiGatewayV2AuthorizerClaims(
+	authorizer *events.APIGatewayV2HTTPRequestContextAuthorizerDescription,
+) map[string]string {
+	claims := map[string]string{}
+	if authorizer == nil {
+		return claims
+	}
+	if authorizer.JWT != nil {
+		for key, value := range authorizer.JWT.Claims {
+			claims[key] = value
+		}
+	}
+	for key, value := range stringifyClaims(authorizer.Lambda) {
+		claims[key] = value
+	}
+	return claims
+}
+
+// stringifyClaims keeps the scalar claims only, nested objects and lists
+// are dropped.
+func stringifyClaims(
+	values map[string]interface{},
+) map[string]string {
+	claims := map[string]string{}
+	for key, value := range values {
+		switch v := value.(type) {
+		case string:
+			claims[key] = v
+		case bool, float64, int, int64:
+			claims[key] = fmt.Sprint(v)
+		}
+	}
+	return claims
+}
+
+// claimsMiddleware records the configured authorizer claims on the parent
+// span and puts them into the baggage for downstream propagation. Missing
+// claims are skipped and never fail the request.
+func claimsMiddleware(
+	next Handler,
+) Handler {
+	return func(
+		ctx context.Context,
+		req *Request,
+	) *createResult {
+		if len(req.Claims) == 0 || len(AUTHORIZER_CLAIM_ATTRIBUTES) == 0 {
+			return next(ctx, req)
+		}
+
+		parentSpan := trace.SpanFromContext(ctx)
+		bag := baggage.FromContext(ctx)
+		for claim, key := range AUTHORIZER_CLAIM_ATTRIBUTES {
+			value, ok := req.Claims[claim]
+			if !ok || value == "" {
+				continue
+			}
+			parentSpan.SetAttributes(attribute.String(key, value))
+
+			member, err := baggage.NewMember(key, url.QueryEscape(value))
+			if err != nil {
+				continue
+			}
+			if withMember, err := bag.SetMember(member); err == nil {
+				bag = withMember
+			}
+		}
+
+		return next(baggage.ContextWithBaggage(ctx, bag), req)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+func TestParseClaimAttributes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]string
+	}{
+		{
+			name:  "defaults",
+			value: DEFAULT_AUTHORIZER_CLAIM_ATTRIBUTES,
+			want:  map[string]string{"sub": "enduser.id", "custom:tenant": "tenant.id"},
+		},
+		{
+			name:  "entries are trimmed",
+			value: " email = enduser.email ",
+			want:  map[string]string{"email": "enduser.email"},
+		},
+		{
+			name:  "malformed entries are skipped",
+			value: "sub,=enduser.id,email=,role=enduser.role",
+			want:  map[string]string{"role": "enduser.role"},
+		},
+		{
+			name:  "empty",
+			value: "",
+			want:  map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseClaimAttributes(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseClaimAttributes(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIGatewayAuthorizerClaims(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer map[string]interface{}
+		want       map[string]string
+	}{
+		{
+			name: "Cognito authorizer",
+			authorizer: map[string]interface{}{
+				"claims": map[string]interface{}{"sub": "user", "email_verified": true},
+			},
+			want: map[string]string{"sub": "user", "email_verified": "true"},
+		},
+		{
+			name: "custom authorizer",
+			authorizer: map[string]interface{}{
+				"principalId": "user",
+				"tier":        float64(2),
+				"groups":      []interface{}{"admin"},
+				"nested":      map[string]interface{}{"a": "b"},
+			},
+			want: map[string]string{"principalId": "user", "tier": "2"},
+		},
+		{
+			name: "no authorizer",
+			want: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apiGatewayAuthorizerClaims(tt.authorizer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apiGatewayAuthorizerClaims() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIGatewayV2AuthorizerClaims(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer *events.APIGatewayV2HTTPRequestContextAuthorizerDescription
+		want       map[string]string
+	}{
+		{
+			name: "no authorizer",
+			want: map[string]string{},
+		},
+		{
+			name: "JWT authorizer",
+			authorizer: &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+				JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{
+					Claims: map[string]string{"sub": "user"},
+				},
+			},
+			want: map[string]string{"sub": "user"},
+		},
+		{
+			name: "Lambda authorizer",
+			authorizer: &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+				Lambda: map[string]interface{}{"tenant": "a", "admin": false},
+			},
+			want: map[string]string{"tenant": "a", "admin": "false"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apiGatewayV2AuthorizerClaims(tt.authorizer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apiGatewayV2AuthorizerClaims() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimsMiddleware(t *testing.T) {
+	previous := AUTHORIZER_CLAIM_ATTRIBUTES
+	t.Cleanup(func() { AUTHORIZER_CLAIM_ATTRIBUTES = previous })
+	AUTHORIZER_CLAIM_ATTRIBUTES = parseClaimAttributes(DEFAULT_AUTHORIZER_CLAIM_ATTRIBUTES)
+
+	tests := []struct {
+		name           string
+		claims         map[string]string
+		wantAttributes map[string]string
+		wantBaggage    map[string]string
+	}{
+		{
+			name:           "no claims",
+			wantAttributes: map[string]string{},
+			wantBaggage:    map[string]string{},
+		},
+		{
+			name:           "configured claims",
+			claims:         map[string]string{"sub": "user", "custom:tenant": "a b", "email": "jane@example.com"},
+			wantAttributes: map[string]string{"enduser.id": "user", "tenant.id": "a b"},
+			wantBaggage:    map[string]string{"enduser.id": "user", "tenant.id": "a b"},
+		},
+		{
+			name:           "empty claim is skipped",
+			claims:         map[string]string{"sub": "", "custom:tenant": "a"},
+			wantAttributes: map[string]string{"tenant.id": "a"},
+			wantBaggage:    map[string]string{"tenant.id": "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, recorder := newRecordingTracerProvider()
+			ctx, parentSpan := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+
+			bag := map[string]string{}
+			handler := claimsMiddleware(func(ctx context.Context, req *Request) *createResult {
+				for _, member := range baggage.FromContext(ctx).Members() {
+					bag[member.Key()] = member.Value()
+				}
+				return &createResult{StatusCode: 201}
+			})
+			handler(ctx, &Request{Claims: tt.claims})
+			parentSpan.End()
+
+			if !reflect.DeepEqual(bag, tt.wantBaggage) {
+				t.Errorf("baggage = %v, want %v", bag, tt.wantBaggage)
+			}
+
+			attributes := map[string]string{}
+			for _, kv := range recorder.Ended()[0].Attributes() {
+				attributes[string(kv.Key)] = kv.Value.AsString()
+			}
+			if !reflect.DeepEqual(attributes, tt.wantAttributes) {
+				t.Errorf("attributes = %v, want %v", attributes, tt.wantAttributes)
+			}
+		})
+	}
+}
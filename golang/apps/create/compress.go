@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type requestBytesContextKey struct{}
+
+// withRequestBytes keeps the size of the request body as it was read, so
+// that the storage span can compare it with the size which is stored.
+func withRequestBytes(
+	ctx context.Context,
+	requestBytes int,
+) context.Context {
+	return context.WithValue(ctx, requestBytesContextKey{}, requestBytes)
+}
+
+// recordStoredBytes sets stored.bytes and, where the object stems from a
+// single request body, request.bytes on the span. Together they show what
+// compression and transformation of the object save.
+func recordStoredBytes(
+	ctx context.Context,
+	span trace.Span,
+	storedBytes int,
+) {
+	span.SetAttributes(attribute.Int("stored.bytes", storedBytes))
+	if requestBytes, ok := ctx.Value(requestBytesContextKey{}).(int); ok {
+		span.SetAttributes(attribute.Int("request.bytes", requestBytes))
+	}
+}
+
+// compressBody gzips bodies larger than COMPRESSION_THRESHOLD_BYTES and
+// records how much the compression saves. It returns the body to upload,
+// its content encoding and the metadata keeping the original size. Bodies
+// which are not compressed are returned unchanged.
+func compressBody(
+	span trace.Span,
+	body []byte,
+) (
+	[]byte,
+	*string,
+	map[string]*string,
+) {
+	if COMPRESSION_THRESHOLD_BYTES <= 0 || len(body) <= COMPRESSION_THRESHOLD_BYTES {
+		span.SetAttributes(attribute.Bool("aws.s3.compressed", false))
+		return body, nil, nil
+	}
+
+	compressed, err := commons.CompressObjectBody(body)
+	if err != nil {
+		logger.warn("Compressing custom object is failed, uploading uncompressed.", "error", err)
+		span.SetAttributes(attribute.Bool("aws.s3.compressed", false))
+		return body, nil, nil
+	}
+
+	span.SetAttributes([]attribute.KeyValue{
+		attribute.Bool("aws.s3.compressed", true),
+		attribute.Int("aws.s3.body.uncompressed_bytes", len(body)),
+		attribute.Int("aws.s3.body.compressed_bytes", len(compressed)),
+		attribute.Float64("aws.s3.compression.ratio", float64(len(compressed))/float64(len(body))),
+	}...)
+
+	return compressed, aws.String(commons.ContentEncodingGzip), map[string]*string{
+		commons.UncompressedSizeMetadataKey: aws.String(strconv.Itoa(len(body))),
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestCompressBody(t *testing.T) {
+	small := []byte(`{"item":"x"}`)
+	large := bytes.Repeat([]byte(`{"item":"x"}`), 100)
+
+	tests := []struct {
+		name           string
+		threshold      int
+		body           []byte
+		wantCompressed bool
+	}{
+		{
+			name:           "compression disabled",
+			threshold:      0,
+			body:           large,
+			wantCompressed: false,
+		},
+		{
+			name:           "below threshold",
+			threshold:      len(small) + 1,
+			body:           small,
+			wantCompressed: false,
+		},
+		{
+			name:           "at threshold",
+			threshold:      len(small),
+			body:           small,
+			wantCompressed: false,
+		},
+		{
+			name:           "above threshold",
+			threshold:      len(small),
+			body:           large,
+			wantCompressed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := COMPRESSION_THRESHOLD_BYTES
+			t.Cleanup(func() { COMPRESSION_THRESHOLD_BYTES = previous })
+			COMPRESSION_THRESHOLD_BYTES = tt.threshold
+
+			tp, recorder := newRecordingTracerProvider()
+			_, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "S3.PutObject")
+			body, contentEncoding, metadata := compressBody(span, tt.body)
+			span.End()
+
+			ended := recorder.Ended()[0]
+			if got := spanAttribute(ended, "aws.s3.compressed").AsBool(); got != tt.wantCompressed {
+				t.Errorf("aws.s3.compressed = %v, want %v", got, tt.wantCompressed)
+			}
+
+			if !tt.wantCompressed {
+				if !bytes.Equal(body, tt.body) || contentEncoding != nil || metadata != nil {
+					t.Errorf("compressBody() = %q, %v, %v, want the body unchanged", body, contentEncoding, metadata)
+				}
+				return
+			}
+
+			if got := aws.StringValue(contentEncoding); got != commons.ContentEncodingGzip {
+				t.Errorf("content encoding = %q, want %q", got, commons.ContentEncodingGzip)
+			}
+			if got := aws.StringValue(metadata[commons.UncompressedSizeMetadataKey]); got != strconv.Itoa(len(tt.body)) {
+				t.Errorf("uncompressed size = %q, want %d", got, len(tt.body))
+			}
+			if got := spanAttribute(ended, "aws.s3.body.compressed_bytes").AsInt64(); got != int64(len(body)) {
+				t.Errorf("aws.s3.body.compressed_bytes = %d, want %d", got, len(body))
+			}
+			decoded, err := commons.DecodeObjectBody(aws.StringValue(contentEncoding), body)
+			if err != nil || !bytes.Equal(decoded, tt.body) {
+				t.Errorf("decoded body = %q, %v, want the original body", decoded, err)
+			}
+		})
+	}
+}
+
+func TestRecordStoredBytes(t *testing.T) {
+	tests := []struct {
+		name             string
+		ctx              context.Context
+		storedBytes      int
+		wantRequestBytes attribute.Value
+	}{
+		{
+			name:             "single request body",
+			ctx:              withRequestBytes(context.Background(), 2048),
+			storedBytes:      512,
+			wantRequestBytes: attribute.IntValue(2048),
+		},
+		{
+			name:             "empty request body",
+			ctx:              withRequestBytes(context.Background(), 0),
+			storedBytes:      0,
+			wantRequestBytes: attribute.IntValue(0),
+		},
+		{
+			name:             "no request body",
+			ctx:              context.Background(),
+			storedBytes:      512,
+			wantRequestBytes: attribute.Value{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, recorder := newRecordingTracerProvider()
+			_, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "S3.PutObject")
+			recordStoredBytes(tt.ctx, span, tt.storedBytes)
+			span.End()
+
+			ended := recorder.Ended()[0]
+			if got := spanAttribute(ended, "stored.bytes"); got != attribute.IntValue(tt.storedBytes) {
+				t.Errorf("stored.bytes = %v, want %d", got.Emit(), tt.storedBytes)
+			}
+			if got := spanAttribute(ended, "request.bytes"); got != tt.wantRequestBytes {
+				t.Errorf("request.bytes = %v, want %v", got.Emit(), tt.wantRequestBytes.Emit())
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	MAX_COPY_COUNT = 50
+
+	// Time kept back from the invocation deadline to answer the request
+	// and flush the telemetry.
+	COPY_DEADLINE_MARGIN = 1 * time.Second
+)
+
+type CopiesResponse struct {
+	Keys      []string `json:"keys"`
+	Requested int      `json:"requested"`
+	Completed int      `json:"completed"`
+	Partial   bool     `json:"partial"`
+}
+
+// createCopies creates count objects from the same body one after another.
+// It stops early once the invocation deadline comes too close or a write
+// fails and then reports the keys created so far as a partial result.
+func createCopies(
+	ctx context.Context,
+	bucket string,
+	body string,
+	count int,
+) *createResult {
+
+	parentSpan := trace.SpanFromContext(ctx)
+
+	// Parse custom object
+	customObject, err := parseCustomObject(parentSpan, body)
+	if err != nil {
+		return failRequest(parentSpan, 400, "Request body is not a valid custom object.")
+	}
+
+	response := &CopiesResponse{
+		Keys:      []string{},
+		Requested: count,
+	}
+
+	for index := 0; index < count; index++ {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < COPY_DEADLINE_MARGIN {
+			logger.warn("Creating copies is stopped, invocation deadline is close.", "completed", response.Completed)
+			parentSpan.AddEvent("CopiesStoppedEarly",
+				trace.WithAttributes(
+					attribute.Int("copies.completed", response.Completed),
+				))
+			response.Partial = true
+			break
+		}
+
+		item := createBatchItem(ctx, parentSpan, bucket, index, customObject)
+		if item.Error != "" {
+			response.Partial = true
+			break
+		}
+
+		response.Keys = append(response.Keys, item.Key)
+		response.Completed++
+	}
+
+	parentSpan.SetAttributes([]attribute.KeyValue{
+		attribute.Int("copies.requested", response.Requested),
+		attribute.Int("copies.completed", response.Completed),
+		attribute.Bool("copies.partial", response.Partial),
+	}...)
+
+	if response.Completed == 0 {
+		return failRequest(parentSpan, 500, "None of the copies could be created.")
+	}
+
+	// Create response body
+	responseAsBytes, err := json.Marshal(response)
+	if err != nil {
+		return failRequest(parentSpan, 500, "Creating the response is failed.")
+	}
+
+	parentSpan.SetAttributes(semconv.HTTPStatusCode(201))
+	enrichSpanWithEvent(parentSpan, !response.Partial)
+
+	return &createResult{
+		StatusCode: 201,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: string(responseAsBytes),
+	}
+}
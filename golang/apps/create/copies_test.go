@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+func TestCreateCopies(t *testing.T) {
+	errStorage := errors.New("storage is down")
+
+	tests := []struct {
+		name           string
+		body           string
+		count          int
+		failFrom       int
+		deadline       time.Duration
+		wantStatusCode int
+		wantCompleted  int
+		wantPartial    bool
+	}{
+		{
+			name:           "all copies are created",
+			body:           `{"item":"x"}`,
+			count:          3,
+			wantStatusCode: 201,
+			wantCompleted:  3,
+		},
+		{
+			name:           "failed write stops the copies",
+			body:           `{"item":"x"}`,
+			count:          3,
+			failFrom:       2,
+			wantStatusCode: 201,
+			wantCompleted:  1,
+			wantPartial:    true,
+		},
+		{
+			name:           "no copy is created",
+			body:           `{"item":"x"}`,
+			count:          3,
+			failFrom:       1,
+			wantStatusCode: 500,
+		},
+		{
+			name:           "close deadline stops the copies",
+			body:           `{"item":"x"}`,
+			count:          3,
+			deadline:       COPY_DEADLINE_MARGIN / 2,
+			wantStatusCode: 500,
+		},
+		{
+			name:           "invalid custom object",
+			body:           `{"item":`,
+			count:          3,
+			wantStatusCode: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			scripted := withScriptedStorage(t, func(key string, body []byte, metadata commons.PutMetadata) (commons.PutResult, error) {
+				calls++
+				if tt.failFrom > 0 && calls >= tt.failFrom {
+					return commons.PutResult{}, errStorage
+				}
+				return commons.PutResult{Bucket: metadata.Bucket}, nil
+			})
+
+			ctx := context.Background()
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.deadline)
+				t.Cleanup(cancel)
+			}
+
+			result := createCopies(ctx, "bucket", tt.body, tt.count)
+			if result.StatusCode != tt.wantStatusCode {
+				t.Fatalf("status code = %d, want %d: %s", result.StatusCode, tt.wantStatusCode, result.Body)
+			}
+			if tt.deadline > 0 && scripted.calls != 0 {
+				t.Errorf("storage calls = %d, want none past the deadline", scripted.calls)
+			}
+			if result.StatusCode != 201 {
+				return
+			}
+
+			response := &CopiesResponse{}
+			if err := json.Unmarshal([]byte(result.Body), response); err != nil {
+				t.Fatalf("body = %s, error = %v", result.Body, err)
+			}
+			if response.Requested != tt.count || response.Completed != tt.wantCompleted || response.Partial != tt.wantPartial {
+				t.Errorf("response = %+v, want %d of %d completed, partial %v", response, tt.wantCompleted, tt.count, tt.wantPartial)
+			}
+			if len(response.Keys) != tt.wantCompleted {
+				t.Errorf("keys = %v, want %d", response.Keys, tt.wantCompleted)
+			}
+		})
+	}
+}
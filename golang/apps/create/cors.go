@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	CORS_ALLOWED_HEADERS = "Authorization,Content-Type,Content-Encoding,X-Tenant-Id,X-Target-Bucket,If-None-Match"
+	CORS_EXPOSED_HEADERS = "Location,X-Trace-Id,traceresponse"
+	CORS_MAX_AGE_SECONDS = "300"
+)
+
+func parseAllowedOrigins(
+	value string,
+) []string {
+	origins := []string{}
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// allowedOrigin returns the value of the Access-Control-Allow-Origin header
+// for the given origin or an empty string if the origin is not allowed.
+func allowedOrigin(
+	origin string,
+) string {
+	for _, allowed := range CORS_ALLOWED_ORIGINS {
+		if allowed == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+func addCORSHeaders(
+	result *createResult,
+	origin string,
+) {
+	allowOrigin := allowedOrigin(origin)
+	if allowOrigin == "" {
+		return
+	}
+
+	if result.Headers == nil {
+		result.Headers = map[string]string{}
+	}
+	result.Headers["Access-Control-Allow-Origin"] = allowOrigin
+	result.Headers["Access-Control-Allow-Methods"] = allowHeader()
+	result.Headers["Access-Control-Allow-Headers"] = CORS_ALLOWED_HEADERS
+	result.Headers["Access-Control-Expose-Headers"] = CORS_EXPOSED_HEADERS
+	result.Headers["Vary"] = "Origin"
+}
+
+// handlePreflight answers CORS preflight requests without touching S3.
+// Preflights of origins which are not allowed are rejected with 403.
+func handlePreflight(
+	parentSpan trace.Span,
+	origin string,
+) *createResult {
+
+	if allowedOrigin(origin) == "" {
+		logger.warn("Origin is not allowed.", "origin", origin)
+		return failRequest(parentSpan, 403, "Origin is not allowed.")
+	}
+
+	parentSpan.SetAttributes(semconv.HTTPStatusCode(204))
+
+	result := &createResult{
+		StatusCode: 204,
+		Headers: map[string]string{
+			"Access-Control-Max-Age": CORS_MAX_AGE_SECONDS,
+		},
+	}
+	addCORSHeaders(result, origin)
+	return result
+}
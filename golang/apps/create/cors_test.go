@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowedOrigins string
+		origin         string
+		want           string
+	}{
+		{name: "no allowed origins", allowedOrigins: "", origin: "https://app.example.com", want: ""},
+		{name: "allowed origin", allowedOrigins: "https://app.example.com, https://admin.example.com", origin: "https://admin.example.com", want: "https://admin.example.com"},
+		{name: "allowed origin in other case", allowedOrigins: "https://app.example.com", origin: "https://APP.example.com", want: "https://APP.example.com"},
+		{name: "other origin", allowedOrigins: "https://app.example.com", origin: "https://evil.example.com", want: ""},
+		{name: "wildcard", allowedOrigins: "*", origin: "https://any.example.com", want: "*"},
+		{name: "wildcard without origin", allowedOrigins: "*", origin: "", want: "*"},
+		{name: "missing origin", allowedOrigins: "https://app.example.com", origin: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := CORS_ALLOWED_ORIGINS
+			t.Cleanup(func() { CORS_ALLOWED_ORIGINS = previous })
+			CORS_ALLOWED_ORIGINS = parseAllowedOrigins(tt.allowedOrigins)
+
+			if got := allowedOrigin(tt.origin); got != tt.want {
+				t.Errorf("allowedOrigin(%q) = %q, want %q", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	previous := CORS_ALLOWED_ORIGINS
+	t.Cleanup(func() { CORS_ALLOWED_ORIGINS = previous })
+	CORS_ALLOWED_ORIGINS = parseAllowedOrigins("https://app.example.com")
+
+	tests := []struct {
+		name           string
+		method         string
+		origin         string
+		wantStatusCode int
+		wantNextCalled bool
+		wantAllowed    bool
+	}{
+		{
+			name:           "preflight of an allowed origin",
+			method:         "OPTIONS",
+			origin:         "https://app.example.com",
+			wantStatusCode: 204,
+			wantAllowed:    true,
+		},
+		{
+			name:           "preflight of another origin",
+			method:         "OPTIONS",
+			origin:         "https://evil.example.com",
+			wantStatusCode: 403,
+		},
+		{
+			name:           "request of an allowed origin",
+			method:         "POST",
+			origin:         "https://app.example.com",
+			wantStatusCode: 201,
+			wantNextCalled: true,
+			wantAllowed:    true,
+		},
+		{
+			name:           "request of another origin",
+			method:         "POST",
+			origin:         "https://evil.example.com",
+			wantStatusCode: 201,
+			wantNextCalled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextCalled := false
+			handler := corsMiddleware(func(ctx context.Context, req *Request) *createResult {
+				nextCalled = true
+				return &createResult{StatusCode: 201}
+			})
+
+			result := handler(context.Background(), &Request{
+				Method:  tt.method,
+				Headers: map[string]string{"Origin": tt.origin},
+			})
+			if result.StatusCode != tt.wantStatusCode {
+				t.Errorf("status code = %d, want %d", result.StatusCode, tt.wantStatusCode)
+			}
+			if nextCalled != tt.wantNextCalled {
+				t.Errorf("next handler called = %v, want %v", nextCalled, tt.wantNextCalled)
+			}
+
+			allowOrigin := result.Headers["Access-Control-Allow-Origin"]
+			if (allowOrigin == tt.origin) != tt.wantAllowed {
+				t.Errorf("Access-Control-Allow-Origin = %q, want allowed %v", allowOrigin, tt.wantAllowed)
+			}
+			if tt.wantAllowed && (result.Headers["Vary"] != "Origin" || result.Headers["Access-Control-Expose-Headers"] != CORS_EXPOSED_HEADERS) {
+				t.Errorf("CORS headers = %v, want Vary and exposed headers", result.Headers)
+			}
+			if tt.method == "OPTIONS" && tt.wantAllowed && result.Headers["Access-Control-Max-Age"] != CORS_MAX_AGE_SECONDS {
+				t.Errorf("Access-Control-Max-Age = %q, want %q", result.Headers["Access-Control-Max-Age"], CORS_MAX_AGE_SECONDS)
+			}
+		})
+	}
+}
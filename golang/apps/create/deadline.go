@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DEFAULT_S3_DEADLINE_MARGIN_MS = 2500
+)
+
+// s3DeadlineMargin keeps the configured margin but never goes below the
+// flush timeout, otherwise a cut off upload would leave no time to export
+// the spans telling about it.
+func s3DeadlineMargin(
+	marginMs int,
+) time.Duration {
+	margin := time.Duration(marginMs) * time.Millisecond
+	if margin < TRACER_PROVIDER_FLUSH_TIMEOUT {
+		return TRACER_PROVIDER_FLUSH_TIMEOUT
+	}
+	return margin
+}
+
+// withS3Deadline bounds the S3 calls by the Lambda deadline minus the
+// safety margin, so that the function answers with a 504 before Lambda
+// kills it. Contexts without deadline are returned unbounded.
+func withS3Deadline(
+	ctx context.Context,
+	span trace.Span,
+) (
+	context.Context,
+	context.CancelFunc,
+) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	s3Deadline := deadline.Add(-S3_DEADLINE_MARGIN)
+	span.SetAttributes(attribute.Int64("aws.s3.timeout_ms", time.Until(s3Deadline).Milliseconds()))
+	return context.WithDeadline(ctx, s3Deadline)
+}
+
+// recordCanceledWrite records a write which has been aborted because its
+// context has ended. The span gets its own status description and error
+// type, so that running out of time is not mistaken for a storage outage.
+// It returns the context error in place of the SDK error.
+func recordCanceledWrite(
+	ctx context.Context,
+	span trace.Span,
+	err error,
+) error {
+	errorType := "canceled"
+	description := "Write is canceled."
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		errorType = "deadline_exceeded"
+		description = "Write is aborted, deadline is exceeded."
+	}
+
+	span.SetAttributes([]attribute.KeyValue{
+		semconv.OtelStatusCodeError,
+		semconv.OtelStatusDescription(description),
+		attribute.String("error.type", errorType),
+	}...)
+
+	span.RecordError(err, trace.WithAttributes(
+		semconv.ExceptionEscaped(true),
+	))
+	return ctx.Err()
+}
+
+// failDeadlineExceeded answers a request whose S3 call has been cut off by
+// the deadline.
+func failDeadlineExceeded(
+	parentSpan trace.Span,
+) *createResult {
+	parentSpan.SetAttributes([]attribute.KeyValue{
+		semconv.OtelStatusCodeError,
+		semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		attribute.String("error.type", "deadline_exceeded"),
+	}...)
+
+	logger.error("Storing custom object into S3 has run into the deadline.")
+	return failRequest(parentSpan, 504, "Storing the object in S3 has timed out.")
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+func TestS3DeadlineMargin(t *testing.T) {
+	tests := []struct {
+		name     string
+		marginMs int
+		want     time.Duration
+	}{
+		{name: "default", marginMs: DEFAULT_S3_DEADLINE_MARGIN_MS, want: 2500 * time.Millisecond},
+		{name: "below the flush timeout", marginMs: 100, want: TRACER_PROVIDER_FLUSH_TIMEOUT},
+		{name: "negative", marginMs: -1, want: TRACER_PROVIDER_FLUSH_TIMEOUT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s3DeadlineMargin(tt.marginMs); got != tt.want {
+				t.Errorf("s3DeadlineMargin(%d) = %v, want %v", tt.marginMs, got, tt.want)
+			}
+		})
+	}
+}
+
+// withS3DeadlineMargin sets the margin which the S3 calls keep from the
+// invocation deadline, main sets it from S3_DEADLINE_MARGIN_MS.
+func withS3DeadlineMargin(
+	t *testing.T,
+	margin time.Duration,
+) {
+	previous := S3_DEADLINE_MARGIN
+	t.Cleanup(func() { S3_DEADLINE_MARGIN = previous })
+	S3_DEADLINE_MARGIN = margin
+}
+
+func TestWithS3Deadline(t *testing.T) {
+	withS3DeadlineMargin(t, time.Second)
+
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		wantDeadline bool
+	}{
+		{name: "no deadline"},
+		{name: "deadline", timeout: time.Minute, wantDeadline: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, recorder := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "S3.PutObject")
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				t.Cleanup(cancel)
+			}
+			invocationDeadline, _ := ctx.Deadline()
+
+			s3Ctx, cancel := withS3Deadline(ctx, span)
+			defer cancel()
+			span.End()
+
+			deadline, ok := s3Ctx.Deadline()
+			if ok != tt.wantDeadline {
+				t.Fatalf("deadline = %v, want %v", ok, tt.wantDeadline)
+			}
+			timeout := spanAttribute(recorder.Ended()[0], "aws.s3.timeout_ms").AsInt64()
+			if !tt.wantDeadline {
+				if timeout != 0 {
+					t.Errorf("aws.s3.timeout_ms = %d, want none", timeout)
+				}
+				return
+			}
+
+			if !deadline.Equal(invocationDeadline.Add(-time.Second)) {
+				t.Errorf("deadline = %v, want a second before %v", deadline, invocationDeadline)
+			}
+			if timeout <= 0 || timeout > (tt.timeout-time.Second).Milliseconds() {
+				t.Errorf("aws.s3.timeout_ms = %d, want up to %d", timeout, (tt.timeout - time.Second).Milliseconds())
+			}
+		})
+	}
+}
+
+func TestRecordCanceledWrite(t *testing.T) {
+	tests := []struct {
+		name            string
+		ctx             func() (context.Context, context.CancelFunc)
+		wantErr         error
+		wantErrorType   string
+		wantDescription string
+	}{
+		{
+			name: "canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			wantErr:         context.Canceled,
+			wantErrorType:   "canceled",
+			wantDescription: "Write is canceled.",
+		},
+		{
+			name: "deadline exceeded",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+			},
+			wantErr:         context.DeadlineExceeded,
+			wantErrorType:   "deadline_exceeded",
+			wantDescription: "Write is aborted, deadline is exceeded.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			tp, recorder := newRecordingTracerProvider()
+			_, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "S3.PutObject")
+			err := recordCanceledWrite(ctx, span, errors.New("RequestCanceled"))
+			span.End()
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("recordCanceledWrite() error = %v, want %v", err, tt.wantErr)
+			}
+			recorded := recorder.Ended()[0]
+			if got := spanAttribute(recorded, "error.type").AsString(); got != tt.wantErrorType {
+				t.Errorf("error.type = %q, want %q", got, tt.wantErrorType)
+			}
+			if got := spanAttribute(recorded, "otel.status_description").AsString(); got != tt.wantDescription {
+				t.Errorf("otel.status_description = %q, want %q", got, tt.wantDescription)
+			}
+		})
+	}
+}
+
+func TestS3StoragePutDeadline(t *testing.T) {
+	withoutFaults(t)
+	withUploadRetries(t, 1)
+	withS3DeadlineMargin(t, 50*time.Millisecond)
+
+	// S3 answers only once the test is over
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(done) })
+
+	previousClient := s3Client
+	t.Cleanup(func() { s3Client = previousClient })
+	s3Client = newTestS3Client(server.URL, nil)
+
+	tp, recorder := newRecordingTracerProvider()
+	ctx, parentSpan := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+	ctx, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+	defer cancel()
+
+	startTime := time.Now()
+	storage := newS3Storage(newS3Uploader(s3Client), s3Client, s3manager.MinUploadPartSize)
+	_, err := storage.Put(ctx, "2026/01/01/id", []byte(`{"item":"x"}`), commons.PutMetadata{Bucket: "bucket"})
+	parentSpan.End()
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Put() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(startTime); elapsed >= 250*time.Millisecond {
+		t.Errorf("Put() has taken %v, want it to end before the invocation deadline", elapsed)
+	}
+
+	for _, span := range recorder.Ended() {
+		if span.Name() != "S3.PutObject" {
+			continue
+		}
+		if got := spanAttribute(span, "error.type").AsString(); got != "deadline_exceeded" {
+			t.Errorf("S3.PutObject error.type = %q, want deadline_exceeded", got)
+		}
+		return
+	}
+	t.Error("S3.PutObject span is missing")
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DEFAULT_DEDUPE_CACHE_SIZE = 1000
+
+	// Both the cache of recently created objects and the lookup of stored
+	// objects report their hits with the same attribute
+	DEDUP_HIT_ATTRIBUTE = attribute.Key("dedup.hit")
+)
+
+type dedupeEntry struct {
+	hash      string
+	key       string
+	expiresAt time.Time
+}
+
+// dedupeCache remembers the keys of recently created objects by the hash of
+// their payload. Like the rate limiter, it lives in a package variable and
+// therefore only covers the requests of one execution environment. Entries
+// outlive a single invocation on purpose and expire by their TTL instead.
+// Payloads which are being created are tracked as in flight, so that
+// concurrent identical payloads wait for the first one instead of both
+// being uploaded.
+type dedupeCache struct {
+	mutex    sync.Mutex
+	size     int
+	ttl      time.Duration
+	order    *list.List
+	entries  map[string]*list.Element
+	inFlight map[string]chan struct{}
+	now      func() time.Time
+}
+
+func newDedupeCache(
+	size int,
+	ttl time.Duration,
+) *dedupeCache {
+	return &dedupeCache{
+		size:     size,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+		inFlight: map[string]chan struct{}{},
+		now:      time.Now,
+	}
+}
+
+// claim returns the key of the object which has been created with the same
+// payload hash. Without one, the caller claims the hash and has to release
+// it once the object is created or has failed. A caller which finds the
+// hash claimed waits for the release and checks again, so that only one of
+// the concurrent identical payloads is uploaded. Waiting ends with the
+// error of the context once it is done.
+func (c *dedupeCache) claim(
+	ctx context.Context,
+	hash string,
+) (
+	string,
+	bool,
+	error,
+) {
+	for {
+		key, ok := c.get(hash)
+		if ok {
+			return key, true, nil
+		}
+
+		c.mutex.Lock()
+		done, claimed := c.inFlight[hash]
+		if !claimed {
+			c.inFlight[hash] = make(chan struct{})
+			c.mutex.Unlock()
+			return "", false, nil
+		}
+		c.mutex.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+		}
+	}
+}
+
+// release ends the claim of the hash. The key of the created object is
+// remembered, an empty key lets the next waiting payload try itself.
+func (c *dedupeCache) release(
+	hash string,
+	key string,
+) {
+	if key != "" {
+		c.put(hash, key)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if done, ok := c.inFlight[hash]; ok {
+		close(done)
+		delete(c.inFlight, hash)
+	}
+}
+
+// get returns the key of the object which has been created with the same
+// payload hash within the TTL.
+func (c *dedupeCache) get(
+	hash string,
+) (
+	string,
+	bool,
+) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[hash]
+	if !ok {
+		return "", false
+	}
+
+	entry := element.Value.(*dedupeEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, hash)
+		return "", false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.key, true
+}
+
+// put remembers the key of a created object and evicts the least recently
+// used entry once the cache is full.
+func (c *dedupeCache) put(
+	hash string,
+	key string,
+) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+	if element, ok := c.entries[hash]; ok {
+		entry := element.Value.(*dedupeEntry)
+		entry.key = key
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[hash] = c.order.PushFront(&dedupeEntry{
+		hash:      hash,
+		key:       key,
+		expiresAt: expiresAt,
+	})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dedupeEntry).hash)
+	}
+}
+
+// hashPayload hashes the canonical JSON of the custom object together with
+// the bucket, so that identical payloads for different tenants are stored
+// separately. Marshaling the struct orders and formats the fields the same
+// way regardless of how the request body was written.
+func hashPayload(
+	bucket string,
+	customObject *CustomObject,
+) (
+	string,
+	error,
+) {
+	customObjectAsBytes, err := json.Marshal(customObject)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.New()
+	sum.Write([]byte(bucket))
+	sum.Write([]byte{0})
+	sum.Write(customObjectAsBytes)
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// isContentDedupEnabled reports whether stored objects are looked up before
+// an upload. Only content hash keys tell that an object with the same
+// payload exists, the other strategies generate a new key on every request.
+func isContentDedupEnabled(
+	ctx context.Context,
+) bool {
+	_, isContentHash := keyGenerator.(contentHashKeyGenerator)
+	return ENABLE_DEDUP && isContentHash && isS3Storage() && !isDryRun(ctx)
+}
+
+// isStoredDuplicate checks whether the object with the content hash key
+// has already been stored. A failing check is not a hit, the object is
+// uploaded again rather than the request being failed.
+func isStoredDuplicate(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+) bool {
+
+	// Start dedup check span
+	ctx, span := parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "CheckDuplicate",
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithAttributes(s3BucketAttributes(bucket)...),
+			trace.WithAttributes([]attribute.KeyValue{
+				attribute.String("aws.s3.key", key),
+			}...))
+	defer span.End()
+
+	existing, err := headObjectInS3(ctx, span, bucket, key)
+	if err != nil {
+		logger.warn("Checking for a stored duplicate is failed, uploading anyway.", "key", key, "error", err)
+	}
+
+	hit := err == nil && existing != nil
+	span.SetAttributes(DEDUP_HIT_ATTRIBUTE.Bool(hit))
+	parentSpan.SetAttributes(DEDUP_HIT_ATTRIBUTE.Bool(hit))
+	return hit
+}
+
+// respondWithDuplicate answers a duplicate payload with the key of the
+// object which has already been created instead of uploading it again.
+func respondWithDuplicate(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+	customObject *CustomObject,
+) *createResult {
+
+	logger.info("Custom object is a duplicate, returning existing key.", "key", key)
+
+	responseAsBytes, err := json.Marshal(versionResponse(ctx, parentSpan, &CreateResponse{
+		Key:    key,
+		Bucket: bucket,
+		Dedupe: true,
+		Item:   customObject,
+	}))
+	if err != nil {
+		return failRequest(parentSpan, 500, "Creating the response is failed.")
+	}
+
+	parentSpan.SetAttributes(semconv.HTTPStatusCode(200))
+
+	enrichSpanWithEvent(parentSpan, true)
+
+	return &createResult{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type": itemMediaType(responseVersion(ctx)),
+			"Location":     itemLocation(key),
+		},
+		Body: string(responseAsBytes),
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+func newTestDedupeCache(
+	size int,
+	ttl time.Duration,
+) (
+	*dedupeCache,
+	*time.Time,
+) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newDedupeCache(size, ttl)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func TestDedupeCacheGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		put     map[string]string
+		advance time.Duration
+		hash    string
+		wantKey string
+		wantHit bool
+	}{
+		{
+			name:    "miss",
+			hash:    "a",
+			wantHit: false,
+		},
+		{
+			name:    "hit",
+			put:     map[string]string{"a": "key-a"},
+			hash:    "a",
+			wantKey: "key-a",
+			wantHit: true,
+		},
+		{
+			name:    "hit before expiry",
+			put:     map[string]string{"a": "key-a"},
+			advance: 59 * time.Second,
+			hash:    "a",
+			wantKey: "key-a",
+			wantHit: true,
+		},
+		{
+			name:    "miss after expiry",
+			put:     map[string]string{"a": "key-a"},
+			advance: time.Minute,
+			hash:    "a",
+			wantHit: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, now := newTestDedupeCache(10, time.Minute)
+			for hash, key := range tt.put {
+				cache.put(hash, key)
+			}
+			*now = now.Add(tt.advance)
+
+			key, ok := cache.get(tt.hash)
+			if ok != tt.wantHit || key != tt.wantKey {
+				t.Errorf("get(%q) = %q, %v, want %q, %v", tt.hash, key, ok, tt.wantKey, tt.wantHit)
+			}
+		})
+	}
+}
+
+func TestDedupeCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, _ := newTestDedupeCache(2, time.Minute)
+	cache.put("a", "key-a")
+	cache.put("b", "key-b")
+	cache.get("a")
+	cache.put("c", "key-c")
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("least recently used entry is not evicted")
+	}
+	for _, hash := range []string{"a", "c"} {
+		if _, ok := cache.get(hash); !ok {
+			t.Errorf("entry %q is evicted", hash)
+		}
+	}
+}
+
+func TestDedupeCacheClaimIsSingleFlight(t *testing.T) {
+	cache, _ := newTestDedupeCache(10, time.Minute)
+
+	const callers = 10
+	uploads := atomic.Int32{}
+	hits := atomic.Int32{}
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			key, ok, err := cache.claim(context.Background(), "a")
+			if err != nil {
+				t.Errorf("claim() error = %v", err)
+				return
+			}
+			if ok {
+				if key != "key-a" {
+					t.Errorf("claim() key = %q, want key-a", key)
+				}
+				hits.Add(1)
+				return
+			}
+
+			// Hold the claim long enough for the others to queue up
+			uploads.Add(1)
+			time.Sleep(10 * time.Millisecond)
+			cache.release("a", "key-a")
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if uploads.Load() != 1 {
+		t.Errorf("uploads = %d, want 1", uploads.Load())
+	}
+	if hits.Load() != callers-1 {
+		t.Errorf("hits = %d, want %d", hits.Load(), callers-1)
+	}
+}
+
+func TestDedupeCacheClaimAfterFailedRelease(t *testing.T) {
+	cache, _ := newTestDedupeCache(10, time.Minute)
+
+	if _, ok, _ := cache.claim(context.Background(), "a"); ok {
+		t.Fatal("first claim is a hit")
+	}
+
+	claimed := make(chan bool)
+	go func() {
+		_, ok, err := cache.claim(context.Background(), "a")
+		claimed <- err == nil && !ok
+	}()
+
+	// A failed create releases without a key, the waiter claims itself
+	cache.release("a", "")
+	if !<-claimed {
+		t.Error("waiter does not claim the hash after a failed create")
+	}
+}
+
+func TestDedupeCacheClaimHonorsContext(t *testing.T) {
+	cache, _ := newTestDedupeCache(10, time.Minute)
+	cache.claim(context.Background(), "a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, ok, err := cache.claim(ctx, "a")
+	if ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("claim() = %v, %v, want deadline exceeded", ok, err)
+	}
+}
+
+func TestHashPayload(t *testing.T) {
+	object := &CustomObject{Item: "item"}
+
+	hashA, _ := hashPayload("bucket-a", object)
+	hashAAgain, _ := hashPayload("bucket-a", &CustomObject{Item: "item"})
+	hashB, _ := hashPayload("bucket-b", object)
+
+	if hashA != hashAAgain {
+		t.Error("identical payloads hash differently")
+	}
+	if hashA == hashB {
+		t.Error("payloads of different buckets hash the same")
+	}
+}
+
+func TestStoredDuplicate(t *testing.T) {
+	tests := []struct {
+		name           string
+		headStatus     int
+		wantStatusCode int
+		wantUploads    int32
+		wantHit        bool
+	}{
+		{
+			name:           "stored",
+			headStatus:     http.StatusOK,
+			wantStatusCode: 200,
+			wantUploads:    0,
+			wantHit:        true,
+		},
+		{
+			name:           "not stored",
+			headStatus:     http.StatusNotFound,
+			wantStatusCode: 201,
+			wantUploads:    1,
+			wantHit:        false,
+		},
+		{
+			name:           "check fails",
+			headStatus:     http.StatusForbidden,
+			wantStatusCode: 201,
+			wantUploads:    1,
+			wantHit:        false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withoutFaults(t)
+			scripted := withScriptedStorage(t, func(key string, body []byte, metadata commons.PutMetadata) (commons.PutResult, error) {
+				return commons.PutResult{}, nil
+			})
+
+			var heads int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "HEAD" {
+					atomic.AddInt32(&heads, 1)
+				}
+				w.WriteHeader(tt.headStatus)
+			}))
+			t.Cleanup(server.Close)
+
+			previousClient, previousDedup, previousBackend, previousDeduper := s3Client, ENABLE_DEDUP, STORAGE_BACKEND, deduper
+			t.Cleanup(func() {
+				s3Client, ENABLE_DEDUP, STORAGE_BACKEND, deduper = previousClient, previousDedup, previousBackend, previousDeduper
+			})
+			s3Client = newTestS3Client(server.URL, nil)
+			s3Client.Config.MaxRetries = aws.Int(0)
+			ENABLE_DEDUP = true
+			STORAGE_BACKEND = STORAGE_BACKEND_S3
+			deduper = nil
+			keyGenerator = contentHashKeyGenerator{}
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+			result := createObject(ctx, "bucket", `{"item":"a"}`)
+			span.End()
+
+			if result.StatusCode != tt.wantStatusCode {
+				t.Errorf("createObject() status code = %d, want %d: %s", result.StatusCode, tt.wantStatusCode, result.Body)
+			}
+			if heads != 1 {
+				t.Errorf("HeadObject called %d times, want 1", heads)
+			}
+			if scripted.calls != tt.wantUploads {
+				t.Errorf("Put() called %d times, want %d", scripted.calls, tt.wantUploads)
+			}
+
+			for _, s := range recorder.Ended() {
+				if s.Name() != "CheckDuplicate" && s.Name() != "handler" {
+					continue
+				}
+				if got := spanAttribute(s, DEDUP_HIT_ATTRIBUTE).AsBool(); got != tt.wantHit {
+					t.Errorf("%s: %s = %v, want %v", s.Name(), DEDUP_HIT_ATTRIBUTE, got, tt.wantHit)
+				}
+			}
+		})
+	}
+}
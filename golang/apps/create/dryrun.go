@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DRY_RUN_HEADER             = "X-Dry-Run"
+	DEFAULT_DRY_RUN_LATENCY_MS = 50
+)
+
+var (
+	DRY_RUN_LATENCY = time.Duration(DEFAULT_DRY_RUN_LATENCY_MS) * time.Millisecond
+)
+
+type dryRunContextKey struct{}
+
+// isDryRunRequest reports whether the request is a dry run. DRY_RUN turns
+// every request into one, otherwise the caller asks for it either by the
+// dryRun query parameter or by the X-Dry-Run header.
+func isDryRunRequest(
+	req *Request,
+) bool {
+	return DRY_RUN ||
+		req.QueryParameters["dryRun"] == "true" ||
+		getHeader(req.Headers, DRY_RUN_HEADER) == "true"
+}
+
+func isDryRun(
+	ctx context.Context,
+) bool {
+	dryRun, _ := ctx.Value(dryRunContextKey{}).(bool)
+	return dryRun
+}
+
+// dryRunMiddleware marks dry runs on the context, so that the whole handler
+// runs as usual but the upload to S3 is only simulated.
+func dryRunMiddleware(
+	next Handler,
+) Handler {
+	return func(
+		ctx context.Context,
+		req *Request,
+	) *createResult {
+		if !isDryRunRequest(req) {
+			return next(ctx, req)
+		}
+
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("dry_run", true))
+
+		result := next(context.WithValue(ctx, dryRunContextKey{}, true), req)
+		if result.Headers == nil {
+			result.Headers = map[string]string{}
+		}
+		result.Headers[DRY_RUN_HEADER] = "true"
+		return result
+	}
+}
+
+// simulateUpload stands in for the uploader during dry runs. It waits for
+// the synthetic latency and fails like a real upload would when a fault
+// is injected.
+func simulateUpload(
+	ctx context.Context,
+	faultInjected bool,
+) (
+	*s3manager.UploadOutput,
+	error,
+) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(DRY_RUN_LATENCY):
+	}
+
+	if faultInjected {
+		return nil, awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil)
+	}
+	return &s3manager.UploadOutput{}, nil
+}
+
+// dryRunSpanProcessor stamps every span started within a dry run, so that
+// dry runs can be told apart in the backend.
+type dryRunSpanProcessor struct{}
+
+func (dryRunSpanProcessor) OnStart(
+	parent context.Context,
+	s sdktrace.ReadWriteSpan,
+) {
+	if isDryRun(parent) {
+		s.SetAttributes(attribute.Bool("dry_run", true))
+	}
+}
+
+func (dryRunSpanProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (dryRunSpanProcessor) Shutdown(context.Context) error   { return nil }
+func (dryRunSpanProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeUploader answers every upload with the scripted errors in order and
+// succeeds once they are used up. It keeps the input and the body of the
+// last upload.
+type fakeUploader struct {
+	calls  int32
+	errors []error
+
+	mutex sync.Mutex
+	input *s3manager.UploadInput
+	body  []byte
+}
+
+func (u *fakeUploader) UploadWithContext(
+	ctx aws.Context,
+	input *s3manager.UploadInput,
+	opts ...func(*s3manager.Uploader),
+) (
+	*s3manager.UploadOutput,
+	error,
+) {
+	call := int(atomic.AddInt32(&u.calls, 1))
+
+	var body []byte
+	if input.Body != nil {
+		var err error
+		if body, err = io.ReadAll(input.Body); err != nil {
+			return nil, err
+		}
+	}
+	u.mutex.Lock()
+	u.input, u.body = input, body
+	u.mutex.Unlock()
+
+	if call <= len(u.errors) && u.errors[call-1] != nil {
+		return nil, u.errors[call-1]
+	}
+	return &s3manager.UploadOutput{VersionID: aws.String("v1")}, nil
+}
+
+// noFaultSource lets causeError never inject a fault.
+type noFaultSource struct{}
+
+func (noFaultSource) Int63() int64 { return 0 }
+func (noFaultSource) Seed(int64)   {}
+
+func withoutFaults(
+	t *testing.T,
+) {
+	previous := randomizer
+	randomizer = rand.New(noFaultSource{})
+	t.Cleanup(func() { randomizer = previous })
+}
+
+// faultSource lets causeError always inject a fault, Intn(15) returns 1.
+type faultSource struct{}
+
+func (faultSource) Int63() int64 { return 1 << 32 }
+func (faultSource) Seed(int64)   {}
+
+func withFaults(
+	t *testing.T,
+) {
+	previous := randomizer
+	randomizer = rand.New(faultSource{})
+	t.Cleanup(func() { randomizer = previous })
+}
+
+func newRecordingTracerProvider() (
+	*sdktrace.TracerProvider,
+	*tracetest.SpanRecorder,
+) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(dryRunSpanProcessor{}),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	return tp, recorder
+}
+
+// spanTreeShape describes the recorded spans by their names and the names
+// of their parents, ignoring ids, timings and attributes.
+func spanTreeShape(
+	spans []sdktrace.ReadOnlySpan,
+) []string {
+	names := map[trace.SpanID]string{}
+	for _, s := range spans {
+		names[s.SpanContext().SpanID()] = s.Name()
+	}
+
+	shape := []string{}
+	for _, s := range spans {
+		shape = append(shape, names[s.Parent().SpanID()]+" > "+s.Name())
+	}
+	sort.Strings(shape)
+	return shape
+}
+
+func putWithRecorder(
+	t *testing.T,
+	dryRun bool,
+	uploader *fakeUploader,
+) []sdktrace.ReadOnlySpan {
+	tp, recorder := newRecordingTracerProvider()
+
+	ctx := context.Background()
+	if dryRun {
+		ctx = context.WithValue(ctx, dryRunContextKey{}, true)
+	}
+	ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(ctx, "handler")
+
+	storage := newS3Storage(uploader, nil, s3manager.DefaultUploadPartSize)
+	if _, err := storage.Put(ctx, "2026/01/01/id", []byte(`{"item":"x"}`), commons.PutMetadata{Bucket: "bucket"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	span.End()
+
+	return recorder.Ended()
+}
+
+func TestDryRunDoesNotInvokeUploader(t *testing.T) {
+	withoutFaults(t)
+	DRY_RUN_LATENCY = 0
+
+	tests := []struct {
+		name      string
+		dryRun    bool
+		wantCalls int32
+	}{
+		{
+			name:      "dry run",
+			dryRun:    true,
+			wantCalls: 0,
+		},
+		{
+			name:      "real run",
+			dryRun:    false,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploader := &fakeUploader{}
+			putWithRecorder(t, tt.dryRun, uploader)
+
+			if uploader.calls != tt.wantCalls {
+				t.Errorf("uploader called %d times, want %d", uploader.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDryRunSpanTreeMatchesRealRun(t *testing.T) {
+	withoutFaults(t)
+	DRY_RUN_LATENCY = 0
+
+	real := spanTreeShape(putWithRecorder(t, false, &fakeUploader{}))
+	dry := spanTreeShape(putWithRecorder(t, true, &fakeUploader{}))
+
+	if len(real) != len(dry) {
+		t.Fatalf("dry run span tree = %v, want %v", dry, real)
+	}
+	for i := range real {
+		if real[i] != dry[i] {
+			t.Fatalf("dry run span tree = %v, want %v", dry, real)
+		}
+	}
+}
+
+func TestDryRunSpansAreStamped(t *testing.T) {
+	withoutFaults(t)
+	DRY_RUN_LATENCY = 0
+
+	for _, s := range putWithRecorder(t, true, &fakeUploader{}) {
+		if s.Name() == "handler" {
+			continue
+		}
+		stamped := false
+		for _, a := range s.Attributes() {
+			if a.Key == "dry_run" && a.Value.AsBool() {
+				stamped = true
+			}
+		}
+		if !stamped {
+			t.Errorf("span %q is not stamped as dry run", s.Name())
+		}
+	}
+}
+
+func TestDryRunDoesNotCloseBreaker(t *testing.T) {
+	withoutFaults(t)
+	DRY_RUN_LATENCY = 0
+
+	previousStorage, previousBreaker := storage, breaker
+	t.Cleanup(func() { storage, breaker = previousStorage, previousBreaker })
+
+	tests := []struct {
+		name      string
+		dryRun    bool
+		wantState circuitBreakerState
+	}{
+		{
+			name:      "dry run leaves the breaker open",
+			dryRun:    true,
+			wantState: circuitBreakerStateOpen,
+		},
+		{
+			name:      "real run closes the breaker",
+			dryRun:    false,
+			wantState: circuitBreakerStateClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage = newS3Storage(&fakeUploader{}, nil, s3manager.DefaultUploadPartSize)
+
+			var now *time.Time
+			breaker, now = newTestCircuitBreaker(1, time.Second)
+			span := trace.SpanFromContext(context.Background())
+			breaker.recordFailure(span)
+			*now = now.Add(time.Second)
+
+			ctx := context.Background()
+			if tt.dryRun {
+				ctx = context.WithValue(ctx, dryRunContextKey{}, true)
+			}
+			if _, err := storeObject(ctx, span, "bucket", "2026/01/01/id", []byte(`{}`), false); err != nil {
+				t.Fatalf("storeObject() error = %v", err)
+			}
+
+			if breaker.state != tt.wantState {
+				t.Errorf("breaker state = %v, want %v", breaker.state, tt.wantState)
+			}
+		})
+	}
+}
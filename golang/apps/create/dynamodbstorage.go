@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	STORAGE_BACKEND_DYNAMODB = "dynamodb"
+)
+
+// dynamoDBStorage writes the objects as items of a DynamoDB table keyed by
+// the object key. The bucket is kept on the item, so that objects of
+// different tenants can still be told apart.
+type dynamoDBStorage struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+}
+
+func newDynamoDBStorage(
+	client dynamodbiface.DynamoDBAPI,
+	table string,
+) *dynamoDBStorage {
+	return &dynamoDBStorage{
+		client: client,
+		table:  table,
+	}
+}
+
+func (s *dynamoDBStorage) Put(
+	ctx context.Context,
+	key string,
+	body []byte,
+	metadata commons.PutMetadata,
+) (
+	commons.PutResult,
+	error,
+) {
+	parentSpan := trace.SpanFromContext(ctx)
+
+	// Start DynamoDB put item span
+	ctx, span := startDynamoDBSpan(ctx, parentSpan, "PutItem", s.table)
+	defer span.End()
+	span.SetAttributes(attribute.String("aws.s3.key", key))
+
+	// Leave time to answer and to flush telemetry before Lambda times out
+	ctx, cancel := withS3Deadline(ctx, span)
+	defer cancel()
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"key":       {S: aws.String(key)},
+			"bucket":    {S: aws.String(metadata.Bucket)},
+			"createdAt": {S: aws.String(time.Now().UTC().Format(time.RFC3339Nano))},
+			"payload":   {S: aws.String(string(body))},
+		},
+	}
+	if metadata.CreateOnly {
+		input.ConditionExpression = aws.String("attribute_not_exists(#key)")
+		input.ExpressionAttributeNames = map[string]*string{
+			"#key": aws.String("key"),
+		}
+	}
+
+	// Dry runs only simulate the write
+	var err error
+	if isDryRun(ctx) {
+		_, err = simulateUpload(ctx, false)
+	} else {
+		_, err = s.client.PutItemWithContext(ctx, input)
+	}
+
+	if isConditionalCheckFailed(err) {
+		span.SetAttributes(attribute.String("error.type", "precondition_failed"))
+		return commons.PutResult{}, errPreconditionFailed
+	}
+
+	if err != nil && ctx.Err() != nil {
+		return commons.PutResult{}, recordCanceledWrite(ctx, span, err)
+	}
+
+	if err != nil {
+		recordDynamoDBError(span, err)
+		return commons.PutResult{}, newStoreError(err)
+	}
+	return commons.PutResult{
+		Checksum: checksumSHA256(body),
+	}, nil
+}
+
+func startDynamoDBSpan(
+	ctx context.Context,
+	parentSpan trace.Span,
+	operation string,
+	table string,
+) (
+	context.Context,
+	trace.Span,
+) {
+	// Start DynamoDB span
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "DynamoDB."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes([]attribute.KeyValue{
+				semconv.NetTransportTCP,
+				semconv.DBSystemDynamoDB,
+				semconv.DBOperation(operation),
+				semconv.AWSDynamoDBTableNames(table),
+			}...))
+}
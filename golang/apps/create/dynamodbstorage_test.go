@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+// fakeObjectTable keeps the items by their object key and enforces the
+// create-only condition like DynamoDB would.
+type fakeObjectTable struct {
+	dynamodbiface.DynamoDBAPI
+
+	mutex sync.Mutex
+	calls int
+	err   error
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (f *fakeObjectTable) PutItemWithContext(
+	_ aws.Context,
+	input *dynamodb.PutItemInput,
+	_ ...request.Option,
+) (
+	*dynamodb.PutItemOutput,
+	error,
+) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	key := aws.StringValue(input.Item["key"].S)
+	if _, ok := f.items[key]; ok && input.ConditionExpression != nil {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	f.items[key] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func TestDynamoDBStoragePut(t *testing.T) {
+	withoutFaults(t)
+	DRY_RUN_LATENCY = 0
+
+	errThrottled := awserr.NewRequestFailure(awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "The level of configured provisioned throughput for the table was exceeded", nil), 400, "")
+
+	tests := []struct {
+		name       string
+		existing   bool
+		createOnly bool
+		dryRun     bool
+		clientErr  error
+		wantErr    error
+		wantKind   StoreErrorKind
+		wantCalls  int
+	}{
+		{
+			name:      "stored",
+			wantCalls: 1,
+		},
+		{
+			name:       "object exists",
+			existing:   true,
+			createOnly: true,
+			wantErr:    errPreconditionFailed,
+			wantCalls:  1,
+		},
+		{
+			name:      "overwritten",
+			existing:  true,
+			wantCalls: 1,
+		},
+		{
+			name:      "throttled",
+			clientErr: errThrottled,
+			wantKind:  STORE_ERROR_KIND_THROTTLED,
+			wantCalls: 1,
+		},
+		{
+			name:      "dry run",
+			dryRun:    true,
+			wantCalls: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &fakeObjectTable{
+				err:   tt.clientErr,
+				items: map[string]map[string]*dynamodb.AttributeValue{},
+			}
+			if tt.existing {
+				table.items["2026/01/01/id"] = map[string]*dynamodb.AttributeValue{}
+			}
+
+			tp, _ := newRecordingTracerProvider()
+			ctx := context.Background()
+			if tt.dryRun {
+				ctx = context.WithValue(ctx, dryRunContextKey{}, true)
+			}
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(ctx, "handler")
+			defer span.End()
+
+			storage := newDynamoDBStorage(table, "objects")
+			result, err := storage.Put(ctx, "2026/01/01/id", []byte(`{"item":"x"}`), commons.PutMetadata{
+				Bucket:     "bucket",
+				CreateOnly: tt.createOnly,
+			})
+
+			if table.calls != tt.wantCalls {
+				t.Errorf("PutItem called %d times, want %d", table.calls, tt.wantCalls)
+			}
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Put() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantKind != "":
+				var storeErr *StoreError
+				if !errors.As(err, &storeErr) || storeErr.Kind != tt.wantKind {
+					t.Errorf("Put() error = %v, want store error of kind %q", err, tt.wantKind)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+				if result.Checksum != checksumSHA256([]byte(`{"item":"x"}`)) {
+					t.Errorf("Put() checksum = %q", result.Checksum)
+				}
+				if tt.dryRun {
+					return
+				}
+				item := table.items["2026/01/01/id"]
+				if got := aws.StringValue(item["payload"].S); got != `{"item":"x"}` {
+					t.Errorf("payload = %q", got)
+				}
+				if got := aws.StringValue(item["bucket"].S); got != "bucket" {
+					t.Errorf("bucket = %q, want %q", got, "bucket")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	METRICS_BACKEND_OTLP = "otlp"
+	METRICS_BACKEND_EMF  = "emf"
+
+	DEFAULT_EMF_NAMESPACE = "MonitoringLambdaWithOpenTelemetry"
+
+	EMF_METRIC_REQUESTS            = "lambda.requests"
+	EMF_METRIC_STORAGE_PUT_LATENCY = "storage.put.duration_ms"
+)
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// emfEmitter writes metrics in the CloudWatch Embedded Metric Format. The
+// Lambda runtime ships every line on stdout to CloudWatch Logs which
+// extracts the metrics, so no collector is needed. Each line carries the
+// trace id, so that the log can be correlated with the trace.
+type emfEmitter struct {
+	mutex     sync.Mutex
+	writer    io.Writer
+	namespace string
+	now       func() time.Time
+}
+
+func newEMFEmitter(
+	writer io.Writer,
+	namespace string,
+) *emfEmitter {
+	if namespace == "" {
+		namespace = DEFAULT_EMF_NAMESPACE
+	}
+	return &emfEmitter{
+		writer:    writer,
+		namespace: namespace,
+		now:       time.Now,
+	}
+}
+
+// emit writes a single metric with the given dimensions as one line.
+func (e *emfEmitter) emit(
+	span trace.Span,
+	name string,
+	unit string,
+	value float64,
+	dimensions map[string]string,
+) {
+	dimensionKeys := []string{"service.name"}
+	record := map[string]interface{}{
+		"service.name": OTEL_SERVICE_NAME,
+		name:           value,
+	}
+	for key, dimension := range dimensions {
+		dimensionKeys = append(dimensionKeys, key)
+		record[key] = dimension
+	}
+	if spanContext := span.SpanContext(); spanContext.IsValid() {
+		record["trace_id"] = spanContext.TraceID().String()
+	}
+
+	record["_aws"] = emfMetadata{
+		Timestamp: e.now().UnixMilli(),
+		CloudWatchMetrics: []emfDirective{{
+			Namespace:  e.namespace,
+			Dimensions: [][]string{dimensionKeys},
+			Metrics: []emfMetricDefinition{{
+				Name: name,
+				Unit: unit,
+			}},
+		}},
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		logger.error("Creating EMF record is failed.", "metric", name, "error", err)
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.writer.Write(append(line, '\n'))
+}
+
+// recordRequestEMF counts an answered request by its status code.
+func recordRequestEMF(
+	span trace.Span,
+	statusCode int,
+) {
+	if emfMetrics == nil {
+		return
+	}
+
+	emfMetrics.emit(span, EMF_METRIC_REQUESTS, "Count", 1, map[string]string{
+		"status_code": strconv.Itoa(statusCode),
+	})
+}
+
+// recordStoragePutLatencyEMF records how long writing an object to the
+// storage backend has taken.
+func recordStoragePutLatencyEMF(
+	span trace.Span,
+	duration time.Duration,
+) {
+	if emfMetrics == nil {
+		return
+	}
+
+	emfMetrics.emit(span, EMF_METRIC_STORAGE_PUT_LATENCY, "Milliseconds", float64(duration)/float64(time.Millisecond), map[string]string{
+		"storage.backend": STORAGE_BACKEND,
+	})
+}
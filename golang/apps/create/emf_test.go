@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestEMFMetrics(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		namespace     string
+		record        func(ctx context.Context)
+		wantNamespace string
+		wantMetric    string
+		wantUnit      string
+		wantValue     float64
+		wantDimension [2]string
+	}{
+		{
+			name:      "request",
+			namespace: "",
+			record: func(ctx context.Context) {
+				recordRequestEMF(trace.SpanFromContext(ctx), 201)
+			},
+			wantNamespace: DEFAULT_EMF_NAMESPACE,
+			wantMetric:    EMF_METRIC_REQUESTS,
+			wantUnit:      "Count",
+			wantValue:     1,
+			wantDimension: [2]string{"status_code", "201"},
+		},
+		{
+			name:      "storage put latency",
+			namespace: "Objects",
+			record: func(ctx context.Context) {
+				recordStoragePutLatencyEMF(trace.SpanFromContext(ctx), 1500*time.Microsecond)
+			},
+			wantNamespace: "Objects",
+			wantMetric:    EMF_METRIC_STORAGE_PUT_LATENCY,
+			wantUnit:      "Milliseconds",
+			wantValue:     1.5,
+			wantDimension: [2]string{"storage.backend", STORAGE_BACKEND_S3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousEMF, previousService, previousBackend := emfMetrics, OTEL_SERVICE_NAME, STORAGE_BACKEND
+			t.Cleanup(func() { emfMetrics, OTEL_SERVICE_NAME, STORAGE_BACKEND = previousEMF, previousService, previousBackend })
+			OTEL_SERVICE_NAME = "create"
+			STORAGE_BACKEND = STORAGE_BACKEND_S3
+
+			var buf bytes.Buffer
+			emfMetrics = newEMFEmitter(&buf, tt.namespace)
+			emfMetrics.now = func() time.Time { return now }
+
+			tp, _ := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "main.handler")
+			tt.record(ctx)
+			span.End()
+
+			var line struct {
+				ServiceName string      `json:"service.name"`
+				TraceID     string      `json:"trace_id"`
+				AWS         emfMetadata `json:"_aws"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("decoding %q: %v", buf.String(), err)
+			}
+			var record map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("decoding %q: %v", buf.String(), err)
+			}
+
+			if line.ServiceName != "create" {
+				t.Errorf("service.name = %q, want %q", line.ServiceName, "create")
+			}
+			if line.TraceID != span.SpanContext().TraceID().String() {
+				t.Errorf("trace_id = %q, want %q", line.TraceID, span.SpanContext().TraceID())
+			}
+			if record[tt.wantMetric] != tt.wantValue {
+				t.Errorf("%s = %v, want %v", tt.wantMetric, record[tt.wantMetric], tt.wantValue)
+			}
+			if record[tt.wantDimension[0]] != tt.wantDimension[1] {
+				t.Errorf("%s = %v, want %q", tt.wantDimension[0], record[tt.wantDimension[0]], tt.wantDimension[1])
+			}
+
+			want := emfMetadata{
+				Timestamp: now.UnixMilli(),
+				CloudWatchMetrics: []emfDirective{{
+					Namespace:  tt.wantNamespace,
+					Dimensions: [][]string{{"service.name", tt.wantDimension[0]}},
+					Metrics:    []emfMetricDefinition{{Name: tt.wantMetric, Unit: tt.wantUnit}},
+				}},
+			}
+			if !reflect.DeepEqual(line.AWS, want) {
+				t.Errorf("_aws = %+v, want %+v", line.AWS, want)
+			}
+		})
+	}
+}
+
+func TestEMFMetricsDisabled(t *testing.T) {
+	previous := emfMetrics
+	t.Cleanup(func() { emfMetrics = previous })
+	emfMetrics = nil
+
+	tp, _ := newRecordingTracerProvider()
+	_, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "main.handler")
+	defer span.End()
+
+	// Nothing to write to, the calls must not panic
+	recordRequestEMF(span, 200)
+	recordStoragePutLatencyEMF(span, time.Millisecond)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/url"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// s3Credentials returns the credentials of the target role for
+// cross-account uploads or the credentials for local endpoints such as
+// LocalStack. AWS_S3_ANONYMOUS=true sends unsigned requests and
+// AWS_S3_ACCESS_KEY_ID with AWS_S3_SECRET_ACCESS_KEY sets static keys.
+// Without these variables, the default credential chain is used.
+func s3Credentials() *credentials.Credentials {
+	if targetRoleCredentials != nil {
+		return targetRoleCredentials
+	}
+
+	if os.Getenv("AWS_S3_ANONYMOUS") == "true" {
+		logger.info("Using anonymous S3 credentials.")
+		return credentials.AnonymousCredentials
+	}
+
+	accessKeyID := os.Getenv("AWS_S3_ACCESS_KEY_ID")
+	if accessKeyID != "" {
+		logger.info("Using static S3 credentials.", "accessKeyId", accessKeyID)
+		return credentials.NewStaticCredentials(
+			accessKeyID,
+			os.Getenv("AWS_S3_SECRET_ACCESS_KEY"),
+			"",
+		)
+	}
+	return nil
+}
+
+// s3ServerAddress returns the host which the requests for the given bucket
+// are sent to. Virtual hosted requests prefix the bucket to the host, path
+// style requests carry it in the path.
+func s3ServerAddress(
+	bucket string,
+) string {
+	host := "s3." + AWS_REGION + ".amazonaws.com"
+	if ap, _, err := parseAccessPoint(bucket); ap != nil && err == nil && S3_ENDPOINT == "" {
+		return accessPointHost(ap)
+	}
+	if isDirectoryBucket(bucket) && S3_ENDPOINT == "" {
+		host = directoryBucketHost(bucket)
+	}
+	if S3_ENDPOINT != "" {
+		endpoint, err := url.Parse(S3_ENDPOINT)
+		if err == nil && endpoint.Hostname() != "" {
+			host = endpoint.Hostname()
+		}
+	}
+
+	if S3_FORCE_PATH_STYLE || bucket == "" {
+		return host
+	}
+	return bucket + "." + host
+}
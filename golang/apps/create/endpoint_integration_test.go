@@ -0,0 +1,73 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+func TestS3StoragePutOnLocalEndpoint(t *testing.T) {
+	tests := []struct {
+		name            string
+		anonymous       string
+		accessKeyID     string
+		secretAccessKey string
+	}{
+		{
+			name:            "static credentials",
+			accessKeyID:     "test",
+			secretAccessKey: "test",
+		},
+		{
+			name:      "anonymous credentials",
+			anonymous: "true",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_S3_ANONYMOUS", tt.anonymous)
+			t.Setenv("AWS_S3_ACCESS_KEY_ID", tt.accessKeyID)
+			t.Setenv("AWS_S3_SECRET_ACCESS_KEY", tt.secretAccessKey)
+			bucket := withLocalEndpoint(t)
+			withoutFaults(t)
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, parentSpan := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+
+			key := "2026/01/01/local"
+			body := []byte(`{"item":"local"}`)
+			storage := newS3Storage(newS3Uploader(s3Client), s3Client, s3manager.DefaultUploadPartSize)
+			_, err := storage.Put(ctx, key, body, commons.PutMetadata{Bucket: bucket})
+			parentSpan.End()
+			if err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+
+			if got := getLocalObject(t, bucket, key); string(got) != string(body) {
+				t.Errorf("stored object = %s, want %s", got, body)
+			}
+
+			// The span names the effective endpoint
+			endpoint, _ := url.Parse(os.Getenv("AWS_S3_ENDPOINT"))
+			wantAddress := endpoint.Hostname()
+			if !S3_FORCE_PATH_STYLE {
+				wantAddress = bucket + "." + wantAddress
+			}
+			for _, span := range recorder.Ended() {
+				if span.Name() != "S3.PutObject" {
+					continue
+				}
+				if got := spanAttribute(span, "server.address").AsString(); got != wantAddress {
+					t.Errorf("server.address = %q, want %q", got, wantAddress)
+				}
+			}
+		})
+	}
+}
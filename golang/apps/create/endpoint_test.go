@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestS3Credentials(t *testing.T) {
+	tests := []struct {
+		name            string
+		anonymous       string
+		accessKeyID     string
+		secretAccessKey string
+		wantNil         bool
+		wantAnonymous   bool
+		wantAccessKeyID string
+	}{
+		{
+			name:    "default chain",
+			wantNil: true,
+		},
+		{
+			name:          "anonymous",
+			anonymous:     "true",
+			wantAnonymous: true,
+		},
+		{
+			name:            "static keys",
+			accessKeyID:     "test",
+			secretAccessKey: "secret",
+			wantAccessKeyID: "test",
+		},
+		{
+			name:            "anonymous wins over static keys",
+			anonymous:       "true",
+			accessKeyID:     "test",
+			secretAccessKey: "secret",
+			wantAnonymous:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_S3_ANONYMOUS", tt.anonymous)
+			t.Setenv("AWS_S3_ACCESS_KEY_ID", tt.accessKeyID)
+			t.Setenv("AWS_S3_SECRET_ACCESS_KEY", tt.secretAccessKey)
+
+			creds := s3Credentials()
+			if (creds == nil) != tt.wantNil {
+				t.Fatalf("s3Credentials() = %v, want nil %v", creds, tt.wantNil)
+			}
+			if creds == nil {
+				return
+			}
+			if (creds == credentials.AnonymousCredentials) != tt.wantAnonymous {
+				t.Errorf("s3Credentials() anonymous = %v, want %v", creds == credentials.AnonymousCredentials, tt.wantAnonymous)
+			}
+			if tt.wantAnonymous {
+				return
+			}
+
+			value, err := creds.Get()
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if value.AccessKeyID != tt.wantAccessKeyID || value.SecretAccessKey != tt.secretAccessKey || value.SessionToken != "" {
+				t.Errorf("Get() = %s/%s/%s, want %s/%s without token", value.AccessKeyID, value.SecretAccessKey, value.SessionToken, tt.wantAccessKeyID, tt.secretAccessKey)
+			}
+		})
+	}
+}
+
+func TestS3ServerAddress(t *testing.T) {
+	previousRegion, previousEndpoint, previousPathStyle := AWS_REGION, S3_ENDPOINT, S3_FORCE_PATH_STYLE
+	t.Cleanup(func() {
+		AWS_REGION, S3_ENDPOINT, S3_FORCE_PATH_STYLE = previousRegion, previousEndpoint, previousPathStyle
+	})
+	AWS_REGION = "eu-west-1"
+
+	accessPointARN := "arn:aws:s3:us-east-1:123456789012:accesspoint/ap"
+
+	tests := []struct {
+		name      string
+		bucket    string
+		endpoint  string
+		pathStyle bool
+		want      string
+	}{
+		{
+			name:   "virtual hosted",
+			bucket: "bucket",
+			want:   "bucket.s3.eu-west-1.amazonaws.com",
+		},
+		{
+			name:      "path style",
+			bucket:    "bucket",
+			pathStyle: true,
+			want:      "s3.eu-west-1.amazonaws.com",
+		},
+		{
+			name:      "custom endpoint with path style",
+			bucket:    "bucket",
+			endpoint:  "http://localhost:4566",
+			pathStyle: true,
+			want:      "localhost",
+		},
+		{
+			name:     "custom endpoint virtual hosted",
+			bucket:   "bucket",
+			endpoint: "http://localhost.localstack.cloud:4566",
+			want:     "bucket.localhost.localstack.cloud",
+		},
+		{
+			name:   "directory bucket",
+			bucket: "bucket--euw1-az1--x-s3",
+			want:   "bucket--euw1-az1--x-s3.s3express-euw1-az1.eu-west-1.amazonaws.com",
+		},
+		{
+			name:   "access point",
+			bucket: accessPointARN,
+			want:   "ap-123456789012.s3-accesspoint.us-east-1.amazonaws.com",
+		},
+		{
+			name:      "access point on a custom endpoint",
+			bucket:    accessPointARN,
+			endpoint:  "http://localhost:4566",
+			pathStyle: true,
+			want:      "localhost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S3_ENDPOINT = tt.endpoint
+			S3_FORCE_PATH_STYLE = tt.pathStyle
+
+			if got := s3ServerAddress(tt.bucket); got != tt.want {
+				t.Errorf("s3ServerAddress(%q) = %q, want %q", tt.bucket, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// eventHandler dispatches HTTP events according to their shape. Scheduled
+// warmer payloads are answered right away. ALB events carry the target
+// group within their request context and Function URL events are
+// recognized by their lambda-url domain. Otherwise, API Gateway HTTP APIs
+// send the payload format version 2.0 and REST APIs send 1.0.
+func eventHandler(
+	ctx context.Context,
+	payload json.RawMessage,
+) (
+	interface{},
+	error,
+) {
+	shape := struct {
+		Warmer         bool   `json:"warmer"`
+		Version        string `json:"version"`
+		RequestContext struct {
+			ELB        json.RawMessage `json:"elb"`
+			DomainName string          `json:"domainName"`
+		} `json:"requestContext"`
+	}{}
+	if err := json.Unmarshal(payload, &shape); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case shape.Warmer:
+		return handleWarmer(ctx), nil
+
+	case len(shape.RequestContext.ELB) > 0:
+		req := events.ALBTargetGroupRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		return albHandler(ctx, req)
+
+	case strings.Contains(shape.RequestContext.DomainName, ".lambda-url."):
+		req := events.LambdaFunctionURLRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		return functionURLHandler(ctx, req)
+
+	case shape.Version == "2.0":
+		req := events.APIGatewayV2HTTPRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		return apiGatewayV2Handler(ctx, req)
+
+	default:
+		req := events.APIGatewayProxyRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestEventHandler(t *testing.T) {
+	withHealthyConfig(t)
+
+	tests := []struct {
+		name     string
+		payload  string
+		wantType interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "warmer",
+			payload:  `{"warmer":true}`,
+			wantType: &WarmerResponse{},
+		},
+		{
+			name:     "ALB",
+			payload:  `{"httpMethod":"GET","path":"/health","requestContext":{"elb":{"targetGroupArn":"arn"}}}`,
+			wantType: events.ALBTargetGroupResponse{},
+		},
+		{
+			name:     "Function URL",
+			payload:  `{"version":"2.0","rawPath":"/health","requestContext":{"domainName":"abc.lambda-url.eu-west-1.on.aws","http":{"method":"GET","path":"/health"}}}`,
+			wantType: events.LambdaFunctionURLResponse{},
+		},
+		{
+			name:     "HTTP API",
+			payload:  `{"version":"2.0","routeKey":"GET /health","rawPath":"/health","requestContext":{"domainName":"abc.execute-api.eu-west-1.amazonaws.com","http":{"method":"GET","path":"/health"}}}`,
+			wantType: events.APIGatewayV2HTTPResponse{},
+		},
+		{
+			name:     "REST API",
+			payload:  `{"httpMethod":"GET","path":"/health","resource":"/health"}`,
+			wantType: events.APIGatewayProxyResponse{},
+		},
+		{
+			name:    "malformed payload",
+			payload: `{`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := eventHandler(context.Background(), json.RawMessage(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("eventHandler() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if reflect.TypeOf(res) != reflect.TypeOf(tt.wantType) {
+				t.Errorf("eventHandler() response = %T, want %T", res, tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	DIRECTORY_BUCKET_SUFFIX        = "--x-s3"
+	DIRECTORY_BUCKET_STORAGE_CLASS = "EXPRESS_ONEZONE"
+	DIRECTORY_BUCKET_MAX_KEY_BYTES = 1024
+)
+
+var (
+	errInvalidDirectoryBucketKey = errors.New("object key is not valid for a directory bucket")
+)
+
+// isDirectoryBucket reports whether the bucket is an S3 Express One Zone
+// directory bucket of the form <name>--<zone id>--x-s3.
+func isDirectoryBucket(
+	bucket string,
+) bool {
+	return directoryBucketZone(bucket) != ""
+}
+
+// directoryBucketZone returns the availability zone id of a directory
+// bucket, e.g. use1-az4, or an empty string for general purpose buckets.
+func directoryBucketZone(
+	bucket string,
+) string {
+	name, ok := strings.CutSuffix(bucket, DIRECTORY_BUCKET_SUFFIX)
+	if !ok {
+		return ""
+	}
+
+	i := strings.LastIndex(name, "--")
+	if i <= 0 {
+		return ""
+	}
+	return name[i+2:]
+}
+
+// validateDirectoryBucketKey checks the key against the naming constraints
+// of directory buckets. The slash is their only delimiter and is mapped to
+// directories, so keys must not start or end with one and must not have
+// empty, "." or ".." segments.
+func validateDirectoryBucketKey(
+	key string,
+) error {
+	if key == "" || len(key) > DIRECTORY_BUCKET_MAX_KEY_BYTES || !utf8.ValidString(key) {
+		return errInvalidDirectoryBucketKey
+	}
+
+	if strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return errInvalidDirectoryBucketKey
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return errInvalidDirectoryBucketKey
+		}
+	}
+	return nil
+}
+
+// storageClassAttributes tells writes into directory buckets apart from
+// the ones into general purpose buckets, so that their latencies can be
+// compared on the same dashboard.
+func storageClassAttributes(
+	bucket string,
+) []attribute.KeyValue {
+	if !isDirectoryBucket(bucket) {
+		return []attribute.KeyValue{
+			attribute.Bool("aws.s3.express", false),
+		}
+	}
+
+	return []attribute.KeyValue{
+		attribute.Bool("aws.s3.express", true),
+		attribute.String("aws.s3.storage_class", DIRECTORY_BUCKET_STORAGE_CLASS),
+		attribute.String("aws.s3.zone_id", directoryBucketZone(bucket)),
+	}
+}
+
+// directoryBucketHost returns the zonal endpoint host of a directory
+// bucket.
+func directoryBucketHost(
+	bucket string,
+) string {
+	return "s3express-" + directoryBucketZone(bucket) + "." + AWS_REGION + ".amazonaws.com"
+}
@@ -0,0 +1,60 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestS3StoragePutExpressBucket writes into a real directory bucket with
+// the credentials of the environment. Run it with
+//
+//	EXPRESS_S3_BUCKET_NAME=<name>--<zone id>--x-s3 AWS_REGION=<region> go test -tags integration -run Express .
+func TestS3StoragePutExpressBucket(t *testing.T) {
+	bucket := os.Getenv("EXPRESS_S3_BUCKET_NAME")
+	if bucket == "" {
+		t.Skip("EXPRESS_S3_BUCKET_NAME is not set")
+	}
+	if !isDirectoryBucket(bucket) {
+		t.Fatalf("%q is not a directory bucket", bucket)
+	}
+
+	withoutFaults(t)
+
+	previousRegion, previousClient, previousSessions := AWS_REGION, s3Client, expressSessions
+	t.Cleanup(func() { AWS_REGION, s3Client, expressSessions = previousRegion, previousClient, previousSessions })
+	AWS_REGION = os.Getenv("AWS_REGION")
+	s3Client = s3.New(session.Must(session.NewSession()), aws.NewConfig().WithRegion(AWS_REGION))
+	expressSessions = newExpressSessionCache(createExpressSession)
+
+	key := commons.BuildObjectKey("integration", time.Now(), strconv.FormatInt(time.Now().UnixNano(), 10))
+	storage := newS3Storage(newS3Uploader(s3Client), s3Client, s3manager.MinUploadPartSize)
+	_, err := storage.Put(context.Background(), key, []byte(`{"item":"integration"}`), commons.PutMetadata{Bucket: bucket})
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	// Clean up with the cached session
+	opts, err := expressSessions.requestOptions(context.Background(), trace.SpanFromContext(context.Background()), bucket)
+	if err != nil {
+		t.Fatalf("requestOptions() error = %v", err)
+	}
+	_, err = s3Client.DeleteObjectWithContext(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, opts...)
+	if err != nil {
+		t.Errorf("DeleteObject() error = %v", err)
+	}
+}
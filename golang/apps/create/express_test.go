@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+func TestDirectoryBucketZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		bucket   string
+		wantZone string
+	}{
+		{
+			name:     "directory bucket",
+			bucket:   "bucket--use1-az4--x-s3",
+			wantZone: "use1-az4",
+		},
+		{
+			name:     "dashes in the name",
+			bucket:   "my--bucket--euw1-az1--x-s3",
+			wantZone: "euw1-az1",
+		},
+		{
+			name:   "general purpose bucket",
+			bucket: "bucket",
+		},
+		{
+			name:   "suffix without zone",
+			bucket: "bucket--x-s3",
+		},
+		{
+			name:   "zone without name",
+			bucket: "--use1-az4--x-s3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := directoryBucketZone(tt.bucket); got != tt.wantZone {
+				t.Errorf("directoryBucketZone(%q) = %q, want %q", tt.bucket, got, tt.wantZone)
+			}
+			if got := isDirectoryBucket(tt.bucket); got != (tt.wantZone != "") {
+				t.Errorf("isDirectoryBucket(%q) = %v, want %v", tt.bucket, got, tt.wantZone != "")
+			}
+		})
+	}
+}
+
+func TestValidateDirectoryBucketKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "partitioned key", key: "2026/01/01/id"},
+		{name: "single segment", key: "id"},
+		{name: "empty", key: "", wantErr: true},
+		{name: "leading slash", key: "/2026/01/01/id", wantErr: true},
+		{name: "trailing slash", key: "2026/01/01/", wantErr: true},
+		{name: "empty segment", key: "2026//01/id", wantErr: true},
+		{name: "dot segment", key: "2026/./id", wantErr: true},
+		{name: "dot dot segment", key: "2026/../id", wantErr: true},
+		{name: "invalid UTF-8", key: "id\xff", wantErr: true},
+		{name: "longest key", key: strings.Repeat("a", DIRECTORY_BUCKET_MAX_KEY_BYTES)},
+		{name: "too long", key: strings.Repeat("a", DIRECTORY_BUCKET_MAX_KEY_BYTES+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDirectoryBucketKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateDirectoryBucketKey(%q) error = %v, want error %v", tt.key, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStorageClassAttributes(t *testing.T) {
+	tests := []struct {
+		name             string
+		bucket           string
+		wantExpress      bool
+		wantStorageClass string
+		wantZone         string
+	}{
+		{
+			name:             "directory bucket",
+			bucket:           "bucket--use1-az4--x-s3",
+			wantExpress:      true,
+			wantStorageClass: DIRECTORY_BUCKET_STORAGE_CLASS,
+			wantZone:         "use1-az4",
+		},
+		{
+			name:   "general purpose bucket",
+			bucket: "bucket",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attributes := map[string]string{}
+			express := false
+			for _, kv := range storageClassAttributes(tt.bucket) {
+				if kv.Key == "aws.s3.express" {
+					express = kv.Value.AsBool()
+					continue
+				}
+				attributes[string(kv.Key)] = kv.Value.AsString()
+			}
+
+			if express != tt.wantExpress {
+				t.Errorf("aws.s3.express = %v, want %v", express, tt.wantExpress)
+			}
+			if got := attributes["aws.s3.storage_class"]; got != tt.wantStorageClass {
+				t.Errorf("aws.s3.storage_class = %q, want %q", got, tt.wantStorageClass)
+			}
+			if got := attributes["aws.s3.zone_id"]; got != tt.wantZone {
+				t.Errorf("aws.s3.zone_id = %q, want %q", got, tt.wantZone)
+			}
+		})
+	}
+}
+
+func TestStoreBatchItemDirectoryBucketKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		bucket      string
+		prefix      string
+		wantStatus  int
+		wantUploads int32
+	}{
+		{
+			name:        "valid key",
+			bucket:      testDirectoryBucket,
+			prefix:      "objects",
+			wantStatus:  201,
+			wantUploads: 1,
+		},
+		{
+			name:        "empty segment",
+			bucket:      testDirectoryBucket,
+			prefix:      "objects/",
+			wantStatus:  400,
+			wantUploads: 0,
+		},
+		{
+			name:        "general purpose bucket",
+			bucket:      "bucket",
+			prefix:      "objects/",
+			wantStatus:  201,
+			wantUploads: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withoutFaults(t)
+			scripted := withScriptedStorage(t, func(key string, body []byte, metadata commons.PutMetadata) (commons.PutResult, error) {
+				return commons.PutResult{Bucket: metadata.Bucket}, nil
+			})
+
+			previousBackend, previousPrefix := STORAGE_BACKEND, OBJECT_KEY_PREFIX
+			t.Cleanup(func() { STORAGE_BACKEND, OBJECT_KEY_PREFIX = previousBackend, previousPrefix })
+			STORAGE_BACKEND = STORAGE_BACKEND_S3
+			OBJECT_KEY_PREFIX = tt.prefix
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+			response := createBatchItem(ctx, span, tt.bucket, 0, &CustomObject{Item: "a"})
+			span.End()
+
+			if response.Status != tt.wantStatus {
+				t.Errorf("item status = %d, want %d: %s", response.Status, tt.wantStatus, response.Error)
+			}
+			if scripted.calls != tt.wantUploads {
+				t.Errorf("Put() called %d times, want %d", scripted.calls, tt.wantUploads)
+			}
+
+			itemSpan := recorder.Ended()[0]
+			if got := spanAttribute(itemSpan, "http.status_code").AsInt64(); got != int64(tt.wantStatus) {
+				t.Errorf("item span http.status_code = %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
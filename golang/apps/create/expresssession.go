@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	EXPRESS_SESSION_SIGNING_NAME = "s3express"
+	EXPRESS_SESSION_TOKEN_HEADER = "X-Amz-S3session-Token"
+
+	// Sessions are valid for 5 minutes, they are renewed a minute before
+	// they expire so that a running upload is not cut off
+	EXPRESS_SESSION_TTL            = 5 * time.Minute
+	EXPRESS_SESSION_REFRESH_WINDOW = time.Minute
+)
+
+var (
+	errMissingExpressSessionCredentials = errors.New("session of the directory bucket has no credentials")
+
+	expressSessions = newExpressSessionCache(createExpressSession)
+)
+
+// expressSession holds the temporary credentials which authorize the
+// requests to one directory bucket.
+type expressSession struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	expiresAt       time.Time
+}
+
+// expressSessionCreator creates a session for a directory bucket, so that
+// the CreateSession call can be replaced without talking to AWS.
+type expressSessionCreator func(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+) (
+	*expressSession,
+	error,
+)
+
+// expressSessionCache keeps the sessions of the directory buckets per
+// bucket. Like the dedupe cache, it lives in a package variable so that
+// the sessions outlive a single invocation. Creating a session holds the
+// lock, concurrent writes into the same bucket wait for the one session
+// instead of each creating their own.
+type expressSessionCache struct {
+	mutex    sync.Mutex
+	sessions map[string]*expressSession
+	create   expressSessionCreator
+	now      func() time.Time
+}
+
+func newExpressSessionCache(
+	create expressSessionCreator,
+) *expressSessionCache {
+	return &expressSessionCache{
+		sessions: map[string]*expressSession{},
+		create:   create,
+		now:      time.Now,
+	}
+}
+
+// get returns the session of the bucket and whether it has been cached. A
+// session which is about to expire is replaced by a new one.
+func (c *expressSessionCache) get(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+) (
+	*expressSession,
+	bool,
+	error,
+) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	session, ok := c.sessions[bucket]
+	if ok && c.now().Add(EXPRESS_SESSION_REFRESH_WINDOW).Before(session.expiresAt) {
+		return session, true, nil
+	}
+
+	session, err := c.create(ctx, parentSpan, bucket)
+	if err != nil {
+		delete(c.sessions, bucket)
+		return nil, false, err
+	}
+	c.sessions[bucket] = session
+	return session, false, nil
+}
+
+// requestOptions authorizes the requests to a directory bucket with its
+// session. They are signed for s3express with the session keys and carry
+// the session token in their own header instead of the security token.
+func (c *expressSessionCache) requestOptions(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+) (
+	[]request.Option,
+	error,
+) {
+	session, cached, err := c.get(ctx, parentSpan, bucket)
+	if err != nil {
+		return nil, err
+	}
+	parentSpan.SetAttributes(attribute.Bool("aws.s3.express.session.cached", cached))
+
+	return []request.Option{
+		func(r *request.Request) {
+			r.Config.Credentials = credentials.NewStaticCredentials(session.accessKeyID, session.secretAccessKey, "")
+			r.ClientInfo.SigningName = EXPRESS_SESSION_SIGNING_NAME
+			r.HTTPRequest.Header.Set(EXPRESS_SESSION_TOKEN_HEADER, session.sessionToken)
+		},
+		withDirectoryBucketEndpoint(bucket),
+	}, nil
+}
+
+// withDirectoryBucketEndpoint sends the request to the zonal endpoint of
+// the directory bucket. A custom endpoint such as LocalStack is kept.
+func withDirectoryBucketEndpoint(
+	bucket string,
+) request.Option {
+	return func(r *request.Request) {
+		if S3_ENDPOINT != "" {
+			return
+		}
+		r.Handlers.Build.PushBack(func(r *request.Request) {
+			r.HTTPRequest.URL.Host = bucket + "." + directoryBucketHost(bucket)
+		})
+	}
+}
+
+type createSessionInput struct {
+	_ struct{} `type:"structure"`
+}
+
+type createSessionOutput struct {
+	_ struct{} `type:"structure"`
+
+	Credentials *createSessionCredentials `type:"structure"`
+}
+
+type createSessionCredentials struct {
+	_ struct{} `type:"structure"`
+
+	AccessKeyId     *string    `type:"string"`
+	SecretAccessKey *string    `type:"string"`
+	SessionToken    *string    `type:"string"`
+	Expiration      *time.Time `type:"timestamp"`
+}
+
+// createExpressSession calls CreateSession of the directory bucket. The
+// SDK does not know the operation, so it is built on the S3 client with
+// the credentials of the function and signed for s3express.
+func createExpressSession(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+) (
+	*expressSession,
+	error,
+) {
+	logger.debug("Creating directory bucket session...", "bucket", bucket)
+
+	// Start S3 create session span
+	ctx, span := startS3CreateSessionSpan(ctx, parentSpan, bucket)
+	defer span.End()
+
+	// Path style endpoints carry the bucket in the path
+	path := "/?session"
+	if S3_ENDPOINT != "" {
+		path = "/" + bucket + "?session"
+	}
+
+	output := &createSessionOutput{}
+	req := s3Client.NewRequest(&request.Operation{
+		Name:       "CreateSession",
+		HTTPMethod: http.MethodGet,
+		HTTPPath:   path,
+	}, &createSessionInput{}, output)
+	req.SetContext(ctx)
+	req.ClientInfo.SigningName = EXPRESS_SESSION_SIGNING_NAME
+	req.ApplyOptions(withDirectoryBucketEndpoint(bucket))
+
+	err := req.Send()
+	if err == nil && (output.Credentials == nil || aws.StringValue(output.Credentials.SessionToken) == "") {
+		err = errMissingExpressSessionCredentials
+	}
+	if err != nil {
+
+		span.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		span.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+
+		logger.error("Creating directory bucket session is failed.", "bucket", bucket, "error", err)
+		return nil, err
+	}
+
+	// Sessions without an expiration are kept for the documented lifetime
+	expiresAt := time.Now().Add(EXPRESS_SESSION_TTL)
+	if output.Credentials.Expiration != nil {
+		expiresAt = *output.Credentials.Expiration
+	}
+	span.SetAttributes(attribute.String("aws.s3.express.session.expires_at", expiresAt.UTC().Format(time.RFC3339)))
+
+	return &expressSession{
+		accessKeyID:     aws.StringValue(output.Credentials.AccessKeyId),
+		secretAccessKey: aws.StringValue(output.Credentials.SecretAccessKey),
+		sessionToken:    aws.StringValue(output.Credentials.SessionToken),
+		expiresAt:       expiresAt,
+	}, nil
+}
+
+func startS3CreateSessionSpan(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+) (
+	context.Context,
+	trace.Span,
+) {
+	// Start S3 create session span
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "S3.CreateSession",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(s3RPCAttributes("CreateSession")...),
+			trace.WithAttributes(s3BucketAttributes(bucket)...),
+			trace.WithAttributes([]attribute.KeyValue{
+				semconv.NetTransportTCP,
+				attribute.String("server.address", s3ServerAddress(bucket)),
+			}...),
+			trace.WithAttributes(assumedRoleAttributes()...))
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	testDirectoryBucket = "bucket--use1-az4--x-s3"
+)
+
+// sessionS3 answers CreateSession with fixed session credentials and
+// records the requests, so that their authorization can be checked.
+type sessionS3 struct {
+	mutex    sync.Mutex
+	sessions []*http.Request
+	puts     []*http.Request
+}
+
+func (s *sessionS3) ServeHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	io.Copy(io.Discard, r.Body)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := r.URL.Query()["session"]; ok {
+		s.sessions = append(s.sessions, r)
+		io.WriteString(w, `<CreateSessionResult><Credentials>`+
+			`<SessionToken>session-token</SessionToken>`+
+			`<SecretAccessKey>session-secret</SecretAccessKey>`+
+			`<AccessKeyId>session-id</AccessKeyId>`+
+			`<Expiration>`+time.Now().Add(EXPRESS_SESSION_TTL).UTC().Format(time.RFC3339)+`</Expiration>`+
+			`</Credentials></CreateSessionResult>`)
+		return
+	}
+
+	s.puts = append(s.puts, r)
+	w.Header().Set("ETag", `"etag"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// withSessionS3 points the S3 client to the stubbed session API and starts
+// with an empty session cache.
+func withSessionS3(
+	t *testing.T,
+) *sessionS3 {
+	s3Server := &sessionS3{}
+	server := httptest.NewServer(s3Server)
+	t.Cleanup(server.Close)
+
+	previousClient, previousEndpoint, previousSessions := s3Client, S3_ENDPOINT, expressSessions
+	t.Cleanup(func() { s3Client, S3_ENDPOINT, expressSessions = previousClient, previousEndpoint, previousSessions })
+	s3Client = newTestS3Client(server.URL, nil)
+	S3_ENDPOINT = server.URL
+	expressSessions = newExpressSessionCache(createExpressSession)
+	return s3Server
+}
+
+func spanAttribute(
+	span sdktrace.ReadOnlySpan,
+	key attribute.Key,
+) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestS3StoragePutDirectoryBucketSession(t *testing.T) {
+	tests := []struct {
+		name         string
+		bucket       string
+		wantSessions int
+		wantToken    string
+		wantScope    string
+	}{
+		{
+			name:         "directory bucket",
+			bucket:       testDirectoryBucket,
+			wantSessions: 1,
+			wantToken:    "session-token",
+			wantScope:    "Credential=session-id/",
+		},
+		{
+			name:         "general purpose bucket",
+			bucket:       "bucket",
+			wantSessions: 0,
+			wantToken:    "",
+			wantScope:    "Credential=id/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withoutFaults(t)
+			withUploadRetries(t, 1)
+			s3Server := withSessionS3(t)
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, parentSpan := tp.Tracer("test").Start(context.Background(), "parent")
+
+			storage := newS3Storage(newS3Uploader(s3Client), s3Client, s3manager.MinUploadPartSize)
+			for _, key := range []string{"2026/01/01/a", "2026/01/01/b"} {
+				_, err := storage.Put(ctx, key, []byte(`{"item":"x"}`), commons.PutMetadata{Bucket: tt.bucket})
+				if err != nil {
+					t.Fatalf("Put(%q) error = %v", key, err)
+				}
+			}
+			parentSpan.End()
+
+			// One session authorizes both writes
+			if len(s3Server.sessions) != tt.wantSessions {
+				t.Fatalf("CreateSession calls = %d, want %d", len(s3Server.sessions), tt.wantSessions)
+			}
+			for _, r := range s3Server.sessions {
+				if r.Method != http.MethodGet || r.URL.Path != "/"+tt.bucket {
+					t.Errorf("CreateSession request = %s %s, want GET /%s", r.Method, r.URL.Path, tt.bucket)
+				}
+				if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "Credential=id/") || !strings.Contains(auth, "/s3express/aws4_request") {
+					t.Errorf("CreateSession Authorization = %q, want the function's keys signed for s3express", auth)
+				}
+			}
+
+			if len(s3Server.puts) != 2 {
+				t.Fatalf("PutObject calls = %d, want 2", len(s3Server.puts))
+			}
+			for _, r := range s3Server.puts {
+				if got := r.Header.Get(EXPRESS_SESSION_TOKEN_HEADER); got != tt.wantToken {
+					t.Errorf("session token header = %q, want %q", got, tt.wantToken)
+				}
+				if got := r.Header.Get("X-Amz-Security-Token"); got != "" {
+					t.Errorf("security token header = %q, want none", got)
+				}
+				if auth := r.Header.Get("Authorization"); !strings.Contains(auth, tt.wantScope) {
+					t.Errorf("PutObject Authorization = %q, want %q", auth, tt.wantScope)
+				}
+			}
+
+			// The session call is traced below the first write only
+			sessionSpans := 0
+			cached := []bool{}
+			for _, span := range recorder.Ended() {
+				switch span.Name() {
+				case "S3.CreateSession":
+					sessionSpans++
+					if span.SpanKind() != trace.SpanKindClient {
+						t.Errorf("S3.CreateSession kind = %v, want client", span.SpanKind())
+					}
+					if !spanAttribute(span, "aws.s3.express").AsBool() {
+						t.Error("S3.CreateSession aws.s3.express = false, want true")
+					}
+					if got := spanAttribute(span, "aws.s3.storage_class").AsString(); got != DIRECTORY_BUCKET_STORAGE_CLASS {
+						t.Errorf("S3.CreateSession aws.s3.storage_class = %q, want %q", got, DIRECTORY_BUCKET_STORAGE_CLASS)
+					}
+					if got := spanAttribute(span, "rpc.method").AsString(); got != "CreateSession" {
+						t.Errorf("S3.CreateSession rpc.method = %q, want CreateSession", got)
+					}
+				case "S3.PutObject":
+					if got := spanAttribute(span, "aws.s3.express").AsBool(); got != (tt.wantSessions > 0) {
+						t.Errorf("S3.PutObject aws.s3.express = %v, want %v", got, tt.wantSessions > 0)
+					}
+					if value := spanAttribute(span, "aws.s3.express.session.cached"); value.Type() == attribute.BOOL {
+						cached = append(cached, value.AsBool())
+					}
+				}
+			}
+			if sessionSpans != tt.wantSessions {
+				t.Errorf("S3.CreateSession spans = %d, want %d", sessionSpans, tt.wantSessions)
+			}
+			if tt.wantSessions > 0 && (len(cached) != 2 || cached[0] || !cached[1]) {
+				t.Errorf("aws.s3.express.session.cached = %v, want [false true]", cached)
+			}
+		})
+	}
+}
+
+func TestExpressSessionCacheGet(t *testing.T) {
+	errCreateSession := errors.New("access denied")
+
+	tests := []struct {
+		name       string
+		bucket     string
+		elapsed    time.Duration
+		createErr  error
+		wantCached bool
+		wantErr    error
+	}{
+		{
+			name:       "fresh session is reused",
+			bucket:     testDirectoryBucket,
+			elapsed:    time.Minute,
+			wantCached: true,
+		},
+		{
+			name:       "session within the refresh window is renewed",
+			bucket:     testDirectoryBucket,
+			elapsed:    EXPRESS_SESSION_TTL - EXPRESS_SESSION_REFRESH_WINDOW,
+			wantCached: false,
+		},
+		{
+			name:       "expired session is renewed",
+			bucket:     testDirectoryBucket,
+			elapsed:    EXPRESS_SESSION_TTL,
+			wantCached: false,
+		},
+		{
+			name:       "other bucket has its own session",
+			bucket:     "other--use1-az4--x-s3",
+			wantCached: false,
+		},
+		{
+			name:      "failed session is not kept",
+			bucket:    testDirectoryBucket,
+			elapsed:   EXPRESS_SESSION_TTL,
+			createErr: errCreateSession,
+			wantErr:   errCreateSession,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			created := 0
+			createErr := error(nil)
+
+			cache := newExpressSessionCache(func(
+				ctx context.Context,
+				parentSpan trace.Span,
+				bucket string,
+			) (
+				*expressSession,
+				error,
+			) {
+				created++
+				if createErr != nil {
+					return nil, createErr
+				}
+				return &expressSession{sessionToken: bucket, expiresAt: now.Add(EXPRESS_SESSION_TTL)}, nil
+			})
+			cache.now = func() time.Time { return now }
+
+			span := trace.SpanFromContext(context.Background())
+			if _, _, err := cache.get(context.Background(), span, testDirectoryBucket); err != nil {
+				t.Fatalf("get() error = %v", err)
+			}
+
+			now = now.Add(tt.elapsed)
+			createErr = tt.createErr
+
+			session, cached, err := cache.get(context.Background(), span, tt.bucket)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("get() error = %v, want %v", err, tt.wantErr)
+			}
+			if cached != tt.wantCached {
+				t.Errorf("get() cached = %v, want %v", cached, tt.wantCached)
+			}
+			if err == nil && session.sessionToken != tt.bucket {
+				t.Errorf("get() session of %q, want %q", session.sessionToken, tt.bucket)
+			}
+			if _, ok := cache.sessions[tt.bucket]; ok != (err == nil) {
+				t.Errorf("session kept = %v, want %v", ok, err == nil)
+			}
+		})
+	}
+}
+
+func TestWithDirectoryBucketEndpoint(t *testing.T) {
+	previousEndpoint, previousRegion := S3_ENDPOINT, AWS_REGION
+	t.Cleanup(func() { S3_ENDPOINT, AWS_REGION = previousEndpoint, previousRegion })
+	AWS_REGION = "us-east-1"
+
+	tests := []struct {
+		name     string
+		endpoint string
+		wantHost string
+	}{
+		{
+			name:     "zonal endpoint",
+			wantHost: testDirectoryBucket + ".s3express-use1-az4.us-east-1.amazonaws.com",
+		},
+		{
+			name:     "custom endpoint",
+			endpoint: "http://localhost:4566",
+			wantHost: "localhost:4566",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S3_ENDPOINT = tt.endpoint
+
+			client := newTestS3Client("http://localhost:4566", nil)
+			req := client.NewRequest(&request.Operation{
+				Name:       "CreateSession",
+				HTTPMethod: http.MethodGet,
+				HTTPPath:   "/?session",
+			}, &createSessionInput{}, &createSessionOutput{})
+			req.ApplyOptions(withDirectoryBucketEndpoint(testDirectoryBucket))
+
+			if err := req.Build(); err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if got := req.HTTPRequest.URL.Host; got != tt.wantHost {
+				t.Errorf("host = %q, want %q", got, tt.wantHost)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	FAILOVER_EVENT_NAME = "failover"
+)
+
+// newFailoverStorage creates the storage which writes into the secondary
+// bucket with a client of the secondary region. There is no failover
+// without both of them or for other backends than S3.
+func newFailoverStorage(
+	sess *session.Session,
+) commons.Storage {
+	if FAILOVER_S3_BUCKET_NAME == "" || FAILOVER_AWS_REGION == "" || !isS3Storage() {
+		return nil
+	}
+
+	client := s3.New(sess, newS3Config().WithRegion(FAILOVER_AWS_REGION))
+	return newS3Storage(newS3Uploader(client), client, S3_UPLOAD_PART_SIZE)
+}
+
+// isRegionalFailure reports whether the write has failed because the
+// region is unavailable: server errors, timeouts and endpoints which
+// cannot be resolved or reached. Client errors like AccessDenied would
+// fail the same way in the secondary region.
+func isRegionalFailure(
+	err error,
+) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() >= 500 {
+		return true
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case "RequestTimeout", request.ErrCodeResponseTimeout, request.ErrCodeRequestError, "MissingEndpoint":
+			return true
+		}
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// canFailover reports whether a failed write is retried in the secondary
+// region. Only the input bucket has a secondary, tenant buckets are not
+// failed over. A write which has run out of time or has been throttled,
+// which is answered with a 429 instead, is not retried either.
+func canFailover(
+	ctx context.Context,
+	bucket string,
+	err error,
+) bool {
+	return failoverStorage != nil &&
+		bucket == INPUT_S3_BUCKET_NAME &&
+		ctx.Err() == nil &&
+		!isThrottled(err) &&
+		isRegionalFailure(err)
+}
+
+// failOver writes the object once into the secondary bucket. The parent
+// span is marked as degraded regardless of the outcome, so that failovers
+// can be found even when the secondary region fails as well.
+func failOver(
+	ctx context.Context,
+	parentSpan trace.Span,
+	key string,
+	body []byte,
+	metadata commons.PutMetadata,
+) (
+	commons.PutResult,
+	error,
+) {
+	parentSpan.AddEvent(FAILOVER_EVENT_NAME, trace.WithAttributes(
+		attribute.String("failover.region", FAILOVER_AWS_REGION),
+		attribute.String("failover.bucket", FAILOVER_S3_BUCKET_NAME),
+		attribute.String("aws.s3.key", key),
+	))
+	parentSpan.SetAttributes(attribute.Bool("failover.degraded", true))
+
+	logger.warn("Storing custom object fails over to the secondary bucket.", "key", key, "region", FAILOVER_AWS_REGION, "bucket", FAILOVER_S3_BUCKET_NAME)
+
+	metadata.Bucket = FAILOVER_S3_BUCKET_NAME
+	result, err := failoverStorage.Put(ctx, key, body, metadata)
+	parentSpan.SetAttributes(attribute.Bool("failover.succeeded", err == nil))
+	if err != nil {
+		logger.error("Storing custom object in the secondary bucket is failed.", "key", key, "error", err)
+		return commons.PutResult{}, err
+	}
+
+	result.Bucket = FAILOVER_S3_BUCKET_NAME
+	return result, nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+func TestNewFailoverStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		bucket  string
+		region  string
+		backend string
+		want    bool
+	}{
+		{
+			name:    "configured",
+			bucket:  "bucket-secondary",
+			region:  "eu-central-1",
+			backend: STORAGE_BACKEND_S3,
+			want:    true,
+		},
+		{
+			name:    "bucket missing",
+			region:  "eu-central-1",
+			backend: STORAGE_BACKEND_S3,
+			want:    false,
+		},
+		{
+			name:    "region missing",
+			bucket:  "bucket-secondary",
+			backend: STORAGE_BACKEND_S3,
+			want:    false,
+		},
+		{
+			name:    "other backend",
+			bucket:  "bucket-secondary",
+			region:  "eu-central-1",
+			backend: STORAGE_BACKEND_DYNAMODB,
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousBucket, previousRegion, previousBackend := FAILOVER_S3_BUCKET_NAME, FAILOVER_AWS_REGION, STORAGE_BACKEND
+			t.Cleanup(func() {
+				FAILOVER_S3_BUCKET_NAME, FAILOVER_AWS_REGION, STORAGE_BACKEND = previousBucket, previousRegion, previousBackend
+			})
+			FAILOVER_S3_BUCKET_NAME = tt.bucket
+			FAILOVER_AWS_REGION = tt.region
+			STORAGE_BACKEND = tt.backend
+
+			sess := session.Must(session.NewSession(aws.NewConfig().WithRegion("eu-west-1")))
+			if got := newFailoverStorage(sess) != nil; got != tt.want {
+				t.Errorf("newFailoverStorage() created = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRegionalFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "no error",
+			err:  nil,
+			want: false,
+		},
+		{
+			name: "server error",
+			err:  awserr.NewRequestFailure(awserr.New("InternalError", "We encountered an internal error", nil), 500, ""),
+			want: true,
+		},
+		{
+			name: "service unavailable",
+			err:  awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "Please reduce your request rate", nil), 503, ""),
+			want: true,
+		},
+		{
+			name: "access denied",
+			err:  awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, ""),
+			want: false,
+		},
+		{
+			name: "request error",
+			err:  awserr.New(request.ErrCodeRequestError, "send request failed", errors.New("connection refused")),
+			want: true,
+		},
+		{
+			name: "unresolvable endpoint",
+			err:  fmt.Errorf("upload: %w", &net.DNSError{Err: "no such host", Name: "s3.eu-west-1.amazonaws.com"}),
+			want: true,
+		},
+		{
+			name: "network timeout",
+			err:  timeoutError{},
+			want: true,
+		},
+		{
+			name: "canceled",
+			err:  fmt.Errorf("upload: %w", context.Canceled),
+			want: false,
+		},
+		{
+			name: "deadline exceeded",
+			err:  context.DeadlineExceeded,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRegionalFailure(tt.err); got != tt.want {
+				t.Errorf("isRegionalFailure(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanFailover(t *testing.T) {
+	errRegional := awserr.NewRequestFailure(awserr.New("InternalError", "We encountered an internal error", nil), 500, "")
+	errThrottled := &StoreError{Kind: STORE_ERROR_KIND_THROTTLED, Err: errRegional}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		failover bool
+		bucket   string
+		err      error
+		want     bool
+	}{
+		{
+			name:     "regional failure",
+			ctx:      context.Background(),
+			failover: true,
+			bucket:   "bucket",
+			err:      errRegional,
+			want:     true,
+		},
+		{
+			name:     "no failover storage",
+			ctx:      context.Background(),
+			failover: false,
+			bucket:   "bucket",
+			err:      errRegional,
+			want:     false,
+		},
+		{
+			name:     "tenant bucket",
+			ctx:      context.Background(),
+			failover: true,
+			bucket:   "bucket-tenant",
+			err:      errRegional,
+			want:     false,
+		},
+		{
+			name:     "out of time",
+			ctx:      canceled,
+			failover: true,
+			bucket:   "bucket",
+			err:      errRegional,
+			want:     false,
+		},
+		{
+			name:     "throttled",
+			ctx:      context.Background(),
+			failover: true,
+			bucket:   "bucket",
+			err:      errThrottled,
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousStorage, previousBucket := failoverStorage, INPUT_S3_BUCKET_NAME
+			t.Cleanup(func() { failoverStorage, INPUT_S3_BUCKET_NAME = previousStorage, previousBucket })
+			INPUT_S3_BUCKET_NAME = "bucket"
+			failoverStorage = nil
+			if tt.failover {
+				failoverStorage = &scriptedStorage{}
+			}
+
+			if got := canFailover(tt.ctx, tt.bucket, tt.err); got != tt.want {
+				t.Errorf("canFailover() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailOver(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantSucceeded bool
+	}{
+		{
+			name:          "secondary stores",
+			wantSucceeded: true,
+		},
+		{
+			name:          "secondary fails",
+			err:           errors.New("secondary unavailable"),
+			wantSucceeded: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousStorage, previousBucket, previousRegion := failoverStorage, FAILOVER_S3_BUCKET_NAME, FAILOVER_AWS_REGION
+			t.Cleanup(func() {
+				failoverStorage, FAILOVER_S3_BUCKET_NAME, FAILOVER_AWS_REGION = previousStorage, previousBucket, previousRegion
+			})
+			FAILOVER_S3_BUCKET_NAME = "bucket-secondary"
+			FAILOVER_AWS_REGION = "eu-central-1"
+
+			var storedBucket string
+			failoverStorage = &scriptedStorage{
+				put: func(key string, body []byte, metadata commons.PutMetadata) (commons.PutResult, error) {
+					storedBucket = metadata.Bucket
+					return commons.PutResult{VersionID: "v1"}, tt.err
+				},
+			}
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "main.handler")
+			result, err := failOver(ctx, span, "2026/01/01/id", []byte(`{"item":"x"}`), commons.PutMetadata{Bucket: "bucket"})
+			span.End()
+
+			if storedBucket != "bucket-secondary" {
+				t.Errorf("stored into %q, want %q", storedBucket, "bucket-secondary")
+			}
+			if (err == nil) != tt.wantSucceeded {
+				t.Fatalf("failOver() error = %v, want succeeded %v", err, tt.wantSucceeded)
+			}
+			if tt.wantSucceeded && (result.Bucket != "bucket-secondary" || result.VersionID != "v1") {
+				t.Errorf("failOver() = %+v", result)
+			}
+
+			ended := recorder.Ended()[0]
+			if !spanAttribute(ended, "failover.degraded").AsBool() {
+				t.Error("failover.degraded is not set")
+			}
+			if got := spanAttribute(ended, "failover.succeeded").AsBool(); got != tt.wantSucceeded {
+				t.Errorf("failover.succeeded = %v, want %v", got, tt.wantSucceeded)
+			}
+			if events := ended.Events(); len(events) != 1 || events[0].Name != FAILOVER_EVENT_NAME {
+				t.Errorf("events = %v, want one %s event", events, FAILOVER_EVENT_NAME)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+func functionURLHandler(
+	ctx context.Context,
+	req events.LambdaFunctionURLRequest,
+) (
+	events.LambdaFunctionURLResponse,
+	error,
+) {
+
+	// Process request
+	result := serveRequest(ctx, functionURLRequestAttributes(req), &Request{
+		Method:          req.RequestContext.HTTP.Method,
+		RouteKey:        req.RequestContext.HTTP.Method + " " + req.RawPath,
+		Path:            req.RawPath,
+		SourceIP:        req.RequestContext.HTTP.SourceIP,
+		Headers:         req.Headers,
+		Cookies:         req.Cookies,
+		QueryParameters: req.QueryStringParameters,
+		Body:            req.Body,
+		IsBase64Encoded: req.IsBase64Encoded,
+	})
+
+	return events.LambdaFunctionURLResponse{
+		StatusCode: result.StatusCode,
+		Headers:    result.Headers,
+		Cookies:    result.Cookies,
+		Body:       result.Body,
+	}, nil
+}
+
+func functionURLRequestAttributes(
+	req events.LambdaFunctionURLRequest,
+) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.FaaSTriggerHTTP,
+		semconv.NetTransportTCP,
+		semconv.HTTPMethod(req.RequestContext.HTTP.Method),
+		semconv.HTTPFlavorKey.String(req.RequestContext.HTTP.Protocol),
+		semconv.HTTPTarget(req.RawPath),
+		semconv.HTTPScheme(req.Headers["x-forwarded-proto"]),
+		semconv.HTTPUserAgent(req.RequestContext.HTTP.UserAgent),
+		semconv.HTTPClientIP(req.RequestContext.HTTP.SourceIP),
+		semconv.NetHostName(req.RequestContext.DomainName),
+		attribute.String("url.full", functionURL(req)),
+	}
+}
+
+func functionURL(
+	req events.LambdaFunctionURLRequest,
+) string {
+	url := "https://" + req.RequestContext.DomainName + req.RawPath
+	if req.RawQueryString != "" {
+		url += "?" + req.RawQueryString
+	}
+	return url
+}
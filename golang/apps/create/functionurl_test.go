@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestFunctionURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawPath  string
+		rawQuery string
+		want     string
+	}{
+		{
+			name:    "without query",
+			rawPath: "/items",
+			want:    "https://abc.lambda-url.eu-west-1.on.aws/items",
+		},
+		{
+			name:     "with query",
+			rawPath:  "/items",
+			rawQuery: "dryRun=true&x=1",
+			want:     "https://abc.lambda-url.eu-west-1.on.aws/items?dryRun=true&x=1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := events.LambdaFunctionURLRequest{
+				RawPath:        tt.rawPath,
+				RawQueryString: tt.rawQuery,
+				RequestContext: events.LambdaFunctionURLRequestContext{
+					DomainName: "abc.lambda-url.eu-west-1.on.aws",
+				},
+			}
+			if got := functionURL(req); got != tt.want {
+				t.Errorf("functionURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFunctionURLHandler(t *testing.T) {
+	withHealthyConfig(t)
+
+	tests := []struct {
+		name           string
+		method         string
+		rawPath        string
+		wantStatusCode int
+	}{
+		{
+			name:           "health check",
+			method:         "GET",
+			rawPath:        "/health",
+			wantStatusCode: 200,
+		},
+		{
+			name:           "method outside of the allowlist",
+			method:         "DELETE",
+			rawPath:        "/items",
+			wantStatusCode: 405,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := functionURLHandler(context.Background(), events.LambdaFunctionURLRequest{
+				RawPath: tt.rawPath,
+				RequestContext: events.LambdaFunctionURLRequestContext{
+					HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{
+						Method:   tt.method,
+						Path:     tt.rawPath,
+						SourceIP: "192.0.2.1",
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("functionURLHandler() error = %v", err)
+			}
+			if res.StatusCode != tt.wantStatusCode {
+				t.Errorf("status code = %d, want %d: %s", res.StatusCode, tt.wantStatusCode, res.Body)
+			}
+			if res.Body == "" {
+				t.Error("body is empty")
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	HEALTH_PATH                   = "/health"
+	HEALTH_STATUS_OK              = "ok"
+	HEALTH_STATUS_FAILED          = "failed"
+	DEFAULT_OTLP_EXPORTER_ADDRESS = "localhost:4317"
+	EXPORTER_DIAL_TIMEOUT         = 250 * time.Millisecond
+)
+
+var (
+	exporterReachable bool
+)
+
+type HealthCheck struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// HealthResponse reports the health of the function. The bucket check is
+// only present for deep checks.
+type HealthResponse struct {
+	Status   string       `json:"status"`
+	Config   HealthCheck  `json:"config"`
+	Exporter HealthCheck  `json:"exporter"`
+	Bucket   *HealthCheck `json:"bucket,omitempty"`
+}
+
+// isHealthRequest detects the health route by the request path and falls
+// back to the route key for triggers which route by resource.
+func isHealthRequest(
+	req *Request,
+) bool {
+	if strings.TrimSuffix(req.Path, "/") == HEALTH_PATH {
+		return true
+	}
+	return strings.HasSuffix(req.RouteKey, " "+HEALTH_PATH)
+}
+
+// checkHealth answers load balancer and canary checks. It never writes
+// objects, so it never reaches the fault injection either. An unreachable
+// exporter is reported but does not fail the check as the function keeps
+// serving requests without telemetry.
+func checkHealth(
+	ctx context.Context,
+	req *Request,
+) *createResult {
+
+	parentSpan := trace.SpanFromContext(ctx)
+
+	response := &HealthResponse{
+		Status:   HEALTH_STATUS_OK,
+		Config:   checkConfig(),
+		Exporter: HealthCheck{Status: HEALTH_STATUS_OK},
+	}
+	if OTEL_SDK_DISABLED {
+		response.Exporter.Detail = "OpenTelemetry SDK is disabled."
+	} else if !exporterReachable {
+		response.Exporter = HealthCheck{
+			Status: HEALTH_STATUS_FAILED,
+			Detail: "Exporter endpoint was not reachable at init.",
+		}
+	}
+	if response.Config.Status != HEALTH_STATUS_OK {
+		response.Status = HEALTH_STATUS_FAILED
+	}
+
+	// Check bucket connectivity
+	deep := req.QueryParameters["deep"] == "true"
+	if deep {
+		bucketCheck := checkBucket(ctx, parentSpan, INPUT_S3_BUCKET_NAME)
+		if bucketCheck.Status != HEALTH_STATUS_OK {
+			response.Status = HEALTH_STATUS_FAILED
+		}
+		response.Bucket = &bucketCheck
+	}
+
+	statusCode := 200
+	if response.Status != HEALTH_STATUS_OK {
+		statusCode = 503
+	}
+
+	parentSpan.SetAttributes([]attribute.KeyValue{
+		attribute.Bool("health.deep", deep),
+		attribute.String("health.status", response.Status),
+		semconv.HTTPStatusCode(statusCode),
+	}...)
+
+	responseAsBytes, err := json.Marshal(response)
+	if err != nil {
+		return failRequest(parentSpan, 500, "Creating the response is failed.")
+	}
+
+	return &createResult{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":  "application/json",
+			"Cache-Control": "no-store",
+		},
+		Body: string(responseAsBytes),
+	}
+}
+
+func checkConfig() HealthCheck {
+	missing := []string{}
+	if OTEL_SERVICE_NAME == "" {
+		missing = append(missing, "OTEL_SERVICE_NAME")
+	}
+	if INPUT_S3_BUCKET_NAME == "" {
+		missing = append(missing, "INPUT_S3_BUCKET_NAME")
+	}
+	if tracerProvider == nil && !OTEL_SDK_DISABLED {
+		missing = append(missing, "tracer provider")
+	}
+
+	if len(missing) > 0 {
+		return HealthCheck{
+			Status: HEALTH_STATUS_FAILED,
+			Detail: "Missing " + strings.Join(missing, ", ") + ".",
+		}
+	}
+	return HealthCheck{Status: HEALTH_STATUS_OK}
+}
+
+func checkBucket(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+) HealthCheck {
+
+	// Start S3 head bucket span
+	ctx, s3HeadBucketSpan := startS3HeadBucketSpan(ctx, parentSpan, bucket)
+	defer s3HeadBucketSpan.End()
+
+	_, err := s3Client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		s3HeadBucketSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		s3HeadBucketSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(false),
+		))
+
+		logger.warn("Checking bucket is failed.", "bucket", bucket, "error", err)
+		return HealthCheck{
+			Status: HEALTH_STATUS_FAILED,
+			Detail: "Bucket is not reachable.",
+		}
+	}
+
+	return HealthCheck{Status: HEALTH_STATUS_OK}
+}
+
+func startS3HeadBucketSpan(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+) (
+	context.Context,
+	trace.Span,
+) {
+	// Start S3 head bucket span
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "S3.HeadBucket",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(s3RPCAttributes("HeadBucket")...),
+			trace.WithAttributes(s3BucketAttributes(bucket)...),
+			trace.WithAttributes([]attribute.KeyValue{
+				semconv.NetTransportTCP,
+			}...))
+}
+
+// isExporterEndpointReachable dials the OTLP endpoint once at init. The
+// exporter itself connects lazily and would not report a missing collector
+// before the first export.
+func isExporterEndpointReachable() bool {
+	address := exporterAddress(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"))
+	if address == "" {
+		address = exporterAddress(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	}
+	if address == "" {
+		address = DEFAULT_OTLP_EXPORTER_ADDRESS
+	}
+
+	conn, err := net.DialTimeout("tcp", address, EXPORTER_DIAL_TIMEOUT)
+	if err != nil {
+		logger.warn("Exporter endpoint is not reachable.", "address", address, "error", err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// exporterAddress turns an endpoint like http://localhost:4317 into a host
+// and port to dial.
+func exporterAddress(
+	endpoint string,
+) string {
+	endpoint = strings.TrimSpace(endpoint)
+	if !strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestIsHealthRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *Request
+		want bool
+	}{
+		{name: "health path", req: &Request{Path: "/health"}, want: true},
+		{name: "health path with trailing slash", req: &Request{Path: "/health/"}, want: true},
+		{name: "health route key", req: &Request{RouteKey: "GET /health", Path: "/prod/health"}, want: true},
+		{name: "items path", req: &Request{RouteKey: "POST /items", Path: "/items"}, want: false},
+		{name: "path ending with health", req: &Request{RouteKey: "GET /items/health", Path: "/items/health"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isHealthRequest(tt.req); got != tt.want {
+				t.Errorf("isHealthRequest(%+v) = %v, want %v", tt.req, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExporterAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		want     string
+	}{
+		{name: "empty", endpoint: "", want: ""},
+		{name: "host and port", endpoint: " collector:4317 ", want: "collector:4317"},
+		{name: "URL with port", endpoint: "http://collector:4318", want: "collector:4318"},
+		{name: "http URL without port", endpoint: "http://collector", want: "collector:80"},
+		{name: "https URL without port", endpoint: "https://collector/v1/traces", want: "collector:443"},
+		{name: "invalid URL", endpoint: "http://collector:port", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exporterAddress(tt.endpoint); got != tt.want {
+				t.Errorf("exporterAddress(%q) = %q, want %q", tt.endpoint, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	tests := []struct {
+		name              string
+		missingBucket     bool
+		sdkEnabled        bool
+		exporterReachable bool
+		deep              bool
+		bucketStatus      int
+		wantStatusCode    int
+		wantStatus        string
+		wantConfig        string
+		wantExporter      string
+		wantBucket        string
+	}{
+		{
+			name:           "shallow check",
+			wantStatusCode: 200,
+			wantStatus:     HEALTH_STATUS_OK,
+			wantConfig:     HEALTH_STATUS_OK,
+			wantExporter:   HEALTH_STATUS_OK,
+		},
+		{
+			name:           "missing configuration",
+			missingBucket:  true,
+			wantStatusCode: 503,
+			wantStatus:     HEALTH_STATUS_FAILED,
+			wantConfig:     HEALTH_STATUS_FAILED,
+			wantExporter:   HEALTH_STATUS_OK,
+		},
+		{
+			name:           "unreachable exporter does not fail the check",
+			sdkEnabled:     true,
+			wantStatusCode: 200,
+			wantStatus:     HEALTH_STATUS_OK,
+			wantConfig:     HEALTH_STATUS_OK,
+			wantExporter:   HEALTH_STATUS_FAILED,
+		},
+		{
+			name:              "reachable exporter",
+			sdkEnabled:        true,
+			exporterReachable: true,
+			wantStatusCode:    200,
+			wantStatus:        HEALTH_STATUS_OK,
+			wantConfig:        HEALTH_STATUS_OK,
+			wantExporter:      HEALTH_STATUS_OK,
+		},
+		{
+			name:           "deep check of a reachable bucket",
+			deep:           true,
+			bucketStatus:   http.StatusOK,
+			wantStatusCode: 200,
+			wantStatus:     HEALTH_STATUS_OK,
+			wantConfig:     HEALTH_STATUS_OK,
+			wantExporter:   HEALTH_STATUS_OK,
+			wantBucket:     HEALTH_STATUS_OK,
+		},
+		{
+			name:           "deep check of an unreachable bucket",
+			deep:           true,
+			bucketStatus:   http.StatusForbidden,
+			wantStatusCode: 503,
+			wantStatus:     HEALTH_STATUS_FAILED,
+			wantConfig:     HEALTH_STATUS_OK,
+			wantExporter:   HEALTH_STATUS_OK,
+			wantBucket:     HEALTH_STATUS_FAILED,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withHealthyConfig(t)
+
+			previousClient, previousReachable, previousProvider := s3Client, exporterReachable, tracerProvider
+			t.Cleanup(func() {
+				s3Client, exporterReachable, tracerProvider = previousClient, previousReachable, previousProvider
+			})
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.bucketStatus)
+			}))
+			t.Cleanup(server.Close)
+			s3Client = newTestS3Client(server.URL, nil)
+
+			if tt.missingBucket {
+				INPUT_S3_BUCKET_NAME = ""
+			}
+			OTEL_SDK_DISABLED = !tt.sdkEnabled
+			if tt.sdkEnabled {
+				tracerProvider = sdktrace.NewTracerProvider()
+			}
+			exporterReachable = tt.exporterReachable
+
+			query := map[string]string{}
+			if tt.deep {
+				query["deep"] = "true"
+			}
+			result := checkHealth(context.Background(), &Request{Method: "GET", Path: HEALTH_PATH, QueryParameters: query})
+			if result.StatusCode != tt.wantStatusCode {
+				t.Errorf("status code = %d, want %d: %s", result.StatusCode, tt.wantStatusCode, result.Body)
+			}
+			if result.Headers["Cache-Control"] != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", result.Headers["Cache-Control"])
+			}
+
+			response := &HealthResponse{}
+			if err := json.Unmarshal([]byte(result.Body), response); err != nil {
+				t.Fatalf("body = %s, error = %v", result.Body, err)
+			}
+			if response.Status != tt.wantStatus || response.Config.Status != tt.wantConfig || response.Exporter.Status != tt.wantExporter {
+				t.Errorf("response = %+v, want status %q, config %q and exporter %q", response, tt.wantStatus, tt.wantConfig, tt.wantExporter)
+			}
+
+			bucket := ""
+			if response.Bucket != nil {
+				bucket = response.Bucket.Status
+			}
+			if bucket != tt.wantBucket {
+				t.Errorf("bucket = %q, want %q", bucket, tt.wantBucket)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// withHTTPTrace adds the connection setup of the AWS HTTP client as events
+// to the given span. On a cold start the DNS lookup, the connect and the
+// TLS handshake dominate the S3 latency but are invisible otherwise. The
+// SDK passes the context on to its HTTP requests, so the hooks apply to
+// every request made with the returned context.
+func withHTTPTrace(
+	ctx context.Context,
+	span trace.Span,
+) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			span.AddEvent("http.get_conn", trace.WithAttributes(
+				attribute.String("net.peer.name", hostPort),
+			))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.AddEvent("http.got_conn", trace.WithAttributes(
+				attribute.Bool("http.conn.reused", info.Reused),
+				attribute.Bool("http.conn.was_idle", info.WasIdle),
+			))
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			span.AddEvent("http.dns.start", trace.WithAttributes(
+				attribute.String("net.peer.name", info.Host),
+			))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			attributes := []attribute.KeyValue{
+				attribute.Int("http.dns.addresses", len(info.Addrs)),
+			}
+			if info.Err != nil {
+				attributes = append(attributes, attribute.String("error.message", info.Err.Error()))
+			}
+			span.AddEvent("http.dns.done", trace.WithAttributes(attributes...))
+		},
+		ConnectStart: func(network string, addr string) {
+			span.AddEvent("http.connect.start", trace.WithAttributes(
+				attribute.String("net.sock.peer.addr", addr),
+			))
+		},
+		ConnectDone: func(network string, addr string, err error) {
+			attributes := []attribute.KeyValue{
+				attribute.String("net.sock.peer.addr", addr),
+			}
+			if err != nil {
+				attributes = append(attributes, attribute.String("error.message", err.Error()))
+			}
+			span.AddEvent("http.connect.done", trace.WithAttributes(attributes...))
+		},
+		TLSHandshakeStart: func() {
+			span.AddEvent("http.tls.start")
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			attributes := []attribute.KeyValue{
+				attribute.Bool("http.tls.resumed", state.DidResume),
+			}
+			if err != nil {
+				attributes = append(attributes, attribute.String("error.message", err.Error()))
+			}
+			span.AddEvent("http.tls.done", trace.WithAttributes(attributes...))
+		},
+	})
+}
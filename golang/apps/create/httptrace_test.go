@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithHTTPTrace(t *testing.T) {
+	tests := []struct {
+		name            string
+		tls             bool
+		wantFirstEvents string
+	}{
+		{
+			name:            "plain connection",
+			wantFirstEvents: "http.get_conn,http.connect.start,http.connect.done,http.got_conn",
+		},
+		{
+			name:            "TLS connection",
+			tls:             true,
+			wantFirstEvents: "http.get_conn,http.connect.start,http.connect.done,http.tls.start,http.tls.done,http.got_conn",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			server := httptest.NewUnstartedServer(handler)
+			if tt.tls {
+				server.StartTLS()
+			} else {
+				server.Start()
+			}
+			t.Cleanup(server.Close)
+			client := server.Client()
+
+			tp, recorder := newRecordingTracerProvider()
+
+			// The second request reuses the connection of the first one
+			reused := []bool{}
+			for i := 0; i < 2; i++ {
+				ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "S3.PutObject")
+				req, _ := http.NewRequestWithContext(withHTTPTrace(ctx, span), http.MethodGet, server.URL, nil)
+				res, err := client.Do(req)
+				if err != nil {
+					t.Fatalf("Do() error = %v", err)
+				}
+				io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+				span.End()
+			}
+
+			spans := recorder.Ended()
+			for i, span := range spans {
+				names := []string{}
+				for _, event := range span.Events() {
+					names = append(names, event.Name)
+					if event.Name != "http.got_conn" {
+						continue
+					}
+					for _, kv := range event.Attributes {
+						if kv.Key == "http.conn.reused" {
+							reused = append(reused, kv.Value.AsBool())
+						}
+					}
+				}
+				if i == 0 && strings.Join(names, ",") != tt.wantFirstEvents {
+					t.Errorf("events = %v, want %s", names, tt.wantFirstEvents)
+				}
+				if i == 1 && strings.Join(names, ",") != "http.get_conn,http.got_conn" {
+					t.Errorf("events of the reused connection = %v, want http.get_conn,http.got_conn", names)
+				}
+			}
+			if len(reused) != 2 || reused[0] || !reused[1] {
+				t.Errorf("http.conn.reused = %v, want [false true]", reused)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	IDEMPOTENCY_STATUS_IN_PROGRESS = "IN_PROGRESS"
+	IDEMPOTENCY_STATUS_COMPLETED   = "COMPLETED"
+
+	// Lambda never runs longer, the lease of an invocation without a
+	// deadline ends at the latest then
+	IDEMPOTENCY_MAX_LEASE = 15 * time.Minute
+)
+
+var (
+	dynamoDBClient dynamodbiface.DynamoDBAPI
+)
+
+type idempotencyRecord struct {
+	Status      string
+	StatusCode  int
+	RequestHash string
+	Headers     map[string]string
+	Body        string
+}
+
+// idempotencyMiddleware replays the stored response of a POST request
+// which has already been processed with the same Idempotency-Key header
+// instead of writing the object again. A key which is reused with another
+// body is rejected with a 422. It is skipped entirely when no idempotency
+// table is configured.
+func idempotencyMiddleware(
+	next Handler,
+) Handler {
+	return func(
+		ctx context.Context,
+		req *Request,
+	) *createResult {
+		idempotencyKey := strings.TrimSpace(getHeader(req.Headers, "Idempotency-Key"))
+		if IDEMPOTENCY_TABLE_NAME == "" || idempotencyKey == "" || req.Method != "POST" || isDryRun(ctx) {
+			return next(ctx, req)
+		}
+
+		parentSpan := trace.SpanFromContext(ctx)
+		parentSpan.SetAttributes(attribute.String("idempotency.key", idempotencyKey))
+
+		// Claim the key before processing
+		requestHash := hashIdempotentRequest(req)
+		claimed, err := claimIdempotencyKey(ctx, parentSpan, idempotencyKey, requestHash)
+		if err != nil {
+			return failRequest(parentSpan, 500, "Claiming the idempotency key is failed.")
+		}
+
+		if !claimed {
+			return replayIdempotentResponse(ctx, parentSpan, idempotencyKey, requestHash)
+		}
+		parentSpan.SetAttributes(attribute.Bool("idempotency.hit", false))
+
+		result := next(ctx, req)
+
+		// Keep successful responses for replays and release the key
+		// otherwise so that the client can retry.
+		if result.StatusCode >= 200 && result.StatusCode < 300 {
+			completeIdempotencyKey(ctx, parentSpan, idempotencyKey, result)
+		} else {
+			releaseIdempotencyKey(ctx, parentSpan, idempotencyKey, requestHash)
+		}
+		return result
+	}
+}
+
+// hashIdempotentRequest returns the SHA-256 digest of the request body as
+// it has been received.
+func hashIdempotentRequest(
+	req *Request,
+) string {
+	sum := sha256.Sum256([]byte(req.Body))
+	return hex.EncodeToString(sum[:])
+}
+
+func replayIdempotentResponse(
+	ctx context.Context,
+	parentSpan trace.Span,
+	idempotencyKey string,
+	requestHash string,
+) *createResult {
+
+	record, err := getIdempotencyRecord(ctx, parentSpan, idempotencyKey)
+	if err != nil {
+		return failRequest(parentSpan, 500, "Getting the stored response is failed.")
+	}
+
+	// The key belongs to another request
+	if record != nil && record.RequestHash != "" && record.RequestHash != requestHash {
+		logger.warn("Idempotency key is reused with another request body.", "idempotencyKey", idempotencyKey)
+		parentSpan.SetAttributes(attribute.String("error.type", "idempotency_key_reused"))
+		countError(parentSpan, ERROR_TYPE_VALIDATION)
+		return failRequest(parentSpan, 422, "Idempotency-Key is reused with another request body.")
+	}
+
+	// The first request is still being processed or has just failed.
+	if record == nil || record.Status != IDEMPOTENCY_STATUS_COMPLETED {
+		logger.warn("Request with the same idempotency key is in progress.", "idempotencyKey", idempotencyKey)
+		return failRequest(parentSpan, 409, "Request with the same Idempotency-Key is in progress.")
+	}
+
+	logger.info("Replaying stored response.", "idempotencyKey", idempotencyKey)
+
+	parentSpan.SetAttributes([]attribute.KeyValue{
+		attribute.Bool("idempotency.hit", true),
+		semconv.HTTPStatusCode(record.StatusCode),
+	}...)
+
+	enrichSpanWithEvent(parentSpan, true)
+
+	return &createResult{
+		StatusCode: record.StatusCode,
+		Headers:    record.Headers,
+		Body:       record.Body,
+	}
+}
+
+// claimIdempotencyKey stores an in progress record for the key unless a
+// record which has not expired yet exists already. It reports whether the
+// key has been claimed. The in progress record is leased until the
+// invocation times out only, so that the key is free again if the
+// invocation dies before it completes or releases the key.
+func claimIdempotencyKey(
+	ctx context.Context,
+	parentSpan trace.Span,
+	idempotencyKey string,
+	requestHash string,
+) (
+	bool,
+	error,
+) {
+	ctx, span := startDynamoDBSpan(ctx, parentSpan, "PutItem", IDEMPOTENCY_TABLE_NAME)
+	defer span.End()
+
+	now := time.Now().UTC()
+	expiresAt := idempotencyLeaseEnd(ctx, now)
+
+	_, err := dynamoDBClient.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(IDEMPOTENCY_TABLE_NAME),
+		Item: map[string]*dynamodb.AttributeValue{
+			"idempotencyKey": {S: aws.String(idempotencyKey)},
+			"status":         {S: aws.String(IDEMPOTENCY_STATUS_IN_PROGRESS)},
+			"requestHash":    {S: aws.String(requestHash)},
+			"expiresAt":      {N: aws.String(strconv.FormatInt(expiresAt.Unix(), 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(idempotencyKey) OR expiresAt < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	})
+
+	if isConditionalCheckFailed(err) {
+		span.SetAttributes(attribute.Bool("idempotency.claimed", false))
+		return false, nil
+	}
+
+	if err != nil {
+		recordDynamoDBError(span, err)
+		logger.error("Claiming idempotency key is failed.", "idempotencyKey", idempotencyKey, "error", err)
+		return false, err
+	}
+
+	span.SetAttributes(attribute.Bool("idempotency.claimed", true))
+	return true, nil
+}
+
+// idempotencyLeaseEnd returns when the lease of an in progress record
+// ends: with the deadline of the invocation, rounded up to the second.
+func idempotencyLeaseEnd(
+	ctx context.Context,
+	now time.Time,
+) time.Time {
+	deadline, ok := ctx.Deadline()
+	if !ok || deadline.Sub(now) > IDEMPOTENCY_MAX_LEASE {
+		deadline = now.Add(IDEMPOTENCY_MAX_LEASE)
+	}
+	return deadline.Add(time.Second - 1).Truncate(time.Second)
+}
+
+func getIdempotencyRecord(
+	ctx context.Context,
+	parentSpan trace.Span,
+	idempotencyKey string,
+) (
+	*idempotencyRecord,
+	error,
+) {
+	ctx, span := startDynamoDBSpan(ctx, parentSpan, "GetItem", IDEMPOTENCY_TABLE_NAME)
+	defer span.End()
+
+	output, err := dynamoDBClient.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(IDEMPOTENCY_TABLE_NAME),
+		Key: map[string]*dynamodb.AttributeValue{
+			"idempotencyKey": {S: aws.String(idempotencyKey)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		recordDynamoDBError(span, err)
+		logger.error("Getting idempotency record is failed.", "idempotencyKey", idempotencyKey, "error", err)
+		return nil, err
+	}
+
+	if len(output.Item) == 0 {
+		return nil, nil
+	}
+
+	// The stored response holds the headers and the body only, the other
+	// fields are kept in their own attributes
+	record := &idempotencyRecord{}
+	if response := output.Item["response"]; response != nil {
+		err = json.Unmarshal([]byte(aws.StringValue(response.S)), record)
+		if err != nil {
+			recordDynamoDBError(span, err)
+			return nil, err
+		}
+	}
+	if status := output.Item["status"]; status != nil {
+		record.Status = aws.StringValue(status.S)
+	}
+	if statusCode := output.Item["statusCode"]; statusCode != nil {
+		record.StatusCode, _ = strconv.Atoi(aws.StringValue(statusCode.N))
+	}
+	if requestHash := output.Item["requestHash"]; requestHash != nil {
+		record.RequestHash = aws.StringValue(requestHash.S)
+	}
+	return record, nil
+}
+
+// completeIdempotencyKey keeps the response for replays and extends the
+// lease of the record to the idempotency TTL.
+func completeIdempotencyKey(
+	ctx context.Context,
+	parentSpan trace.Span,
+	idempotencyKey string,
+	result *createResult,
+) {
+	ctx, span := startDynamoDBSpan(ctx, parentSpan, "UpdateItem", IDEMPOTENCY_TABLE_NAME)
+	defer span.End()
+
+	expiresAt := time.Now().UTC().Add(time.Duration(IDEMPOTENCY_TTL_SECONDS) * time.Second)
+
+	responseAsBytes, err := json.Marshal(&idempotencyRecord{
+		Headers: result.Headers,
+		Body:    result.Body,
+	})
+	if err != nil {
+		recordDynamoDBError(span, err)
+		return
+	}
+
+	_, err = dynamoDBClient.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(IDEMPOTENCY_TABLE_NAME),
+		Key: map[string]*dynamodb.AttributeValue{
+			"idempotencyKey": {S: aws.String(idempotencyKey)},
+		},
+		UpdateExpression: aws.String("SET #status = :status, statusCode = :statusCode, #response = :response, expiresAt = :expiresAt"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status":   aws.String("status"),
+			"#response": aws.String("response"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":status":     {S: aws.String(IDEMPOTENCY_STATUS_COMPLETED)},
+			":statusCode": {N: aws.String(strconv.Itoa(result.StatusCode))},
+			":response":   {S: aws.String(string(responseAsBytes))},
+			":expiresAt":  {N: aws.String(strconv.FormatInt(expiresAt.Unix(), 10))},
+		},
+	})
+	if err != nil {
+		recordDynamoDBError(span, err)
+		logger.error("Completing idempotency key is failed.", "idempotencyKey", idempotencyKey, "error", err)
+	}
+}
+
+// releaseIdempotencyKey deletes the in progress record of this request
+// only. Once the lease has expired, another request might have claimed the
+// key already and its record is left as it is.
+func releaseIdempotencyKey(
+	ctx context.Context,
+	parentSpan trace.Span,
+	idempotencyKey string,
+	requestHash string,
+) {
+	ctx, span := startDynamoDBSpan(ctx, parentSpan, "DeleteItem", IDEMPOTENCY_TABLE_NAME)
+	defer span.End()
+
+	_, err := dynamoDBClient.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(IDEMPOTENCY_TABLE_NAME),
+		Key: map[string]*dynamodb.AttributeValue{
+			"idempotencyKey": {S: aws.String(idempotencyKey)},
+		},
+		ConditionExpression: aws.String("#status = :status AND requestHash = :requestHash"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":status":      {S: aws.String(IDEMPOTENCY_STATUS_IN_PROGRESS)},
+			":requestHash": {S: aws.String(requestHash)},
+		},
+	})
+
+	if isConditionalCheckFailed(err) {
+		span.SetAttributes(attribute.Bool("idempotency.released", false))
+		return
+	}
+
+	if err != nil {
+		recordDynamoDBError(span, err)
+		logger.error("Releasing idempotency key is failed.", "idempotencyKey", idempotencyKey, "error", err)
+		return
+	}
+
+	span.SetAttributes(attribute.Bool("idempotency.released", true))
+}
+
+func isConditionalCheckFailed(
+	err error,
+) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+	}
+	return false
+}
+
+func recordDynamoDBError(
+	span trace.Span,
+	err error,
+) {
+	span.SetAttributes([]attribute.KeyValue{
+		semconv.OtelStatusCodeError,
+		semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+	}...)
+
+	span.RecordError(err, trace.WithAttributes(
+		semconv.ExceptionEscaped(true),
+	))
+}
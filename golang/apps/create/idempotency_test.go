@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// fakeIdempotencyTable keeps the idempotency records in memory and
+// evaluates the conditions which the middleware uses.
+type fakeIdempotencyTable struct {
+	dynamodbiface.DynamoDBAPI
+
+	mutex sync.Mutex
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func newFakeIdempotencyTable() *fakeIdempotencyTable {
+	return &fakeIdempotencyTable{
+		items: map[string]map[string]*dynamodb.AttributeValue{},
+	}
+}
+
+func (f *fakeIdempotencyTable) PutItemWithContext(
+	_ aws.Context,
+	input *dynamodb.PutItemInput,
+	_ ...request.Option,
+) (
+	*dynamodb.PutItemOutput,
+	error,
+) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	key := aws.StringValue(input.Item["idempotencyKey"].S)
+	if existing, ok := f.items[key]; ok {
+		expiresAt, _ := strconv.ParseInt(aws.StringValue(existing["expiresAt"].N), 10, 64)
+		now, _ := strconv.ParseInt(aws.StringValue(input.ExpressionAttributeValues[":now"].N), 10, 64)
+		if expiresAt >= now {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+		}
+	}
+	f.items[key] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeIdempotencyTable) GetItemWithContext(
+	_ aws.Context,
+	input *dynamodb.GetItemInput,
+	_ ...request.Option,
+) (
+	*dynamodb.GetItemOutput,
+	error,
+) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return &dynamodb.GetItemOutput{
+		Item: f.items[aws.StringValue(input.Key["idempotencyKey"].S)],
+	}, nil
+}
+
+func (f *fakeIdempotencyTable) UpdateItemWithContext(
+	_ aws.Context,
+	input *dynamodb.UpdateItemInput,
+	_ ...request.Option,
+) (
+	*dynamodb.UpdateItemOutput,
+	error,
+) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	item := f.items[aws.StringValue(input.Key["idempotencyKey"].S)]
+	item["status"] = input.ExpressionAttributeValues[":status"]
+	item["statusCode"] = input.ExpressionAttributeValues[":statusCode"]
+	item["response"] = input.ExpressionAttributeValues[":response"]
+	item["expiresAt"] = input.ExpressionAttributeValues[":expiresAt"]
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (f *fakeIdempotencyTable) DeleteItemWithContext(
+	_ aws.Context,
+	input *dynamodb.DeleteItemInput,
+	_ ...request.Option,
+) (
+	*dynamodb.DeleteItemOutput,
+	error,
+) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	key := aws.StringValue(input.Key["idempotencyKey"].S)
+	existing, ok := f.items[key]
+	if !ok ||
+		aws.StringValue(existing["status"].S) != aws.StringValue(input.ExpressionAttributeValues[":status"].S) ||
+		aws.StringValue(existing["requestHash"].S) != aws.StringValue(input.ExpressionAttributeValues[":requestHash"].S) {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	delete(f.items, key)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (f *fakeIdempotencyTable) expiresAt(
+	key string,
+) int64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	expiresAt, _ := strconv.ParseInt(aws.StringValue(f.items[key]["expiresAt"].N), 10, 64)
+	return expiresAt
+}
+
+func withIdempotencyTable(
+	t *testing.T,
+) *fakeIdempotencyTable {
+	previousClient, previousTable, previousTTL := dynamoDBClient, IDEMPOTENCY_TABLE_NAME, IDEMPOTENCY_TTL_SECONDS
+	t.Cleanup(func() {
+		dynamoDBClient, IDEMPOTENCY_TABLE_NAME, IDEMPOTENCY_TTL_SECONDS = previousClient, previousTable, previousTTL
+	})
+
+	table := newFakeIdempotencyTable()
+	dynamoDBClient = table
+	IDEMPOTENCY_TABLE_NAME = "idempotency"
+	IDEMPOTENCY_TTL_SECONDS = 3600
+	return table
+}
+
+func idempotentRequest(
+	body string,
+) *Request {
+	return &Request{
+		Method:  "POST",
+		Headers: map[string]string{"Idempotency-Key": "key-1"},
+		Body:    body,
+	}
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		first          *Request
+		firstStatus    int
+		second         *Request
+		wantStatusCode int
+		wantCalls      int
+	}{
+		{
+			name:           "replays the stored response",
+			first:          idempotentRequest(`{"item":"a"}`),
+			firstStatus:    201,
+			second:         idempotentRequest(`{"item":"a"}`),
+			wantStatusCode: 201,
+			wantCalls:      1,
+		},
+		{
+			name:           "rejects the key with another body",
+			first:          idempotentRequest(`{"item":"a"}`),
+			firstStatus:    201,
+			second:         idempotentRequest(`{"item":"b"}`),
+			wantStatusCode: 422,
+			wantCalls:      1,
+		},
+		{
+			name:           "processes again after a failure",
+			first:          idempotentRequest(`{"item":"a"}`),
+			firstStatus:    500,
+			second:         idempotentRequest(`{"item":"a"}`),
+			wantStatusCode: 201,
+			wantCalls:      2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withIdempotencyTable(t)
+
+			calls := 0
+			statusCode := tt.firstStatus
+			handler := idempotencyMiddleware(func(context.Context, *Request) *createResult {
+				calls++
+				result := &createResult{StatusCode: statusCode, Headers: map[string]string{}, Body: strconv.Itoa(calls)}
+				statusCode = 201
+				return result
+			})
+
+			handler(context.Background(), tt.first)
+			result := handler(context.Background(), tt.second)
+
+			if result.StatusCode != tt.wantStatusCode || calls != tt.wantCalls {
+				t.Errorf("status code = %d, calls = %d, want %d, %d", result.StatusCode, calls, tt.wantStatusCode, tt.wantCalls)
+			}
+			if tt.wantStatusCode == 201 && tt.wantCalls == 1 && result.Body != "1" {
+				t.Errorf("body = %q, want the stored response", result.Body)
+			}
+		})
+	}
+}
+
+func TestIdempotencyMiddlewareInProgress(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		wantStatusCode int
+	}{
+		{
+			name:           "same body waits for the first request",
+			body:           `{"item":"a"}`,
+			wantStatusCode: 409,
+		},
+		{
+			name:           "another body is rejected",
+			body:           `{"item":"b"}`,
+			wantStatusCode: 422,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withIdempotencyTable(t)
+
+			var second *createResult
+			handler := idempotencyMiddleware(func(ctx context.Context, req *Request) *createResult {
+
+				// A concurrent request while the first one is processed
+				second = idempotencyMiddleware(func(context.Context, *Request) *createResult {
+					t.Error("concurrent request is processed")
+					return &createResult{StatusCode: 201}
+				})(ctx, idempotentRequest(tt.body))
+				return &createResult{StatusCode: 201, Headers: map[string]string{}}
+			})
+			handler(context.Background(), idempotentRequest(`{"item":"a"}`))
+
+			if second.StatusCode != tt.wantStatusCode {
+				t.Errorf("status code = %d, want %d", second.StatusCode, tt.wantStatusCode)
+			}
+		})
+	}
+}
+
+func TestIdempotencyLease(t *testing.T) {
+	table := withIdempotencyTable(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	var leasedUntil int64
+	handler := idempotencyMiddleware(func(context.Context, *Request) *createResult {
+		leasedUntil = table.expiresAt("key-1")
+		return &createResult{StatusCode: 201, Headers: map[string]string{}}
+	})
+	handler(ctx, idempotentRequest(`{"item":"a"}`))
+
+	// In progress records are leased until the invocation times out
+	if leasedUntil < deadline.Unix() || leasedUntil > deadline.Unix()+1 {
+		t.Errorf("in progress record expires at %d, want the deadline %d", leasedUntil, deadline.Unix())
+	}
+
+	// Completed records are kept for the TTL
+	if completedUntil := table.expiresAt("key-1"); completedUntil < time.Now().Add(time.Hour).Unix()-1 {
+		t.Errorf("completed record expires at %d, want the TTL", completedUntil)
+	}
+}
+
+func TestIdempotencyLeaseEnd(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		deadline time.Time
+		want     time.Time
+	}{
+		{
+			name: "without deadline",
+			want: now.Add(IDEMPOTENCY_MAX_LEASE),
+		},
+		{
+			name:     "deadline",
+			deadline: now.Add(30 * time.Second),
+			want:     now.Add(30 * time.Second),
+		},
+		{
+			name:     "deadline within a second",
+			deadline: now.Add(30*time.Second + time.Millisecond),
+			want:     now.Add(31 * time.Second),
+		},
+		{
+			name:     "deadline beyond the longest invocation",
+			deadline: now.Add(time.Hour),
+			want:     now.Add(IDEMPOTENCY_MAX_LEASE),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if !tt.deadline.IsZero() {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, tt.deadline)
+				defer cancel()
+			}
+
+			if got := idempotencyLeaseEnd(ctx, now); !got.Equal(tt.want) {
+				t.Errorf("idempotencyLeaseEnd() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdempotencyExpiredLeaseIsClaimedAgain(t *testing.T) {
+	table := withIdempotencyTable(t)
+
+	// An invocation which died while processing
+	table.items["key-1"] = map[string]*dynamodb.AttributeValue{
+		"idempotencyKey": {S: aws.String("key-1")},
+		"status":         {S: aws.String(IDEMPOTENCY_STATUS_IN_PROGRESS)},
+		"requestHash":    {S: aws.String(hashIdempotentRequest(idempotentRequest(`{"item":"a"}`)))},
+		"expiresAt":      {N: aws.String(strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10))},
+	}
+
+	calls := 0
+	handler := idempotencyMiddleware(func(context.Context, *Request) *createResult {
+		calls++
+		return &createResult{StatusCode: 201, Headers: map[string]string{}}
+	})
+
+	if result := handler(context.Background(), idempotentRequest(`{"item":"a"}`)); result.StatusCode != 201 || calls != 1 {
+		t.Errorf("status code = %d, calls = %d, want 201, 1", result.StatusCode, calls)
+	}
+}
+
+func TestReleaseIdempotencyKey(t *testing.T) {
+	requestHash := hashIdempotentRequest(idempotentRequest(`{"item":"a"}`))
+
+	tests := []struct {
+		name         string
+		status       string
+		requestHash  string
+		wantReleased bool
+	}{
+		{
+			name:         "own record",
+			status:       IDEMPOTENCY_STATUS_IN_PROGRESS,
+			requestHash:  requestHash,
+			wantReleased: true,
+		},
+		{
+			name:         "claimed by another request",
+			status:       IDEMPOTENCY_STATUS_IN_PROGRESS,
+			requestHash:  hashIdempotentRequest(idempotentRequest(`{"item":"b"}`)),
+			wantReleased: false,
+		},
+		{
+			name:         "completed by another request",
+			status:       IDEMPOTENCY_STATUS_COMPLETED,
+			requestHash:  requestHash,
+			wantReleased: false,
+		},
+		{
+			name:         "no record",
+			wantReleased: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := withIdempotencyTable(t)
+			if tt.status != "" {
+				table.items["key-1"] = map[string]*dynamodb.AttributeValue{
+					"idempotencyKey": {S: aws.String("key-1")},
+					"status":         {S: aws.String(tt.status)},
+					"requestHash":    {S: aws.String(tt.requestHash)},
+				}
+			}
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+			releaseIdempotencyKey(ctx, span, "key-1", requestHash)
+			span.End()
+
+			_, kept := table.items["key-1"]
+			if wantKept := tt.status != "" && !tt.wantReleased; kept != wantKept {
+				t.Errorf("record kept = %v, want %v", kept, wantKept)
+			}
+
+			deleteSpan := recorder.Ended()[0]
+			if got := spanAttribute(deleteSpan, "idempotency.released").AsBool(); got != tt.wantReleased {
+				t.Errorf("idempotency.released = %v, want %v", got, tt.wantReleased)
+			}
+			if got := spanAttribute(deleteSpan, "otel.status_code").AsString(); got != "" {
+				t.Errorf("otel.status_code = %q, want none", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KEY_STRATEGY_UUID         = "uuid"
+	KEY_STRATEGY_TIMESTAMP    = "timestamp"
+	KEY_STRATEGY_CONTENT_HASH = "content-hash"
+)
+
+// KeyGenerator creates the S3 object keys of newly created objects from
+// the serialized object.
+type KeyGenerator interface {
+	Generate(
+		ctx context.Context,
+		body []byte,
+	) (
+		string,
+		error,
+	)
+}
+
+// newKeyGenerator creates the generator of the given KEY_STRATEGY. Unknown
+// strategies fall back to UUIDv7 keys.
+func newKeyGenerator(
+	strategy string,
+) KeyGenerator {
+	switch strings.ToLower(strategy) {
+	case KEY_STRATEGY_TIMESTAMP:
+		return newTimestampKeyGenerator()
+	case KEY_STRATEGY_CONTENT_HASH:
+		return contentHashKeyGenerator{}
+	case "", KEY_STRATEGY_UUID:
+	default:
+		logger.error("Key strategy is unknown, falling back to UUIDv7 keys.", "strategy", strategy)
+	}
+	return newUUIDV7KeyGenerator()
+}
+
+// uuidV7KeyGenerator creates time-ordered UUIDv7 keys (RFC 9562). Keys
+// created within the same millisecond stay unique thanks to the random
+// bits and remain sortable thanks to a monotonic sequence.
+type uuidV7KeyGenerator struct {
+	mutex    sync.Mutex
+	lastUnix int64
+	sequence uint16
+	now      func() time.Time
+}
+
+func newUUIDV7KeyGenerator() *uuidV7KeyGenerator {
+	return &uuidV7KeyGenerator{
+		now: time.Now,
+	}
+}
+
+func (g *uuidV7KeyGenerator) Generate(
+	ctx context.Context,
+	body []byte,
+) (
+	string,
+	error,
+) {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return "", err
+	}
+
+	g.mutex.Lock()
+	unixMilli := g.now().UTC().UnixMilli()
+	if unixMilli <= g.lastUnix {
+		// Clock did not move (or moved backwards), keep ordering with
+		// the 12 bit counter in rand_a.
+		unixMilli = g.lastUnix
+		g.sequence++
+		if g.sequence > 0x0fff {
+			unixMilli++
+			g.sequence = 0
+		}
+	} else {
+		g.sequence = uint16(uuid[6]&0x07)<<8 | uint16(uuid[7])
+	}
+	g.lastUnix = unixMilli
+	sequence := g.sequence
+	g.mutex.Unlock()
+
+	// 48 bit big-endian unix timestamp in milliseconds
+	uuid[0] = byte(unixMilli >> 40)
+	uuid[1] = byte(unixMilli >> 32)
+	uuid[2] = byte(unixMilli >> 24)
+	uuid[3] = byte(unixMilli >> 16)
+	uuid[4] = byte(unixMilli >> 8)
+	uuid[5] = byte(unixMilli)
+
+	// Version 7 & 12 bit sequence
+	uuid[6] = 0x70 | byte(sequence>>8)&0x0f
+	uuid[7] = byte(sequence)
+
+	// Variant 10xx
+	uuid[8] = uuid[8]&0x3f | 0x80
+
+	return formatUUID(uuid), nil
+}
+
+func formatUUID(
+	uuid [16]byte,
+) string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], uuid[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], uuid[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], uuid[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], uuid[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], uuid[10:])
+	return string(buf[:])
+}
+
+// timestampKeyGenerator keeps the former millisecond timestamp keys for
+// dashboards which rely on numeric object names. Two invocations within
+// the same millisecond overwrite each other.
+type timestampKeyGenerator struct {
+	now func() time.Time
+}
+
+func newTimestampKeyGenerator() *timestampKeyGenerator {
+	return &timestampKeyGenerator{
+		now: time.Now,
+	}
+}
+
+func (g *timestampKeyGenerator) Generate(
+	ctx context.Context,
+	body []byte,
+) (
+	string,
+	error,
+) {
+	return strconv.FormatInt(g.now().UTC().UnixMilli(), 10), nil
+}
+
+// contentHashKeyGenerator derives the key from the SHA-256 of the object,
+// so that the same object is always written to the same key of a day's
+// partition and repeated writes overwrite instead of piling up.
+type contentHashKeyGenerator struct{}
+
+func (g contentHashKeyGenerator) Generate(
+	ctx context.Context,
+	body []byte,
+) (
+	string,
+	error,
+) {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
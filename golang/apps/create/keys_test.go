@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+var uuidV7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestUUIDV7KeyGenerator(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		clock []time.Duration
+	}{
+		{
+			name:  "advancing clock",
+			clock: []time.Duration{0, time.Millisecond, 2 * time.Millisecond},
+		},
+		{
+			name:  "same millisecond",
+			clock: []time.Duration{0, 0, 0, 0},
+		},
+		{
+			name:  "clock moving backwards",
+			clock: []time.Duration{time.Second, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := newUUIDV7KeyGenerator()
+
+			keys := []string{}
+			for _, offset := range tt.clock {
+				now := start.Add(offset)
+				generator.now = func() time.Time { return now }
+
+				key, err := generator.Generate(context.Background(), nil)
+				if err != nil {
+					t.Fatalf("Generate() error = %v", err)
+				}
+				if !uuidV7Pattern.MatchString(key) {
+					t.Errorf("Generate() = %q, want a UUIDv7", key)
+				}
+				keys = append(keys, key)
+			}
+
+			// Keys sort in the order they have been created
+			if !sort.StringsAreSorted(keys) {
+				t.Errorf("keys %q are not sorted", keys)
+			}
+			seen := map[string]bool{}
+			for _, key := range keys {
+				if seen[key] {
+					t.Errorf("key %q is generated twice", key)
+				}
+				seen[key] = true
+			}
+		})
+	}
+}
+
+func TestUUIDV7KeyGeneratorSequenceOverflow(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	generator := newUUIDV7KeyGenerator()
+	generator.now = func() time.Time { return now }
+
+	previous := ""
+	for i := 0; i < 0x1000+2; i++ {
+		key, err := generator.Generate(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		if key <= previous {
+			t.Fatalf("key %q after %q is not ordered", key, previous)
+		}
+		previous = key
+	}
+
+	// The exhausted sequence moves on to the next millisecond
+	if generator.lastUnix != now.UnixMilli()+1 {
+		t.Errorf("lastUnix = %d, want %d", generator.lastUnix, now.UnixMilli()+1)
+	}
+}
+
+func TestNewKeyGenerator(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		want     KeyGenerator
+	}{
+		{
+			name:     "default",
+			strategy: "",
+			want:     &uuidV7KeyGenerator{},
+		},
+		{
+			name:     "uuid",
+			strategy: "UUID",
+			want:     &uuidV7KeyGenerator{},
+		},
+		{
+			name:     "timestamp",
+			strategy: "timestamp",
+			want:     &timestampKeyGenerator{},
+		},
+		{
+			name:     "content hash",
+			strategy: "content-hash",
+			want:     contentHashKeyGenerator{},
+		},
+		{
+			name:     "unknown",
+			strategy: "sequential",
+			want:     &uuidV7KeyGenerator{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newKeyGenerator(tt.strategy)
+
+			if gotType, wantType := fmt.Sprintf("%T", got), fmt.Sprintf("%T", tt.want); gotType != wantType {
+				t.Errorf("newKeyGenerator(%q) = %s, want %s", tt.strategy, gotType, wantType)
+			}
+		})
+	}
+}
+
+func TestTimestampKeyGenerator(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{
+			name: "utc",
+			now:  time.Date(2026, 1, 1, 0, 0, 0, 123e6, time.UTC),
+			want: "1767225600123",
+		},
+		{
+			name: "other zone",
+			now:  time.Date(2026, 1, 1, 1, 0, 0, 123e6, time.FixedZone("CET", 3600)),
+			want: "1767225600123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := newTimestampKeyGenerator()
+			generator.now = func() time.Time { return tt.now }
+
+			got, err := generator.Generate(context.Background(), nil)
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Generate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentHashKeyGenerator(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		want string
+	}{
+		{
+			name: "empty",
+			body: nil,
+			want: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			name: "object",
+			body: []byte("abc"),
+			want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := contentHashKeyGenerator{}.Generate(context.Background(), tt.body)
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Generate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	STORAGE_BACKEND_LOCAL = "local"
+
+	LOCAL_STORAGE_MODE_FILE   = "file"
+	LOCAL_STORAGE_MODE_MEMORY = "memory"
+)
+
+// localObject is what the local storage keeps per object. The tags carry
+// the trace id, so that propagation can be checked without AWS.
+type localObject struct {
+	Bucket string              `json:"bucket"`
+	Tags   []commons.ObjectTag `json:"tags,omitempty"`
+	Body   []byte              `json:"-"`
+}
+
+// localStorage writes the objects into a directory or keeps them in memory
+// for offline development. The put is traced like an S3 upload, so that
+// the trace has the same shape as with the S3 backend.
+type localStorage struct {
+	mutex   sync.Mutex
+	dir     string
+	objects map[string]*localObject
+}
+
+// newLocalStorage keeps the objects in memory when no directory is given.
+func newLocalStorage(
+	dir string,
+) *localStorage {
+	return &localStorage{
+		dir:     dir,
+		objects: map[string]*localObject{},
+	}
+}
+
+func (s *localStorage) Put(
+	ctx context.Context,
+	key string,
+	body []byte,
+	metadata commons.PutMetadata,
+) (
+	commons.PutResult,
+	error,
+) {
+	parentSpan := trace.SpanFromContext(ctx)
+
+	// Start local put span
+	_, span := parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "LocalStorage.Put",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes([]attribute.KeyValue{
+				attribute.String("aws.s3.bucket", metadata.Bucket),
+				attribute.String("aws.s3.key", key),
+				attribute.String("local.storage.mode", s.mode()),
+			}...))
+	defer span.End()
+
+	object := &localObject{
+		Bucket: metadata.Bucket,
+		Tags:   metadata.Tags,
+		Body:   body,
+	}
+
+	var err error
+	if s.dir == "" {
+		err = s.putInMemory(key, object, metadata.CreateOnly)
+	} else {
+		var path string
+		path, err = s.putInFile(key, object, metadata.CreateOnly)
+		span.SetAttributes(attribute.String("file.path", path))
+	}
+
+	if errors.Is(err, errPreconditionFailed) {
+		span.SetAttributes(attribute.String("error.type", "precondition_failed"))
+		return commons.PutResult{}, err
+	}
+
+	if err != nil {
+		span.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		span.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+		return commons.PutResult{}, newStoreError(err)
+	}
+	return commons.PutResult{
+		Checksum: checksumSHA256(body),
+	}, nil
+}
+
+func (s *localStorage) mode() string {
+	if s.dir == "" {
+		return LOCAL_STORAGE_MODE_MEMORY
+	}
+	return LOCAL_STORAGE_MODE_FILE
+}
+
+func (s *localStorage) putInMemory(
+	key string,
+	object *localObject,
+	createOnly bool,
+) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	objectKey := object.Bucket + "/" + key
+	if _, ok := s.objects[objectKey]; ok && createOnly {
+		return errPreconditionFailed
+	}
+	s.objects[objectKey] = object
+	return nil
+}
+
+// putInFile writes the body to <dir>/<bucket>/<key> and the bucket and
+// tags next to it to <dir>/<bucket>/<key>.meta.json.
+func (s *localStorage) putInFile(
+	key string,
+	object *localObject,
+	createOnly bool,
+) (
+	string,
+	error,
+) {
+	path := filepath.Join(s.dir, object.Bucket, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.dir)+string(filepath.Separator)) {
+		return path, fmt.Errorf("key %q escapes the storage directory", key)
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return path, err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if createOnly {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return path, errPreconditionFailed
+	}
+	if err != nil {
+		return path, err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(object.Body); err != nil {
+		return path, err
+	}
+
+	metadataAsBytes, err := json.Marshal(object)
+	if err != nil {
+		return path, err
+	}
+	return path, os.WriteFile(path+".meta.json", metadataAsBytes, 0o644)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+func TestLocalStoragePut(t *testing.T) {
+	tags := []commons.ObjectTag{{Key: "traceId", Value: "0af7651916cd43dd8448eb211c80319c"}}
+
+	tests := []struct {
+		name       string
+		inFile     bool
+		key        string
+		existing   bool
+		createOnly bool
+		wantErr    error
+		wantKind   StoreErrorKind
+	}{
+		{
+			name: "in memory",
+			key:  "2026/01/01/id",
+		},
+		{
+			name:       "in memory object exists",
+			key:        "2026/01/01/id",
+			existing:   true,
+			createOnly: true,
+			wantErr:    errPreconditionFailed,
+		},
+		{
+			name:     "in memory overwritten",
+			key:      "2026/01/01/id",
+			existing: true,
+		},
+		{
+			name:   "in file",
+			inFile: true,
+			key:    "2026/01/01/id",
+		},
+		{
+			name:       "in file object exists",
+			inFile:     true,
+			key:        "2026/01/01/id",
+			existing:   true,
+			createOnly: true,
+			wantErr:    errPreconditionFailed,
+		},
+		{
+			name:     "in file overwritten",
+			inFile:   true,
+			key:      "2026/01/01/id",
+			existing: true,
+		},
+		{
+			name:     "key escapes the directory",
+			inFile:   true,
+			key:      "../../etc/id",
+			wantKind: STORE_ERROR_KIND_UNKNOWN,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := ""
+			if tt.inFile {
+				dir = t.TempDir()
+			}
+			storage := newLocalStorage(dir)
+
+			tp, _ := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+			defer span.End()
+
+			if tt.existing {
+				if _, err := storage.Put(ctx, tt.key, []byte(`{"item":"old"}`), commons.PutMetadata{Bucket: "bucket"}); err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+			}
+
+			body := []byte(`{"item":"x"}`)
+			result, err := storage.Put(ctx, tt.key, body, commons.PutMetadata{
+				Bucket:     "bucket",
+				Tags:       tags,
+				CreateOnly: tt.createOnly,
+			})
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Put() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case tt.wantKind != "":
+				var storeErr *StoreError
+				if !errors.As(err, &storeErr) || storeErr.Kind != tt.wantKind {
+					t.Errorf("Put() error = %v, want store error of kind %q", err, tt.wantKind)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if result.Checksum != checksumSHA256(body) {
+				t.Errorf("Put() checksum = %q, want %q", result.Checksum, checksumSHA256(body))
+			}
+
+			if !tt.inFile {
+				object := storage.objects["bucket/"+tt.key]
+				if object == nil || string(object.Body) != string(body) || len(object.Tags) != len(tags) {
+					t.Errorf("stored object = %+v", object)
+				}
+				return
+			}
+
+			path := filepath.Join(dir, "bucket", filepath.FromSlash(tt.key))
+			stored, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading the object: %v", err)
+			}
+			if string(stored) != string(body) {
+				t.Errorf("stored body = %s, want %s", stored, body)
+			}
+
+			metadataAsBytes, err := os.ReadFile(path + ".meta.json")
+			if err != nil {
+				t.Fatalf("reading the metadata: %v", err)
+			}
+			var metadata localObject
+			if err := json.Unmarshal(metadataAsBytes, &metadata); err != nil {
+				t.Fatalf("decoding the metadata: %v", err)
+			}
+			if metadata.Bucket != "bucket" || len(metadata.Tags) != 1 || metadata.Tags[0] != tags[0] {
+				t.Errorf("stored metadata = %s", metadataAsBytes)
+			}
+		})
+	}
+}
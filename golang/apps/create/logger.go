@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type logLevel int
+
+const (
+	logLevelDebug logLevel = iota
+	logLevelInfo
+	logLevelWarn
+	logLevelError
+)
+
+func (l logLevel) String() string {
+	switch l {
+	case logLevelDebug:
+		return "debug"
+	case logLevelWarn:
+		return "warn"
+	case logLevelError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+func (l logLevel) slogLevel() slog.Level {
+	switch l {
+	case logLevelDebug:
+		return slog.LevelDebug
+	case logLevelWarn:
+		return slog.LevelWarn
+	case logLevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func parseLogLevel(
+	value string,
+) logLevel {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return logLevelDebug
+	case "warn", "warning":
+		return logLevelWarn
+	case "error":
+		return logLevelError
+	default:
+		return logLevelInfo
+	}
+}
+
+// structuredLogger writes one JSON object per line so that CloudWatch Logs
+// Insights can parse the fields. Lines below the configured level are
+// dropped, and so are debug and info lines while the trace of the current
+// invocation is not sampled. If a handler is set, the lines are passed to
+// it as well, in the span context of the current invocation.
+type structuredLogger struct {
+	mutex       sync.Mutex
+	level       logLevel
+	writer      io.Writer
+	unsampled   atomic.Bool
+	handler     slog.Handler
+	spanContext atomic.Pointer[trace.SpanContext]
+}
+
+func newStructuredLogger(
+	level logLevel,
+	writer io.Writer,
+) *structuredLogger {
+	return &structuredLogger{
+		level:  level,
+		writer: writer,
+	}
+}
+
+func (l *structuredLogger) debug(msg string, fields ...any) { l.log(logLevelDebug, msg, fields...) }
+func (l *structuredLogger) info(msg string, fields ...any)  { l.log(logLevelInfo, msg, fields...) }
+func (l *structuredLogger) warn(msg string, fields ...any)  { l.log(logLevelWarn, msg, fields...) }
+func (l *structuredLogger) error(msg string, fields ...any) { l.log(logLevelError, msg, fields...) }
+
+// exportTo passes the lines to the handler besides writing them. It is
+// called once at startup, before any line is written.
+func (l *structuredLogger) exportTo(
+	handler slog.Handler,
+) {
+	l.handler = handler
+}
+
+// bindTrace correlates the lines with the span of the context until the
+// returned function is called. Like reduceForTrace, it holds for the whole
+// invocation.
+func (l *structuredLogger) bindTrace(
+	ctx context.Context,
+) func() {
+	spanContext := trace.SpanFromContext(ctx).SpanContext()
+	l.spanContext.Store(&spanContext)
+	return func() {
+		l.spanContext.Store(nil)
+	}
+}
+
+// reduceForTrace drops the debug and info lines until the returned
+// function is called if the trace of the context has been sampled out.
+// Those lines cannot be correlated with a trace and only add to the
+// CloudWatch costs. Without a valid span context, e.g. when the SDK is
+// disabled, there is no sampling decision and nothing is dropped. An
+// execution environment serves one invocation at a time, so the logger is
+// reduced for the whole invocation.
+func (l *structuredLogger) reduceForTrace(
+	ctx context.Context,
+) func() {
+	spanContext := trace.SpanFromContext(ctx).SpanContext()
+	if !spanContext.IsValid() || spanContext.IsSampled() {
+		return func() {}
+	}
+
+	l.unsampled.Store(true)
+	return func() {
+		l.unsampled.Store(false)
+	}
+}
+
+// log takes the fields as alternating key/value pairs.
+func (l *structuredLogger) log(
+	level logLevel,
+	msg string,
+	fields ...any,
+) {
+	if level < l.level || (level < logLevelWarn && l.unsampled.Load()) {
+		return
+	}
+
+	entry := map[string]any{
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+		"level":     level.String(),
+		"message":   msg,
+	}
+	attrs := make([]slog.Attr, 0, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		value := fields[i+1]
+		if redactor.isRedactedField(key) {
+			value = REDACTED_VALUE
+		} else if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[key] = value
+		attrs = append(attrs, slog.Any(key, value))
+	}
+	if l.handler != nil {
+		l.export(level, msg, attrs)
+	}
+
+	entryAsBytes, err := json.Marshal(entry)
+	if err != nil {
+		entryAsBytes = []byte(fmt.Sprintf(`{"level":%q,"message":%q}`, level.String(), msg))
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	fmt.Fprintln(l.writer, string(entryAsBytes))
+}
+
+func (l *structuredLogger) export(
+	level logLevel,
+	msg string,
+	attrs []slog.Attr,
+) {
+	ctx := context.Background()
+	if spanContext := l.spanContext.Load(); spanContext != nil {
+		ctx = trace.ContextWithSpanContext(ctx, *spanContext)
+	}
+
+	record := slog.NewRecord(time.Now(), level.slogLevel(), msg, 0)
+	record.AddAttrs(attrs...)
+	if err := l.handler.Handle(ctx, record); err != nil {
+		fmt.Fprintf(os.Stderr, "Exporting log line is failed: %v\n", err)
+	}
+}
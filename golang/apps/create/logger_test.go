@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanContextWithFlags(
+	flags trace.TraceFlags,
+) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: flags,
+	}))
+}
+
+func TestStructuredLoggerReduceForTrace(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		wantInfo bool
+	}{
+		{
+			name:     "sampled trace keeps info lines",
+			ctx:      spanContextWithFlags(trace.FlagsSampled),
+			wantInfo: true,
+		},
+		{
+			name:     "unsampled trace drops info lines",
+			ctx:      spanContextWithFlags(0),
+			wantInfo: false,
+		},
+		{
+			name:     "missing span context keeps info lines",
+			ctx:      context.Background(),
+			wantInfo: true,
+		},
+		{
+			name:     "no-op span keeps info lines",
+			ctx:      trace.ContextWithSpan(context.Background(), trace.SpanFromContext(context.Background())),
+			wantInfo: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := newStructuredLogger(logLevelDebug, &buf)
+
+			restore := l.reduceForTrace(tt.ctx)
+			l.info("info line")
+			l.warn("warn line")
+			restore()
+			l.info("restored line")
+
+			output := buf.String()
+			if got := strings.Contains(output, "info line"); got != tt.wantInfo {
+				t.Errorf("info line written = %v, want %v", got, tt.wantInfo)
+			}
+			if !strings.Contains(output, "warn line") {
+				t.Error("warn line is dropped")
+			}
+			if !strings.Contains(output, "restored line") {
+				t.Error("info line after restoring is dropped")
+			}
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	LOGS_EXPORTER_OTLP         = "otlp"
+	DEFAULT_OTLP_LOGS_ENDPOINT = "http://localhost:4318/v1/logs"
+
+	// Records beyond this number are dropped until the next flush
+	LOG_RECORD_BUFFER_SIZE = 2048
+)
+
+// logRecord is a log line in the OpenTelemetry log data model. The span
+// context correlates the line with the trace it has been written in.
+type logRecord struct {
+	timestamp   time.Time
+	level       slog.Level
+	body        string
+	attributes  []attribute.KeyValue
+	spanContext trace.SpanContext
+}
+
+// logExporter sends the log records to a logs backend.
+type logExporter interface {
+	Export(
+		ctx context.Context,
+		res *resource.Resource,
+		records []logRecord,
+	) error
+}
+
+// LoggerProvider keeps the log records until they are flushed. The SDK
+// version in use has no logs signal yet, so the records are exported by
+// hand, like the EMF metrics are written. As the Lambda may be frozen
+// between invocations, they are flushed at the end of every request
+// together with the metrics.
+type LoggerProvider struct {
+	mutex    sync.Mutex
+	exporter logExporter
+	resource *resource.Resource
+	records  []logRecord
+	dropped  int
+}
+
+// newLoggerProvider creates a logger provider which sends the records to
+// the collector extension with OTLP over HTTP. The endpoint can be
+// overridden with OTEL_EXPORTER_OTLP_LOGS_ENDPOINT.
+func newLoggerProvider(
+	ctx context.Context,
+) (
+	*LoggerProvider,
+	error,
+) {
+	res, err := newResource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT")
+	if endpoint == "" {
+		endpoint = DEFAULT_OTLP_LOGS_ENDPOINT
+	}
+
+	return newLoggerProviderWithExporter(newOTLPLogExporter(endpoint, http.DefaultClient), res), nil
+}
+
+func newLoggerProviderWithExporter(
+	exporter logExporter,
+	res *resource.Resource,
+) *LoggerProvider {
+	return &LoggerProvider{
+		exporter: exporter,
+		resource: res,
+	}
+}
+
+func (p *LoggerProvider) emit(
+	record logRecord,
+) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.records) >= LOG_RECORD_BUFFER_SIZE {
+		p.dropped++
+		return
+	}
+	p.records = append(p.records, record)
+}
+
+// ForceFlush exports the pending records. Records which could not be
+// exported are dropped, the next flush would most likely fail as well.
+func (p *LoggerProvider) ForceFlush(
+	ctx context.Context,
+) error {
+	p.mutex.Lock()
+	records, dropped := p.records, p.dropped
+	p.records, p.dropped = nil, 0
+	p.mutex.Unlock()
+
+	if dropped > 0 {
+		fmt.Fprintf(os.Stderr, "%d log records are dropped, the buffer is full.\n", dropped)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return p.exporter.Export(ctx, p.resource, records)
+}
+
+// Shutdown exports the records which are still pending.
+func (p *LoggerProvider) Shutdown(
+	ctx context.Context,
+) error {
+	return p.ForceFlush(ctx)
+}
+
+// otlpLogExporter posts the records as OTLP JSON.
+type otlpLogExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+func newOTLPLogExporter(
+	endpoint string,
+	client *http.Client,
+) *otlpLogExporter {
+	return &otlpLogExporter{
+		endpoint: endpoint,
+		client:   client,
+	}
+}
+
+func (e *otlpLogExporter) Export(
+	ctx context.Context,
+	res *resource.Resource,
+	records []logRecord,
+) error {
+	requestAsBytes, err := json.Marshal(newOTLPLogsRequest(res, records))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(requestAsBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("exporting logs is failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string         `json:"timeUnixNano"`
+	SeverityNumber int            `json:"severityNumber"`
+	SeverityText   string         `json:"severityText"`
+	Body           otlpAnyValue   `json:"body"`
+	Attributes     []otlpKeyValue `json:"attributes,omitempty"`
+	TraceID        string         `json:"traceId,omitempty"`
+	SpanID         string         `json:"spanId,omitempty"`
+	Flags          uint32         `json:"flags,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// newOTLPLogsRequest maps the records to the OTLP JSON encoding, which
+// writes the trace and span ids in hex and 64 bit integers as strings.
+func newOTLPLogsRequest(
+	res *resource.Resource,
+	records []logRecord,
+) *otlpLogsRequest {
+	logRecords := make([]otlpLogRecord, 0, len(records))
+	for _, record := range records {
+		logRecord := otlpLogRecord{
+			TimeUnixNano:   strconv.FormatInt(record.timestamp.UnixNano(), 10),
+			SeverityNumber: severityNumber(record.level),
+			SeverityText:   record.level.String(),
+			Body:           otlpString(record.body),
+			Attributes:     otlpKeyValues(record.attributes),
+		}
+		if record.spanContext.IsValid() {
+			traceID, spanID := record.spanContext.TraceID(), record.spanContext.SpanID()
+			logRecord.TraceID = hex.EncodeToString(traceID[:])
+			logRecord.SpanID = hex.EncodeToString(spanID[:])
+			logRecord.Flags = uint32(record.spanContext.TraceFlags())
+		}
+		logRecords = append(logRecords, logRecord)
+	}
+
+	return &otlpLogsRequest{
+		ResourceLogs: []otlpResourceLogs{
+			{
+				Resource: otlpResource{
+					Attributes: otlpKeyValues(res.Attributes()),
+				},
+				ScopeLogs: []otlpScopeLogs{
+					{
+						Scope:      otlpScope{Name: INSTRUMENTATION_SCOPE_NAME},
+						LogRecords: logRecords,
+					},
+				},
+			},
+		},
+	}
+}
+
+// severityNumber maps the slog levels onto the OpenTelemetry severities,
+// where INFO is 9 and every level is 4 apart like in slog.
+func severityNumber(
+	level slog.Level,
+) int {
+	return int(level) + 9
+}
+
+func otlpString(
+	value string,
+) otlpAnyValue {
+	return otlpAnyValue{StringValue: &value}
+}
+
+func otlpKeyValues(
+	attributes []attribute.KeyValue,
+) []otlpKeyValue {
+	keyValues := make([]otlpKeyValue, 0, len(attributes))
+	for _, kv := range attributes {
+		value := otlpAnyValue{}
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			boolValue := kv.Value.AsBool()
+			value.BoolValue = &boolValue
+		case attribute.INT64:
+			intValue := strconv.FormatInt(kv.Value.AsInt64(), 10)
+			value.IntValue = &intValue
+		case attribute.FLOAT64:
+			doubleValue := kv.Value.AsFloat64()
+			value.DoubleValue = &doubleValue
+		default:
+			value = otlpString(kv.Value.Emit())
+		}
+		keyValues = append(keyValues, otlpKeyValue{Key: string(kv.Key), Value: value})
+	}
+	return keyValues
+}
+
+// otelLogHandler bridges slog to the logger provider. Every record becomes
+// an OpenTelemetry log record which carries the trace and span id of the
+// span in the context.
+type otelLogHandler struct {
+	provider   *LoggerProvider
+	attributes []attribute.KeyValue
+	group      string
+}
+
+func newOTelLogHandler(
+	provider *LoggerProvider,
+) *otelLogHandler {
+	return &otelLogHandler{
+		provider: provider,
+	}
+}
+
+// Enabled lets every level pass, the structured logger drops the records
+// below its level already.
+func (h *otelLogHandler) Enabled(
+	context.Context,
+	slog.Level,
+) bool {
+	return true
+}
+
+func (h *otelLogHandler) Handle(
+	ctx context.Context,
+	r slog.Record,
+) error {
+	attributes := append([]attribute.KeyValue{}, h.attributes...)
+	r.Attrs(func(attr slog.Attr) bool {
+		attributes = appendSlogAttr(attributes, h.group, attr)
+		return true
+	})
+
+	h.provider.emit(logRecord{
+		timestamp:   r.Time,
+		level:       r.Level,
+		body:        r.Message,
+		attributes:  attributes,
+		spanContext: trace.SpanContextFromContext(ctx),
+	})
+	return nil
+}
+
+func (h *otelLogHandler) WithAttrs(
+	attrs []slog.Attr,
+) slog.Handler {
+	attributes := append([]attribute.KeyValue{}, h.attributes...)
+	for _, attr := range attrs {
+		attributes = appendSlogAttr(attributes, h.group, attr)
+	}
+	return &otelLogHandler{
+		provider:   h.provider,
+		attributes: attributes,
+		group:      h.group,
+	}
+}
+
+func (h *otelLogHandler) WithGroup(
+	name string,
+) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &otelLogHandler{
+		provider:   h.provider,
+		attributes: h.attributes,
+		group:      groupKey(h.group, name),
+	}
+}
+
+// appendSlogAttr flattens groups into dotted keys, OTLP attributes have no
+// nesting.
+func appendSlogAttr(
+	attributes []attribute.KeyValue,
+	group string,
+	attr slog.Attr,
+) []attribute.KeyValue {
+	value := attr.Value.Resolve()
+	key := groupKey(group, attr.Key)
+
+	switch value.Kind() {
+	case slog.KindGroup:
+		for _, groupAttr := range value.Group() {
+			attributes = appendSlogAttr(attributes, key, groupAttr)
+		}
+		return attributes
+	case slog.KindBool:
+		return append(attributes, attribute.Bool(key, value.Bool()))
+	case slog.KindInt64:
+		return append(attributes, attribute.Int64(key, value.Int64()))
+	case slog.KindUint64:
+		return append(attributes, attribute.Int64(key, int64(value.Uint64())))
+	case slog.KindFloat64:
+		return append(attributes, attribute.Float64(key, value.Float64()))
+	case slog.KindTime:
+		return append(attributes, attribute.String(key, value.Time().UTC().Format(time.RFC3339Nano)))
+	default:
+		return append(attributes, attribute.String(key, value.String()))
+	}
+}
+
+func groupKey(
+	group string,
+	key string,
+) string {
+	if group == "" {
+		return key
+	}
+	return group + "." + key
+}
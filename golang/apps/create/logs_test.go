@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeLogExporter records the exported log records.
+type fakeLogExporter struct {
+	exports [][]logRecord
+}
+
+func (e *fakeLogExporter) Export(
+	_ context.Context,
+	_ *resource.Resource,
+	records []logRecord,
+) error {
+	e.exports = append(e.exports, records)
+	return nil
+}
+
+func TestStructuredLoggerExport(t *testing.T) {
+	tp, _ := newRecordingTracerProvider()
+	spanCtx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+	defer span.End()
+	traceID, spanID := span.SpanContext().TraceID(), span.SpanContext().SpanID()
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		log          func(l *structuredLogger)
+		wantRecords  int
+		wantSeverity int
+		wantTraceID  string
+		wantSpanID   string
+		wantKey      string
+	}{
+		{
+			name:         "active span",
+			ctx:          spanCtx,
+			log:          func(l *structuredLogger) { l.info("Object is stored.", "key", "2026/01/01/id") },
+			wantRecords:  1,
+			wantSeverity: 9,
+			wantTraceID:  hex.EncodeToString(traceID[:]),
+			wantSpanID:   hex.EncodeToString(spanID[:]),
+			wantKey:      "2026/01/01/id",
+		},
+		{
+			name:         "error line",
+			ctx:          spanCtx,
+			log:          func(l *structuredLogger) { l.error("Storing object is failed.", "key", "2026/01/01/id") },
+			wantRecords:  1,
+			wantSeverity: 17,
+			wantTraceID:  hex.EncodeToString(traceID[:]),
+			wantSpanID:   hex.EncodeToString(spanID[:]),
+			wantKey:      "2026/01/01/id",
+		},
+		{
+			name:         "without span",
+			ctx:          context.Background(),
+			log:          func(l *structuredLogger) { l.info("Object is stored.", "key", "2026/01/01/id") },
+			wantRecords:  1,
+			wantSeverity: 9,
+			wantKey:      "2026/01/01/id",
+		},
+		{
+			name:         "redacted field",
+			ctx:          spanCtx,
+			log:          func(l *structuredLogger) { l.warn("Request is rejected.", "key", "secret") },
+			wantRecords:  1,
+			wantSeverity: 13,
+			wantTraceID:  hex.EncodeToString(traceID[:]),
+			wantSpanID:   hex.EncodeToString(spanID[:]),
+			wantKey:      REDACTED_VALUE,
+		},
+		{
+			name:        "below level",
+			ctx:         spanCtx,
+			log:         func(l *structuredLogger) { l.debug("Object is stored.", "key", "2026/01/01/id") },
+			wantRecords: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := redactor
+			t.Cleanup(func() { redactor = previous })
+			if tt.wantKey == REDACTED_VALUE {
+				redactor = newFieldRedactor("key")
+			}
+
+			var got otlpLogsRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("Content-Type = %q, want application/json", r.Header.Get("Content-Type"))
+				}
+				body, _ := io.ReadAll(r.Body)
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Errorf("decoding export request is failed: %v", err)
+				}
+			}))
+			defer server.Close()
+
+			provider := newLoggerProviderWithExporter(newOTLPLogExporter(server.URL, server.Client()), resource.Empty())
+			l := newStructuredLogger(logLevelInfo, io.Discard)
+			l.exportTo(newOTelLogHandler(provider))
+
+			unbind := l.bindTrace(tt.ctx)
+			tt.log(l)
+			unbind()
+
+			if err := provider.ForceFlush(context.Background()); err != nil {
+				t.Fatalf("ForceFlush() error = %v", err)
+			}
+
+			if tt.wantRecords == 0 {
+				if len(got.ResourceLogs) != 0 {
+					t.Errorf("exported %d resource logs, want none", len(got.ResourceLogs))
+				}
+				return
+			}
+			scopeLogs := got.ResourceLogs[0].ScopeLogs[0]
+			if scopeLogs.Scope.Name != INSTRUMENTATION_SCOPE_NAME {
+				t.Errorf("scope = %q, want %q", scopeLogs.Scope.Name, INSTRUMENTATION_SCOPE_NAME)
+			}
+			if len(scopeLogs.LogRecords) != tt.wantRecords {
+				t.Fatalf("exported %d records, want %d", len(scopeLogs.LogRecords), tt.wantRecords)
+			}
+			record := scopeLogs.LogRecords[0]
+			if record.SeverityNumber != tt.wantSeverity {
+				t.Errorf("severityNumber = %d, want %d", record.SeverityNumber, tt.wantSeverity)
+			}
+			if record.TraceID != tt.wantTraceID {
+				t.Errorf("traceId = %q, want %q", record.TraceID, tt.wantTraceID)
+			}
+			if record.SpanID != tt.wantSpanID {
+				t.Errorf("spanId = %q, want %q", record.SpanID, tt.wantSpanID)
+			}
+			if len(record.Attributes) != 1 || record.Attributes[0].Key != "key" || *record.Attributes[0].Value.StringValue != tt.wantKey {
+				t.Errorf("attributes = %+v, want key=%q", record.Attributes, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestOTelLogHandler(t *testing.T) {
+	tp, _ := newRecordingTracerProvider()
+	ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+	defer span.End()
+
+	tests := []struct {
+		name           string
+		ctx            context.Context
+		log            func(ctx context.Context, l *slog.Logger)
+		wantLevel      slog.Level
+		wantAttributes map[string]string
+		wantTraceID    trace.TraceID
+	}{
+		{
+			name: "active span",
+			ctx:  ctx,
+			log: func(ctx context.Context, l *slog.Logger) {
+				l.InfoContext(ctx, "Object is stored.", "key", "2026/01/01/id")
+			},
+			wantLevel:      slog.LevelInfo,
+			wantAttributes: map[string]string{"key": "2026/01/01/id"},
+			wantTraceID:    span.SpanContext().TraceID(),
+		},
+		{
+			name: "without span",
+			ctx:  context.Background(),
+			log: func(ctx context.Context, l *slog.Logger) {
+				l.WarnContext(ctx, "Object is stored.", "key", "2026/01/01/id")
+			},
+			wantLevel:      slog.LevelWarn,
+			wantAttributes: map[string]string{"key": "2026/01/01/id"},
+		},
+		{
+			name: "groups and attributes",
+			ctx:  ctx,
+			log: func(ctx context.Context, l *slog.Logger) {
+				l.With("bucket", "objects").WithGroup("object").ErrorContext(ctx, "Storing object is failed.",
+					slog.Group("s3", "key", "2026/01/01/id"),
+				)
+			},
+			wantLevel: slog.LevelError,
+			wantAttributes: map[string]string{
+				"bucket":        "objects",
+				"object.s3.key": "2026/01/01/id",
+			},
+			wantTraceID: span.SpanContext().TraceID(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := &fakeLogExporter{}
+			provider := newLoggerProviderWithExporter(exporter, resource.Empty())
+
+			tt.log(tt.ctx, slog.New(newOTelLogHandler(provider)))
+			if err := provider.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown() error = %v", err)
+			}
+
+			if len(exporter.exports) != 1 || len(exporter.exports[0]) != 1 {
+				t.Fatalf("exports = %v, want one record", exporter.exports)
+			}
+			record := exporter.exports[0][0]
+			if record.level != tt.wantLevel {
+				t.Errorf("level = %v, want %v", record.level, tt.wantLevel)
+			}
+			if got := record.spanContext.TraceID(); got != tt.wantTraceID {
+				t.Errorf("trace id = %v, want %v", got, tt.wantTraceID)
+			}
+			if len(record.attributes) != len(tt.wantAttributes) {
+				t.Errorf("attributes = %v, want %v", record.attributes, tt.wantAttributes)
+			}
+			for _, kv := range record.attributes {
+				if want := tt.wantAttributes[string(kv.Key)]; kv.Value.AsString() != want {
+					t.Errorf("attribute %s = %q, want %q", kv.Key, kv.Value.AsString(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoggerProviderForceFlush(t *testing.T) {
+	tests := []struct {
+		name        string
+		records     int
+		wantExports int
+		wantRecords int
+	}{
+		{
+			name:        "nothing pending",
+			records:     0,
+			wantExports: 0,
+		},
+		{
+			name:        "pending records",
+			records:     3,
+			wantExports: 1,
+			wantRecords: 3,
+		},
+		{
+			name:        "full buffer",
+			records:     LOG_RECORD_BUFFER_SIZE + 1,
+			wantExports: 1,
+			wantRecords: LOG_RECORD_BUFFER_SIZE,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := &fakeLogExporter{}
+			provider := newLoggerProviderWithExporter(exporter, resource.Empty())
+			for i := 0; i < tt.records; i++ {
+				provider.emit(logRecord{body: "line"})
+			}
+
+			if err := provider.ForceFlush(context.Background()); err != nil {
+				t.Fatalf("ForceFlush() error = %v", err)
+			}
+			if err := provider.ForceFlush(context.Background()); err != nil {
+				t.Fatalf("ForceFlush() error = %v", err)
+			}
+
+			if len(exporter.exports) != tt.wantExports {
+				t.Fatalf("got %d exports, want %d", len(exporter.exports), tt.wantExports)
+			}
+			if tt.wantExports > 0 && len(exporter.exports[0]) != tt.wantRecords {
+				t.Errorf("exported %d records, want %d", len(exporter.exports[0]), tt.wantRecords)
+			}
+		})
+	}
+}
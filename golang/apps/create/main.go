@@ -1,11 +1,11 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"math/rand"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -14,27 +14,142 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda/xrayconfig"
 	"go.opentelemetry.io/contrib/propagators/aws/xray"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
 )
 
 const (
 	OTEL_STATUS_ERROR_DESCRIPTION = "Create Lambda is failed."
 	CUSTOM_OTEL_SPAN_EVENT_NAME   = "LambdaCreateEvent"
+
+	// The instrumentation scope names the code which creates the spans and
+	// stays the same across deployments. The service name belongs on the
+	// resource.
+	INSTRUMENTATION_SCOPE_NAME = "github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/create"
+
+	DEFAULT_CIRCUIT_BREAKER_FAILURE_THRESHOLD = 5
+	DEFAULT_CIRCUIT_BREAKER_COOLDOWN_SECONDS  = 30
+	DEFAULT_BATCH_CONCURRENCY                 = 5
+	DEFAULT_MAX_BODY_SIZE_BYTES               = 256 * 1024
+	TRACER_PROVIDER_FLUSH_TIMEOUT             = 2 * time.Second
+	DEFAULT_IDEMPOTENCY_TTL_SECONDS           = 24 * 60 * 60
+	DEFAULT_PRESIGNED_URL_EXPIRY_SECONDS      = 15 * 60
+	MAX_CAPTURED_BODY_SIZE_BYTES              = 4 * 1024
 )
 
 var (
-	randomizer           = rand.New(rand.NewSource(time.Now().UnixNano()))
-	OTEL_SERVICE_NAME    string
-	INPUT_S3_BUCKET_NAME string
-	uploader             *s3manager.Uploader
+	randomizer                  = rand.New(rand.NewSource(time.Now().UnixNano()))
+	OTEL_SERVICE_NAME           string
+	AWS_REGION                  string
+	SERVICE_NAMESPACE           string
+	SERVICE_VERSION             string
+	DEPLOYMENT_ENVIRONMENT      string
+	OTEL_SPAN_PROCESSOR         string
+	INPUT_S3_BUCKET_NAME        string
+	TENANT_BUCKET_MAP           map[string]string
+	TARGET_BUCKET_ALLOWLIST     map[string]bool
+	AUTHORIZER_CLAIM_ATTRIBUTES map[string]string
+	CORS_ALLOWED_ORIGINS        []string
+	ALLOWED_METHODS             = parseAllowedMethods(DEFAULT_ALLOWED_METHODS)
+	ALLOWED_QUERY_PARAMS        map[string]bool
+	REDACT_KEYS                 = parseRedactKeys("")
+	REDACT_MODE                 string
+	REDACT_STORED_OBJECTS       bool
+	CAPTURE_REQUEST_BODY        bool
+	DEBUG_PROPAGATION           bool
+	OBJECT_KEY_PREFIX           string
+	BATCH_CONCURRENCY           int
+	MAX_BODY_SIZE_BYTES         int
+	IDEMPOTENCY_TABLE_NAME      string
+	IDEMPOTENCY_TTL_SECONDS     int
+	PRESIGN_URLS                bool
+	DRY_RUN                     bool
+	VERIFY_WRITES               bool
+	MANIFEST_KEY_PREFIX         string
+	MANIFEST_S3_BUCKET_NAME     string
+	TRACE_HTTP_INTERNALS        bool
+	FORCE_FLUSH_PER_INVOCATION  bool
+	ENABLE_DEDUP                bool
+	S3_UPLOAD_MAX_ATTEMPTS      int
+	S3_UPLOAD_BASE_DELAY        time.Duration
+	S3_UPLOAD_PART_SIZE         int64
+	S3_UPLOAD_CONCURRENCY       int
+	S3_UPLOAD_LEAVE_PARTS       bool
+	S3_DEADLINE_MARGIN          time.Duration
+	COMPRESSION_THRESHOLD_BYTES int
+	STORE_ERROR_STATUS_CODES    = DEFAULT_STORE_ERROR_STATUS_CODES
+	S3_OBJECT_TAGS              []commons.ObjectTag
+	S3_SSE_KMS_KEY_ID           string
+	S3_SSE_KMS_KEY_ATTRIBUTE    string
+	S3_OBJECT_ACL               string
+	S3_ENDPOINT                 string
+	S3_TARGET_ROLE_ARN          string
+	assumedRole                 *assumeRoleProvider
+	targetRoleCredentials       *credentials.Credentials
+	S3_FORCE_PATH_STYLE         bool
+	JWKS_URL                    string
+	JWT_ISSUER                  string
+	JWT_AUDIENCE                string
+	FORCE_SAMPLE_SECRET         string
+	FUNCTION_MEMORY_SIZE_MB     int
+	SLA                         time.Duration
+	keySet                      *jwks
+	limiter                     *rateLimiter
+	deduper                     *dedupeCache
+	rateLimitCounter            metric.Int64Counter
+	throttleCounter             metric.Int64Counter
+	RESPONSE_VERSION_DEFAULT    = RESPONSE_VERSION_V1
+	PRESIGNED_URL_EXPIRY        time.Duration
+	STORAGE_BACKEND             string
+	STORAGE_TABLE_NAME          string
+	storage                     commons.Storage
+	FAILOVER_S3_BUCKET_NAME     string
+	FAILOVER_AWS_REGION         string
+	failoverStorage             commons.Storage
+	STORAGE_MAX_CONCURRENT_PUTS int
+	putQueueTimeHistogram       metric.Float64Histogram
+	s3Client                    *s3.S3
+	breaker                     *circuitBreaker
+	keyGenerator                KeyGenerator
+	tracerProvider              *sdktrace.TracerProvider
+	meterProvider               *sdkmetric.MeterProvider
+	loggerProvider              *LoggerProvider
+	OTEL_SDK_DISABLED           bool
+	METRICS_BACKEND             string
+	emfMetrics                  *emfEmitter
+	errorCounter                metric.Int64Counter
+	handlerDurationHistogram    metric.Float64Histogram
+	logger                      = newStructuredLogger(logLevelInfo, os.Stdout)
+	redactor                    = newFieldRedactor("")
+	requestHandler              = chainMiddlewares(routeRequest,
+		warmupMiddleware,
+		dryRunMiddleware,
+		claimsMiddleware,
+		loggingMiddleware,
+		corsMiddleware,
+		recoverMiddleware,
+		rateLimitMiddleware,
+		authMiddleware,
+		acceptMiddleware,
+		idempotencyMiddleware,
+	)
 )
 
 type CustomObject struct {
@@ -43,122 +158,999 @@ type CustomObject struct {
 	IsChecked bool   `json:"isChecked"`
 }
 
+// CreateResponse describes the stored object. The checksum is the SHA-256
+// digest of the stored bytes, the same one S3 keeps for the object.
+type CreateResponse struct {
+	Key       string        `json:"key"`
+	Bucket    string        `json:"bucket"`
+	VersionID string        `json:"versionId,omitempty"`
+	URL       string        `json:"url,omitempty"`
+	Checksum  string        `json:"checksumSha256,omitempty"`
+	DryRun    bool          `json:"dryRun,omitempty"`
+	Dedupe    bool          `json:"dedupe,omitempty"`
+	Item      *CustomObject `json:"item"`
+}
+
 func main() {
 
 	// Parse environment variables
+	logger = newStructuredLogger(parseLogLevel(os.Getenv("LOG_LEVEL")), os.Stdout)
 	OTEL_SERVICE_NAME = os.Getenv("OTEL_SERVICE_NAME")
+	AWS_REGION = os.Getenv("AWS_REGION")
+	SERVICE_NAMESPACE = os.Getenv("SERVICE_NAMESPACE")
+	SERVICE_VERSION = os.Getenv("SERVICE_VERSION")
+	DEPLOYMENT_ENVIRONMENT = os.Getenv("DEPLOYMENT_ENVIRONMENT")
+	OTEL_SPAN_PROCESSOR = strings.ToLower(os.Getenv("OTEL_SPAN_PROCESSOR"))
 	INPUT_S3_BUCKET_NAME = os.Getenv("INPUT_S3_BUCKET_NAME")
+	if _, isARN, err := parseAccessPoint(INPUT_S3_BUCKET_NAME); isARN && err != nil {
+		logger.error("Input bucket is not a valid access point ARN.", "bucket", INPUT_S3_BUCKET_NAME, "error", err)
+	}
+	TENANT_BUCKET_MAP = parseTenantBucketMap(os.Getenv("TENANT_BUCKET_MAP"))
+	TARGET_BUCKET_ALLOWLIST = parseBucketAllowlist(os.Getenv("TARGET_BUCKET_ALLOWLIST"))
+	AUTHORIZER_CLAIM_ATTRIBUTES = parseClaimAttributes(DEFAULT_AUTHORIZER_CLAIM_ATTRIBUTES)
+	if value, ok := os.LookupEnv("AUTHORIZER_CLAIM_ATTRIBUTES"); ok {
+		AUTHORIZER_CLAIM_ATTRIBUTES = parseClaimAttributes(value)
+	}
+	CORS_ALLOWED_ORIGINS = parseAllowedOrigins(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	ALLOWED_METHODS = parseAllowedMethods(os.Getenv("ALLOWED_METHODS"))
+	ALLOWED_QUERY_PARAMS = parseAllowedQueryParams(os.Getenv("ALLOWED_QUERY_PARAMS"))
+	REDACT_KEYS = parseRedactKeys(os.Getenv("REDACT_KEYS"))
+	REDACT_MODE = strings.ToLower(os.Getenv("REDACT_MODE"))
+	REDACT_STORED_OBJECTS = os.Getenv("REDACT_STORED_OBJECTS") == "true"
+	CAPTURE_REQUEST_BODY = os.Getenv("CAPTURE_REQUEST_BODY") == "true"
+	redactor = newFieldRedactor(os.Getenv("REDACT_FIELDS"))
+	DEBUG_PROPAGATION = os.Getenv("DEBUG_PROPAGATION") == "true"
+	OBJECT_KEY_PREFIX = commons.SanitizeKeyPrefix(getEnvWithFallback("S3_KEY_PREFIX", "OBJECT_KEY_PREFIX"))
+	BATCH_CONCURRENCY = getEnvAsInt("BATCH_CONCURRENCY", DEFAULT_BATCH_CONCURRENCY)
+	MAX_BODY_SIZE_BYTES = getEnvAsInt("MAX_BODY_SIZE_BYTES", DEFAULT_MAX_BODY_SIZE_BYTES)
+	IDEMPOTENCY_TABLE_NAME = os.Getenv("IDEMPOTENCY_TABLE_NAME")
+	DRY_RUN = os.Getenv("DRY_RUN") == "true"
+	VERIFY_WRITES = os.Getenv("VERIFY_WRITES") == "true"
+	MANIFEST_KEY_PREFIX = commons.SanitizeKeyPrefix(os.Getenv("MANIFEST_KEY_PREFIX"))
+	MANIFEST_S3_BUCKET_NAME = os.Getenv("MANIFEST_S3_BUCKET_NAME")
+	if MANIFEST_KEY_PREFIX != "" && MANIFEST_S3_BUCKET_NAME == "" {
+		logger.warn("Manifest is disabled as MANIFEST_S3_BUCKET_NAME is not set.")
+	}
+	TRACE_HTTP_INTERNALS = os.Getenv("TRACE_HTTP_INTERNALS") == "true"
+	FORCE_FLUSH_PER_INVOCATION = os.Getenv("FORCE_FLUSH_PER_INVOCATION") == "true"
+	S3_SSE_KMS_KEY_ID = os.Getenv("S3_SSE_KMS_KEY_ID")
+	S3_SSE_KMS_KEY_ATTRIBUTE = strings.ToLower(os.Getenv("S3_SSE_KMS_KEY_ATTRIBUTE"))
+	S3_OBJECT_ACL = parseObjectACL(os.Getenv("S3_OBJECT_ACL"))
+	S3_UPLOAD_MAX_ATTEMPTS = getEnvAsInt("S3_UPLOAD_MAX_ATTEMPTS", DEFAULT_S3_UPLOAD_MAX_ATTEMPTS)
+	S3_UPLOAD_BASE_DELAY = time.Duration(getEnvAsInt("S3_UPLOAD_BASE_DELAY_MS", DEFAULT_S3_UPLOAD_BASE_DELAY_MS)) * time.Millisecond
+	S3_UPLOAD_PART_SIZE = s3UploadPartSize(int64(getEnvAsInt("S3_UPLOAD_PART_SIZE_BYTES", int(s3manager.DefaultUploadPartSize))))
+	S3_UPLOAD_CONCURRENCY = getEnvAsInt("S3_UPLOAD_CONCURRENCY", s3manager.DefaultUploadConcurrency)
+	S3_UPLOAD_LEAVE_PARTS = os.Getenv("S3_UPLOAD_LEAVE_PARTS_ON_ERROR") == "true"
+	S3_DEADLINE_MARGIN = s3DeadlineMargin(getEnvAsInt("S3_DEADLINE_MARGIN_MS", DEFAULT_S3_DEADLINE_MARGIN_MS))
+	COMPRESSION_THRESHOLD_BYTES = getEnvAsInt("COMPRESSION_THRESHOLD_BYTES", 0)
+	STORE_ERROR_STATUS_CODES = parseStoreErrorStatusCodes(os.Getenv("STORE_ERROR_STATUS_CODES"))
+	JWKS_URL = os.Getenv("JWKS_URL")
+	JWT_ISSUER = os.Getenv("JWT_ISSUER")
+	JWT_AUDIENCE = os.Getenv("JWT_AUDIENCE")
+	FORCE_SAMPLE_SECRET = os.Getenv("FORCE_SAMPLE_SECRET")
+	FUNCTION_MEMORY_SIZE_MB = getEnvAsInt("AWS_LAMBDA_FUNCTION_MEMORY_SIZE", 0)
+	SLA = time.Duration(getEnvAsInt("SLA_MS", 0)) * time.Millisecond
+
+	// Parse object tags, invalid tags are not applied at all
+	tags, err := parseObjectTags(os.Getenv("S3_OBJECT_TAGS"))
+	if err != nil {
+		logger.error("Parsing object tags is failed.", "error", err)
+	} else {
+		S3_OBJECT_TAGS = tags
+	}
+	RESPONSE_VERSION_DEFAULT = os.Getenv("RESPONSE_VERSION_DEFAULT")
+	if !isSupportedResponseVersion(RESPONSE_VERSION_DEFAULT) {
+		RESPONSE_VERSION_DEFAULT = RESPONSE_VERSION_V1
+	}
+	DRY_RUN_LATENCY = time.Duration(getEnvAsInt("DRY_RUN_LATENCY_MS", DEFAULT_DRY_RUN_LATENCY_MS)) * time.Millisecond
+	IDEMPOTENCY_TTL_SECONDS = getEnvAsInt("IDEMPOTENCY_TTL_SECONDS", DEFAULT_IDEMPOTENCY_TTL_SECONDS)
+	PRESIGN_URLS = os.Getenv("PRESIGN_URLS") != "false"
+	PRESIGNED_URL_EXPIRY = time.Duration(getEnvAsInt("PRESIGNED_URL_EXPIRY_SECONDS", DEFAULT_PRESIGNED_URL_EXPIRY_SECONDS)) * time.Second
+
+	// Create circuit breaker for S3 writes
+	breaker = newCircuitBreaker(
+		getEnvAsInt("CIRCUIT_BREAKER_FAILURE_THRESHOLD", DEFAULT_CIRCUIT_BREAKER_FAILURE_THRESHOLD),
+		time.Duration(getEnvAsInt("CIRCUIT_BREAKER_COOLDOWN_SECONDS", DEFAULT_CIRCUIT_BREAKER_COOLDOWN_SECONDS))*time.Second,
+	)
+
+	// Create rate limiter, requests are not limited without a rate
+	rateLimit, err := strconv.ParseFloat(os.Getenv("RATE_LIMIT_RPS"), 64)
+	if err == nil && rateLimit > 0 {
+		limiter = newRateLimiter(rateLimit, getEnvAsInt("RATE_LIMIT_BURST", DEFAULT_RATE_LIMIT_BURST))
+	}
+
+	ENABLE_DEDUP = os.Getenv("ENABLE_DEDUP") == "true"
+
+	// Create dedupe cache, payloads are not deduplicated without a window
+	dedupeWindowSeconds := getEnvAsInt("DEDUPE_WINDOW_SECONDS", 0)
+	if dedupeWindowSeconds > 0 {
+		deduper = newDedupeCache(
+			getEnvAsInt("DEDUPE_CACHE_SIZE", DEFAULT_DEDUPE_CACHE_SIZE),
+			time.Duration(dedupeWindowSeconds)*time.Second,
+		)
+	}
+
+	// Create object key generator, USE_TIMESTAMP_OBJECT_KEYS is kept for
+	// existing deployments
+	keyStrategy := os.Getenv("KEY_STRATEGY")
+	if keyStrategy == "" && os.Getenv("USE_TIMESTAMP_OBJECT_KEYS") == "true" {
+		keyStrategy = KEY_STRATEGY_TIMESTAMP
+	}
+	keyGenerator = newKeyGenerator(keyStrategy)
+
+	// Override the S3 endpoint, e.g. for LocalStack
+	S3_ENDPOINT = os.Getenv("AWS_S3_ENDPOINT")
+	S3_FORCE_PATH_STYLE = os.Getenv("AWS_S3_FORCE_PATH_STYLE") == "true"
 
-	// Create a s3 uploader
-	uploader = s3manager.NewUploader(session.Must(session.NewSession()))
+	// Create a s3 client & a dynamodb client for idempotency records
+	sess := session.Must(session.NewSession())
+
+	// Sign the S3 calls with the target role for cross-account uploads,
+	// the idempotency records stay in the own account
+	S3_TARGET_ROLE_ARN = os.Getenv("S3_TARGET_ROLE_ARN")
+	if S3_TARGET_ROLE_ARN != "" {
+		sessionName := os.Getenv("S3_TARGET_ROLE_SESSION_NAME")
+		if sessionName == "" {
+			sessionName = OTEL_SERVICE_NAME
+		}
+		assumedRole = newAssumeRoleProvider(sts.New(sess), S3_TARGET_ROLE_ARN, sessionName, os.Getenv("S3_TARGET_ROLE_EXTERNAL_ID"))
+		targetRoleCredentials = credentials.NewCredentials(assumedRole)
+	}
+	s3Client = s3.New(sess, newS3Config())
+	dynamoDBClient = dynamodb.New(sess)
+
+	// Create the storage backend
+	STORAGE_TABLE_NAME = os.Getenv("STORAGE_TABLE_NAME")
+	STORAGE_BACKEND, storage = newStorage(strings.ToLower(os.Getenv("STORAGE_BACKEND")))
+
+	// Create the storage of the secondary region
+	FAILOVER_S3_BUCKET_NAME = os.Getenv("FAILOVER_S3_BUCKET_NAME")
+	FAILOVER_AWS_REGION = os.Getenv("FAILOVER_AWS_REGION")
+	failoverStorage = newFailoverStorage(sess)
+
+	// Bound the concurrent writes of the execution environment, the
+	// primary and the secondary storage share the same slots
+	STORAGE_MAX_CONCURRENT_PUTS = getEnvAsInt("STORAGE_MAX_CONCURRENT_PUTS", 0)
+	if STORAGE_MAX_CONCURRENT_PUTS > 0 {
+		putSlots := semaphore.NewWeighted(int64(STORAGE_MAX_CONCURRENT_PUTS))
+		storage = newLimitedStorage(storage, putSlots)
+		failoverStorage = newLimitedStorage(failoverStorage, putSlots)
+	}
 
 	// Get context
 	ctx := context.Background()
 
+	// Telemetry is turned off entirely with the standard SDK variable,
+	// nothing is exported then and the spans are no-ops
+	OTEL_SDK_DISABLED = strings.ToLower(os.Getenv("OTEL_SDK_DISABLED")) == "true"
+
 	// Create tracer provider
-	tp, err := xrayconfig.NewTracerProvider(ctx)
+	tp, err := setupTracerProvider(ctx)
 	if err != nil {
-		fmt.Printf("error creating tracer provider: %v", err)
+		logger.error("Creating tracer provider is failed.", "error", err)
+	}
+	if tp != nil {
+		defer func(ctx context.Context) {
+			err := tp.Shutdown(ctx)
+			if err != nil {
+				logger.error("Shutting down tracer provider is failed.", "error", err)
+			}
+		}(ctx)
 	}
 
-	defer func(ctx context.Context) {
-		err := tp.Shutdown(ctx)
+	// Assume the target role before the first request, uploads could never
+	// succeed with a role which cannot be assumed
+	if targetRoleCredentials != nil {
+		_, err := targetRoleCredentials.GetWithContext(ctx)
 		if err != nil {
-			fmt.Printf("error shutting down tracer provider: %v", err)
+			logger.error("Initializing cross-account uploads is failed, target role cannot be assumed.", "roleArn", S3_TARGET_ROLE_ARN, "error", err)
+			flushTracerProvider()
+			os.Exit(1)
 		}
-	}(ctx)
+	}
+
+	// Create meter provider, EMF writes the metrics to stdout instead and
+	// leaves the OTLP instruments without a provider. Without a provider,
+	// the instruments record into the no-op global one.
+	METRICS_BACKEND = strings.ToLower(os.Getenv("METRICS_BACKEND"))
+	if METRICS_BACKEND == METRICS_BACKEND_EMF {
+		emfMetrics = newEMFEmitter(os.Stdout, os.Getenv("EMF_NAMESPACE"))
+	} else if OTEL_SDK_DISABLED {
+		logger.debug("Skipping meter provider, OpenTelemetry SDK is disabled.")
+	} else if mp, err := newMeterProvider(ctx); err != nil {
+		logger.error("Creating meter provider is failed.", "error", err)
+	} else {
+		defer func(ctx context.Context) {
+			err := mp.Shutdown(ctx)
+			if err != nil {
+				logger.error("Shutting down meter provider is failed.", "error", err)
+			}
+		}(ctx)
+
+		// Set global meter provider
+		meterProvider = mp
+		otel.SetMeterProvider(mp)
+	}
+
+	// Create logger provider, OTEL_LOGS_EXPORTER=otlp exports the log lines
+	// with the trace ids of their invocations besides writing them to stdout
+	if strings.ToLower(os.Getenv("OTEL_LOGS_EXPORTER")) != LOGS_EXPORTER_OTLP {
+		logger.debug("Skipping logger provider, logs are only written to stdout.")
+	} else if OTEL_SDK_DISABLED {
+		logger.debug("Skipping logger provider, OpenTelemetry SDK is disabled.")
+	} else if lp, err := newLoggerProvider(ctx); err != nil {
+		logger.error("Creating logger provider is failed.", "error", err)
+	} else {
+		defer func(ctx context.Context) {
+			err := lp.Shutdown(ctx)
+			if err != nil {
+				logger.error("Shutting down logger provider is failed.", "error", err)
+			}
+		}(ctx)
+
+		loggerProvider = lp
+		logger.exportTo(newOTelLogHandler(lp))
+	}
+
+	// Create error counter
+	errorCounter, err = newErrorCounter(otel.Meter(INSTRUMENTATION_SCOPE_NAME))
+	if err != nil {
+		logger.error("Creating error counter is failed.", "error", err)
+	}
+
+	// Create rate limit counter
+	rateLimitCounter, err = newRateLimitCounter(otel.Meter(INSTRUMENTATION_SCOPE_NAME))
+	if err != nil {
+		logger.error("Creating rate limit counter is failed.", "error", err)
+	}
+
+	// Create throttle counter
+	throttleCounter, err = newThrottleCounter(otel.Meter(INSTRUMENTATION_SCOPE_NAME))
+	if err != nil {
+		logger.error("Creating throttle counter is failed.", "error", err)
+	}
+
+	// Create storage queue time histogram
+	putQueueTimeHistogram, err = newPutQueueTimeHistogram(otel.Meter(INSTRUMENTATION_SCOPE_NAME))
+	if err != nil {
+		logger.error("Creating storage queue time histogram is failed.", "error", err)
+	}
+
+	// Create handler duration histogram
+	handlerDurationHistogram, err = newHandlerDurationHistogram(otel.Meter(INSTRUMENTATION_SCOPE_NAME))
+	if err != nil {
+		logger.error("Creating handler duration histogram is failed.", "error", err)
+	}
 
-	// Set global tracer provider
-	otel.SetTracerProvider(tp)
+	// Fetch the keys for token validation
+	if JWKS_URL != "" {
+		keySet = newJWKS(JWKS_URL)
+		keySet.fetch(ctx)
+	}
+
+	// Check whether the collector extension accepts connections
+	if !OTEL_SDK_DISABLED {
+		exporterReachable = isExporterEndpointReachable()
+	}
 
 	// Set propagator
-	otel.SetTextMapPropagator(xray.Propagator{})
+	otel.SetTextMapPropagator(newPropagator())
+
+	// Without an SDK there is nothing to flush after the invocations, the
+	// handler runs uninstrumented
+	if OTEL_SDK_DISABLED {
+		lambda.Start(selectHandler())
+		return
+	}
 
 	// Wrap handler & instrument
-	lambda.Start(otellambda.InstrumentHandler(handler, xrayconfig.WithRecommendedOptions(tp)...))
+	lambda.Start(otellambda.InstrumentHandler(selectHandler(), xrayconfig.WithRecommendedOptions(tp)...))
+}
+
+// selectHandler picks the entry point matching the configured trigger of
+// the Lambda. By default, API Gateway and ALB events are detected per
+// request.
+func selectHandler() interface{} {
+	switch os.Getenv("LAMBDA_TRIGGER") {
+	case "functionurl":
+		return functionURLHandler
+	default:
+		return eventHandler
+	}
+}
+
+// flushTracerProvider exports the pending spans and returns how long the
+// export has taken.
+func flushTracerProvider() time.Duration {
+	if tracerProvider == nil {
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TRACER_PROVIDER_FLUSH_TIMEOUT)
+	defer cancel()
+
+	startTime := time.Now()
+	err := tracerProvider.ForceFlush(ctx)
+	if err != nil {
+		logger.error("Flushing tracer provider is failed.", "error", err)
+	}
+	return time.Since(startTime)
+}
+
+func flushMeterProvider() {
+	if meterProvider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TRACER_PROVIDER_FLUSH_TIMEOUT)
+	defer cancel()
+
+	err := meterProvider.ForceFlush(ctx)
+	if err != nil {
+		logger.error("Flushing meter provider is failed.", "error", err)
+	}
+}
+
+func flushLoggerProvider() {
+	if loggerProvider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TRACER_PROVIDER_FLUSH_TIMEOUT)
+	defer cancel()
+
+	err := loggerProvider.ForceFlush(ctx)
+	if err != nil {
+		logger.error("Flushing logger provider is failed.", "error", err)
+	}
+}
+
+// newS3Config overrides the S3 endpoint with AWS_S3_ENDPOINT, e.g. to run
+// against LocalStack. AWS_S3_FORCE_PATH_STYLE=true addresses buckets by path
+// instead of by subdomain which local endpoints usually require. Without
+// these variables, the default AWS endpoint of the region is used.
+func newS3Config() *aws.Config {
+	config := aws.NewConfig()
+
+	if S3_ENDPOINT != "" {
+		logger.info("Using custom S3 endpoint.", "endpoint", S3_ENDPOINT)
+		config = config.WithEndpoint(S3_ENDPOINT)
+	}
+
+	if S3_FORCE_PATH_STYLE {
+		config = config.WithS3ForcePathStyle(true)
+	}
+
+	// Access point ARNs may point to another region than the function's
+	config = config.WithS3UseARNRegion(true)
+
+	if creds := s3Credentials(); creds != nil {
+		config = config.WithCredentials(creds)
+	}
+	return config
+}
+
+// getEnvWithFallback returns the first of the given variables which is set.
+func getEnvWithFallback(
+	names ...string,
+) string {
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func getEnvAsInt(
+	key string,
+	defaultValue int,
+) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
 }
 
 func handler(
+	ctx context.Context,
 	req events.APIGatewayProxyRequest,
 ) (
 	events.APIGatewayProxyResponse,
 	error,
 ) {
 
+	// Process request
+	result := serveRequest(ctx, apiGatewayRequestAttributes(req), &Request{
+		Method:          req.HTTPMethod,
+		RouteKey:        req.HTTPMethod + " " + req.Resource,
+		Path:            req.Path,
+		SourceIP:        req.RequestContext.Identity.SourceIP,
+		APIKey:          req.RequestContext.Identity.APIKey,
+		Headers:         req.Headers,
+		PathParameters:  req.PathParameters,
+		QueryParameters: req.QueryStringParameters,
+		Claims:          apiGatewayAuthorizerClaims(req.RequestContext.Authorizer),
+		Body:            req.Body,
+		IsBase64Encoded: req.IsBase64Encoded,
+	})
+
+	// Payload format 1.0 has no dedicated cookies field
+	var multiValueHeaders map[string][]string
+	if len(result.Cookies) > 0 {
+		multiValueHeaders = map[string][]string{
+			"Set-Cookie": result.Cookies,
+		}
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode:        result.StatusCode,
+		Headers:           result.Headers,
+		MultiValueHeaders: multiValueHeaders,
+		Body:              result.Body,
+	}, nil
+}
+
+// processRequest writes under the caller chosen key for PUT requests with
+// an id, creates every object of a JSON array body, creates N copies of the
+// body for ?count=N and creates a single new key otherwise.
+func processRequest(
+	ctx context.Context,
+	req *Request,
+) *createResult {
+
+	parentSpan := trace.SpanFromContext(ctx)
+
+	// Validate body size
+	bodySize := requestBodySize(req.Body, req.IsBase64Encoded)
+	parentSpan.SetAttributes(semconv.HTTPRequestContentLength(bodySize))
+	if bodySize > MAX_BODY_SIZE_BYTES {
+		logger.warn("Request body is too large.", "size", bodySize, "limit", MAX_BODY_SIZE_BYTES)
+		countError(parentSpan, ERROR_TYPE_VALIDATION)
+		return failRequest(parentSpan, 413, "Request body must not exceed "+strconv.Itoa(MAX_BODY_SIZE_BYTES)+" bytes.")
+	}
+
+	// Decode body
+	body, err := decodeRequestBody(req, MAX_BODY_SIZE_BYTES)
+	if errors.Is(err, errBodyTooLarge) {
+		logger.warn("Decompressed request body is too large.", "limit", MAX_BODY_SIZE_BYTES)
+		countError(parentSpan, ERROR_TYPE_VALIDATION)
+		return failRequest(parentSpan, 413, "Request body must not exceed "+strconv.Itoa(MAX_BODY_SIZE_BYTES)+" bytes.")
+	}
+	if err != nil {
+		logger.warn("Decoding request body is failed.", "error", err)
+		countError(parentSpan, ERROR_TYPE_VALIDATION)
+		parentSpan.RecordError(err)
+		return failRequest(parentSpan, 400, "Request body could not be decoded.")
+	}
+	parentSpan.SetAttributes(attribute.Int("http.request.body.size", len(body)))
+
+	// Negotiate content type
+	body, err = negotiateRequestBody(req.Headers, body)
+	if errors.Is(err, errUnsupportedContentType) {
+		logger.warn("Content type is not supported.", "contentType", getHeader(req.Headers, "Content-Type"))
+		countError(parentSpan, ERROR_TYPE_VALIDATION)
+		return failRequest(parentSpan, 415, "Content-Type must be application/json, application/x-www-form-urlencoded or application/yaml.")
+	}
+	if err != nil {
+		logger.warn("Parsing request body is failed.", "error", err)
+		countError(parentSpan, ERROR_TYPE_VALIDATION)
+		parentSpan.RecordError(err)
+		return failRequest(parentSpan, 400, "Request body could not be parsed.")
+	}
+
+	// Capture the redacted body
+	if CAPTURE_REQUEST_BODY {
+		captureRequestBody(parentSpan, body)
+	}
+
+	// Resolve tenant bucket
+	tenantID, bucket, err := resolveBucket(req.Headers)
+	if tenantID != "" {
+		parentSpan.SetAttributes(attribute.String("tenant.id", tenantID))
+	}
+	if err != nil {
+		logger.warn("Tenant is unknown.", "tenantId", tenantID)
+		countError(parentSpan, ERROR_TYPE_VALIDATION)
+		return failRequest(parentSpan, 400, "Tenant is unknown.")
+	}
+
+	// Override target bucket
+	bucket, err = resolveTargetBucket(req.Headers, bucket)
+	if err != nil {
+		logger.warn("Target bucket is not allowed.", "targetBucket", getHeader(req.Headers, "X-Target-Bucket"))
+		countError(parentSpan, ERROR_TYPE_VALIDATION)
+		return failRequest(parentSpan, 403, "Target bucket is not allowed.")
+	}
+	parentSpan.SetAttributes(s3BucketAttributes(bucket)...)
+
+	// The items of a batch are stored separately, their sizes cannot be
+	// compared with the size of the whole request
+	if !isBatchBody(body) {
+		ctx = withRequestBytes(ctx, bodySize)
+	}
+
+	if id, ok := req.PathParameters["id"]; ok && req.Method == "PUT" {
+		return putObject(ctx, bucket, id, body, getHeader(req.Headers, "If-None-Match") == "*")
+	}
+	if isBatchBody(body) {
+		return createObjects(ctx, bucket, body)
+	}
+	if countParameter, ok := req.QueryParameters["count"]; ok {
+		count, err := strconv.Atoi(countParameter)
+		if err != nil || count < 1 || count > MAX_COPY_COUNT {
+			logger.warn("Count is out of range.", "count", countParameter)
+			countError(parentSpan, ERROR_TYPE_VALIDATION)
+			return failRequest(parentSpan, 400, "Count must be between 1 and "+strconv.Itoa(MAX_COPY_COUNT)+".")
+		}
+		return createCopies(ctx, bucket, body, count)
+	}
+	return createObject(ctx, bucket, body)
+}
+
+// serveRequest processes the request within the parent span. A panic is
+// recorded on the parent span and answered with a 500. As the invocation
+// might not survive it, the span is flushed right away.
+func serveRequest(
+	invocationCtx context.Context,
+	attributes []attribute.KeyValue,
+	req *Request,
+) (
+	result *createResult,
+) {
+
+	// Keep the deadline of the invocation only, the parent span is built
+	// from the request headers.
+	ctx := context.Background()
+	if deadline, ok := invocationCtx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+
+		attributes = append(attributes, attribute.Int64("faas.time_remaining_ms", time.Until(deadline).Milliseconds()))
+	}
+	if FUNCTION_MEMORY_SIZE_MB > 0 {
+		attributes = append(attributes, semconv.FaaSMaxMemory(FUNCTION_MEMORY_SIZE_MB))
+	}
+
 	// Start parent span
-	ctx, parentSpan := startParentSpan(req)
-	defer parentSpan.End()
+	startTime := time.Now()
+	attributes = append(attributes, queryParameterAttributes(req.QueryParameters)...)
+	if isForceSampleRequest(req) {
+		attributes = append(attributes, SAMPLING_FORCED_ATTRIBUTE.Bool(true))
+	}
+	remoteCtx := extractTraceContext(ctx, req.Headers)
+	ctx, parentSpan := startParentSpan(remoteCtx, attributes, req.Headers)
+	if DEBUG_PROPAGATION {
+		recordPropagationExtract(ctx, parentSpan, remoteCtx, req.Headers)
+	}
 
-	// Create object
-	customObject := &CustomObject{
-		Item:      "test",
-		IsUpdated: false,
-		IsChecked: false,
+	// Drop debug and info logs of unsampled traces
+	restoreLogger := logger.reduceForTrace(ctx)
+	defer restoreLogger()
+
+	// Correlate the exported logs with the trace of the request
+	unbindLogger := logger.bindTrace(ctx)
+	defer unbindLogger()
+
+	defer func() {
+		r := recover()
+		if r != nil {
+			recordPanic(parentSpan, r)
+			result = failRequest(parentSpan, 500, "Processing the request is failed unexpectedly.")
+		}
+
+		addTraceHeaders(result, parentSpan.SpanContext())
+		elapsed := time.Since(startTime)
+		recordHandlerDuration(parentSpan, elapsed, result.StatusCode)
+		recordRequestEMF(parentSpan, result.StatusCode)
+		recordSLA(parentSpan, elapsed)
+		parentSpan.End()
+
+		// Export the spans before the runtime may freeze the environment
+		if r != nil || FORCE_FLUSH_PER_INVOCATION {
+			flushDuration := flushTracerProvider()
+			trace.SpanFromContext(invocationCtx).AddEvent("ForceFlush", trace.WithAttributes(
+				attribute.Float64("flush.duration_ms", float64(flushDuration)/float64(time.Millisecond)),
+			))
+		}
+		flushMeterProvider()
+		flushLoggerProvider()
+	}()
+
+	return requestHandler(ctx, req)
+}
+
+// createResult is the trigger independent outcome of createObject which
+// every handler translates into its own response type.
+type createResult struct {
+	StatusCode int
+	Headers    map[string]string
+	Cookies    []string
+	Body       string
+}
+
+func createObject(
+	ctx context.Context,
+	bucket string,
+	body string,
+) *createResult {
+
+	parentSpan := trace.SpanFromContext(ctx)
+
+	// Parse custom object
+	customObject, err := parseCustomObject(parentSpan, body)
+	if err != nil {
+		return failRequest(parentSpan, 400, "Request body is not a valid custom object.")
+	}
+
+	// Return the existing key for a payload which was just created, an
+	// identical payload in flight is waited for
+	var createdKey string
+	if deduper != nil && !isDryRun(ctx) {
+		payloadHash, err := hashPayload(bucket, customObject)
+		if err == nil {
+			key, ok, err := deduper.claim(ctx, payloadHash)
+			if ok {
+				parentSpan.SetAttributes(DEDUP_HIT_ATTRIBUTE.Bool(true))
+				return respondWithDuplicate(ctx, parentSpan, bucket, key, customObject)
+			}
+			if err == nil {
+				parentSpan.SetAttributes(DEDUP_HIT_ATTRIBUTE.Bool(false))
+				defer func() {
+					deduper.release(payloadHash, createdKey)
+				}()
+			}
+		}
+	}
+
+	// Generate object key
+	var id string
+	customObjectAsBytes, err := json.Marshal(customObject)
+	if err == nil {
+		id, err = keyGenerator.Generate(ctx, customObjectAsBytes)
+	}
+	if err != nil {
+		logger.error("Generating object key is failed.", "error", err)
+
+		parentSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		parentSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+
+		return failRequest(parentSpan, 500, "Generating the object key is failed.")
+	}
+	key := commons.BuildObjectKey(OBJECT_KEY_PREFIX, time.Now(), id)
+
+	// Skip the upload of a payload which is already stored
+	if isContentDedupEnabled(ctx) && isStoredDuplicate(ctx, parentSpan, bucket, key) {
+		createdKey = key
+		return respondWithDuplicate(ctx, parentSpan, bucket, key, customObject)
+	}
+
+	result := writeObject(ctx, parentSpan, bucket, key, customObject, 201, false)
+	if result.StatusCode == 201 {
+		createdKey = key
+	}
+	return result
+}
+
+// writeObject stores the custom object under the given key and responds
+// with the given status code on success.
+func writeObject(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+	customObject *CustomObject,
+	statusCode int,
+	createOnly bool,
+) *createResult {
+
+	// Directory buckets reject keys which cannot be mapped to directories
+	if isS3Storage() && isDirectoryBucket(bucket) {
+		if err := validateDirectoryBucketKey(key); err != nil {
+			logger.warn("Object key is not valid for a directory bucket.", "key", key, "bucket", bucket)
+			countError(parentSpan, ERROR_TYPE_VALIDATION)
+			return failRequest(parentSpan, 400, "Object key is not valid for a directory bucket.")
+		}
 	}
 
-	// Convert updated custom object to bytes
+	// Convert custom object to bytes
 	customObjectAsBytes, err := convertCustomObjectIntoBytes(parentSpan, customObject)
 	if err != nil {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Body:       "Failed",
-		}, nil
+		return failRequest(parentSpan, 500, "Converting the custom object is failed.")
 	}
 
 	// Store object in S3
-	err = storeObjectInS3(ctx, parentSpan, customObjectAsBytes)
+	result, err := storeObject(ctx, parentSpan, bucket, key, customObjectAsBytes, createOnly)
+	if errors.Is(err, errCircuitOpen) {
+		return failRequest(parentSpan, 503, "Storing objects is paused as S3 keeps failing.")
+	}
+	if errors.Is(err, errPreconditionFailed) {
+		var existing *s3.HeadObjectOutput
+		if isS3Storage() {
+			existing, _ = headObjectInS3(ctx, parentSpan, bucket, key)
+		}
+		return rejectExistingObject(parentSpan, bucket, key, existing)
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return failDeadlineExceeded(parentSpan)
+	}
+	if isThrottled(err) {
+		return failThrottled(parentSpan, err)
+	}
 	if err != nil {
+		return failRequest(parentSpan, storeErrorStatusCode(err), "Storing the object in S3 is failed.")
+	}
 
-		parentSpan.SetAttributes([]attribute.KeyValue{
-			semconv.HTTPStatusCode(500),
-		}...)
+	// The primary client cannot reach the secondary bucket, objects which
+	// have failed over are neither verified nor presigned
+	failedOver := result.Bucket != bucket
+
+	// Index the stored object, an object without an entry is deleted again
+	if isManifestEnabled(ctx) && !failedOver {
+		err := writeManifestEntry(ctx, parentSpan, bucket, key, result.VersionID, result.Checksum)
+		if err != nil {
+			return failManifestWrite(ctx, parentSpan, bucket, key, result.VersionID, statusCode == 200, err)
+		}
+	}
+
+	// Verify the stored object
+	if VERIFY_WRITES && !isDryRun(ctx) && isS3Storage() && !failedOver {
+		err := verifyObjectInS3(ctx, parentSpan, bucket, key, len(customObjectAsBytes))
+		if err != nil {
+			return failRequest(parentSpan, 500, "Verifying the stored object is failed.")
+		}
+	}
 
-		enrichSpanWithEvent(parentSpan, false)
+	// Presign a GET URL, the object is created regardless of the outcome
+	var presignedURL string
+	if PRESIGN_URLS && !isDryRun(ctx) && isS3Storage() && !failedOver {
+		presignedURL, _ = presignGetObject(ctx, parentSpan, bucket, key)
+	}
 
-		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Body:       "Failed",
-		}, nil
+	// Create response body
+	responseAsBytes, err := json.Marshal(versionResponse(ctx, parentSpan, &CreateResponse{
+		Key:       key,
+		Bucket:    result.Bucket,
+		VersionID: result.VersionID,
+		URL:       presignedURL,
+		Checksum:  result.Checksum,
+		DryRun:    isDryRun(ctx),
+		Item:      customObject,
+	}))
+	if err != nil {
+		return failRequest(parentSpan, 500, "Creating the response is failed.")
 	}
 
 	parentSpan.SetAttributes([]attribute.KeyValue{
-		semconv.HTTPStatusCode(200),
+		semconv.HTTPStatusCode(statusCode),
 	}...)
 
 	enrichSpanWithEvent(parentSpan, true)
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Body:       string(customObjectAsBytes),
-	}, nil
+	return &createResult{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": itemMediaType(responseVersion(ctx)),
+			"Location":     itemLocation(key),
+		},
+		Body: string(responseAsBytes),
+	}
+}
+
+// failRequest responds with RFC 7807 problem details. The trace id is
+// part of the body so that callers can report the failed request.
+func failRequest(
+	parentSpan trace.Span,
+	statusCode int,
+	detail string,
+) *createResult {
+	return failRequestWithProblem(parentSpan, statusCode,
+		commons.NewProblem(statusCode, detail, traceIDOf(parentSpan)))
+}
+
+// failRequestWithProblem responds with the given problem details which
+// might carry further members besides the standard ones.
+func failRequestWithProblem(
+	parentSpan trace.Span,
+	statusCode int,
+	problem interface{},
+) *createResult {
+
+	parentSpan.SetAttributes([]attribute.KeyValue{
+		semconv.HTTPStatusCode(statusCode),
+	}...)
+
+	enrichSpanWithEvent(parentSpan, false)
+
+	problemAsBytes, err := json.Marshal(problem)
+	if err != nil {
+		return &createResult{
+			StatusCode: statusCode,
+			Body:       http.StatusText(statusCode),
+		}
+	}
+
+	return &createResult{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": commons.ProblemContentType,
+		},
+		Body: string(problemAsBytes),
+	}
+}
+
+func traceIDOf(
+	span trace.Span,
+) string {
+	spanContext := span.SpanContext()
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// addTraceHeaders returns the trace id so that clients and gateways can
+// log it. The traceresponse header follows the W3C Trace Context format.
+func addTraceHeaders(
+	result *createResult,
+	spanContext trace.SpanContext,
+) {
+	if !spanContext.IsValid() {
+		return
+	}
+
+	if result.Headers == nil {
+		result.Headers = map[string]string{}
+	}
+	result.Headers["X-Trace-Id"] = spanContext.TraceID().String()
+	result.Headers["traceresponse"] = "00-" +
+		spanContext.TraceID().String() + "-" +
+		spanContext.SpanID().String() + "-" +
+		spanContext.TraceFlags().String()
+}
+
+// newPropagator extracts the X-Ray trace header of AWS services and the
+// W3C traceparent of other callers. The traceresponse header answers in
+// the W3C format either way.
+func newPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(
+		xray.Propagator{},
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	)
 }
 
+func extractTraceContext(
+	ctx context.Context,
+	headers map[string]string,
+) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, headerCarrier(headers))
+}
+
+// recordPropagationExtract adds a short span telling whether a remote
+// parent has been extracted and from which propagation headers. It helps
+// to debug broken propagation chains and is only recorded with
+// DEBUG_PROPAGATION=true.
+func recordPropagationExtract(
+	ctx context.Context,
+	parentSpan trace.Span,
+	remoteCtx context.Context,
+	headers map[string]string,
+) {
+	carrier := headerCarrier(headers)
+
+	fields := []string{}
+	for _, field := range otel.GetTextMapPropagator().Fields() {
+		if carrier.Get(field) != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	_, span := parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "propagation.extract",
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithAttributes([]attribute.KeyValue{
+				attribute.Bool("remote.parent", trace.SpanContextFromContext(remoteCtx).IsRemote()),
+				attribute.StringSlice("propagation.fields", fields),
+			}...))
+	span.End()
+}
+
+// startParentSpan starts the server span. The request headers are
+// recorded after redaction so that credentials never end up in a trace.
 func startParentSpan(
-	req events.APIGatewayProxyRequest,
+	ctx context.Context,
+	attributes []attribute.KeyValue,
+	headers map[string]string,
 ) (
 	context.Context,
 	trace.Span,
 ) {
 	// Create tracer
-	tracer := otel.Tracer(OTEL_SERVICE_NAME)
-
-	// Get context
-	ctx := context.Background()
+	tracer := otel.Tracer(INSTRUMENTATION_SCOPE_NAME)
 
 	// Start parent span
 	return tracer.Start(ctx, "main.handler",
 		trace.WithSpanKind(trace.SpanKindServer),
-		trace.WithAttributes([]attribute.KeyValue{
-			semconv.FaaSTriggerHTTP,
-			semconv.NetTransportTCP,
-			semconv.HTTPMethod(req.HTTPMethod),
-			semconv.HTTPFlavorKey.String(req.RequestContext.Protocol),
-			semconv.HTTPRoute(req.Resource),
-			semconv.HTTPTarget(req.Resource),
-			semconv.HTTPScheme(req.Headers["X-Forwarded-Proto"]),
-			semconv.HTTPUserAgent(req.Headers["User-Agent"]),
-			semconv.NetHostName(req.Headers["Host"]),
-		}...))
+		trace.WithAttributes(attributes...),
+		trace.WithAttributes(headerAttributes(headers)...),
+		trace.WithAttributes(semconv.CloudRegion(AWS_REGION)))
+}
+
+func apiGatewayRequestAttributes(
+	req events.APIGatewayProxyRequest,
+) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.FaaSTriggerHTTP,
+		semconv.NetTransportTCP,
+		semconv.HTTPMethod(req.HTTPMethod),
+		semconv.HTTPFlavorKey.String(req.RequestContext.Protocol),
+		semconv.HTTPRoute(req.Resource),
+		semconv.HTTPTarget(req.Resource),
+		semconv.HTTPScheme(req.Headers["X-Forwarded-Proto"]),
+		semconv.HTTPUserAgent(req.Headers["User-Agent"]),
+		semconv.NetHostName(req.Headers["Host"]),
+	}
+}
+
+func parseCustomObject(
+	parentSpan trace.Span,
+	body string,
+) (
+	*CustomObject,
+	error,
+) {
+	customObject := &CustomObject{
+		Item: "test",
+	}
+
+	// Fall back to the default object without a body
+	if strings.TrimSpace(body) == "" {
+		return customObject, nil
+	}
+
+	err := json.Unmarshal([]byte(body), customObject)
+	if err != nil {
+		logger.error("Parsing custom object is failed.", "error", err)
+		countError(parentSpan, ERROR_TYPE_VALIDATION)
+
+		parentSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+
+		return nil, err
+	}
+
+	// A new object is neither updated nor checked
+	customObject.IsUpdated = false
+	customObject.IsChecked = false
+	return customObject, nil
+}
+
+// captureRequestBody records the request body after field redaction. A
+// body which is not valid JSON is not recorded as its fields cannot be
+// redacted.
+func captureRequestBody(
+	parentSpan trace.Span,
+	body string,
+) {
+	redactedBody, err := redactor.redactJSON([]byte(body))
+	if err != nil {
+		return
+	}
+
+	if len(redactedBody) > MAX_CAPTURED_BODY_SIZE_BYTES {
+		redactedBody = redactedBody[:MAX_CAPTURED_BODY_SIZE_BYTES]
+	}
+	parentSpan.SetAttributes(attribute.String("http.request.body.content", strings.ToValidUTF8(string(redactedBody), "")))
 }
 
 func convertCustomObjectIntoBytes(
@@ -170,8 +1162,8 @@ func convertCustomObjectIntoBytes(
 ) {
 	customObjectAsBytes, err := json.Marshal(customObject)
 	if err != nil {
-		msg := "Converting custom object into JSON bytes has failed."
-		fmt.Println(msg)
+		logger.error("Converting custom object into JSON bytes has failed.", "error", err)
+		countError(parentSpan, ERROR_TYPE_MARSHAL)
 
 		parentSpan.SetAttributes([]attribute.KeyValue{
 			semconv.OtelStatusCodeError,
@@ -184,74 +1176,101 @@ func convertCustomObjectIntoBytes(
 
 		return nil, err
 	}
+
+	// Redact the configured fields before the object is persisted
+	if REDACT_STORED_OBJECTS {
+		return redactor.redactJSON(customObjectAsBytes)
+	}
 	return customObjectAsBytes, nil
 }
 
-func storeObjectInS3(
+// storeObject writes the object with the configured storage backend. The
+// backend traces the write itself, the outcome is recorded on the parent
+// span and feeds the circuit breaker.
+func storeObject(
 	ctx context.Context,
 	parentSpan trace.Span,
+	bucket string,
+	key string,
 	customObjectAsBytes []byte,
-) error {
+	createOnly bool,
+) (
+	commons.PutResult,
+	error,
+) {
 
-	fmt.Println("Storing custom object into S3...")
+	// Short-circuit while the storage keeps failing
+	allowed, trial := breaker.allow(parentSpan)
+	if !allowed {
+		logger.warn("Storing custom object is skipped, circuit breaker is open.")
+		return commons.PutResult{}, errCircuitOpen
+	}
+	if trial {
+		defer breaker.endTrial()
+	}
 
-	// Start S3 put span
-	ctx, s3PutSpan := startS3PutSpan(ctx, parentSpan)
-	defer s3PutSpan.End()
+	logger.debug("Storing custom object...", "key", key)
 
-	// Cause error?
-	bucketName := strings.Clone(INPUT_S3_BUCKET_NAME)
-	if causeError() {
-		bucketName = "wrong-bucket-name"
+	metadata := commons.PutMetadata{
+		Bucket:     bucket,
+		Tags:       objectTags(parentSpan),
+		CreateOnly: createOnly,
 	}
 
-	// Upload object to S3
-	_, err := uploader.UploadWithContext(
-		ctx,
-		&s3manager.UploadInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(strconv.FormatInt(time.Now().UTC().UnixMilli(), 10)),
-			Body:   bytes.NewReader(customObjectAsBytes),
-		})
+	startTime := time.Now()
+	result, err := storage.Put(ctx, key, customObjectAsBytes, metadata)
+	recordStoragePutLatencyEMF(parentSpan, time.Since(startTime))
+
+	// A failed precondition is answered by a healthy storage
+	if errors.Is(err, errPreconditionFailed) {
+		breaker.recordSuccess(parentSpan)
+
+		logger.warn("Storing custom object is rejected, object already exists.", "key", key)
+		return commons.PutResult{}, errPreconditionFailed
+	}
 
 	if err != nil {
-		msg := "Storing custom object into S3 is failed."
 
-		s3PutSpan.SetAttributes([]attribute.KeyValue{
-			semconv.OtelStatusCodeError,
-			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
-		}...)
+		// Simulated failures and canceled writes must not pause real
+		// writes
+		if !isDryRun(ctx) && !errors.Is(err, context.Canceled) {
+			breaker.recordFailure(parentSpan)
+		}
+		countError(parentSpan, ERROR_TYPE_S3)
 
-		s3PutSpan.RecordError(err, trace.WithAttributes(
-			semconv.ExceptionEscaped(true),
-		))
+		logger.error("Storing custom object is failed.", "key", key, "error", err)
+
+		// Retry once in the secondary region if the primary one is down
+		if !canFailover(ctx, bucket, err) {
+			return commons.PutResult{}, err
+		}
+		return failOver(ctx, parentSpan, key, customObjectAsBytes, metadata)
+	}
 
-		fmt.Println(msg)
-		return err
+	// Simulated successes must not close a breaker of the real storage
+	if !isDryRun(ctx) {
+		breaker.recordSuccess(parentSpan)
 	}
 
-	fmt.Println("Storing custom object into S3 is succeeded.")
-	return nil
+	logger.info("Storing custom object is succeeded.", "key", key, "versionId", result.VersionID)
+	result.Bucket = bucket
+	return result, nil
 }
 
 func causeError() bool {
 	return randomizer.Intn(15) == 1
 }
 
-func startS3PutSpan(
-	ctx context.Context,
-	parentSpan trace.Span,
-) (
-	context.Context,
-	trace.Span,
-) {
-	// Start S3 put span
-	return parentSpan.TracerProvider().Tracer(OTEL_SERVICE_NAME).
-		Start(ctx, "S3.PutObject",
-			trace.WithSpanKind(trace.SpanKindClient),
-			trace.WithAttributes([]attribute.KeyValue{
-				semconv.NetTransportTCP,
-			}...))
+// s3RPCAttributes describes an S3 call the same way the AWS SDK
+// instrumentations do, so that the spans show up on S3 dashboards.
+func s3RPCAttributes(
+	method string,
+) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.RPCSystemKey.String("aws-api"),
+		semconv.RPCService("S3"),
+		semconv.RPCMethod(method),
+	}
 }
 
 func enrichSpanWithEvent(
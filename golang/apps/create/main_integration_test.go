@@ -0,0 +1,134 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// withLocalEndpoint configures the S3 client like main does for
+// AWS_S3_ENDPOINT and creates a bucket of its own for the test. The test
+// is skipped without an endpoint, e.g. run LocalStack with
+//
+//	AWS_S3_ENDPOINT=http://localhost:4566 AWS_S3_FORCE_PATH_STYLE=true \
+//	AWS_S3_ACCESS_KEY_ID=test AWS_S3_SECRET_ACCESS_KEY=test AWS_REGION=us-east-1 \
+//	go test -tags integration -run Local .
+func withLocalEndpoint(
+	t *testing.T,
+) string {
+	endpoint := os.Getenv("AWS_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("AWS_S3_ENDPOINT is not set")
+	}
+
+	previousEndpoint, previousPathStyle, previousClient := S3_ENDPOINT, S3_FORCE_PATH_STYLE, s3Client
+	t.Cleanup(func() {
+		S3_ENDPOINT, S3_FORCE_PATH_STYLE, s3Client = previousEndpoint, previousPathStyle, previousClient
+	})
+	S3_ENDPOINT = endpoint
+	S3_FORCE_PATH_STYLE = os.Getenv("AWS_S3_FORCE_PATH_STYLE") == "true"
+
+	sess := session.Must(session.NewSession(aws.NewConfig().WithRegion(os.Getenv("AWS_REGION"))))
+	s3Client = s3.New(sess, newS3Config())
+
+	bucket := "integration-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	_, err := s3Client.CreateBucket(&s3.CreateBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		t.Fatalf("CreateBucket() error = %v", err)
+	}
+	return bucket
+}
+
+// getLocalObject returns the body of the stored object.
+func getLocalObject(
+	t *testing.T,
+	bucket string,
+	key string,
+) []byte {
+	output, err := s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		t.Fatalf("GetObject(%q) error = %v", key, err)
+	}
+	defer output.Body.Close()
+
+	body, err := io.ReadAll(output.Body)
+	if err != nil {
+		t.Fatalf("reading object %q error = %v", key, err)
+	}
+	return body
+}
+
+func TestCreateObjectOnLocalEndpoint(t *testing.T) {
+	bucket := withLocalEndpoint(t)
+	withHealthyConfig(t)
+	withoutFaults(t)
+
+	previousStorage, previousBackend, previousBreaker, previousKeys, previousMaxBody := storage, STORAGE_BACKEND, breaker, keyGenerator, MAX_BODY_SIZE_BYTES
+	t.Cleanup(func() {
+		storage, STORAGE_BACKEND, breaker, keyGenerator, MAX_BODY_SIZE_BYTES = previousStorage, previousBackend, previousBreaker, previousKeys, previousMaxBody
+	})
+	storage = newS3Storage(newS3Uploader(s3Client), s3Client, s3manager.DefaultUploadPartSize)
+	STORAGE_BACKEND = STORAGE_BACKEND_S3
+	breaker, _ = newTestCircuitBreaker(5, time.Minute)
+	keyGenerator = newKeyGenerator("")
+	MAX_BODY_SIZE_BYTES = DEFAULT_MAX_BODY_SIZE_BYTES
+	INPUT_S3_BUCKET_NAME = bucket
+
+	tests := []struct {
+		name string
+		item string
+	}{
+		{
+			name: "small object",
+			item: "local",
+		},
+		{
+			name: "large object",
+			item: strings.Repeat("x", 64*1024),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(&CustomObject{Item: tt.item})
+
+			// The whole flow from the request to the stored object
+			result := serveRequest(context.Background(), nil, &Request{
+				Method:   "POST",
+				RouteKey: "POST /items",
+				Path:     "/items",
+				Headers:  map[string]string{"Content-Type": "application/json"},
+				Body:     string(body),
+			})
+			if result.StatusCode != 201 {
+				t.Fatalf("status code = %d, want 201: %s", result.StatusCode, result.Body)
+			}
+
+			key := strings.TrimPrefix(result.Headers["Location"], "/items/")
+			stored := &CustomObject{}
+			if err := json.Unmarshal(getLocalObject(t, bucket, key), stored); err != nil {
+				t.Fatalf("stored object of %q is not a custom object: %v", key, err)
+			}
+			if stored.Item != tt.item {
+				t.Errorf("stored item has %d bytes, want %d", len(stored.Item), len(tt.item))
+			}
+		})
+	}
+}
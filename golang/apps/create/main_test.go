@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStartParentSpanCloudRegion(t *testing.T) {
+	tests := []struct {
+		name   string
+		region string
+	}{
+		{
+			name:   "primary region",
+			region: "eu-west-1",
+		},
+		{
+			name:   "secondary region",
+			region: "eu-central-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousProvider, previousRegion := otel.GetTracerProvider(), AWS_REGION
+			t.Cleanup(func() {
+				otel.SetTracerProvider(previousProvider)
+				AWS_REGION = previousRegion
+			})
+			tp, recorder := newRecordingTracerProvider()
+			otel.SetTracerProvider(tp)
+
+			// Read like at startup
+			t.Setenv("AWS_REGION", tt.region)
+			AWS_REGION = os.Getenv("AWS_REGION")
+
+			_, span := startParentSpan(context.Background(), nil, nil)
+			span.End()
+
+			if got := spanAttribute(recorder.Ended()[0], "cloud.region").AsString(); got != tt.region {
+				t.Errorf("cloud.region = %q, want %q", got, tt.region)
+			}
+		})
+	}
+}
+
+func TestRecordPropagationExtract(t *testing.T) {
+	withHealthyConfig(t)
+
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		wantRemote  bool
+		wantTraceID string
+	}{
+		{
+			name: "traceparent",
+			headers: map[string]string{
+				"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+			},
+			wantRemote:  true,
+			wantTraceID: "0af7651916cd43dd8448eb211c80319c",
+		},
+		{
+			name:       "no traceparent",
+			headers:    map[string]string{},
+			wantRemote: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousProvider, previousPropagator, previousDebug := otel.GetTracerProvider(), otel.GetTextMapPropagator(), DEBUG_PROPAGATION
+			t.Cleanup(func() {
+				otel.SetTracerProvider(previousProvider)
+				otel.SetTextMapPropagator(previousPropagator)
+				DEBUG_PROPAGATION = previousDebug
+			})
+			tp, recorder := newRecordingTracerProvider()
+			otel.SetTracerProvider(tp)
+			otel.SetTextMapPropagator(newPropagator())
+			DEBUG_PROPAGATION = true
+
+			serveRequest(context.Background(), nil, &Request{
+				Method:   "GET",
+				RouteKey: "GET /health",
+				Path:     "/health",
+				Headers:  tt.headers,
+			})
+
+			var found bool
+			for _, span := range recorder.Ended() {
+				if span.Name() != "propagation.extract" {
+					continue
+				}
+				found = true
+				if got := spanAttribute(span, "remote.parent").AsBool(); got != tt.wantRemote {
+					t.Errorf("remote.parent = %v, want %v", got, tt.wantRemote)
+				}
+				if tt.wantTraceID != "" && span.SpanContext().TraceID().String() != tt.wantTraceID {
+					t.Errorf("trace id = %s, want %s", span.SpanContext().TraceID(), tt.wantTraceID)
+				}
+			}
+			if !found {
+				t.Error("propagation.extract span is missing")
+			}
+		})
+	}
+}
+
+func TestInstrumentationScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(ctx context.Context) trace.Span
+	}{
+		{
+			name: "parent span",
+			start: func(ctx context.Context) trace.Span {
+				_, span := startParentSpan(ctx, nil, nil)
+				return span
+			},
+		},
+		{
+			name: "S3 span",
+			start: func(ctx context.Context) trace.Span {
+				_, span := startS3PutSpan(ctx, trace.SpanFromContext(ctx), "bucket", "2026/01/01/id")
+				return span
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := otel.GetTracerProvider()
+			t.Cleanup(func() { otel.SetTracerProvider(previous) })
+			tp, recorder := newRecordingTracerProvider()
+			otel.SetTracerProvider(tp)
+
+			ctx, parent := tp.Tracer("test").Start(context.Background(), "test")
+			tt.start(ctx).End()
+			parent.End()
+
+			if got := recorder.Ended()[0].InstrumentationScope().Name; got != INSTRUMENTATION_SCOPE_NAME {
+				t.Errorf("instrumentation scope = %q, want %q", got, INSTRUMENTATION_SCOPE_NAME)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	COMPENSATION_EVENT_NAME = "Compensation"
+	MANIFEST_DATE_LAYOUT    = "2006-01-02"
+)
+
+// ManifestEntry indexes a stored object. Every object gets its own entry
+// as S3 cannot append to an existing object.
+type ManifestEntry struct {
+	Key       string `json:"key"`
+	Bucket    string `json:"bucket"`
+	VersionID string `json:"versionId,omitempty"`
+	Checksum  string `json:"checksum,omitempty"`
+	StoredAt  string `json:"storedAt"`
+	TraceID   string `json:"traceId,omitempty"`
+}
+
+// isManifestEnabled reports whether the stored objects are indexed. The
+// manifest entry is written with the S3 client, so it is only written for
+// real writes into S3. The entries are kept in a bucket of their own, the
+// input bucket would trigger the update function with every entry.
+func isManifestEnabled(
+	ctx context.Context,
+) bool {
+	return MANIFEST_KEY_PREFIX != "" && MANIFEST_S3_BUCKET_NAME != "" && isS3Storage() && !isDryRun(ctx)
+}
+
+// manifestKey returns the key of the entry of an object, the entries of a
+// day are listed together under <prefix>/<date>/.
+func manifestKey(
+	key string,
+	storedAt time.Time,
+) string {
+	return MANIFEST_KEY_PREFIX + "/" + storedAt.UTC().Format(MANIFEST_DATE_LAYOUT) + "/" + key + ".json"
+}
+
+// writeManifestEntry is the second phase of a write. It indexes the stored
+// object in the manifest bucket within its own S3 span.
+func writeManifestEntry(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+	versionID string,
+	checksum string,
+) error {
+
+	storedAt := time.Now()
+	entryKey := manifestKey(key, storedAt)
+
+	logger.debug("Writing manifest entry...", "key", key, "manifestKey", entryKey)
+
+	// Start S3 manifest put span
+	ctx, manifestSpan := startS3PutManifestEntrySpan(ctx, parentSpan, entryKey, key)
+	defer manifestSpan.End()
+
+	entryAsBytes, err := json.Marshal(&ManifestEntry{
+		Key:       key,
+		Bucket:    bucket,
+		VersionID: versionID,
+		Checksum:  checksum,
+		StoredAt:  storedAt.UTC().Format(time.RFC3339),
+		TraceID:   traceIDOf(parentSpan),
+	})
+	if err == nil {
+		_, err = s3Client.PutObjectWithContext(ctx,
+			&s3.PutObjectInput{
+				Bucket:      aws.String(MANIFEST_S3_BUCKET_NAME),
+				Key:         aws.String(entryKey),
+				Body:        bytes.NewReader(entryAsBytes),
+				ContentType: aws.String("application/json"),
+			})
+	}
+
+	if err != nil {
+
+		manifestSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		manifestSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+
+		logger.error("Writing manifest entry is failed.", "key", key, "manifestKey", entryKey, "error", err)
+		return err
+	}
+
+	logger.debug("Writing manifest entry is succeeded.", "key", key, "manifestKey", entryKey)
+	return nil
+}
+
+func startS3PutManifestEntrySpan(
+	ctx context.Context,
+	parentSpan trace.Span,
+	entryKey string,
+	key string,
+) (
+	context.Context,
+	trace.Span,
+) {
+	// Start S3 manifest put span
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "S3.PutManifestEntry",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(s3RPCAttributes("PutObject")...),
+			trace.WithAttributes(s3BucketAttributes(MANIFEST_S3_BUCKET_NAME)...),
+			trace.WithAttributes([]attribute.KeyValue{
+				semconv.NetTransportTCP,
+				attribute.String("aws.s3.key", entryKey),
+				attribute.String("server.address", s3ServerAddress(MANIFEST_S3_BUCKET_NAME)),
+				attribute.String("write.phase", "manifest"),
+				attribute.String("manifest.object.key", key),
+			}...),
+			trace.WithAttributes(assumedRoleAttributes()...))
+}
+
+// failManifestWrite compensates a write whose manifest entry could not be
+// written and responds with the outcome of the compensation.
+func failManifestWrite(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+	versionID string,
+	overwritten bool,
+	manifestErr error,
+) *createResult {
+	detail := compensateManifestWrite(ctx, parentSpan, bucket, key, versionID, overwritten, manifestErr)
+	return failRequest(parentSpan, 500, detail)
+}
+
+// compensateManifestWrite deletes the stored object again. The version
+// which has just been written is deleted where the bucket is versioned, so
+// that an overwritten object is restored. An overwrite of an unversioned
+// object cannot be rolled back and is left as it is. The parent span
+// reports the manifest error and, if the compensation fails as well, its
+// error too. It returns the detail which describes the outcome.
+func compensateManifestWrite(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+	versionID string,
+	overwritten bool,
+	manifestErr error,
+) string {
+
+	parentSpan.SetAttributes([]attribute.KeyValue{
+		semconv.OtelStatusCodeError,
+		semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		attribute.String("error.type", "manifest_write_failed"),
+	}...)
+
+	parentSpan.RecordError(manifestErr, trace.WithAttributes(
+		semconv.ExceptionEscaped(true),
+	))
+	countError(parentSpan, ERROR_TYPE_S3)
+
+	if overwritten && versionID == "" {
+		parentSpan.AddEvent(COMPENSATION_EVENT_NAME, trace.WithAttributes(
+			attribute.String("compensation.reason", "manifest_write_failed"),
+			attribute.String("compensation.action", "none"),
+			attribute.String("compensation.detail", "The overwritten object has no version to restore."),
+			attribute.String("aws.s3.key", key),
+		))
+		parentSpan.SetAttributes(attribute.Bool("compensation.succeeded", false))
+
+		logger.error("Stored object cannot be rolled back, it has overwritten an unversioned object.", "key", key)
+		return "Writing the manifest entry is failed, the overwritten object could not be restored."
+	}
+
+	parentSpan.AddEvent(COMPENSATION_EVENT_NAME, trace.WithAttributes(
+		attribute.String("compensation.reason", "manifest_write_failed"),
+		attribute.String("compensation.action", "delete"),
+		attribute.String("compensation.detail", "The stored object is deleted as its manifest entry could not be written."),
+		attribute.String("aws.s3.key", key),
+		attribute.String("aws.s3.version_id", versionID),
+	))
+
+	err := deleteObjectInS3(ctx, parentSpan, bucket, key, versionID)
+	parentSpan.SetAttributes(attribute.Bool("compensation.succeeded", err == nil))
+	if err != nil {
+		parentSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+		return "Writing the manifest entry is failed and the stored object could not be deleted."
+	}
+
+	logger.warn("Stored object is deleted, its manifest entry could not be written.", "key", key)
+	return "Writing the manifest entry is failed, the stored object has been deleted."
+}
+
+// deleteObjectInS3 deletes the given version of the object or the object
+// itself without a version.
+func deleteObjectInS3(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+	versionID string,
+) error {
+
+	logger.debug("Deleting custom object in S3...", "key", key, "versionId", versionID)
+
+	// Start S3 delete span
+	ctx, s3DeleteSpan := startS3DeleteSpan(ctx, parentSpan, bucket, key)
+	defer s3DeleteSpan.End()
+
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+		s3DeleteSpan.SetAttributes(attribute.String("aws.s3.version_id", versionID))
+	}
+
+	_, err := s3Client.DeleteObjectWithContext(ctx, input)
+	if err != nil {
+
+		s3DeleteSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		s3DeleteSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+
+		logger.error("Deleting custom object in S3 is failed.", "key", key, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func startS3DeleteSpan(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+) (
+	context.Context,
+	trace.Span,
+) {
+	// Start S3 delete span
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "S3.DeleteObject",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(s3RPCAttributes("DeleteObject")...),
+			trace.WithAttributes(s3BucketAttributes(bucket)...),
+			trace.WithAttributes([]attribute.KeyValue{
+				semconv.NetTransportTCP,
+				attribute.String("aws.s3.key", key),
+				attribute.String("write.phase", "compensation"),
+			}...),
+			trace.WithAttributes(assumedRoleAttributes()...))
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	testManifestBucket = "manifest-bucket"
+)
+
+// manifestS3 stores objects and manifest entries and fails the writes of
+// the entries or the compensating deletes on demand. Access denied is not
+// retried by the SDK, so that every call is sent once.
+type manifestS3 struct {
+	mutex         sync.Mutex
+	versioned     bool
+	failManifest  bool
+	failDelete    bool
+	requests      []string
+	manifestEntry []byte
+}
+
+func (s *manifestS3) ServeHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	request := r.Method + " " + r.URL.Path
+	if versionID := r.URL.Query().Get("versionId"); versionID != "" {
+		request += "?versionId=" + versionID
+	}
+	s.requests = append(s.requests, request)
+
+	isManifest := strings.HasPrefix(r.URL.Path, "/"+testManifestBucket+"/")
+	if (isManifest && s.failManifest) || (r.Method == http.MethodDelete && s.failDelete) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+		return
+	}
+
+	if isManifest {
+		s.manifestEntry = body
+	}
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if s.versioned {
+		w.Header().Set("X-Amz-Version-Id", "v1")
+	}
+	w.Header().Set("ETag", `"etag"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// withManifestS3 stores the objects into the stubbed S3 and indexes them
+// in the manifest bucket.
+func withManifestS3(
+	t *testing.T,
+	s3Server *manifestS3,
+) {
+	server := httptest.NewServer(s3Server)
+	t.Cleanup(server.Close)
+
+	previousClient, previousStorage, previousBackend, previousBreaker := s3Client, storage, STORAGE_BACKEND, breaker
+	previousPrefix, previousBucket := MANIFEST_KEY_PREFIX, MANIFEST_S3_BUCKET_NAME
+	t.Cleanup(func() {
+		s3Client, storage, STORAGE_BACKEND, breaker = previousClient, previousStorage, previousBackend, previousBreaker
+		MANIFEST_KEY_PREFIX, MANIFEST_S3_BUCKET_NAME = previousPrefix, previousBucket
+	})
+
+	s3Client = newTestS3Client(server.URL, nil)
+	storage = newS3Storage(newS3Uploader(s3Client), s3Client, s3manager.MinUploadPartSize)
+	STORAGE_BACKEND = STORAGE_BACKEND_S3
+	breaker, _ = newTestCircuitBreaker(5, time.Minute)
+	MANIFEST_KEY_PREFIX = "manifest"
+	MANIFEST_S3_BUCKET_NAME = testManifestBucket
+}
+
+func TestWriteObjectManifest(t *testing.T) {
+	key := "2026/01/01/id"
+	entryKey := "manifest/" + time.Now().UTC().Format(MANIFEST_DATE_LAYOUT) + "/" + key + ".json"
+
+	tests := []struct {
+		name              string
+		versioned         bool
+		overwrite         bool
+		failManifest      bool
+		failDelete        bool
+		wantStatusCode    int
+		wantDetail        string
+		wantRequests      []string
+		wantCompensation  string
+		wantCompensated   bool
+		wantRecordedError int
+	}{
+		{
+			name:           "entry is written",
+			versioned:      true,
+			wantStatusCode: 201,
+			wantRequests: []string{
+				"PUT /bucket/" + key,
+				"PUT /" + testManifestBucket + "/" + entryKey,
+			},
+		},
+		{
+			name:           "failed entry deletes the stored version",
+			versioned:      true,
+			failManifest:   true,
+			wantStatusCode: 500,
+			wantDetail:     "the stored object has been deleted",
+			wantRequests: []string{
+				"PUT /bucket/" + key,
+				"PUT /" + testManifestBucket + "/" + entryKey,
+				"DELETE /bucket/" + key + "?versionId=v1",
+			},
+			wantCompensation:  "delete",
+			wantCompensated:   true,
+			wantRecordedError: 1,
+		},
+		{
+			name:           "failed entry and failed delete",
+			versioned:      true,
+			failManifest:   true,
+			failDelete:     true,
+			wantStatusCode: 500,
+			wantDetail:     "the stored object could not be deleted",
+			wantRequests: []string{
+				"PUT /bucket/" + key,
+				"PUT /" + testManifestBucket + "/" + entryKey,
+				"DELETE /bucket/" + key + "?versionId=v1",
+			},
+			wantCompensation:  "delete",
+			wantCompensated:   false,
+			wantRecordedError: 2,
+		},
+		{
+			name:           "failed entry of an unversioned overwrite",
+			overwrite:      true,
+			failManifest:   true,
+			wantStatusCode: 500,
+			wantDetail:     "the overwritten object could not be restored",
+			wantRequests: []string{
+				"PUT /bucket/" + key,
+				"PUT /" + testManifestBucket + "/" + entryKey,
+			},
+			wantCompensation:  "none",
+			wantCompensated:   false,
+			wantRecordedError: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withoutFaults(t)
+			withUploadRetries(t, 1)
+
+			s3Server := &manifestS3{
+				versioned:    tt.versioned,
+				failManifest: tt.failManifest,
+				failDelete:   tt.failDelete,
+			}
+			withManifestS3(t, s3Server)
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, parentSpan := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+
+			statusCode := 201
+			if tt.overwrite {
+				statusCode = 200
+			}
+			result := writeObject(ctx, parentSpan, "bucket", key, &CustomObject{Item: "x"}, statusCode, false)
+			parentSpan.End()
+
+			if result.StatusCode != tt.wantStatusCode {
+				t.Fatalf("status code = %d, want %d (%s)", result.StatusCode, tt.wantStatusCode, result.Body)
+			}
+			if !strings.Contains(result.Body, tt.wantDetail) {
+				t.Errorf("body = %s, want detail %q", result.Body, tt.wantDetail)
+			}
+
+			if strings.Join(s3Server.requests, "\n") != strings.Join(tt.wantRequests, "\n") {
+				t.Errorf("requests = %q, want %q", s3Server.requests, tt.wantRequests)
+			}
+
+			var handler, manifestSpan sdktrace.ReadOnlySpan
+			for _, span := range recorder.Ended() {
+				switch span.Name() {
+				case "handler":
+					handler = span
+				case "S3.PutManifestEntry":
+					manifestSpan = span
+				}
+			}
+
+			// The entry is written within its own span into the manifest
+			// bucket
+			if manifestSpan == nil {
+				t.Fatal("S3.PutManifestEntry span is missing")
+			}
+			if got := spanAttribute(manifestSpan, "aws.s3.bucket").AsString(); got != testManifestBucket {
+				t.Errorf("S3.PutManifestEntry aws.s3.bucket = %q, want %q", got, testManifestBucket)
+			}
+			if got := spanAttribute(manifestSpan, "manifest.object.key").AsString(); got != key {
+				t.Errorf("S3.PutManifestEntry manifest.object.key = %q, want %q", got, key)
+			}
+
+			compensation := ""
+			for _, event := range handler.Events() {
+				if event.Name != COMPENSATION_EVENT_NAME {
+					continue
+				}
+				for _, kv := range event.Attributes {
+					if kv.Key == "compensation.action" {
+						compensation = kv.Value.AsString()
+					}
+				}
+			}
+			if compensation != tt.wantCompensation {
+				t.Errorf("compensation.action = %q, want %q", compensation, tt.wantCompensation)
+			}
+
+			compensated := spanAttribute(handler, "compensation.succeeded")
+			if tt.wantCompensation != "" && (compensated.Type() != attribute.BOOL || compensated.AsBool() != tt.wantCompensated) {
+				t.Errorf("compensation.succeeded = %v, want %v", compensated.Emit(), tt.wantCompensated)
+			}
+
+			recordedErrors := 0
+			for _, event := range handler.Events() {
+				if event.Name == "exception" {
+					recordedErrors++
+				}
+			}
+			if recordedErrors != tt.wantRecordedError {
+				t.Errorf("recorded errors = %d, want %d", recordedErrors, tt.wantRecordedError)
+			}
+
+			if tt.failManifest {
+				return
+			}
+			entry := &ManifestEntry{}
+			if err := json.Unmarshal(s3Server.manifestEntry, entry); err != nil {
+				t.Fatalf("manifest entry = %s, error = %v", s3Server.manifestEntry, err)
+			}
+			if entry.Key != key || entry.Bucket != "bucket" || entry.VersionID != "v1" || entry.Checksum == "" {
+				t.Errorf("manifest entry = %+v, want key %q in bucket %q with version v1 and checksum", entry, key, "bucket")
+			}
+		})
+	}
+}
+
+func TestCreateObjectsManifest(t *testing.T) {
+	day := time.Now().UTC().Format(MANIFEST_DATE_LAYOUT)
+
+	tests := []struct {
+		name             string
+		failManifest     bool
+		wantItemStatus   int
+		wantError        string
+		wantDelete       bool
+		wantCompensation string
+	}{
+		{
+			name:           "entry is written",
+			wantItemStatus: 201,
+		},
+		{
+			name:             "failed entry deletes the stored item",
+			failManifest:     true,
+			wantItemStatus:   500,
+			wantError:        "the stored object has been deleted",
+			wantDelete:       true,
+			wantCompensation: "delete",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withoutFaults(t)
+			withUploadRetries(t, 1)
+			withBatchConcurrency(t, 1)
+
+			s3Server := &manifestS3{
+				versioned:    true,
+				failManifest: tt.failManifest,
+			}
+			withManifestS3(t, s3Server)
+
+			previousKeys := keyGenerator
+			t.Cleanup(func() { keyGenerator = previousKeys })
+			keyGenerator = newKeyGenerator(KEY_STRATEGY_UUID)
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, parentSpan := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+			result := createObjects(ctx, "bucket", `[{"item":"a"}]`)
+			parentSpan.End()
+
+			responses := []*BatchItemResponse{}
+			if err := json.Unmarshal([]byte(result.Body), &responses); err != nil || len(responses) != 1 {
+				t.Fatalf("body = %s, error = %v", result.Body, err)
+			}
+			item := responses[0]
+			if item.Status != tt.wantItemStatus {
+				t.Fatalf("item status = %d, want %d: %s", item.Status, tt.wantItemStatus, item.Error)
+			}
+			if !strings.Contains(item.Error, tt.wantError) {
+				t.Errorf("item error = %q, want %q", item.Error, tt.wantError)
+			}
+
+			// The key of a deleted item is not reported, it is taken from
+			// the stored object
+			key := strings.TrimPrefix(s3Server.requests[0], "PUT /bucket/")
+			wantRequests := []string{
+				"PUT /bucket/" + key,
+				"PUT /" + testManifestBucket + "/manifest/" + day + "/" + key + ".json",
+			}
+			if tt.wantDelete {
+				wantRequests = append(wantRequests, "DELETE /bucket/"+key+"?versionId=v1")
+			}
+			if strings.Join(s3Server.requests, "\n") != strings.Join(wantRequests, "\n") {
+				t.Errorf("requests = %q, want %q", s3Server.requests, wantRequests)
+			}
+
+			var itemSpan sdktrace.ReadOnlySpan
+			for _, span := range recorder.Ended() {
+				if span.Name() == "main.createBatchItem" {
+					itemSpan = span
+				}
+			}
+			if itemSpan == nil {
+				t.Fatal("main.createBatchItem span is missing")
+			}
+
+			compensation := ""
+			for _, event := range itemSpan.Events() {
+				if event.Name != COMPENSATION_EVENT_NAME {
+					continue
+				}
+				for _, kv := range event.Attributes {
+					if kv.Key == "compensation.action" {
+						compensation = kv.Value.AsString()
+					}
+				}
+			}
+			if compensation != tt.wantCompensation {
+				t.Errorf("compensation.action = %q, want %q", compensation, tt.wantCompensation)
+			}
+			if tt.wantCompensation != "" && spanAttribute(itemSpan, "otel.status_code").AsString() != "ERROR" {
+				t.Errorf("item span is not marked as failed")
+			}
+		})
+	}
+}
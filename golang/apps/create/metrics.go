@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ERROR_TYPE_MARSHAL      = "marshal"
+	ERROR_TYPE_S3           = "s3"
+	ERROR_TYPE_VALIDATION   = "validation"
+	ERROR_TYPE_PANIC        = "panic"
+	ERROR_TYPE_VERIFICATION = "verification"
+	ERROR_TYPE_AUTH         = "auth"
+)
+
+// newErrorCounter creates the lambda.errors counter which is broken down
+// by the type of the failure.
+func newErrorCounter(
+	meter metric.Meter,
+) (
+	metric.Int64Counter,
+	error,
+) {
+	return meter.Int64Counter("lambda.errors",
+		metric.WithDescription("Number of failures of the Lambda by failure type."),
+		metric.WithUnit("{error}"),
+	)
+}
+
+// newHandlerDurationHistogram creates the lambda.handler.duration_ms
+// histogram which covers the whole request from the start of the parent
+// span until the response is returned.
+func newHandlerDurationHistogram(
+	meter metric.Meter,
+) (
+	metric.Float64Histogram,
+	error,
+) {
+	return meter.Float64Histogram("lambda.handler.duration_ms",
+		metric.WithDescription("Duration of the Lambda handler by response status code."),
+		metric.WithUnit("ms"),
+	)
+}
+
+// recordHandlerDuration records the handler duration along with the status
+// code of the response.
+func recordHandlerDuration(
+	span trace.Span,
+	duration time.Duration,
+	statusCode int,
+) {
+	if handlerDurationHistogram == nil {
+		return
+	}
+
+	handlerDurationHistogram.Record(trace.ContextWithSpan(context.Background(), span),
+		float64(duration)/float64(time.Millisecond),
+		metric.WithAttributes(
+			attribute.Int("status_code", statusCode),
+		))
+}
+
+// countError increments the error counter. The span is put into the
+// context so that the measurement can be correlated with the trace.
+func countError(
+	span trace.Span,
+	errorType string,
+) {
+	if errorCounter == nil {
+		return
+	}
+
+	errorCounter.Add(trace.ContextWithSpan(context.Background(), span), 1,
+		metric.WithAttributes(
+			attribute.String("type", errorType),
+		))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// withMetricReader creates the instruments on a manual reader, so that the
+// recorded measurements can be collected by the test.
+func withMetricReader(
+	t *testing.T,
+) sdkmetric.Reader {
+	previousCounter, previousHistogram, previousThrottles, previousQueueTime := errorCounter, handlerDurationHistogram, throttleCounter, putQueueTimeHistogram
+	t.Cleanup(func() {
+		errorCounter, handlerDurationHistogram, throttleCounter, putQueueTimeHistogram = previousCounter, previousHistogram, previousThrottles, previousQueueTime
+	})
+
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(INSTRUMENTATION_SCOPE_NAME)
+
+	var err error
+	if errorCounter, err = newErrorCounter(meter); err != nil {
+		t.Fatalf("newErrorCounter() error = %v", err)
+	}
+	if handlerDurationHistogram, err = newHandlerDurationHistogram(meter); err != nil {
+		t.Fatalf("newHandlerDurationHistogram() error = %v", err)
+	}
+	if throttleCounter, err = newThrottleCounter(meter); err != nil {
+		t.Fatalf("newThrottleCounter() error = %v", err)
+	}
+	if putQueueTimeHistogram, err = newPutQueueTimeHistogram(meter); err != nil {
+		t.Fatalf("newPutQueueTimeHistogram() error = %v", err)
+	}
+	return reader
+}
+
+// collectMetric returns the collected metric of the given name.
+func collectMetric(
+	t *testing.T,
+	reader sdkmetric.Reader,
+	name string,
+) metricdata.Aggregation {
+	metrics := metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), &metrics); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	for _, scopeMetrics := range metrics.ScopeMetrics {
+		for _, m := range scopeMetrics.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	t.Fatalf("metric %q is missing", name)
+	return nil
+}
+
+func TestCountError(t *testing.T) {
+	tests := []struct {
+		name       string
+		errorTypes []string
+		want       map[string]int64
+	}{
+		{
+			name:       "one type",
+			errorTypes: []string{ERROR_TYPE_S3},
+			want:       map[string]int64{ERROR_TYPE_S3: 1},
+		},
+		{
+			name:       "types are counted apart",
+			errorTypes: []string{ERROR_TYPE_VALIDATION, ERROR_TYPE_S3, ERROR_TYPE_VALIDATION},
+			want:       map[string]int64{ERROR_TYPE_VALIDATION: 2, ERROR_TYPE_S3: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := withMetricReader(t)
+
+			span := trace.SpanFromContext(context.Background())
+			for _, errorType := range tt.errorTypes {
+				countError(span, errorType)
+			}
+
+			sum, ok := collectMetric(t, reader, "lambda.errors").(metricdata.Sum[int64])
+			if !ok {
+				t.Fatal("lambda.errors is not an int64 sum")
+			}
+			got := map[string]int64{}
+			for _, point := range sum.DataPoints {
+				errorType, _ := point.Attributes.Value("type")
+				got[errorType.AsString()] = point.Value
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("lambda.errors = %v, want %v", got, tt.want)
+			}
+			for errorType, value := range tt.want {
+				if got[errorType] != value {
+					t.Errorf("lambda.errors{type=%q} = %d, want %d", errorType, got[errorType], value)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordHandlerDuration(t *testing.T) {
+	reader := withMetricReader(t)
+
+	span := trace.SpanFromContext(context.Background())
+	recordHandlerDuration(span, 1500*time.Microsecond, 201)
+	recordHandlerDuration(span, 2500*time.Microsecond, 201)
+	recordHandlerDuration(span, time.Millisecond, 500)
+
+	histogram, ok := collectMetric(t, reader, "lambda.handler.duration_ms").(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatal("lambda.handler.duration_ms is not a float64 histogram")
+	}
+
+	tests := []struct {
+		statusCode int
+		wantCount  uint64
+		wantSum    float64
+	}{
+		{statusCode: 201, wantCount: 2, wantSum: 4},
+		{statusCode: 500, wantCount: 1, wantSum: 1},
+	}
+	for _, tt := range tests {
+		found := false
+		for _, point := range histogram.DataPoints {
+			if statusCode, _ := point.Attributes.Value(attribute.Key("status_code")); statusCode.AsInt64() != int64(tt.statusCode) {
+				continue
+			}
+			found = true
+			if point.Count != tt.wantCount || point.Sum != tt.wantSum {
+				t.Errorf("status code %d: count = %d, sum = %v ms, want %d and %v ms", tt.statusCode, point.Count, point.Sum, tt.wantCount, tt.wantSum)
+			}
+		}
+		if !found {
+			t.Errorf("status code %d has no data point", tt.statusCode)
+		}
+	}
+}
+
+func TestMetricsWithoutInstruments(t *testing.T) {
+	previousCounter, previousHistogram, previousThrottles, previousQueueTime := errorCounter, handlerDurationHistogram, throttleCounter, putQueueTimeHistogram
+	t.Cleanup(func() {
+		errorCounter, handlerDurationHistogram, throttleCounter, putQueueTimeHistogram = previousCounter, previousHistogram, previousThrottles, previousQueueTime
+	})
+	errorCounter, handlerDurationHistogram = nil, nil
+
+	// Neither panics when the instruments could not be created
+	span := trace.SpanFromContext(context.Background())
+	countError(span, ERROR_TYPE_S3)
+	recordHandlerDuration(span, time.Millisecond, 201)
+}
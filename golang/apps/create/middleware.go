@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Request is the trigger independent HTTP request which every entry point
+// translates its event into.
+type Request struct {
+	Method          string
+	RouteKey        string
+	Path            string
+	SourceIP        string
+	APIKey          string
+	Headers         map[string]string
+	Cookies         []string
+	PathParameters  map[string]string
+	QueryParameters map[string]string
+	Claims          map[string]string
+	Body            string
+	IsBase64Encoded bool
+}
+
+// Handler processes a request within the context of the parent span.
+type Handler func(
+	ctx context.Context,
+	req *Request,
+) *createResult
+
+// Middleware wraps a handler with a cross-cutting concern.
+type Middleware func(Handler) Handler
+
+// chainMiddlewares wraps the handler so that the first middleware is the
+// outermost one.
+func chainMiddlewares(
+	handler Handler,
+	middlewares ...Middleware,
+) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+func loggingMiddleware(
+	next Handler,
+) Handler {
+	return func(
+		ctx context.Context,
+		req *Request,
+	) *createResult {
+		startTime := time.Now()
+		logger.debug("Processing request...",
+			"method", req.Method,
+			"route", req.RouteKey,
+			"sourceIp", req.SourceIP,
+		)
+
+		result := next(ctx, req)
+
+		logger.info("Processing request is completed.",
+			"method", req.Method,
+			"route", req.RouteKey,
+			"statusCode", result.StatusCode,
+			"durationMs", time.Since(startTime).Milliseconds(),
+		)
+		return result
+	}
+}
+
+// recoverMiddleware turns a panic of the inner handler into a 500 and
+// records it as an exception on the parent span.
+func recoverMiddleware(
+	next Handler,
+) Handler {
+	return func(
+		ctx context.Context,
+		req *Request,
+	) (result *createResult) {
+		defer func() {
+			if r := recover(); r != nil {
+				parentSpan := trace.SpanFromContext(ctx)
+				recordPanic(parentSpan, r)
+				result = failRequest(parentSpan, 500, "Processing the request is failed unexpectedly.")
+			}
+		}()
+
+		return next(ctx, req)
+	}
+}
+
+func recordPanic(
+	span trace.Span,
+	r interface{},
+) {
+	err := fmt.Errorf("panic: %v", r)
+	logger.error("Processing request has panicked.", "error", err)
+	countError(span, ERROR_TYPE_PANIC)
+
+	span.SetAttributes(
+		semconv.OtelStatusCodeError,
+		semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+	)
+	span.RecordError(err,
+		trace.WithStackTrace(true),
+		trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+}
+
+// corsMiddleware answers CORS preflights and adds the CORS headers to the
+// responses of all other requests.
+func corsMiddleware(
+	next Handler,
+) Handler {
+	return func(
+		ctx context.Context,
+		req *Request,
+	) *createResult {
+		origin := getHeader(req.Headers, "Origin")
+
+		// Answer CORS preflight
+		if req.Method == "OPTIONS" {
+			return handlePreflight(trace.SpanFromContext(ctx), origin)
+		}
+
+		result := next(ctx, req)
+		addCORSHeaders(result, origin)
+		return result
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestChainMiddlewares(t *testing.T) {
+	calls := []string{}
+	middleware := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, req *Request) *createResult {
+				calls = append(calls, name)
+				return next(ctx, req)
+			}
+		}
+	}
+
+	tests := []struct {
+		name        string
+		middlewares []Middleware
+		wantCalls   string
+	}{
+		{
+			name:      "no middlewares",
+			wantCalls: "handler",
+		},
+		{
+			name:        "first middleware is the outermost",
+			middlewares: []Middleware{middleware("first"), middleware("second"), middleware("third")},
+			wantCalls:   "first,second,third,handler",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = calls[:0]
+			handler := chainMiddlewares(func(ctx context.Context, req *Request) *createResult {
+				calls = append(calls, "handler")
+				return &createResult{StatusCode: 201}
+			}, tt.middlewares...)
+
+			result := handler(context.Background(), &Request{})
+			if result.StatusCode != 201 {
+				t.Errorf("status code = %d, want 201", result.StatusCode)
+			}
+			if got := strings.Join(calls, ","); got != tt.wantCalls {
+				t.Errorf("calls = %q, want %q", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		next           Handler
+		wantStatusCode int
+		wantException  bool
+	}{
+		{
+			name: "handler returns",
+			next: func(ctx context.Context, req *Request) *createResult {
+				return &createResult{StatusCode: 201}
+			},
+			wantStatusCode: 201,
+		},
+		{
+			name: "handler panics",
+			next: func(ctx context.Context, req *Request) *createResult {
+				panic("boom")
+			},
+			wantStatusCode: 500,
+			wantException:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, recorder := newRecordingTracerProvider()
+			ctx, parentSpan := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+
+			result := recoverMiddleware(tt.next)(ctx, &Request{})
+			parentSpan.End()
+
+			if result.StatusCode != tt.wantStatusCode {
+				t.Errorf("status code = %d, want %d", result.StatusCode, tt.wantStatusCode)
+			}
+
+			exception := false
+			for _, event := range recorder.Ended()[0].Events() {
+				if event.Name == "exception" {
+					exception = true
+				}
+			}
+			if exception != tt.wantException {
+				t.Errorf("exception recorded = %v, want %v", exception, tt.wantException)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// s3MultipartAborter is the part of the S3 client which cleans up the
+// parts of a failed multipart upload.
+type s3MultipartAborter interface {
+	AbortMultipartUploadWithContext(
+		ctx aws.Context,
+		input *s3.AbortMultipartUploadInput,
+		opts ...request.Option,
+	) (
+		*s3.AbortMultipartUploadOutput,
+		error,
+	)
+}
+
+// s3UploadPartSize keeps the configured part size but never goes below the
+// smallest part which S3 accepts.
+func s3UploadPartSize(
+	partSize int64,
+) int64 {
+	if partSize < s3manager.MinUploadPartSize {
+		return s3manager.MinUploadPartSize
+	}
+	return partSize
+}
+
+// newS3Uploader configures the part size and the concurrency of multipart
+// uploads. The uploader always leaves the parts of a failed upload, the
+// storage aborts the upload itself unless S3_UPLOAD_LEAVE_PARTS_ON_ERROR is
+// set, so that the abort shows up in the trace. The uploads are retried by
+// uploadWithRetry, so the SDK does not resend the calls of the uploader.
+func newS3Uploader(
+	client *s3.S3,
+) *s3manager.Uploader {
+	return s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
+		u.PartSize = S3_UPLOAD_PART_SIZE
+		u.Concurrency = S3_UPLOAD_CONCURRENCY
+		u.LeavePartsOnError = true
+		u.RequestOptions = append(u.RequestOptions, withoutSDKRetries)
+	})
+}
+
+// isMultipartUpload reports whether the uploader splits the body into
+// parts. Bodies which fit into a single part are uploaded with one
+// PutObject call.
+func isMultipartUpload(
+	size int,
+	partSize int64,
+) bool {
+	return int64(size) > partSize
+}
+
+// recordUploadParts records how the uploader splits the body.
+func recordUploadParts(
+	span trace.Span,
+	size int,
+	partSize int64,
+) {
+	parts := (int64(size) + partSize - 1) / partSize
+	if parts < 1 {
+		parts = 1
+	}
+
+	span.SetAttributes([]attribute.KeyValue{
+		attribute.Int64("aws.s3.upload.parts", parts),
+		attribute.Bool("aws.s3.upload.multipart", isMultipartUpload(size, partSize)),
+	}...)
+}
+
+// abortFailedMultipartUpload aborts the multipart upload which the error
+// belongs to, so that its parts are not billed until a lifecycle rule
+// removes them. Errors of single part uploads are ignored.
+func (s *s3Storage) abortFailedMultipartUpload(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+	err error,
+) {
+	var multipartErr s3manager.MultiUploadFailure
+	if S3_UPLOAD_LEAVE_PARTS || !errors.As(err, &multipartErr) || multipartErr.UploadID() == "" {
+		return
+	}
+
+	// Start S3 abort span
+	ctx, span := parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "S3.AbortMultipartUpload",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(s3RPCAttributes("AbortMultipartUpload")...),
+			trace.WithAttributes(s3BucketAttributes(bucket)...),
+			trace.WithAttributes([]attribute.KeyValue{
+				semconv.NetTransportTCP,
+				attribute.String("aws.s3.key", key),
+				attribute.String("aws.s3.upload_id", multipartErr.UploadID()),
+			}...))
+	defer span.End()
+
+	_, err = s.aborter.AbortMultipartUploadWithContext(
+		ctx,
+		&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: aws.String(multipartErr.UploadID()),
+		})
+
+	if err != nil {
+
+		span.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		span.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(false),
+		))
+
+		logger.error("Aborting multipart upload is failed.", "key", key, "uploadId", multipartErr.UploadID(), "error", err)
+	}
+}
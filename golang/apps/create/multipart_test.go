@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+// multiUploadFailure is the error which the uploader returns for a failed
+// multipart upload.
+type multiUploadFailure struct {
+	err      awserr.Error
+	uploadID string
+}
+
+func (e multiUploadFailure) Error() string    { return e.err.Error() }
+func (e multiUploadFailure) Code() string     { return e.err.Code() }
+func (e multiUploadFailure) Message() string  { return e.err.Message() }
+func (e multiUploadFailure) OrigErr() error   { return e.err.OrigErr() }
+func (e multiUploadFailure) UploadID() string { return e.uploadID }
+
+// fakeAborter records the aborted uploads.
+type fakeAborter struct {
+	err     error
+	aborted []string
+}
+
+func (a *fakeAborter) AbortMultipartUploadWithContext(
+	_ aws.Context,
+	input *s3.AbortMultipartUploadInput,
+	_ ...request.Option,
+) (
+	*s3.AbortMultipartUploadOutput,
+	error,
+) {
+	a.aborted = append(a.aborted, aws.StringValue(input.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, a.err
+}
+
+func TestS3UploadPartSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		partSize int64
+		want     int64
+	}{
+		{
+			name:     "unset",
+			partSize: 0,
+			want:     s3manager.MinUploadPartSize,
+		},
+		{
+			name:     "below minimum",
+			partSize: 1024,
+			want:     s3manager.MinUploadPartSize,
+		},
+		{
+			name:     "configured",
+			partSize: 16 * 1024 * 1024,
+			want:     16 * 1024 * 1024,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s3UploadPartSize(tt.partSize); got != tt.want {
+				t.Errorf("s3UploadPartSize(%d) = %d, want %d", tt.partSize, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordUploadParts(t *testing.T) {
+	tests := []struct {
+		name          string
+		size          int
+		partSize      int64
+		wantParts     int64
+		wantMultipart bool
+	}{
+		{
+			name:          "empty",
+			size:          0,
+			partSize:      5,
+			wantParts:     1,
+			wantMultipart: false,
+		},
+		{
+			name:          "single part",
+			size:          5,
+			partSize:      5,
+			wantParts:     1,
+			wantMultipart: false,
+		},
+		{
+			name:          "multiple parts",
+			size:          11,
+			partSize:      5,
+			wantParts:     3,
+			wantMultipart: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, recorder := newRecordingTracerProvider()
+			_, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "S3.PutObject")
+			recordUploadParts(span, tt.size, tt.partSize)
+			span.End()
+
+			ended := recorder.Ended()[0]
+			if got := spanAttribute(ended, "aws.s3.upload.parts").AsInt64(); got != tt.wantParts {
+				t.Errorf("aws.s3.upload.parts = %d, want %d", got, tt.wantParts)
+			}
+			if got := spanAttribute(ended, "aws.s3.upload.multipart").AsBool(); got != tt.wantMultipart {
+				t.Errorf("aws.s3.upload.multipart = %v, want %v", got, tt.wantMultipart)
+			}
+		})
+	}
+}
+
+func TestAbortFailedMultipartUpload(t *testing.T) {
+	errUpload := awserr.New("InternalError", "We encountered an internal error", nil)
+
+	tests := []struct {
+		name        string
+		err         error
+		leaveParts  bool
+		abortErr    error
+		wantAborted []string
+		wantStatus  string
+	}{
+		{
+			name:        "multipart upload",
+			err:         multiUploadFailure{err: errUpload, uploadID: "upload-1"},
+			wantAborted: []string{"upload-1"},
+			wantStatus:  "",
+		},
+		{
+			name:        "abort failed",
+			err:         multiUploadFailure{err: errUpload, uploadID: "upload-1"},
+			abortErr:    errors.New("connection reset"),
+			wantAborted: []string{"upload-1"},
+			wantStatus:  OTEL_STATUS_ERROR_DESCRIPTION,
+		},
+		{
+			name:       "parts are left",
+			err:        multiUploadFailure{err: errUpload, uploadID: "upload-1"},
+			leaveParts: true,
+		},
+		{
+			name: "upload not created",
+			err:  multiUploadFailure{err: errUpload},
+		},
+		{
+			name: "single part upload",
+			err:  errUpload,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := S3_UPLOAD_LEAVE_PARTS
+			t.Cleanup(func() { S3_UPLOAD_LEAVE_PARTS = previous })
+			S3_UPLOAD_LEAVE_PARTS = tt.leaveParts
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "S3.PutObject")
+
+			aborter := &fakeAborter{err: tt.abortErr}
+			storage := newS3Storage(&fakeUploader{}, aborter, s3manager.MinUploadPartSize)
+			storage.abortFailedMultipartUpload(ctx, span, "bucket", "2026/01/01/id", tt.err)
+			span.End()
+
+			if len(aborter.aborted) != len(tt.wantAborted) || (len(tt.wantAborted) > 0 && aborter.aborted[0] != tt.wantAborted[0]) {
+				t.Errorf("aborted uploads = %v, want %v", aborter.aborted, tt.wantAborted)
+			}
+
+			var abortSpans int
+			for _, s := range recorder.Ended() {
+				if s.Name() != "S3.AbortMultipartUpload" {
+					continue
+				}
+				abortSpans++
+				if got := spanAttribute(s, "otel.status_description").AsString(); got != tt.wantStatus {
+					t.Errorf("otel.status_description = %q, want %q", got, tt.wantStatus)
+				}
+			}
+			if abortSpans != len(tt.wantAborted) {
+				t.Errorf("got %d abort spans, want %d", abortSpans, len(tt.wantAborted))
+			}
+		})
+	}
+}
+
+func TestS3StoragePutMultipartChecksum(t *testing.T) {
+	withoutFaults(t)
+	withUploadRetries(t, 1)
+
+	body := []byte(`{"item":"x"}`)
+
+	tests := []struct {
+		name         string
+		partSize     int64
+		wantChecksum string
+	}{
+		{
+			name:         "single part",
+			partSize:     s3manager.MinUploadPartSize,
+			wantChecksum: checksumSHA256(body),
+		},
+		{
+			name:         "multipart",
+			partSize:     5,
+			wantChecksum: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, recorder := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+
+			uploader := &fakeUploader{}
+			storage := newS3Storage(uploader, &fakeAborter{}, tt.partSize)
+			result, err := storage.Put(ctx, "2026/01/01/id", body, commons.PutMetadata{Bucket: "bucket"})
+			span.End()
+			if err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+
+			if result.Checksum != tt.wantChecksum {
+				t.Errorf("Put() checksum = %q, want %q", result.Checksum, tt.wantChecksum)
+			}
+			if got := aws.StringValue(uploader.input.ChecksumSHA256); got != tt.wantChecksum {
+				t.Errorf("uploaded checksum = %q, want %q", got, tt.wantChecksum)
+			}
+			if got := spanAttribute(recorder.Ended()[0], "aws.s3.checksum.sha256").AsString(); got != tt.wantChecksum {
+				t.Errorf("aws.s3.checksum.sha256 = %q, want %q", got, tt.wantChecksum)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// presignGetObject creates a GET URL for the freshly created object so that
+// callers can fetch it right away. The URL carries a signature and must
+// therefore never end up in logs or span attributes.
+func presignGetObject(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+) (
+	string,
+	error,
+) {
+	// Start S3 presign span
+	_, s3PresignSpan := startS3PresignSpan(ctx, parentSpan, bucket, key)
+	defer s3PresignSpan.End()
+
+	req, _ := s3Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	presignedURL, err := req.Presign(PRESIGNED_URL_EXPIRY)
+	if err != nil {
+		s3PresignSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		s3PresignSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(false),
+		))
+
+		logger.warn("Presigning object URL is failed.", "bucket", bucket, "key", key, "error", err)
+		return "", err
+	}
+
+	return presignedURL, nil
+}
+
+func startS3PresignSpan(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+) (
+	context.Context,
+	trace.Span,
+) {
+	// Start S3 presign span
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "S3.PresignGetObject",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(s3BucketAttributes(bucket)...),
+			trace.WithAttributes([]attribute.KeyValue{
+				attribute.String("aws.s3.key", key),
+				attribute.Int64("aws.s3.presign.expiry_seconds", int64(PRESIGNED_URL_EXPIRY/time.Second)),
+			}...))
+}
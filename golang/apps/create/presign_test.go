@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestPresignGetObject(t *testing.T) {
+	previousClient, previousExpiry := s3Client, PRESIGNED_URL_EXPIRY
+	t.Cleanup(func() { s3Client, PRESIGNED_URL_EXPIRY = previousClient, previousExpiry })
+
+	tests := []struct {
+		name               string
+		expiry             time.Duration
+		missingCredentials bool
+		wantExpires        string
+		wantErr            bool
+	}{
+		{
+			name:        "default expiry",
+			expiry:      DEFAULT_PRESIGNED_URL_EXPIRY_SECONDS * time.Second,
+			wantExpires: "900",
+		},
+		{
+			name:        "custom expiry",
+			expiry:      time.Minute,
+			wantExpires: "60",
+		},
+		{
+			name:               "missing credentials",
+			expiry:             time.Minute,
+			missingCredentials: true,
+			wantErr:            true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			PRESIGNED_URL_EXPIRY = tt.expiry
+			s3Client = newTestS3Client("http://localhost:4566", nil)
+			if tt.missingCredentials {
+				s3Client.Config.Credentials = credentials.NewCredentials(&credentials.ErrorProvider{
+					Err:          errors.New("no credentials"),
+					ProviderName: "test",
+				})
+			}
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, parentSpan := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+
+			presignedURL, err := presignGetObject(ctx, parentSpan, "bucket", "2026/01/01/id")
+			parentSpan.End()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("presignGetObject() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			var spanAttributes []string
+			for _, span := range recorder.Ended() {
+				if span.Name() != "S3.PresignGetObject" {
+					continue
+				}
+				for _, kv := range span.Attributes() {
+					spanAttributes = append(spanAttributes, kv.Value.Emit())
+				}
+				if got := spanAttribute(span, "aws.s3.key").AsString(); got != "2026/01/01/id" {
+					t.Errorf("S3.PresignGetObject aws.s3.key = %q, want %q", got, "2026/01/01/id")
+				}
+			}
+			if len(spanAttributes) == 0 {
+				t.Fatal("S3.PresignGetObject span is missing")
+			}
+			if tt.wantErr {
+				return
+			}
+
+			parsed, err := url.Parse(presignedURL)
+			if err != nil {
+				t.Fatalf("presigned URL %q is invalid: %v", presignedURL, err)
+			}
+			if parsed.Path != "/bucket/2026/01/01/id" {
+				t.Errorf("presigned URL path = %q, want /bucket/2026/01/01/id", parsed.Path)
+			}
+			query := parsed.Query()
+			if query.Get("X-Amz-Expires") != tt.wantExpires || query.Get("X-Amz-Signature") == "" {
+				t.Errorf("presigned URL query = %v, want signature expiring in %s seconds", query, tt.wantExpires)
+			}
+
+			// The signature never ends up in the span
+			for _, value := range spanAttributes {
+				if strings.Contains(value, query.Get("X-Amz-Signature")) {
+					t.Errorf("span attribute %q carries the signature", value)
+				}
+			}
+		})
+	}
+}
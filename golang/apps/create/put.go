@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	PRECONDITION_FAILED_EVENT_NAME = "PreconditionFailed"
+)
+
+var (
+	errPreconditionFailed = errors.New("object already exists")
+
+	// Caller chosen ids end up in object keys, so keep them to a
+	// conservative character set without any path separators.
+	objectIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+	// Keys returned in the Location header carry the date partition in
+	// front of the id.
+	objectPartitionPattern = regexp.MustCompile(`^\d{4}/\d{2}/\d{2}/`)
+)
+
+// ConflictResponse extends the problem details with the object which
+// prevented a create-only write.
+type ConflictResponse struct {
+	*commons.Problem
+	Key           string `json:"key"`
+	Bucket        string `json:"bucket"`
+	ETag          string `json:"etag,omitempty"`
+	VersionID     string `json:"versionId,omitempty"`
+	LastModified  string `json:"lastModified,omitempty"`
+	ContentLength int64  `json:"contentLength,omitempty"`
+}
+
+// resolveObjectKey returns the object key which a PUT addresses. A bare id
+// is placed into today's partition like generated keys are, a full key as
+// returned in the Location header is used as it is. ok is false if the id
+// is neither.
+func resolveObjectKey(
+	id string,
+	now time.Time,
+) (
+	string,
+	bool,
+) {
+	if objectIDPattern.MatchString(id) {
+		return commons.BuildObjectKey(OBJECT_KEY_PREFIX, now, id), true
+	}
+
+	partitioned := id
+	if OBJECT_KEY_PREFIX != "" {
+		if !strings.HasPrefix(id, OBJECT_KEY_PREFIX+"/") {
+			return "", false
+		}
+		partitioned = strings.TrimPrefix(id, OBJECT_KEY_PREFIX+"/")
+	}
+
+	partition := objectPartitionPattern.FindString(partitioned)
+	if partition == "" {
+		return "", false
+	}
+	if _, err := time.Parse("2006/01/02/", partition); err != nil {
+		return "", false
+	}
+	if !objectIDPattern.MatchString(strings.TrimPrefix(partitioned, partition)) {
+		return "", false
+	}
+	return id, true
+}
+
+// itemLocation returns the path under which the object can be addressed.
+// Keys consist of URL safe segments only, the greedy {id+} routes of PUT
+// and PATCH take them including the slashes of the partition.
+func itemLocation(
+	key string,
+) string {
+	return "/items/" + key
+}
+
+// putObject stores the body under the caller chosen id. It responds with
+// 201 when the object is new and with 200 when an existing one has been
+// overwritten. With createOnly (If-None-Match: *), an existing object is
+// never overwritten and 409 is returned instead.
+func putObject(
+	ctx context.Context,
+	bucket string,
+	id string,
+	body string,
+	createOnly bool,
+) *createResult {
+
+	parentSpan := trace.SpanFromContext(ctx)
+
+	// Validate object id
+	key, ok := resolveObjectKey(id, time.Now())
+	if !ok {
+		logger.warn("Object id is invalid.", "id", id)
+		countError(parentSpan, ERROR_TYPE_VALIDATION)
+		return failRequest(parentSpan, 400, "Object id is invalid.")
+	}
+
+	// Parse custom object
+	customObject, err := parseCustomObject(parentSpan, body)
+	if err != nil {
+		return failRequest(parentSpan, 400, "Request body is not a valid custom object.")
+	}
+
+	// Check whether the object already exists, other backends rely on
+	// the conditional write only
+	var existing *s3.HeadObjectOutput
+	if isS3Storage() {
+		existing, err = headObjectInS3(ctx, parentSpan, bucket, key)
+		if err != nil {
+			return failRequest(parentSpan, 500, "Checking the object in S3 is failed.")
+		}
+	}
+
+	if !createOnly {
+		statusCode := 201
+		if existing != nil {
+			statusCode = 200
+		}
+		return writeObject(ctx, parentSpan, bucket, key, customObject, statusCode, false)
+	}
+
+	parentSpan.SetAttributes(attribute.Bool("aws.s3.create_only", true))
+	if existing != nil {
+		return rejectExistingObject(parentSpan, bucket, key, existing)
+	}
+
+	// The object might be created between the check and the write, so S3
+	// has to enforce the precondition as well.
+	return writeObject(ctx, parentSpan, bucket, key, customObject, 201, true)
+}
+
+// rejectExistingObject answers a create-only write of an existing key. A
+// conflict is an expected outcome, so the trace is not marked as an error.
+func rejectExistingObject(
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+	existing *s3.HeadObjectOutput,
+) *createResult {
+
+	logger.warn("Object already exists.", "key", key)
+
+	parentSpan.SetAttributes(attribute.String("error.type", "precondition_failed"))
+	parentSpan.AddEvent(PRECONDITION_FAILED_EVENT_NAME,
+		trace.WithAttributes(s3BucketAttributes(bucket)...),
+		trace.WithAttributes(
+			attribute.String("aws.s3.key", key),
+		))
+
+	conflict := &ConflictResponse{
+		Problem: commons.NewProblem(409, "Object already exists.", traceIDOf(parentSpan)),
+		Key:     key,
+		Bucket:  bucket,
+	}
+	if existing != nil {
+		conflict.ETag = aws.StringValue(existing.ETag)
+		conflict.VersionID = aws.StringValue(existing.VersionId)
+		conflict.ContentLength = aws.Int64Value(existing.ContentLength)
+		if existing.LastModified != nil {
+			conflict.LastModified = existing.LastModified.UTC().Format(time.RFC3339)
+		}
+	}
+
+	return failRequestWithProblem(parentSpan, 409, conflict)
+}
+
+// headObjectInS3 returns the metadata of the object or nil if it does not
+// exist.
+func headObjectInS3(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+) (
+	*s3.HeadObjectOutput,
+	error,
+) {
+
+	logger.debug("Checking custom object in S3...", "key", key)
+
+	// Start S3 head span
+	ctx, s3HeadSpan := startS3HeadSpan(ctx, parentSpan, bucket, key)
+	defer s3HeadSpan.End()
+
+	// Directory buckets authorize the requests with a session of their own
+	var opts []request.Option
+	var err error
+	if isDirectoryBucket(bucket) {
+		opts, err = expressSessions.requestOptions(ctx, s3HeadSpan, bucket)
+	}
+
+	var output *s3.HeadObjectOutput
+	if err == nil {
+		output, err = s3Client.HeadObjectWithContext(
+			ctx,
+			&s3.HeadObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(key),
+			},
+			opts...)
+	}
+
+	if isNotFound(err) {
+		s3HeadSpan.SetAttributes(attribute.Bool("aws.s3.object.exists", false))
+		return nil, nil
+	}
+
+	if err != nil {
+
+		s3HeadSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		s3HeadSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+
+		logger.error("Checking custom object in S3 is failed.", "key", key, "error", err)
+		return nil, err
+	}
+
+	s3HeadSpan.SetAttributes(attribute.Bool("aws.s3.object.exists", true))
+	return output, nil
+}
+
+func isNotFound(
+	err error,
+) bool {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) {
+		return requestFailure.StatusCode() == 404
+	}
+	return false
+}
+
+// isPreconditionFailed reports whether S3 rejected a conditional write.
+// S3 answers with 412 if the precondition does not hold and with 409 if a
+// concurrent conditional write is in flight.
+func isPreconditionFailed(
+	err error,
+) bool {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) {
+		return requestFailure.StatusCode() == 412 ||
+			requestFailure.Code() == "ConditionalRequestConflict"
+	}
+	return false
+}
+
+func startS3HeadSpan(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+) (
+	context.Context,
+	trace.Span,
+) {
+	// Start S3 head span
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "S3.HeadObject",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(s3RPCAttributes("HeadObject")...),
+			trace.WithAttributes(s3BucketAttributes(bucket)...),
+			trace.WithAttributes([]attribute.KeyValue{
+				semconv.NetTransportTCP,
+				attribute.String("aws.s3.key", key),
+			}...),
+			trace.WithAttributes(assumedRoleAttributes()...))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveObjectKey(t *testing.T) {
+	now := time.Date(2026, 3, 7, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		prefix  string
+		id      string
+		wantKey string
+		wantOK  bool
+	}{
+		{
+			name:    "bare id",
+			id:      "item-1",
+			wantKey: "2026/03/07/item-1",
+			wantOK:  true,
+		},
+		{
+			name:    "bare id with prefix",
+			prefix:  "objects",
+			id:      "item-1",
+			wantKey: "objects/2026/03/07/item-1",
+			wantOK:  true,
+		},
+		{
+			name:    "full key",
+			id:      "2025/12/31/item-1",
+			wantKey: "2025/12/31/item-1",
+			wantOK:  true,
+		},
+		{
+			name:    "full key with prefix",
+			prefix:  "objects",
+			id:      "objects/2025/12/31/item-1",
+			wantKey: "objects/2025/12/31/item-1",
+			wantOK:  true,
+		},
+		{
+			name:   "full key without the configured prefix",
+			prefix: "objects",
+			id:     "2025/12/31/item-1",
+			wantOK: false,
+		},
+		{
+			name:   "full key with another prefix",
+			prefix: "objects",
+			id:     "others/2025/12/31/item-1",
+			wantOK: false,
+		},
+		{
+			name:   "invalid date",
+			id:     "2025/13/31/item-1",
+			wantOK: false,
+		},
+		{
+			name:   "partition without id",
+			id:     "2025/12/31/",
+			wantOK: false,
+		},
+		{
+			name:   "nested id",
+			id:     "2025/12/31/a/b",
+			wantOK: false,
+		},
+		{
+			name:   "traversal",
+			id:     "../item-1",
+			wantOK: false,
+		},
+		{
+			name:   "empty",
+			id:     "",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := OBJECT_KEY_PREFIX
+			t.Cleanup(func() { OBJECT_KEY_PREFIX = previous })
+			OBJECT_KEY_PREFIX = tt.prefix
+
+			key, ok := resolveObjectKey(tt.id, now)
+			if ok != tt.wantOK || key != tt.wantKey {
+				t.Errorf("resolveObjectKey(%q) = (%q, %v), want (%q, %v)", tt.id, key, ok, tt.wantKey, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestItemLocationRoundTrips(t *testing.T) {
+	now := time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	for _, prefix := range []string{"", "objects", "tenants/a"} {
+		t.Run("prefix "+prefix, func(t *testing.T) {
+			previous := OBJECT_KEY_PREFIX
+			t.Cleanup(func() { OBJECT_KEY_PREFIX = previous })
+			OBJECT_KEY_PREFIX = prefix
+
+			key, _ := resolveObjectKey("item-1", now)
+
+			// The greedy route hands everything behind /items/ over as id
+			id := itemLocation(key)[len("/items/"):]
+			resolved, ok := resolveObjectKey(id, now.AddDate(0, 0, 1))
+			if !ok || resolved != key {
+				t.Errorf("resolveObjectKey(%q) = (%q, %v), want (%q, true)", id, resolved, ok, key)
+			}
+		})
+	}
+}
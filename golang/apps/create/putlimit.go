@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
+)
+
+type putQueueTimeContextKey struct{}
+
+// limitedStorage bounds the number of writes which run at the same time.
+// The slots are shared by every storage which wraps them and live in a
+// package variable, so that concurrent invocations of the same execution
+// environment and the items of a batch all queue for the same slots.
+type limitedStorage struct {
+	next  commons.Storage
+	slots *semaphore.Weighted
+}
+
+// newLimitedStorage returns the storage as it is without slots, so that
+// writes are only bounded when STORAGE_MAX_CONCURRENT_PUTS is set.
+func newLimitedStorage(
+	next commons.Storage,
+	slots *semaphore.Weighted,
+) commons.Storage {
+	if next == nil || slots == nil {
+		return next
+	}
+	return &limitedStorage{
+		next:  next,
+		slots: slots,
+	}
+}
+
+// Put waits for a free slot before it writes. A write whose context is
+// done while it waits gives up with the error of the context instead of
+// holding on to the queue.
+func (s *limitedStorage) Put(
+	ctx context.Context,
+	key string,
+	body []byte,
+	metadata commons.PutMetadata,
+) (
+	commons.PutResult,
+	error,
+) {
+	startTime := time.Now()
+	err := s.slots.Acquire(ctx, 1)
+	queueTime := time.Since(startTime)
+	recordPutQueueTime(ctx, queueTime)
+	if err != nil {
+		logger.warn("Waiting for a storage slot is canceled.", "key", key, "error", err)
+		return commons.PutResult{}, err
+	}
+	defer s.slots.Release(1)
+
+	ctx = context.WithValue(ctx, putQueueTimeContextKey{}, queueTime)
+	return s.next.Put(ctx, key, body, metadata)
+}
+
+// newPutQueueTimeHistogram creates the lambda.storage.put.queue_time_ms
+// histogram which records how long the writes have waited for a slot.
+func newPutQueueTimeHistogram(
+	meter metric.Meter,
+) (
+	metric.Float64Histogram,
+	error,
+) {
+	return meter.Float64Histogram("lambda.storage.put.queue_time_ms",
+		metric.WithDescription("Time which the writes have waited for a free storage slot."),
+		metric.WithUnit("ms"),
+	)
+}
+
+// recordPutQueueTime keeps the span but not the cancellation of the
+// context, the SDK would drop the queue time of writes which have given up
+// waiting otherwise.
+func recordPutQueueTime(
+	ctx context.Context,
+	queueTime time.Duration,
+) {
+	if putQueueTimeHistogram == nil {
+		return
+	}
+	putQueueTimeHistogram.Record(trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx)), float64(queueTime)/float64(time.Millisecond))
+}
+
+// putQueueTimeAttributes records the time which the write has waited for
+// a slot on the S3 span. Nothing is recorded for unbounded writes.
+func putQueueTimeAttributes(
+	ctx context.Context,
+) []attribute.KeyValue {
+	queueTime, ok := ctx.Value(putQueueTimeContextKey{}).(time.Duration)
+	if !ok {
+		return nil
+	}
+	return []attribute.KeyValue{
+		attribute.Float64("aws.s3.upload.queue_time_ms", float64(queueTime)/float64(time.Millisecond)),
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestNewLimitedStorage(t *testing.T) {
+	next := &scriptedStorage{}
+
+	tests := []struct {
+		name        string
+		next        commons.Storage
+		slots       *semaphore.Weighted
+		wantLimited bool
+	}{
+		{
+			name:        "bounded",
+			next:        next,
+			slots:       semaphore.NewWeighted(2),
+			wantLimited: true,
+		},
+		{
+			name:        "unbounded",
+			next:        next,
+			slots:       nil,
+			wantLimited: false,
+		},
+		{
+			name:        "no storage",
+			next:        nil,
+			slots:       semaphore.NewWeighted(2),
+			wantLimited: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newLimitedStorage(tt.next, tt.slots)
+
+			if _, limited := got.(*limitedStorage); limited != tt.wantLimited {
+				t.Errorf("newLimitedStorage() = %T, want limited %v", got, tt.wantLimited)
+			}
+			if !tt.wantLimited && got != tt.next {
+				t.Errorf("newLimitedStorage() = %v, want %v", got, tt.next)
+			}
+		})
+	}
+}
+
+func TestLimitedStoragePut(t *testing.T) {
+	tests := []struct {
+		name          string
+		slotsTaken    bool
+		wantErr       error
+		wantCalls     int32
+		wantQueueTime bool
+	}{
+		{
+			name:          "free slot",
+			slotsTaken:    false,
+			wantCalls:     1,
+			wantQueueTime: true,
+		},
+		{
+			name:          "canceled while waiting",
+			slotsTaken:    true,
+			wantErr:       context.DeadlineExceeded,
+			wantCalls:     0,
+			wantQueueTime: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := withMetricReader(t)
+
+			var queueTimeAttributes int
+			next := &scriptedStorage{}
+			next.put = func(key string, body []byte, metadata commons.PutMetadata) (commons.PutResult, error) {
+				return commons.PutResult{VersionID: "v1"}, nil
+			}
+			slots := semaphore.NewWeighted(1)
+			if tt.slotsTaken {
+				slots.Acquire(context.Background(), 1)
+			}
+			storage := newLimitedStorage(queueTimeRecorder{next: next, attributes: &queueTimeAttributes}, slots)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err := storage.Put(ctx, "2026/01/01/id", []byte(`{"item":"x"}`), commons.PutMetadata{Bucket: "bucket"})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Put() error = %v, want %v", err, tt.wantErr)
+			}
+			if next.calls != tt.wantCalls {
+				t.Errorf("storage called %d times, want %d", next.calls, tt.wantCalls)
+			}
+			if got := queueTimeAttributes > 0; got != tt.wantQueueTime {
+				t.Errorf("queue time passed on = %v, want %v", got, tt.wantQueueTime)
+			}
+			if tt.wantErr == nil && !slots.TryAcquire(1) {
+				t.Error("slot is not released")
+			}
+
+			histogram := collectMetric(t, reader, "lambda.storage.put.queue_time_ms").(metricdata.Histogram[float64])
+			if len(histogram.DataPoints) != 1 || histogram.DataPoints[0].Count != 1 {
+				t.Errorf("lambda.storage.put.queue_time_ms = %+v, want one record", histogram.DataPoints)
+			}
+		})
+	}
+}
+
+// queueTimeRecorder counts the queue time attributes which reach the
+// storage behind the limit.
+type queueTimeRecorder struct {
+	next       commons.Storage
+	attributes *int
+}
+
+func (r queueTimeRecorder) Put(
+	ctx context.Context,
+	key string,
+	body []byte,
+	metadata commons.PutMetadata,
+) (
+	commons.PutResult,
+	error,
+) {
+	*r.attributes += len(putQueueTimeAttributes(ctx))
+	return r.next.Put(ctx, key, body, metadata)
+}
+
+func TestPutQueueTimeAttributes(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []float64
+	}{
+		{
+			name: "unbounded",
+			ctx:  context.Background(),
+			want: nil,
+		},
+		{
+			name: "queued",
+			ctx:  context.WithValue(context.Background(), putQueueTimeContextKey{}, 1500*time.Microsecond),
+			want: []float64{1.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []float64
+			for _, attr := range putQueueTimeAttributes(tt.ctx) {
+				got = append(got, attr.Value.AsFloat64())
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("putQueueTimeAttributes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	MAX_QUERY_PARAM_VALUE_LENGTH = 128
+)
+
+// parseAllowedQueryParams parses the comma separated ALLOWED_QUERY_PARAMS.
+// Query parameters are matched case-insensitively.
+func parseAllowedQueryParams(
+	value string,
+) map[string]bool {
+	allowed := map[string]bool{}
+	for _, key := range strings.Split(value, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key != "" {
+			allowed[key] = true
+		}
+	}
+	return allowed
+}
+
+// queryParameterAttributes records the allowlisted query parameters as
+// http.query.<key> attributes. Every other parameter is dropped as it might
+// carry personal data. Values are truncated to keep the spans small.
+func queryParameterAttributes(
+	queryParameters map[string]string,
+) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{}
+	for key, value := range queryParameters {
+		key = strings.ToLower(key)
+		if !ALLOWED_QUERY_PARAMS[key] {
+			continue
+		}
+
+		if len(value) > MAX_QUERY_PARAM_VALUE_LENGTH {
+			value = strings.ToValidUTF8(value[:MAX_QUERY_PARAM_VALUE_LENGTH], "")
+		}
+		attributes = append(attributes, attribute.String("http.query."+key, value))
+	}
+	return attributes
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestParseAllowedQueryParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]bool
+	}{
+		{name: "empty", value: "", want: map[string]bool{}},
+		{name: "keys are trimmed and lowered", value: " dryRun , Tenant,,", want: map[string]bool{"dryrun": true, "tenant": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAllowedQueryParams(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAllowedQueryParams(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryParameterAttributes(t *testing.T) {
+	previous := ALLOWED_QUERY_PARAMS
+	t.Cleanup(func() { ALLOWED_QUERY_PARAMS = previous })
+	ALLOWED_QUERY_PARAMS = parseAllowedQueryParams("dryRun,tenant")
+
+	tests := []struct {
+		name            string
+		queryParameters map[string]string
+		want            []attribute.KeyValue
+	}{
+		{
+			name:            "no query parameters",
+			queryParameters: map[string]string{},
+			want:            []attribute.KeyValue{},
+		},
+		{
+			name:            "allowed parameter in other case",
+			queryParameters: map[string]string{"DryRun": "true"},
+			want:            []attribute.KeyValue{attribute.String("http.query.dryrun", "true")},
+		},
+		{
+			name:            "other parameters are dropped",
+			queryParameters: map[string]string{"email": "jane@example.com", "tenant": "a"},
+			want:            []attribute.KeyValue{attribute.String("http.query.tenant", "a")},
+		},
+		{
+			name:            "long value is truncated",
+			queryParameters: map[string]string{"tenant": strings.Repeat("a", MAX_QUERY_PARAM_VALUE_LENGTH+1)},
+			want:            []attribute.KeyValue{attribute.String("http.query.tenant", strings.Repeat("a", MAX_QUERY_PARAM_VALUE_LENGTH))},
+		},
+		{
+			name:            "truncation keeps valid UTF-8",
+			queryParameters: map[string]string{"tenant": strings.Repeat("a", MAX_QUERY_PARAM_VALUE_LENGTH-1) + "ä"},
+			want:            []attribute.KeyValue{attribute.String("http.query.tenant", strings.Repeat("a", MAX_QUERY_PARAM_VALUE_LENGTH-1))},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryParameterAttributes(tt.queryParameters); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queryParameterAttributes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
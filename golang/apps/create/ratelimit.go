@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DEFAULT_RATE_LIMIT_BURST = 10
+	RATE_LIMIT_MAX_CLIENTS   = 10000
+	RATE_LIMIT_MAX_KEYS      = 100
+	RATE_LIMIT_OTHER_KEY     = "other"
+
+	RATE_LIMIT_OUTCOME_ALLOWED = "allowed"
+	RATE_LIMIT_OUTCOME_LIMITED = "limited"
+)
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// rateLimiter keeps a token bucket per client. Its state lives in a package
+// variable and therefore only covers the requests of one execution
+// environment, concurrent Lambda instances limit independently. All
+// buckets are guarded by a single mutex as a request takes one token only.
+type rateLimiter struct {
+	mutex   sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+func newRateLimiter(
+	rate float64,
+	burst int,
+) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*tokenBucket{},
+		now:     time.Now,
+	}
+}
+
+// allow takes a token of the client. Otherwise, it returns how long the
+// client has to wait for the next token.
+func (l *rateLimiter) allow(
+	client string,
+) (
+	bool,
+	time.Duration,
+) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	bucket, ok := l.buckets[client]
+	if !ok {
+		l.evictFullBuckets(now)
+		bucket = &tokenBucket{
+			tokens:    l.burst,
+			updatedAt: now,
+		}
+		l.buckets[client] = bucket
+	}
+
+	// Refill for the elapsed time
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*l.rate)
+	bucket.updatedAt = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+// evictFullBuckets bounds the memory once too many clients are tracked.
+// Buckets which are full again behave like new ones and can be dropped.
+func (l *rateLimiter) evictFullBuckets(
+	now time.Time,
+) {
+	if len(l.buckets) < RATE_LIMIT_MAX_CLIENTS {
+		return
+	}
+	for client, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// rateLimitClient identifies the caller by the API key which API Gateway
+// has validated and falls back to the source IP. A key sent by the caller
+// is not trusted, anyone could send a new one with every request. Both are
+// hashed as the client ends up in metrics and logs.
+func rateLimitClient(
+	req *Request,
+) string {
+	if apiKey := strings.TrimSpace(req.APIKey); apiKey != "" {
+		return "apikey:" + hashRateLimitClient(apiKey)
+	}
+	return "ip:" + hashRateLimitClient(req.SourceIP)
+}
+
+func hashRateLimitClient(
+	value string,
+) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+// rateLimitMiddleware answers requests of exhausted clients with a 429
+// before anything touches S3. CORS preflights and health checks are not
+// limited.
+func rateLimitMiddleware(
+	next Handler,
+) Handler {
+	return func(
+		ctx context.Context,
+		req *Request,
+	) *createResult {
+		if limiter == nil || req.Method == "OPTIONS" || isHealthRequest(req) {
+			return next(ctx, req)
+		}
+
+		parentSpan := trace.SpanFromContext(ctx)
+		client := rateLimitClient(req)
+
+		allowed, retryAfter := limiter.allow(client)
+		if allowed {
+			countRateLimitRequest(parentSpan, client, RATE_LIMIT_OUTCOME_ALLOWED)
+			return next(ctx, req)
+		}
+		countRateLimitRequest(parentSpan, client, RATE_LIMIT_OUTCOME_LIMITED)
+
+		logger.warn("Request is rate limited.", "client", client)
+		parentSpan.SetAttributes(attribute.String("error.type", "rate_limited"))
+
+		result := failRequest(parentSpan, 429, "Too many requests.")
+		result.Headers["Retry-After"] = strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+		return result
+	}
+}
+
+// rateLimitKeys caps the number of distinct clients recorded on the
+// counter. Later clients are recorded as "other".
+type rateLimitKeys struct {
+	mutex sync.Mutex
+	keys  map[string]bool
+}
+
+func (k *rateLimitKeys) attribute(
+	client string,
+) string {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.keys[client] {
+		return client
+	}
+	if len(k.keys) >= RATE_LIMIT_MAX_KEYS {
+		return RATE_LIMIT_OTHER_KEY
+	}
+	k.keys[client] = true
+	return client
+}
+
+var (
+	rateLimitCounterKeys = &rateLimitKeys{
+		keys: map[string]bool{},
+	}
+)
+
+// newRateLimitCounter creates the lambda.rate_limit.requests counter which
+// is broken down by client and outcome.
+func newRateLimitCounter(
+	meter metric.Meter,
+) (
+	metric.Int64Counter,
+	error,
+) {
+	return meter.Int64Counter("lambda.rate_limit.requests",
+		metric.WithDescription("Number of rate limited and allowed requests by client."),
+		metric.WithUnit("{request}"),
+	)
+}
+
+func countRateLimitRequest(
+	span trace.Span,
+	client string,
+	outcome string,
+) {
+	if rateLimitCounter == nil {
+		return
+	}
+
+	rateLimitCounter.Add(trace.ContextWithSpan(context.Background(), span), 1,
+		metric.WithAttributes(
+			attribute.String("client", rateLimitCounterKeys.attribute(client)),
+			attribute.String("outcome", outcome),
+		))
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimitClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        *Request
+		wantPrefix string
+		wantSameAs *Request
+	}{
+		{
+			name:       "gateway API key",
+			req:        &Request{APIKey: "key-1", SourceIP: "203.0.113.7"},
+			wantPrefix: "apikey:",
+		},
+		{
+			name:       "header API key is not trusted",
+			req:        &Request{Headers: map[string]string{"X-Api-Key": "key-1"}, SourceIP: "203.0.113.7"},
+			wantPrefix: "ip:",
+			wantSameAs: &Request{SourceIP: "203.0.113.7"},
+		},
+		{
+			name:       "source IP",
+			req:        &Request{SourceIP: "203.0.113.7"},
+			wantPrefix: "ip:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := rateLimitClient(tt.req)
+
+			if !strings.HasPrefix(client, tt.wantPrefix) {
+				t.Errorf("rateLimitClient() = %q, want prefix %q", client, tt.wantPrefix)
+			}
+			if strings.Contains(client, tt.req.SourceIP) || (tt.req.APIKey != "" && strings.Contains(client, tt.req.APIKey)) {
+				t.Errorf("rateLimitClient() = %q contains the raw identity", client)
+			}
+			if tt.wantSameAs != nil && client != rateLimitClient(tt.wantSameAs) {
+				t.Errorf("rateLimitClient() = %q, want %q", client, rateLimitClient(tt.wantSameAs))
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name           string
+		requests       int
+		advance        time.Duration
+		wantAllowed    int
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:        "burst",
+			requests:    3,
+			wantAllowed: 3,
+		},
+		{
+			name:           "exhausted",
+			requests:       5,
+			wantAllowed:    3,
+			wantRetryAfter: time.Second,
+		},
+		{
+			name:        "refilled",
+			requests:    5,
+			advance:     2 * time.Second,
+			wantAllowed: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			l := newRateLimiter(1, 3)
+			l.now = func() time.Time { return now }
+
+			allowed := 0
+			var retryAfter time.Duration
+			for i := 0; i < tt.requests; i++ {
+				ok, wait := l.allow("client")
+				if ok {
+					allowed++
+				} else {
+					retryAfter = wait
+				}
+				if i == 2 {
+					now = now.Add(tt.advance)
+				}
+			}
+
+			if allowed != tt.wantAllowed || retryAfter != tt.wantRetryAfter {
+				t.Errorf("allowed = %d, retry after = %v, want %d, %v", allowed, retryAfter, tt.wantAllowed, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllowConcurrently(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(1, 10)
+	l.now = func() time.Time { return now }
+
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if ok, _ := l.allow("client-" + strconv.Itoa(i%2)); ok {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Each of the two clients gets its burst, not more
+	if allowed != 20 {
+		t.Errorf("allowed %d concurrent requests, want 20", allowed)
+	}
+}
+
+func TestRateLimitKeysConcurrently(t *testing.T) {
+	keys := &rateLimitKeys{keys: map[string]bool{}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4*RATE_LIMIT_MAX_KEYS; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys.attribute("client-" + strconv.Itoa(i))
+		}(i)
+	}
+	wg.Wait()
+
+	if len(keys.keys) != RATE_LIMIT_MAX_KEYS {
+		t.Errorf("%d keys are recorded, want %d", len(keys.keys), RATE_LIMIT_MAX_KEYS)
+	}
+	if got := keys.attribute("client-new"); got != RATE_LIMIT_OTHER_KEY {
+		t.Errorf("attribute() = %q, want %q", got, RATE_LIMIT_OTHER_KEY)
+	}
+}
+
+func TestRateLimitMiddlewareExemptions(t *testing.T) {
+	previous := limiter
+	t.Cleanup(func() { limiter = previous })
+
+	tests := []struct {
+		name           string
+		req            *Request
+		wantStatusCode int
+	}{
+		{
+			name:           "limited request",
+			req:            &Request{Method: "POST", Path: "/create", SourceIP: "203.0.113.7"},
+			wantStatusCode: 429,
+		},
+		{
+			name:           "health check",
+			req:            &Request{Method: "GET", RouteKey: "GET /health", Path: "/health", SourceIP: "203.0.113.7"},
+			wantStatusCode: 200,
+		},
+		{
+			name:           "CORS preflight",
+			req:            &Request{Method: "OPTIONS", Path: "/create", SourceIP: "203.0.113.7"},
+			wantStatusCode: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// An exhausted client
+			limiter = newRateLimiter(1, 1)
+			limiter.allow(rateLimitClient(tt.req))
+
+			handler := rateLimitMiddleware(func(context.Context, *Request) *createResult {
+				return &createResult{StatusCode: 200}
+			})
+
+			if result := handler(context.Background(), tt.req); result.StatusCode != tt.wantStatusCode {
+				t.Errorf("status code = %d, want %d", result.StatusCode, tt.wantStatusCode)
+			}
+		})
+	}
+}
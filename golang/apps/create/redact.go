@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	DEFAULT_REDACT_KEYS = "authorization,proxy-authorization,cookie,set-cookie,x-api-key,x-amz-security-token,x-force-sample-secret"
+
+	REDACT_MODE_DROP = "drop"
+	REDACT_MODE_HASH = "hash"
+
+	REDACTED_VALUE = "[REDACTED]"
+)
+
+// parseRedactKeys parses the comma separated REDACT_KEYS. Keys are matched
+// case-insensitively and the credential carrying headers are redacted when
+// nothing is configured.
+func parseRedactKeys(
+	value string,
+) map[string]bool {
+	if strings.TrimSpace(value) == "" {
+		value = DEFAULT_REDACT_KEYS
+	}
+
+	keys := map[string]bool{}
+	for _, key := range strings.Split(value, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key != "" {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// redact returns the value which may be recorded for the key. Values of
+// redacted keys are dropped or, with REDACT_MODE=hash, replaced by a
+// truncated SHA-256 so that equal values can still be correlated.
+func redact(
+	key string,
+	value string,
+) (
+	string,
+	bool,
+) {
+	if !REDACT_KEYS[strings.ToLower(key)] {
+		return value, true
+	}
+
+	if REDACT_MODE != REDACT_MODE_HASH {
+		return "", false
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:8]), true
+}
+
+// headerAttributes records the request headers as
+// http.request.header.<key> attributes after redaction.
+func headerAttributes(
+	headers map[string]string,
+) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{}
+	for key, value := range headers {
+		value, ok := redact(key, value)
+		if !ok {
+			continue
+		}
+		attributes = append(attributes,
+			attribute.StringSlice("http.request.header."+strings.ToLower(key), []string{value}))
+	}
+	return attributes
+}
+
+// fieldRedactor replaces the values of JSON fields with [REDACTED]. Fields
+// are addressed by dot separated paths like "user.email". Arrays are
+// traversed transparently, so "items.email" matches the email of every
+// item.
+type fieldRedactor struct {
+	paths      [][]string
+	fieldNames map[string]bool
+}
+
+// newFieldRedactor parses the comma separated REDACT_FIELDS.
+func newFieldRedactor(
+	value string,
+) *fieldRedactor {
+	r := &fieldRedactor{
+		paths:      [][]string{},
+		fieldNames: map[string]bool{},
+	}
+	for _, path := range strings.Split(value, ",") {
+		path = strings.Trim(strings.TrimSpace(path), ".")
+		if path == "" {
+			continue
+		}
+		segments := strings.Split(path, ".")
+		r.paths = append(r.paths, segments)
+		r.fieldNames[segments[len(segments)-1]] = true
+	}
+	return r
+}
+
+func (r *fieldRedactor) enabled() bool {
+	return r != nil && len(r.paths) > 0
+}
+
+// isRedactedField reports whether the name is the last segment of any
+// configured path. The logger uses it for its flat key value pairs.
+func (r *fieldRedactor) isRedactedField(
+	name string,
+) bool {
+	return r.enabled() && r.fieldNames[name]
+}
+
+// redactJSON redacts the configured fields of a JSON document. Documents
+// which cannot be parsed are returned as they are.
+func (r *fieldRedactor) redactJSON(
+	data []byte,
+) (
+	[]byte,
+	error,
+) {
+	if !r.enabled() {
+		return data, nil
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return data, err
+	}
+
+	for _, path := range r.paths {
+		document = redactPath(document, path)
+	}
+	return json.Marshal(document)
+}
+
+func redactPath(
+	value interface{},
+	path []string,
+) interface{} {
+	if len(path) == 0 {
+		return REDACTED_VALUE
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if child, ok := v[path[0]]; ok {
+			v[path[0]] = redactPath(child, path[1:])
+		}
+	case []interface{}:
+		for i, element := range v {
+			v[i] = redactPath(element, path)
+		}
+	}
+	return value
+}
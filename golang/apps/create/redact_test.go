@@ -0,0 +1,210 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	previousKeys, previousMode := REDACT_KEYS, REDACT_MODE
+	t.Cleanup(func() { REDACT_KEYS, REDACT_MODE = previousKeys, previousMode })
+	REDACT_KEYS = parseRedactKeys("")
+
+	tests := []struct {
+		name   string
+		mode   string
+		key    string
+		value  string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "other header is kept",
+			mode:   REDACT_MODE_DROP,
+			key:    "Content-Type",
+			value:  "application/json",
+			want:   "application/json",
+			wantOK: true,
+		},
+		{
+			name:   "default header is dropped",
+			mode:   REDACT_MODE_DROP,
+			key:    "Authorization",
+			value:  "Bearer token",
+			wantOK: false,
+		},
+		{
+			name:   "unknown mode drops",
+			mode:   "",
+			key:    "x-api-key",
+			value:  "key",
+			wantOK: false,
+		},
+		{
+			name:   "default header is hashed",
+			mode:   REDACT_MODE_HASH,
+			key:    "X-Api-Key",
+			value:  "key",
+			want:   "sha256:2c70e12b7a0646f9",
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			REDACT_MODE = tt.mode
+
+			got, ok := redact(tt.key, tt.value)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("redact(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseRedactKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		redacted  []string
+		unchanged []string
+	}{
+		{
+			name:      "defaults",
+			value:     " ",
+			redacted:  []string{"authorization", "cookie", "x-api-key"},
+			unchanged: []string{"content-type"},
+		},
+		{
+			name:      "configured keys replace the defaults",
+			value:     " X-Tenant-Secret ,,",
+			redacted:  []string{"x-tenant-secret"},
+			unchanged: []string{"authorization"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := parseRedactKeys(tt.value)
+			for _, key := range tt.redacted {
+				if !keys[key] {
+					t.Errorf("%q is not redacted", key)
+				}
+			}
+			for _, key := range tt.unchanged {
+				if keys[key] {
+					t.Errorf("%q is redacted", key)
+				}
+			}
+		})
+	}
+}
+
+func TestHeaderAttributes(t *testing.T) {
+	previousKeys, previousMode := REDACT_KEYS, REDACT_MODE
+	t.Cleanup(func() { REDACT_KEYS, REDACT_MODE = previousKeys, previousMode })
+	REDACT_KEYS, REDACT_MODE = parseRedactKeys(""), REDACT_MODE_DROP
+
+	attributes := headerAttributes(map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": "Bearer token",
+	})
+	if len(attributes) != 1 {
+		t.Fatalf("headerAttributes() = %v, want the content type only", attributes)
+	}
+	if attributes[0].Key != "http.request.header.content-type" || attributes[0].Value.AsStringSlice()[0] != "application/json" {
+		t.Errorf("headerAttributes() = %v, want http.request.header.content-type", attributes)
+	}
+}
+
+func TestFieldRedactorRedactJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "disabled",
+			fields: "",
+			data:   `{"email":"jane@example.com"}`,
+			want:   `{"email":"jane@example.com"}`,
+		},
+		{
+			name:   "top level field",
+			fields: "email",
+			data:   `{"email":"jane@example.com","item":"x"}`,
+			want:   `{"email":"[REDACTED]","item":"x"}`,
+		},
+		{
+			name:   "nested field",
+			fields: " .user.email. ",
+			data:   `{"user":{"email":"jane@example.com","name":"Jane"}}`,
+			want:   `{"user":{"email":"[REDACTED]","name":"Jane"}}`,
+		},
+		{
+			name:   "field of every array element",
+			fields: "items.email",
+			data:   `{"items":[{"email":"a@example.com"},{"email":"b@example.com"},{"item":"x"}]}`,
+			want:   `{"items":[{"email":"[REDACTED]"},{"email":"[REDACTED]"},{"item":"x"}]}`,
+		},
+		{
+			name:   "top level array",
+			fields: "email",
+			data:   `[{"email":"a@example.com"}]`,
+			want:   `[{"email":"[REDACTED]"}]`,
+		},
+		{
+			name:   "object field is redacted as a whole",
+			fields: "user",
+			data:   `{"user":{"email":"jane@example.com"}}`,
+			want:   `{"user":"[REDACTED]"}`,
+		},
+		{
+			name:   "missing field",
+			fields: "user.email",
+			data:   `{"item":"x"}`,
+			want:   `{"item":"x"}`,
+		},
+		{
+			name:    "invalid JSON is returned as it is",
+			fields:  "email",
+			data:    `{"email":`,
+			want:    `{"email":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newFieldRedactor(tt.fields).redactJSON([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("redactJSON() error = %v, want error %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("redactJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldRedactorIsRedactedField(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		field  string
+		want   bool
+	}{
+		{name: "disabled", fields: "", field: "email", want: false},
+		{name: "last segment", fields: "user.email", field: "email", want: true},
+		{name: "parent segment", fields: "user.email", field: "user", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newFieldRedactor(tt.fields).isRedactedField(tt.field); got != tt.want {
+				t.Errorf("isRedactedField(%q) = %v, want %v", tt.field, got, tt.want)
+			}
+		})
+	}
+}
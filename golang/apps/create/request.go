@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	errInvalidBody  = errors.New("request body could not be decoded")
+	errBodyTooLarge = errors.New("decompressed request body is too large")
+
+	errUnsupportedContentType = errors.New("content type is not supported")
+)
+
+// getHeader looks up a header case-insensitively as the triggers differ in
+// how they pass the header names.
+func getHeader(
+	headers map[string]string,
+	name string,
+) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// requestBodySize returns the size of the request body in bytes. Base64
+// encoded bodies are measured by their decoded length without decoding
+// them, so that oversized bodies are not buffered twice.
+func requestBodySize(
+	body string,
+	isBase64Encoded bool,
+) int {
+	if !isBase64Encoded {
+		return len(body)
+	}
+
+	trimmed := strings.TrimRight(body, "=")
+	return base64.RawStdEncoding.DecodedLen(len(trimmed))
+}
+
+// decodeRequestBody returns the raw bytes of the request body. Base64
+// encoded bodies, which API Gateway sends for binary media types, are
+// decoded first and gzip encoded bodies are decompressed afterwards. The
+// decompressed body is capped at maxSize bytes.
+func decodeRequestBody(
+	req *Request,
+	maxSize int,
+) (
+	string,
+	error,
+) {
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return "", errors.Join(errInvalidBody, err)
+		}
+		body = decoded
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(getHeader(req.Headers, "Content-Encoding")), "gzip") {
+		return string(body), nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Join(errInvalidBody, err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(reader, int64(maxSize)+1))
+	if err != nil {
+		return "", errors.Join(errInvalidBody, err)
+	}
+	if len(decompressed) > maxSize {
+		return "", errBodyTooLarge
+	}
+	return string(decompressed), nil
+}
+
+// bodyParser turns a request body of a supported media type into JSON.
+type bodyParser func(body string) (string, error)
+
+// bodyParsers maps the supported media types onto their parsers. Adding a
+// format only takes a new entry.
+var bodyParsers = map[string]bodyParser{
+	"application/json":                  parseJSONBody,
+	"application/x-www-form-urlencoded": parseFormBody,
+	"application/yaml":                  parseYAMLBody,
+	"application/x-yaml":                parseYAMLBody,
+	"text/yaml":                         parseYAMLBody,
+}
+
+// negotiateRequestBody converts the request body into JSON according to its
+// content type, so that objects are always stored as canonical JSON.
+// Requests without a body are accepted regardless of their content type.
+func negotiateRequestBody(
+	headers map[string]string,
+	body string,
+) (
+	string,
+	error,
+) {
+	if strings.TrimSpace(body) == "" {
+		return body, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(getHeader(headers, "Content-Type"))
+	if err != nil {
+		return "", errUnsupportedContentType
+	}
+	parse, ok := bodyParsers[mediaType]
+	if !ok {
+		return "", errUnsupportedContentType
+	}
+	return parse(body)
+}
+
+func parseJSONBody(
+	body string,
+) (
+	string,
+	error,
+) {
+	return body, nil
+}
+
+// parseFormBody parses item=...&isUpdated=... into a custom object. The
+// boolean fields accept the values of strconv.ParseBool.
+func parseFormBody(
+	body string,
+) (
+	string,
+	error,
+) {
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		return "", err
+	}
+
+	customObject := &CustomObject{
+		Item: values.Get("item"),
+	}
+	if value := values.Get("isUpdated"); value != "" {
+		if customObject.IsUpdated, err = strconv.ParseBool(value); err != nil {
+			return "", err
+		}
+	}
+	if value := values.Get("isChecked"); value != "" {
+		if customObject.IsChecked, err = strconv.ParseBool(value); err != nil {
+			return "", err
+		}
+	}
+
+	customObjectAsBytes, err := json.Marshal(customObject)
+	if err != nil {
+		return "", err
+	}
+	return string(customObjectAsBytes), nil
+}
+
+// parseYAMLBody converts a YAML document into JSON. A sequence of objects
+// becomes a batch just like a JSON array.
+func parseYAMLBody(
+	body string,
+) (
+	string,
+	error,
+) {
+	var document interface{}
+	if err := yaml.Unmarshal([]byte(body), &document); err != nil {
+		return "", err
+	}
+
+	documentAsBytes, err := json.Marshal(document)
+	if err != nil {
+		return "", err
+	}
+	return string(documentAsBytes), nil
+}
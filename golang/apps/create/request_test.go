@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGetHeader(t *testing.T) {
+	headers := map[string]string{
+		"content-type":    "application/json",
+		"X-Tenant-Id":     "tenant",
+		"IDEMPOTENCY-KEY": "key",
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "lower case header", header: "Content-Type", want: "application/json"},
+		{name: "canonical header", header: "x-tenant-id", want: "tenant"},
+		{name: "upper case header", header: "Idempotency-Key", want: "key"},
+		{name: "missing header", header: "Origin", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getHeader(headers, tt.header); got != tt.want {
+				t.Errorf("getHeader(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestBodySize(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		isBase64Encoded bool
+		want            int
+	}{
+		{name: "empty", body: "", want: 0},
+		{name: "plain", body: `{"item":"x"}`, want: 12},
+		{name: "base64 without padding", body: base64.StdEncoding.EncodeToString([]byte("abc")), isBase64Encoded: true, want: 3},
+		{name: "base64 with one padding", body: base64.StdEncoding.EncodeToString([]byte("abcd")), isBase64Encoded: true, want: 4},
+		{name: "base64 with two paddings", body: base64.StdEncoding.EncodeToString([]byte("abcde")), isBase64Encoded: true, want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestBodySize(tt.body, tt.isBase64Encoded); got != tt.want {
+				t.Errorf("requestBodySize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessRequestBodySizeLimit(t *testing.T) {
+	previous := MAX_BODY_SIZE_BYTES
+	t.Cleanup(func() { MAX_BODY_SIZE_BYTES = previous })
+	MAX_BODY_SIZE_BYTES = 16
+
+	tests := []struct {
+		name            string
+		body            string
+		isBase64Encoded bool
+		wantStatusCode  int
+	}{
+		{
+			name:           "body above the limit",
+			body:           `{"item":"` + strings.Repeat("x", 16) + `"}`,
+			wantStatusCode: 413,
+		},
+		{
+			name:            "encoded body above the limit",
+			body:            base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 17))),
+			isBase64Encoded: true,
+			wantStatusCode:  413,
+		},
+		{
+			name:           "body within the limit",
+			body:           `{"item":`,
+			wantStatusCode: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := processRequest(context.Background(), &Request{
+				Method:          "POST",
+				Headers:         map[string]string{"Content-Type": "application/json"},
+				Body:            tt.body,
+				IsBase64Encoded: tt.isBase64Encoded,
+			})
+			if result.StatusCode != tt.wantStatusCode {
+				t.Errorf("status code = %d, want %d: %s", result.StatusCode, tt.wantStatusCode, result.Body)
+			}
+		})
+	}
+}
+
+func TestNegotiateRequestBodyRejectsUnsupportedContentTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     error
+	}{
+		{name: "JSON", contentType: "application/json", body: `{"item":"x"}`},
+		{name: "JSON with charset", contentType: "application/json; charset=utf-8", body: `{"item":"x"}`},
+		{name: "empty body without content type", body: ""},
+		{name: "missing content type", body: `{"item":"x"}`, wantErr: errUnsupportedContentType},
+		{name: "plain text", contentType: "text/plain", body: "x", wantErr: errUnsupportedContentType},
+		{name: "malformed content type", contentType: "application/", body: "x", wantErr: errUnsupportedContentType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := negotiateRequestBody(map[string]string{"Content-Type": tt.contentType}, tt.body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("negotiateRequestBody() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeRequestBody(t *testing.T) {
+	gzipped := func(body string) string {
+		buffer := &bytes.Buffer{}
+		writer := gzip.NewWriter(buffer)
+		writer.Write([]byte(body))
+		writer.Close()
+		return buffer.String()
+	}
+
+	tests := []struct {
+		name            string
+		body            string
+		isBase64Encoded bool
+		contentEncoding string
+		maxSize         int
+		want            string
+		wantErr         error
+	}{
+		{
+			name:    "plain body",
+			body:    `{"item":"x"}`,
+			maxSize: 64,
+			want:    `{"item":"x"}`,
+		},
+		{
+			name:            "base64 encoded body",
+			body:            base64.StdEncoding.EncodeToString([]byte(`{"item":"x"}`)),
+			isBase64Encoded: true,
+			maxSize:         64,
+			want:            `{"item":"x"}`,
+		},
+		{
+			name:            "invalid base64",
+			body:            "not base64!",
+			isBase64Encoded: true,
+			maxSize:         64,
+			wantErr:         errInvalidBody,
+		},
+		{
+			name:            "gzip encoded body",
+			body:            base64.StdEncoding.EncodeToString([]byte(gzipped(`{"item":"x"}`))),
+			isBase64Encoded: true,
+			contentEncoding: "GZIP",
+			maxSize:         64,
+			want:            `{"item":"x"}`,
+		},
+		{
+			name:            "invalid gzip",
+			body:            `{"item":"x"}`,
+			contentEncoding: "gzip",
+			maxSize:         64,
+			wantErr:         errInvalidBody,
+		},
+		{
+			name:            "decompressed body at the limit",
+			body:            gzipped(strings.Repeat("x", 64)),
+			contentEncoding: "gzip",
+			maxSize:         64,
+			want:            strings.Repeat("x", 64),
+		},
+		{
+			name:            "decompressed body over the limit",
+			body:            gzipped(strings.Repeat("x", 65)),
+			contentEncoding: "gzip",
+			maxSize:         64,
+			wantErr:         errBodyTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeRequestBody(&Request{
+				Headers:         map[string]string{"Content-Encoding": tt.contentEncoding},
+				Body:            tt.body,
+				IsBase64Encoded: tt.isBase64Encoded,
+			}, tt.maxSize)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("decodeRequestBody() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decodeRequestBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiateRequestBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "JSON is kept as it is",
+			contentType: "application/json",
+			body:        `{"item": "x"}`,
+			want:        `{"item": "x"}`,
+		},
+		{
+			name:        "form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "item=a+b&isUpdated=true&isChecked=0",
+			want:        `{"item":"a b","isUpdated":true,"isChecked":false}`,
+		},
+		{
+			name:        "form without booleans",
+			contentType: "application/x-www-form-urlencoded; charset=utf-8",
+			body:        "item=x",
+			want:        `{"item":"x","isUpdated":false,"isChecked":false}`,
+		},
+		{
+			name:        "form with invalid boolean",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "item=x&isUpdated=maybe",
+			wantErr:     true,
+		},
+		{
+			name:        "form with invalid escape",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "item=%zz",
+			wantErr:     true,
+		},
+		{
+			name:        "YAML object",
+			contentType: "application/yaml",
+			body:        "item: x\nisUpdated: true\n",
+			want:        `{"isUpdated":true,"item":"x"}`,
+		},
+		{
+			name:        "YAML sequence becomes a batch",
+			contentType: "text/yaml",
+			body:        "- item: a\n- item: b\n",
+			want:        `[{"item":"a"},{"item":"b"}]`,
+		},
+		{
+			name:        "legacy YAML media type",
+			contentType: "application/x-yaml",
+			body:        "item: x",
+			want:        `{"item":"x"}`,
+		},
+		{
+			name:        "invalid YAML",
+			contentType: "application/yaml",
+			body:        "item: [x",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := negotiateRequestBody(map[string]string{"Content-Type": tt.contentType}, tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("negotiateRequestBody() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("negotiateRequestBody() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
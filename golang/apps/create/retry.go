@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DEFAULT_S3_UPLOAD_MAX_ATTEMPTS   = 3
+	DEFAULT_S3_UPLOAD_BASE_DELAY_MS  = 100
+	S3_UPLOAD_MAX_DELAY              = 2 * time.Second
+	S3_UPLOAD_RETRY_DEADLINE_RESERVE = 500 * time.Millisecond
+)
+
+// isRetryable classifies upload errors which are worth another attempt:
+// throttling, server errors and timeouts. Client errors like a missing
+// bucket or a failed precondition fail the same way on every attempt.
+func isRetryable(
+	err error,
+) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		if reqErr.StatusCode() >= 500 || reqErr.StatusCode() == 429 {
+			return true
+		}
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case "SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable", request.ErrCodeRequestError:
+			return true
+		}
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// withoutSDKRetries keeps the SDK from resending the request. Otherwise
+// every attempt of uploadWithRetry would be retried by the SDK as well and
+// the attempts would multiply.
+func withoutSDKRetries(
+	r *request.Request,
+) {
+	r.Retryer = client.NoOpRetryer{}
+}
+
+// errorCode returns the AWS error code of the error if there is any.
+func errorCode(
+	err error,
+) string {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code()
+	}
+	return ""
+}
+
+// retryDelay backs off exponentially from the base delay and picks a
+// random delay between half and the full backoff, so that concurrent
+// invocations do not retry in lockstep.
+func retryDelay(
+	attempt int,
+) time.Duration {
+	backoff := S3_UPLOAD_BASE_DELAY << (attempt - 1)
+	if backoff <= 0 || backoff > S3_UPLOAD_MAX_DELAY {
+		backoff = S3_UPLOAD_MAX_DELAY
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// uploadWithRetry runs the upload until it succeeds, fails with an error
+// which is not retryable or runs out of attempts. A retry is only started
+// when its delay still leaves time for the attempt before the Lambda
+// deadline. Every failed attempt is recorded as an event on the span and
+// the number of attempts as an attribute. The number of attempts is
+// returned as well.
+func uploadWithRetry(
+	ctx context.Context,
+	span trace.Span,
+	upload func() (*s3manager.UploadOutput, error),
+) (
+	*s3manager.UploadOutput,
+	int,
+	error,
+) {
+	for attempt := 1; ; attempt++ {
+		output, err := upload()
+		if err == nil || !isRetryable(err) || attempt >= S3_UPLOAD_MAX_ATTEMPTS {
+			span.SetAttributes(attribute.Int("aws.s3.upload.attempts", attempt))
+			return output, attempt, err
+		}
+
+		delay := retryDelay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay+S3_UPLOAD_RETRY_DEADLINE_RESERVE {
+			span.AddEvent("S3UploadRetryBudgetExhausted", trace.WithAttributes(
+				attribute.Int("retry.attempt", attempt),
+				attribute.String("error.code", errorCode(err)),
+			))
+			span.SetAttributes(attribute.Int("aws.s3.upload.attempts", attempt))
+			return output, attempt, err
+		}
+
+		span.AddEvent("S3UploadRetry", trace.WithAttributes(
+			attribute.Int("retry.attempt", attempt),
+			attribute.Int64("retry.delay_ms", delay.Milliseconds()),
+			attribute.String("error.code", errorCode(err)),
+		))
+		logger.warn("Storing custom object into S3 is retried.", "attempt", attempt, "delay", delay.String(), "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			span.SetAttributes(attribute.Int("aws.s3.upload.attempts", attempt))
+			return output, attempt, err
+		case <-timer.C:
+		}
+	}
+}
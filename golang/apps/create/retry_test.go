@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func withUploadRetries(
+	t *testing.T,
+	maxAttempts int,
+) {
+	previousAttempts, previousDelay := S3_UPLOAD_MAX_ATTEMPTS, S3_UPLOAD_BASE_DELAY
+	t.Cleanup(func() { S3_UPLOAD_MAX_ATTEMPTS, S3_UPLOAD_BASE_DELAY = previousAttempts, previousDelay })
+	S3_UPLOAD_MAX_ATTEMPTS = maxAttempts
+	S3_UPLOAD_BASE_DELAY = time.Millisecond
+}
+
+func TestUploadWithRetry(t *testing.T) {
+	errThrottled := awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), 503, "")
+	errNoSuchBucket := awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil), 404, "")
+
+	tests := []struct {
+		name         string
+		errors       []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:         "succeeds at once",
+			wantAttempts: 1,
+		},
+		{
+			name:         "retries throttling until it succeeds",
+			errors:       []error{errThrottled, errThrottled},
+			wantAttempts: 3,
+		},
+		{
+			name:         "gives up after the last attempt",
+			errors:       []error{errThrottled, errThrottled, errThrottled, errThrottled},
+			wantAttempts: 3,
+			wantErr:      errThrottled,
+		},
+		{
+			name:         "does not retry client errors",
+			errors:       []error{errNoSuchBucket},
+			wantAttempts: 1,
+			wantErr:      errNoSuchBucket,
+		},
+		{
+			name:         "does not retry canceled uploads",
+			errors:       []error{context.Canceled},
+			wantAttempts: 1,
+			wantErr:      context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withUploadRetries(t, 3)
+
+			uploader := &fakeUploader{errors: tt.errors}
+			span := trace.SpanFromContext(context.Background())
+
+			_, attempts, err := uploadWithRetry(context.Background(), span, func() (*s3manager.UploadOutput, error) {
+				return uploader.UploadWithContext(context.Background(), &s3manager.UploadInput{})
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("uploadWithRetry() error = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts || int(uploader.calls) != tt.wantAttempts {
+				t.Errorf("attempts = %d, uploader calls = %d, want %d", attempts, uploader.calls, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestUploadWithRetryKeepsDeadlineReserve(t *testing.T) {
+	withUploadRetries(t, 3)
+
+	errThrottled := awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), 503, "")
+	uploader := &fakeUploader{errors: []error{errThrottled, errThrottled}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), S3_UPLOAD_RETRY_DEADLINE_RESERVE)
+	defer cancel()
+
+	_, attempts, err := uploadWithRetry(ctx, trace.SpanFromContext(ctx), func() (*s3manager.UploadOutput, error) {
+		return uploader.UploadWithContext(ctx, &s3manager.UploadInput{})
+	})
+
+	if err == nil || attempts != 1 {
+		t.Errorf("uploadWithRetry() = (%d, %v), want a single failed attempt", attempts, err)
+	}
+}
+
+func TestS3UploaderDoesNotResend(t *testing.T) {
+	withoutFaults(t)
+	withUploadRetries(t, 2)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newTestS3Client(server.URL, nil)
+
+	storage := newS3Storage(newS3Uploader(client), client, s3manager.MinUploadPartSize)
+	_, err := storage.Put(context.Background(), "2026/01/01/id", []byte(`{"item":"x"}`), commons.PutMetadata{Bucket: "bucket"})
+	if err == nil {
+		t.Fatal("Put() succeeded against a failing endpoint")
+	}
+
+	// One request per attempt of uploadWithRetry, none by the SDK
+	if requests != 2 {
+		t.Errorf("endpoint received %d requests, want 2", requests)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DEFAULT_ALLOWED_METHODS = "POST"
+)
+
+type ServiceDescriptor struct {
+	Service string `json:"service"`
+	Version string `json:"version,omitempty"`
+	Bucket  string `json:"bucket"`
+}
+
+// routeRequest dispatches the request by its method. POST and PUT with an
+// id create objects, GET /health reports the health, any other GET
+// describes the service without touching S3 and every other method is
+// rejected. Only POST is allowed by default, deployments opt into the
+// other methods with ALLOWED_METHODS. Health checks stay open.
+func routeRequest(
+	ctx context.Context,
+	req *Request,
+) *createResult {
+
+	parentSpan := trace.SpanFromContext(ctx)
+
+	// Name the parent span after the routed method
+	if req.RouteKey != "" {
+		parentSpan.SetName(req.RouteKey)
+	}
+	parentSpan.SetAttributes(attribute.String("http.request.method", req.Method))
+
+	// Health checks must not depend on the allowlist
+	if req.Method == "GET" && isHealthRequest(req) {
+		return checkHealth(ctx, req)
+	}
+
+	// Reject methods outside of the allowlist
+	if !ALLOWED_METHODS[req.Method] {
+		return rejectMethod(parentSpan, req)
+	}
+
+	switch {
+	case req.Method == "GET":
+		return describeService(parentSpan, req)
+	case req.Method == "POST":
+		return processRequest(ctx, req)
+	case req.Method == "PUT" && req.PathParameters["id"] != "":
+		return processRequest(ctx, req)
+	default:
+		return rejectMethod(parentSpan, req)
+	}
+}
+
+// parseAllowedMethods parses the comma separated ALLOWED_METHODS. Without
+// any method the default methods are allowed.
+func parseAllowedMethods(
+	value string,
+) map[string]bool {
+	methods := map[string]bool{}
+	for _, method := range strings.Split(value, ",") {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method != "" {
+			methods[method] = true
+		}
+	}
+	if len(methods) == 0 {
+		return parseAllowedMethods(DEFAULT_ALLOWED_METHODS)
+	}
+	return methods
+}
+
+// allowHeader lists the allowed methods in a stable order.
+func allowHeader() string {
+	methods := make([]string, 0, len(ALLOWED_METHODS))
+	for method := range ALLOWED_METHODS {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ",")
+}
+
+func rejectMethod(
+	parentSpan trace.Span,
+	req *Request,
+) *createResult {
+	logger.warn("Method is not allowed.", "method", req.Method)
+	parentSpan.SetAttributes(attribute.String("error.type", "method_not_allowed"))
+
+	result := failRequest(parentSpan, 405, "Method "+req.Method+" is not allowed.")
+	if result.Headers == nil {
+		result.Headers = map[string]string{}
+	}
+	result.Headers["Allow"] = allowHeader()
+	return result
+}
+
+func describeService(
+	parentSpan trace.Span,
+	req *Request,
+) *createResult {
+
+	// Resolve tenant bucket
+	_, bucket, err := resolveBucket(req.Headers)
+	if err != nil {
+		return failRequest(parentSpan, 400, "Tenant is unknown.")
+	}
+
+	descriptorAsBytes, err := json.Marshal(&ServiceDescriptor{
+		Service: OTEL_SERVICE_NAME,
+		Version: SERVICE_VERSION,
+		Bucket:  bucket,
+	})
+	if err != nil {
+		return failRequest(parentSpan, 500, "Creating the response is failed.")
+	}
+
+	parentSpan.SetAttributes(semconv.HTTPStatusCode(200))
+
+	return &createResult{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: string(descriptorAsBytes),
+	}
+}
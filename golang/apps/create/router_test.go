@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// withHealthyConfig sets the configuration which the health check and the
+// service descriptor expect.
+func withHealthyConfig(
+	t *testing.T,
+) {
+	serviceName, bucket, sdkDisabled := OTEL_SERVICE_NAME, INPUT_S3_BUCKET_NAME, OTEL_SDK_DISABLED
+	t.Cleanup(func() {
+		OTEL_SERVICE_NAME, INPUT_S3_BUCKET_NAME, OTEL_SDK_DISABLED = serviceName, bucket, sdkDisabled
+	})
+	OTEL_SERVICE_NAME = "create"
+	INPUT_S3_BUCKET_NAME = "bucket"
+	OTEL_SDK_DISABLED = true
+}
+
+func TestParseAllowedMethods(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{
+			name:  "default",
+			value: "",
+			want:  "POST",
+		},
+		{
+			name:  "blank entries only",
+			value: " , ,",
+			want:  "POST",
+		},
+		{
+			name:  "opted in methods",
+			value: "post, put ,GET",
+			want:  "GET,POST,PUT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := ALLOWED_METHODS
+			t.Cleanup(func() { ALLOWED_METHODS = previous })
+
+			ALLOWED_METHODS = parseAllowedMethods(tt.value)
+			if got := allowHeader(); got != tt.want {
+				t.Errorf("allowed methods = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteRequestAllowlist(t *testing.T) {
+	withHealthyConfig(t)
+
+	tests := []struct {
+		name           string
+		allowedMethods string
+		req            *Request
+		wantStatusCode int
+		wantAllow      string
+	}{
+		{
+			name:           "GET is rejected by default",
+			req:            &Request{Method: "GET", Path: "/"},
+			wantStatusCode: 405,
+			wantAllow:      "POST",
+		},
+		{
+			name:           "PUT is rejected by default",
+			req:            &Request{Method: "PUT", Path: "/items/id", PathParameters: map[string]string{"id": "id"}},
+			wantStatusCode: 405,
+			wantAllow:      "POST",
+		},
+		{
+			name:           "DELETE is rejected by default",
+			req:            &Request{Method: "DELETE", Path: "/items/id"},
+			wantStatusCode: 405,
+			wantAllow:      "POST",
+		},
+		{
+			name:           "health check stays open by default",
+			req:            &Request{Method: "GET", RouteKey: "GET /health", Path: "/health"},
+			wantStatusCode: 200,
+		},
+		{
+			name:           "GET is allowed once opted in",
+			allowedMethods: "GET,POST",
+			req:            &Request{Method: "GET", Path: "/"},
+			wantStatusCode: 200,
+		},
+		{
+			name:           "PUT without id is rejected even when opted in",
+			allowedMethods: "POST,PUT",
+			req:            &Request{Method: "PUT", Path: "/items"},
+			wantStatusCode: 405,
+			wantAllow:      "POST,PUT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := ALLOWED_METHODS
+			t.Cleanup(func() { ALLOWED_METHODS = previous })
+			ALLOWED_METHODS = parseAllowedMethods(tt.allowedMethods)
+
+			result := routeRequest(context.Background(), tt.req)
+
+			if result.StatusCode != tt.wantStatusCode {
+				t.Fatalf("status code = %d, want %d: %s", result.StatusCode, tt.wantStatusCode, result.Body)
+			}
+			if got := result.Headers["Allow"]; got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	STORAGE_BACKEND_S3 = "s3"
+)
+
+// s3Uploader is the part of the s3manager.Uploader which the S3 storage
+// depends on, so that the upload can be replaced without talking to AWS.
+type s3Uploader interface {
+	UploadWithContext(
+		ctx aws.Context,
+		input *s3manager.UploadInput,
+		opts ...func(*s3manager.Uploader),
+	) (
+		*s3manager.UploadOutput,
+		error,
+	)
+}
+
+// s3Storage uploads the objects into S3 buckets. Bodies larger than the
+// part size are uploaded in multiple parts.
+type s3Storage struct {
+	uploader s3Uploader
+	aborter  s3MultipartAborter
+	partSize int64
+}
+
+func newS3Storage(
+	uploader s3Uploader,
+	aborter s3MultipartAborter,
+	partSize int64,
+) *s3Storage {
+	return &s3Storage{
+		uploader: uploader,
+		aborter:  aborter,
+		partSize: partSize,
+	}
+}
+
+func (s *s3Storage) Put(
+	ctx context.Context,
+	key string,
+	body []byte,
+	metadata commons.PutMetadata,
+) (
+	commons.PutResult,
+	error,
+) {
+	parentSpan := trace.SpanFromContext(ctx)
+
+	// Start S3 put span
+	ctx, s3PutSpan := startS3PutSpan(ctx, parentSpan, metadata.Bucket, key)
+	defer s3PutSpan.End()
+
+	// Aborting a failed upload must not be cut off by the upload deadline
+	abortCtx := ctx
+
+	// Leave time to answer and to flush telemetry before Lambda times out
+	ctx, cancel := withS3Deadline(ctx, s3PutSpan)
+	defer cancel()
+
+	// Compress large bodies, S3 stores the compressed bytes
+	body, contentEncoding, objectMetadata := compressBody(s3PutSpan, body)
+	recordStoredBytes(ctx, s3PutSpan, len(body))
+
+	// Let S3 verify the integrity of the body, the checksum covers the
+	// stored bytes so that it matches the one S3 keeps for the object. The
+	// uploader drops the checksum of multipart uploads and S3 keeps a
+	// checksum of the part checksums for them instead, so neither is
+	// reported for bodies which are split into parts.
+	var checksum string
+	if !isMultipartUpload(len(body), s.partSize) {
+		checksum = checksumSHA256(body)
+		s3PutSpan.SetAttributes(attribute.String("aws.s3.checksum.sha256", checksum))
+	}
+
+	if len(metadata.Tags) > 0 {
+		s3PutSpan.SetAttributes(attribute.Int("aws.s3.tags.count", len(metadata.Tags)))
+	}
+	recordSSEAttributes(s3PutSpan)
+	recordACLAttribute(s3PutSpan)
+
+	// Trace the connection setup
+	if TRACE_HTTP_INTERNALS {
+		ctx = withHTTPTrace(ctx, s3PutSpan)
+	}
+
+	// Count the resends which the SDK hides within the span
+	sdkRetries := newSDKRetryRecorder(s3PutSpan)
+	defer sdkRetries.record()
+
+	// S3 has to enforce create-only writes as the object might be
+	// created between a check and the write
+	opts := []request.Option{
+		sdkRetries.requestOption(),
+	}
+	if metadata.CreateOnly {
+		opts = append(opts, func(r *request.Request) {
+			r.HTTPRequest.Header.Set("If-None-Match", "*")
+		})
+	}
+
+	// Cause error?
+	bucketName := strings.Clone(metadata.Bucket)
+	faultInjected := causeError()
+	if faultInjected {
+		bucketName = wrongBucketName(metadata.Bucket)
+	}
+	s3PutSpan.SetAttributes(attribute.Bool("fault.injected", faultInjected))
+
+	// Directory buckets authorize the requests with a session of their
+	// own, dry runs do not talk to S3 at all
+	if isDirectoryBucket(bucketName) && !isDryRun(ctx) {
+		sessionOpts, err := expressSessions.requestOptions(ctx, s3PutSpan, bucketName)
+		if err != nil {
+			s3PutSpan.SetAttributes([]attribute.KeyValue{
+				semconv.OtelStatusCodeError,
+				semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+			}...)
+			return commons.PutResult{}, newStoreError(err)
+		}
+		opts = append(opts, sessionOpts...)
+	}
+
+	// Upload object to S3, dry runs only simulate the upload
+	output, attempts, err := uploadWithRetry(ctx, s3PutSpan, func() (*s3manager.UploadOutput, error) {
+		if isDryRun(ctx) {
+			return simulateUpload(ctx, faultInjected)
+		}
+		output, err := s.uploader.UploadWithContext(
+			ctx,
+			&s3manager.UploadInput{
+				Bucket:               aws.String(bucketName),
+				Key:                  aws.String(key),
+				Body:                 bytes.NewReader(body),
+				ContentEncoding:      contentEncoding,
+				Metadata:             objectMetadata,
+				Tagging:              objectTagging(metadata.Tags),
+				ACL:                  objectACL(),
+				ServerSideEncryption: sseAlgorithm(),
+				SSEKMSKeyId:          sseKMSKeyID(),
+				ChecksumSHA256:       objectChecksum(checksum),
+			},
+			s3manager.WithUploaderRequestOptions(opts...))
+		if err != nil {
+			s.abortFailedMultipartUpload(abortCtx, s3PutSpan, bucketName, key, err)
+		}
+		return output, err
+	})
+	recordUploadParts(s3PutSpan, len(body), s.partSize)
+
+	if isPreconditionFailed(err) {
+		s3PutSpan.SetAttributes(attribute.String("error.type", "precondition_failed"))
+		return commons.PutResult{}, errPreconditionFailed
+	}
+
+	// The SDK reports a write whose context has ended as canceled
+	if err != nil && ctx.Err() != nil {
+		return commons.PutResult{}, recordCanceledWrite(ctx, s3PutSpan, err)
+	}
+
+	if err != nil {
+
+		s3PutSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		s3PutSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+
+		// Tell key misconfigurations and altered bodies apart from other
+		// S3 failures
+		if errorType := kmsErrorType(err); errorType != "" {
+			s3PutSpan.SetAttributes(attribute.String("error.type", errorType))
+		}
+		if isChecksumMismatch(err) {
+			s3PutSpan.SetAttributes(attribute.String("error.type", "checksum_mismatch"))
+			parentSpan.SetAttributes(attribute.String("error.type", "checksum_mismatch"))
+		}
+
+		storeErr := newStoreError(err)
+		storeErr.Attempts = attempts
+		if storeErr.Kind == STORE_ERROR_KIND_THROTTLED {
+			s3PutSpan.SetAttributes(attribute.String("error.type", "throttled"))
+		}
+		return commons.PutResult{}, storeErr
+	}
+
+	// Version id is only returned for versioned buckets
+	versionID := aws.StringValue(output.VersionID)
+	if versionID != "" {
+		s3PutSpan.SetAttributes(attribute.String("aws.s3.version_id", versionID))
+	}
+	return commons.PutResult{
+		VersionID: versionID,
+		Checksum:  checksum,
+	}, nil
+}
+
+func startS3PutSpan(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+) (
+	context.Context,
+	trace.Span,
+) {
+	// Start S3 put span
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "S3.PutObject",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(s3RPCAttributes("PutObject")...),
+			trace.WithAttributes(s3BucketAttributes(bucket)...),
+			trace.WithAttributes([]attribute.KeyValue{
+				semconv.NetTransportTCP,
+				attribute.String("aws.s3.key", key),
+				attribute.String("server.address", s3ServerAddress(bucket)),
+			}...),
+			trace.WithAttributes(assumedRoleAttributes()...),
+			trace.WithAttributes(putQueueTimeAttributes(ctx)...))
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestS3StoragePut(t *testing.T) {
+	withoutFaults(t)
+	withUploadRetries(t, 1)
+
+	errPrecondition := awserr.NewRequestFailure(awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil), 412, "")
+	errAccessDenied := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "")
+
+	tests := []struct {
+		name          string
+		uploadErr     error
+		wantVersionID string
+		wantErr       error
+		wantKind      StoreErrorKind
+		wantErrorType string
+		wantSpanError bool
+	}{
+		{
+			name:          "stored",
+			wantVersionID: "v1",
+		},
+		{
+			name:          "object exists",
+			uploadErr:     errPrecondition,
+			wantErr:       errPreconditionFailed,
+			wantErrorType: "precondition_failed",
+		},
+		{
+			name:          "access denied",
+			uploadErr:     errAccessDenied,
+			wantKind:      STORE_ERROR_KIND_ACCESS_DENIED,
+			wantSpanError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, recorder := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+
+			uploader := &fakeUploader{errors: []error{tt.uploadErr}}
+			storage := newS3Storage(uploader, nil, s3manager.DefaultUploadPartSize)
+			result, err := storage.Put(ctx, "2026/01/01/id", []byte(`{"item":"x"}`), commons.PutMetadata{
+				Bucket:     "bucket",
+				CreateOnly: true,
+			})
+			span.End()
+
+			if got := aws.StringValue(uploader.input.Bucket); got != "bucket" {
+				t.Errorf("uploaded bucket = %q, want %q", got, "bucket")
+			}
+			if got := aws.StringValue(uploader.input.Key); got != "2026/01/01/id" {
+				t.Errorf("uploaded key = %q, want %q", got, "2026/01/01/id")
+			}
+			if got := string(uploader.body); got != `{"item":"x"}` {
+				t.Errorf("uploaded body = %s, want %s", got, `{"item":"x"}`)
+			}
+
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Put() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantKind != "" {
+				var storeErr *StoreError
+				if !errors.As(err, &storeErr) || storeErr.Kind != tt.wantKind {
+					t.Errorf("Put() error = %v, want store error of kind %q", err, tt.wantKind)
+				}
+			}
+			if tt.wantErr == nil && tt.wantKind == "" {
+				if err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+				if result.VersionID != tt.wantVersionID {
+					t.Errorf("Put() version id = %q, want %q", result.VersionID, tt.wantVersionID)
+				}
+				if result.Checksum == "" {
+					t.Error("Put() checksum is empty")
+				}
+			}
+
+			for _, s := range recorder.Ended() {
+				if s.Name() != "S3.PutObject" {
+					continue
+				}
+				if got := spanAttribute(s, "error.type").AsString(); got != tt.wantErrorType {
+					t.Errorf("S3.PutObject error.type = %q, want %q", got, tt.wantErrorType)
+				}
+				if got := spanAttribute(s, "otel.status_code").AsString() == "ERROR"; got != tt.wantSpanError {
+					t.Errorf("S3.PutObject marked as failed = %v, want %v", got, tt.wantSpanError)
+				}
+				var exceptions int
+				for _, event := range s.Events() {
+					if event.Name == "exception" {
+						exceptions++
+					}
+				}
+				if got := exceptions == 1; got != tt.wantSpanError {
+					t.Errorf("S3.PutObject recorded %d errors, want recorded %v", exceptions, tt.wantSpanError)
+				}
+			}
+		})
+	}
+}
+
+func TestS3StoragePutFaultInjection(t *testing.T) {
+	withUploadRetries(t, 1)
+
+	tests := []struct {
+		name       string
+		withFaults func(t *testing.T)
+		wantBucket string
+		wantFault  bool
+	}{
+		{
+			name:       "fault injected",
+			withFaults: withFaults,
+			wantBucket: WRONG_BUCKET_NAME,
+			wantFault:  true,
+		},
+		{
+			name:       "no fault",
+			withFaults: withoutFaults,
+			wantBucket: "bucket",
+			wantFault:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.withFaults(t)
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+
+			uploader := &fakeUploader{}
+			storage := newS3Storage(uploader, nil, s3manager.DefaultUploadPartSize)
+			if _, err := storage.Put(ctx, "2026/01/01/id", []byte(`{"item":"x"}`), commons.PutMetadata{Bucket: "bucket"}); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			span.End()
+
+			if got := aws.StringValue(uploader.input.Bucket); got != tt.wantBucket {
+				t.Errorf("uploaded bucket = %q, want %q", got, tt.wantBucket)
+			}
+			for _, s := range recorder.Ended() {
+				if s.Name() != "S3.PutObject" {
+					continue
+				}
+				value := spanAttribute(s, "fault.injected")
+				if value.Type() != attribute.BOOL || value.AsBool() != tt.wantFault {
+					t.Errorf("fault.injected = %v, want %v", value.Emit(), tt.wantFault)
+				}
+			}
+		})
+	}
+}
+
+func TestS3SpanRPCAttributes(t *testing.T) {
+	tests := []struct {
+		name       string
+		start      func(ctx context.Context, span trace.Span)
+		wantSpan   string
+		wantMethod string
+	}{
+		{
+			name: "put",
+			start: func(ctx context.Context, span trace.Span) {
+				_, putSpan := startS3PutSpan(ctx, span, "bucket", "2026/01/01/id")
+				putSpan.End()
+			},
+			wantSpan:   "S3.PutObject",
+			wantMethod: "PutObject",
+		},
+		{
+			name: "abort",
+			start: func(ctx context.Context, span trace.Span) {
+				storage := newS3Storage(&fakeUploader{}, &fakeAborter{}, s3manager.MinUploadPartSize)
+				storage.abortFailedMultipartUpload(ctx, span, "bucket", "2026/01/01/id",
+					multiUploadFailure{err: awserr.New("InternalError", "We encountered an internal error", nil), uploadID: "upload-1"})
+			},
+			wantSpan:   "S3.AbortMultipartUpload",
+			wantMethod: "AbortMultipartUpload",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := S3_UPLOAD_LEAVE_PARTS
+			t.Cleanup(func() { S3_UPLOAD_LEAVE_PARTS = previous })
+			S3_UPLOAD_LEAVE_PARTS = false
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+			tt.start(ctx, span)
+			span.End()
+
+			ended := recorder.Ended()[0]
+			if ended.Name() != tt.wantSpan {
+				t.Fatalf("span = %q, want %q", ended.Name(), tt.wantSpan)
+			}
+			if got := spanAttribute(ended, "rpc.system").AsString(); got != "aws-api" {
+				t.Errorf("rpc.system = %q, want %q", got, "aws-api")
+			}
+			if got := spanAttribute(ended, "rpc.service").AsString(); got != "S3" {
+				t.Errorf("rpc.service = %q, want %q", got, "S3")
+			}
+			if got := spanAttribute(ended, "rpc.method").AsString(); got != tt.wantMethod {
+				t.Errorf("rpc.method = %q, want %q", got, tt.wantMethod)
+			}
+		})
+	}
+}
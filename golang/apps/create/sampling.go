@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/subtle"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	FORCE_SAMPLE_HEADER        = "X-Force-Sample"
+	FORCE_SAMPLE_SECRET_HEADER = "X-Force-Sample-Secret"
+	SAMPLING_FORCED_ATTRIBUTE  = attribute.Key("sampling.forced")
+)
+
+// isForceSampleRequest reports whether the request asks for its trace to
+// be sampled. Only callers which know the shared secret may force it,
+// otherwise anyone could bypass the sampling ratio.
+func isForceSampleRequest(
+	req *Request,
+) bool {
+	if FORCE_SAMPLE_SECRET == "" || !strings.EqualFold(getHeader(req.Headers, FORCE_SAMPLE_HEADER), "true") {
+		return false
+	}
+
+	secret := getHeader(req.Headers, FORCE_SAMPLE_SECRET_HEADER)
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(FORCE_SAMPLE_SECRET)) == 1
+}
+
+// forceSampler samples every span which is started with the
+// sampling.forced attribute and leaves all other decisions to the
+// configured sampler. Children of a forced span follow their sampled
+// parent.
+type forceSampler struct {
+	base sdktrace.Sampler
+}
+
+func (s forceSampler) ShouldSample(
+	parameters sdktrace.SamplingParameters,
+) sdktrace.SamplingResult {
+	for _, attr := range parameters.Attributes {
+		if attr.Key == SAMPLING_FORCED_ATTRIBUTE && attr.Value.AsBool() {
+			return sdktrace.AlwaysSample().ShouldSample(parameters)
+		}
+	}
+	return s.base.ShouldSample(parameters)
+}
+
+func (s forceSampler) Description() string {
+	return "ForceSampler{" + s.base.Description() + "}"
+}
+
+// newSampler wraps the sampler configured by OTEL_TRACES_SAMPLER and
+// OTEL_TRACES_SAMPLER_ARG, which the SDK would only apply when no sampler
+// is given explicitly.
+func newSampler() sdktrace.Sampler {
+	ratio, err := strconv.ParseFloat(os.Getenv("OTEL_TRACES_SAMPLER_ARG"), 64)
+	if err != nil {
+		ratio = 1
+	}
+
+	var base sdktrace.Sampler
+	switch strings.ToLower(os.Getenv("OTEL_TRACES_SAMPLER")) {
+	case "always_off":
+		base = sdktrace.NeverSample()
+	case "traceidratio":
+		base = sdktrace.TraceIDRatioBased(ratio)
+	case "parentbased_always_off":
+		base = sdktrace.ParentBased(sdktrace.NeverSample())
+	case "parentbased_traceidratio":
+		base = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	case "always_on":
+		base = sdktrace.AlwaysSample()
+	default:
+		base = sdktrace.ParentBased(sdktrace.AlwaysSample())
+	}
+	return forceSampler{base: base}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestIsForceSampleRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		headers map[string]string
+		want    bool
+	}{
+		{
+			name:   "matching secret",
+			secret: "s3cret",
+			headers: map[string]string{
+				"x-force-sample":        "TRUE",
+				"x-force-sample-secret": "s3cret",
+			},
+			want: true,
+		},
+		{
+			name:   "wrong secret",
+			secret: "s3cret",
+			headers: map[string]string{
+				"x-force-sample":        "true",
+				"x-force-sample-secret": "guess",
+			},
+			want: false,
+		},
+		{
+			name:   "not asked for",
+			secret: "s3cret",
+			headers: map[string]string{
+				"x-force-sample":        "false",
+				"x-force-sample-secret": "s3cret",
+			},
+			want: false,
+		},
+		{
+			name:   "no secret configured",
+			secret: "",
+			headers: map[string]string{
+				"x-force-sample":        "true",
+				"x-force-sample-secret": "",
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := FORCE_SAMPLE_SECRET
+			t.Cleanup(func() { FORCE_SAMPLE_SECRET = previous })
+			FORCE_SAMPLE_SECRET = tt.secret
+
+			if got := isForceSampleRequest(&Request{Headers: tt.headers}); got != tt.want {
+				t.Errorf("isForceSampleRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForceSampler(t *testing.T) {
+	tests := []struct {
+		name       string
+		base       sdktrace.Sampler
+		attributes []attribute.KeyValue
+		want       sdktrace.SamplingDecision
+	}{
+		{
+			name:       "forced",
+			base:       sdktrace.NeverSample(),
+			attributes: []attribute.KeyValue{SAMPLING_FORCED_ATTRIBUTE.Bool(true)},
+			want:       sdktrace.RecordAndSample,
+		},
+		{
+			name:       "not forced",
+			base:       sdktrace.NeverSample(),
+			attributes: []attribute.KeyValue{SAMPLING_FORCED_ATTRIBUTE.Bool(false)},
+			want:       sdktrace.Drop,
+		},
+		{
+			name: "base decides",
+			base: sdktrace.AlwaysSample(),
+			want: sdktrace.RecordAndSample,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := forceSampler{base: tt.base}.ShouldSample(sdktrace.SamplingParameters{
+				TraceID:    trace.TraceID{1},
+				Name:       "main.handler",
+				Attributes: tt.attributes,
+			})
+
+			if result.Decision != tt.want {
+				t.Errorf("ShouldSample() decision = %v, want %v", result.Decision, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		name    string
+		sampler string
+		arg     string
+		want    string
+	}{
+		{
+			name: "default",
+			want: "ForceSampler{" + sdktrace.ParentBased(sdktrace.AlwaysSample()).Description() + "}",
+		},
+		{
+			name:    "always off",
+			sampler: "always_off",
+			want:    "ForceSampler{AlwaysOffSampler}",
+		},
+		{
+			name:    "ratio",
+			sampler: "traceidratio",
+			arg:     "0.25",
+			want:    "ForceSampler{TraceIDRatioBased{0.25}}",
+		},
+		{
+			name:    "invalid ratio samples everything",
+			sampler: "TraceIdRatio",
+			arg:     "a quarter",
+			want:    "ForceSampler{AlwaysOnSampler}",
+		},
+		{
+			name:    "parent based ratio",
+			sampler: "parentbased_traceidratio",
+			arg:     "0.5",
+			want:    "ForceSampler{" + sdktrace.ParentBased(sdktrace.TraceIDRatioBased(0.5)).Description() + "}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_SAMPLER", tt.sampler)
+			t.Setenv("OTEL_TRACES_SAMPLER_ARG", tt.arg)
+
+			if got := newSampler().Description(); got != tt.want {
+				t.Errorf("newSampler() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
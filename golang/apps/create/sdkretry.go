@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SDK_RETRY_EVENT_NAME = "SDKRetry"
+)
+
+// sdkRetryRecorder counts the resends which the SDK makes on its own for
+// the requests of one S3 span. A multipart upload sends several requests,
+// their resends add up.
+type sdkRetryRecorder struct {
+	span    trace.Span
+	resends atomic.Int64
+}
+
+func newSDKRetryRecorder(
+	span trace.Span,
+) *sdkRetryRecorder {
+	return &sdkRetryRecorder{
+		span: span,
+	}
+}
+
+// requestOption hooks into the retry handlers of every request. The SDK
+// clears the error of a request which it is going to resend, so the error
+// is kept before the retry decision and reported once it is made.
+func (r *sdkRetryRecorder) requestOption() request.Option {
+	return func(req *request.Request) {
+		var lastErr error
+		req.Handlers.AfterRetry.PushFront(func(req *request.Request) {
+			lastErr = req.Error
+		})
+		req.Handlers.AfterRetry.PushBack(func(req *request.Request) {
+			if lastErr == nil || req.Error != nil {
+				return
+			}
+			r.resends.Add(1)
+			r.span.AddEvent(SDK_RETRY_EVENT_NAME, trace.WithAttributes(
+				sdkRetryAttributes(req.RetryCount, lastErr)...,
+			))
+		})
+	}
+}
+
+// record sets the number of resends on the span, zero included, so that
+// requests without any resend can be told apart from uninstrumented ones.
+func (r *sdkRetryRecorder) record() {
+	r.span.SetAttributes(attribute.Int64("aws.request.resend_count", r.resends.Load()))
+}
+
+func sdkRetryAttributes(
+	resendCount int,
+	err error,
+) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		attribute.Int("aws.request.resend_count", resendCount),
+		semconv.ExceptionMessage(err.Error()),
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		attributes = append(attributes, attribute.String("aws.error.code", awsErr.Code()))
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		attributes = append(attributes, semconv.HTTPStatusCode(reqErr.StatusCode()))
+	}
+	return attributes
+}
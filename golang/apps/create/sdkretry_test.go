@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestSDKRetryAttributes(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want map[string]string
+	}{
+		{
+			name: "plain error",
+			err:  errors.New("connection reset"),
+			want: map[string]string{
+				"aws.request.resend_count": "1",
+				"exception.message":        "connection reset",
+			},
+		},
+		{
+			name: "aws error",
+			err:  awserr.New("RequestError", "send request failed", nil),
+			want: map[string]string{
+				"aws.request.resend_count": "1",
+				"exception.message":        "RequestError: send request failed",
+				"aws.error.code":           "RequestError",
+			},
+		},
+		{
+			name: "request failure",
+			err:  awserr.NewRequestFailure(awserr.New("InternalError", "We encountered an internal error", nil), 500, ""),
+			want: map[string]string{
+				"aws.request.resend_count": "1",
+				"exception.message":        "InternalError: We encountered an internal error\n\tstatus code: 500, request id: ",
+				"aws.error.code":           "InternalError",
+				"http.status_code":         "500",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			for _, attr := range sdkRetryAttributes(1, tt.err) {
+				got[string(attr.Key)] = attr.Value.Emit()
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sdkRetryAttributes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSDKRetryRecorder(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int32
+		wantResends int64
+		wantErr     bool
+	}{
+		{
+			name:        "no resend",
+			failures:    0,
+			wantResends: 0,
+		},
+		{
+			name:        "resent",
+			failures:    2,
+			wantResends: 2,
+		},
+		{
+			name:        "resends used up",
+			failures:    10,
+			wantResends: 3,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= tt.failures {
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte(`<Error><Code>InternalError</Code><Message>We encountered an internal error</Message></Error>`))
+					return
+				}
+			}))
+			t.Cleanup(server.Close)
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "S3.PutObject")
+			retries := newSDKRetryRecorder(span)
+
+			_, err := newTestS3Client(server.URL, nil).PutObjectWithContext(ctx, &s3.PutObjectInput{
+				Bucket: aws.String("bucket"),
+				Key:    aws.String("2026/01/01/id"),
+				Body:   bytes.NewReader([]byte(`{"item":"x"}`)),
+			}, retries.requestOption())
+			retries.record()
+			span.End()
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PutObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			ended := recorder.Ended()[0]
+			if got := spanAttribute(ended, "aws.request.resend_count").AsInt64(); got != tt.wantResends {
+				t.Errorf("aws.request.resend_count = %d, want %d", got, tt.wantResends)
+			}
+			var events int64
+			for _, event := range ended.Events() {
+				if event.Name == SDK_RETRY_EVENT_NAME {
+					events++
+				}
+			}
+			if events != tt.wantResends {
+				t.Errorf("got %d %s events, want %d", events, SDK_RETRY_EVENT_NAME, tt.wantResends)
+			}
+		})
+	}
+}
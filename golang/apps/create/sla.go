@@ -0,0 +1,36 @@
+package main
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SLA_BREACHED_EVENT_NAME = "SLABreached"
+)
+
+// recordSLA marks the parent span of an invocation which has taken longer
+// than SLA_MS, so that slow invocations can be filtered without knowing
+// the threshold. Nothing is recorded without a configured SLA.
+func recordSLA(
+	parentSpan trace.Span,
+	elapsed time.Duration,
+) {
+	if SLA <= 0 {
+		return
+	}
+
+	breached := elapsed > SLA
+	parentSpan.SetAttributes(attribute.Bool("sla.breached", breached))
+	if !breached {
+		return
+	}
+
+	parentSpan.AddEvent(SLA_BREACHED_EVENT_NAME, trace.WithAttributes(
+		attribute.Int64("sla.threshold_ms", SLA.Milliseconds()),
+		attribute.Int64("sla.elapsed_ms", elapsed.Milliseconds()),
+	))
+	logger.warn("Invocation has breached the SLA.", "thresholdMs", SLA.Milliseconds(), "elapsedMs", elapsed.Milliseconds())
+}
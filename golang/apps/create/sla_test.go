@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestRecordSLA(t *testing.T) {
+	tests := []struct {
+		name         string
+		sla          time.Duration
+		elapsed      time.Duration
+		wantRecorded bool
+		wantBreached bool
+	}{
+		{
+			name:         "no sla",
+			sla:          0,
+			elapsed:      time.Minute,
+			wantRecorded: false,
+		},
+		{
+			name:         "within sla",
+			sla:          time.Second,
+			elapsed:      500 * time.Millisecond,
+			wantRecorded: true,
+			wantBreached: false,
+		},
+		{
+			name:         "exactly the sla",
+			sla:          time.Second,
+			elapsed:      time.Second,
+			wantRecorded: true,
+			wantBreached: false,
+		},
+		{
+			name:         "breached",
+			sla:          time.Second,
+			elapsed:      1500 * time.Millisecond,
+			wantRecorded: true,
+			wantBreached: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := SLA
+			t.Cleanup(func() { SLA = previous })
+			SLA = tt.sla
+
+			tp, recorder := newRecordingTracerProvider()
+			_, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "main.handler")
+			recordSLA(span, tt.elapsed)
+			span.End()
+
+			ended := recorder.Ended()[0]
+			breached := spanAttribute(ended, "sla.breached")
+			if recorded := breached.Type() != attribute.INVALID; recorded != tt.wantRecorded {
+				t.Fatalf("sla.breached recorded = %v, want %v", recorded, tt.wantRecorded)
+			}
+			if breached.AsBool() != tt.wantBreached {
+				t.Errorf("sla.breached = %v, want %v", breached.AsBool(), tt.wantBreached)
+			}
+
+			var events int
+			for _, event := range ended.Events() {
+				if event.Name != SLA_BREACHED_EVENT_NAME {
+					continue
+				}
+				events++
+				for _, attr := range event.Attributes {
+					if attr.Key == "sla.elapsed_ms" && attr.Value.AsInt64() != tt.elapsed.Milliseconds() {
+						t.Errorf("sla.elapsed_ms = %d, want %d", attr.Value.AsInt64(), tt.elapsed.Milliseconds())
+					}
+				}
+			}
+			if breachedEvent := events == 1; breachedEvent != tt.wantBreached || events > 1 {
+				t.Errorf("got %d %s events, want breached %v", events, SLA_BREACHED_EVENT_NAME, tt.wantBreached)
+			}
+		})
+	}
+}
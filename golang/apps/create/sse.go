@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SSE_KMS_KEY_ATTRIBUTE_ALIAS = "alias"
+	SSE_KMS_KEY_ATTRIBUTE_FULL  = "full"
+	SSE_KMS_KEY_ATTRIBUTE_NONE  = "none"
+)
+
+// sseAlgorithm returns aws:kms when a KMS key is configured and nil
+// otherwise, so that the bucket default encryption applies.
+func sseAlgorithm() *string {
+	if S3_SSE_KMS_KEY_ID == "" {
+		return nil
+	}
+	return aws.String(s3.ServerSideEncryptionAwsKms)
+}
+
+func sseKMSKeyID() *string {
+	if S3_SSE_KMS_KEY_ID == "" {
+		return nil
+	}
+	return aws.String(S3_SSE_KMS_KEY_ID)
+}
+
+// sseKMSKeyLabel returns what is recorded about the key on the spans. Key
+// ARNs contain the account id, so by default only the resource part like
+// alias/demo or key/<id> is recorded.
+func sseKMSKeyLabel(
+	keyID string,
+	mode string,
+) string {
+	switch mode {
+	case SSE_KMS_KEY_ATTRIBUTE_NONE:
+		return ""
+	case SSE_KMS_KEY_ATTRIBUTE_FULL:
+		return keyID
+	}
+
+	if !strings.HasPrefix(keyID, "arn:") {
+		return keyID
+	}
+	parts := strings.SplitN(keyID, ":", 6)
+	return parts[len(parts)-1]
+}
+
+func recordSSEAttributes(
+	span trace.Span,
+) {
+	if S3_SSE_KMS_KEY_ID == "" {
+		return
+	}
+
+	span.SetAttributes(attribute.String("aws.s3.sse", s3.ServerSideEncryptionAwsKms))
+	if label := sseKMSKeyLabel(S3_SSE_KMS_KEY_ID, S3_SSE_KMS_KEY_ATTRIBUTE); label != "" {
+		span.SetAttributes(attribute.String("aws.s3.sse.kms_key", label))
+	}
+}
+
+// kmsErrorType maps the errors which S3 passes through from KMS to their
+// error type. Access denied is only attributed to KMS while a key is
+// configured.
+func kmsErrorType(
+	err error,
+) string {
+	var awsErr awserr.Error
+	if S3_SSE_KMS_KEY_ID == "" || !errors.As(err, &awsErr) {
+		return ""
+	}
+
+	switch awsErr.Code() {
+	case "KMS.DisabledException":
+		return "kms_key_disabled"
+	case "KMS.NotFoundException":
+		return "kms_key_not_found"
+	case "KMS.KMSInvalidStateException":
+		return "kms_key_invalid_state"
+	case "AccessDenied", "KMS.AccessDeniedException":
+		return "kms_access_denied"
+	}
+	return ""
+}
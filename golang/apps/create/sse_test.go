@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+// withSSEKMSKey configures the KMS key of the stored objects and how it is
+// recorded on the spans.
+func withSSEKMSKey(
+	t *testing.T,
+	keyID string,
+	mode string,
+) {
+	previousKey, previousMode := S3_SSE_KMS_KEY_ID, S3_SSE_KMS_KEY_ATTRIBUTE
+	t.Cleanup(func() { S3_SSE_KMS_KEY_ID, S3_SSE_KMS_KEY_ATTRIBUTE = previousKey, previousMode })
+	S3_SSE_KMS_KEY_ID, S3_SSE_KMS_KEY_ATTRIBUTE = keyID, mode
+}
+
+func TestSSEKMSKeyLabel(t *testing.T) {
+	keyARN := "arn:aws:kms:eu-west-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	aliasARN := "arn:aws:kms:eu-west-1:123456789012:alias/demo"
+
+	tests := []struct {
+		name  string
+		keyID string
+		mode  string
+		want  string
+	}{
+		{name: "key ARN", keyID: keyARN, mode: SSE_KMS_KEY_ATTRIBUTE_ALIAS, want: "key/1234abcd-12ab-34cd-56ef-1234567890ab"},
+		{name: "alias ARN", keyID: aliasARN, mode: SSE_KMS_KEY_ATTRIBUTE_ALIAS, want: "alias/demo"},
+		{name: "alias name", keyID: "alias/demo", mode: SSE_KMS_KEY_ATTRIBUTE_ALIAS, want: "alias/demo"},
+		{name: "unknown mode falls back to the alias", keyID: keyARN, mode: "", want: "key/1234abcd-12ab-34cd-56ef-1234567890ab"},
+		{name: "full ARN", keyID: keyARN, mode: SSE_KMS_KEY_ATTRIBUTE_FULL, want: keyARN},
+		{name: "none", keyID: keyARN, mode: SSE_KMS_KEY_ATTRIBUTE_NONE, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sseKMSKeyLabel(tt.keyID, tt.mode); got != tt.want {
+				t.Errorf("sseKMSKeyLabel(%q, %q) = %q, want %q", tt.keyID, tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKMSErrorType(t *testing.T) {
+	tests := []struct {
+		name  string
+		keyID string
+		err   error
+		want  string
+	}{
+		{name: "disabled key", keyID: "alias/demo", err: awserr.New("KMS.DisabledException", "", nil), want: "kms_key_disabled"},
+		{name: "missing key", keyID: "alias/demo", err: awserr.New("KMS.NotFoundException", "", nil), want: "kms_key_not_found"},
+		{name: "key in invalid state", keyID: "alias/demo", err: awserr.New("KMS.KMSInvalidStateException", "", nil), want: "kms_key_invalid_state"},
+		{name: "access denied", keyID: "alias/demo", err: awserr.New("AccessDenied", "", nil), want: "kms_access_denied"},
+		{name: "access denied by KMS", keyID: "alias/demo", err: awserr.New("KMS.AccessDeniedException", "", nil), want: "kms_access_denied"},
+		{name: "access denied without key", keyID: "", err: awserr.New("AccessDenied", "", nil), want: ""},
+		{name: "other S3 error", keyID: "alias/demo", err: awserr.New("SlowDown", "", nil), want: ""},
+		{name: "no error", keyID: "alias/demo", err: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSSEKMSKey(t, tt.keyID, SSE_KMS_KEY_ATTRIBUTE_ALIAS)
+
+			if got := kmsErrorType(tt.err); got != tt.want {
+				t.Errorf("kmsErrorType(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3StoragePutSSEKMS(t *testing.T) {
+	tests := []struct {
+		name          string
+		keyID         string
+		wantAlgorithm string
+		wantKeyLabel  string
+	}{
+		{
+			name: "bucket default encryption",
+		},
+		{
+			name:          "KMS key",
+			keyID:         "arn:aws:kms:eu-west-1:123456789012:alias/demo",
+			wantAlgorithm: "aws:kms",
+			wantKeyLabel:  "alias/demo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withoutFaults(t)
+			withUploadRetries(t, 1)
+			withSSEKMSKey(t, tt.keyID, SSE_KMS_KEY_ATTRIBUTE_ALIAS)
+
+			var headers http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				headers = r.Header.Clone()
+				w.Header().Set("ETag", `"etag"`)
+			}))
+			t.Cleanup(server.Close)
+
+			previousClient := s3Client
+			t.Cleanup(func() { s3Client = previousClient })
+			s3Client = newTestS3Client(server.URL, nil)
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, parentSpan := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+
+			storage := newS3Storage(newS3Uploader(s3Client), s3Client, s3manager.MinUploadPartSize)
+			if _, err := storage.Put(ctx, "2026/01/01/id", []byte(`{"item":"x"}`), commons.PutMetadata{Bucket: "bucket"}); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			parentSpan.End()
+
+			if got := headers.Get("X-Amz-Server-Side-Encryption"); got != tt.wantAlgorithm {
+				t.Errorf("X-Amz-Server-Side-Encryption = %q, want %q", got, tt.wantAlgorithm)
+			}
+			if got := headers.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"); got != tt.keyID {
+				t.Errorf("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id = %q, want %q", got, tt.keyID)
+			}
+
+			found := false
+			for _, span := range recorder.Ended() {
+				if span.Name() != "S3.PutObject" {
+					continue
+				}
+				found = true
+				if got := spanAttribute(span, "aws.s3.sse").AsString(); got != tt.wantAlgorithm {
+					t.Errorf("aws.s3.sse = %q, want %q", got, tt.wantAlgorithm)
+				}
+				if got := spanAttribute(span, "aws.s3.sse.kms_key").AsString(); got != tt.wantKeyLabel {
+					t.Errorf("aws.s3.sse.kms_key = %q, want %q", got, tt.wantKeyLabel)
+				}
+			}
+			if !found {
+				t.Error("S3.PutObject span is missing")
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+// newStorage creates the storage backend selected by STORAGE_BACKEND.
+// Without a bucket, LOCAL=true selects the local backend, so that the
+// function runs without AWS credentials. Unknown or incompletely
+// configured backends fall back to S3.
+func newStorage(
+	backend string,
+) (
+	string,
+	commons.Storage,
+) {
+	if backend == "" && INPUT_S3_BUCKET_NAME == "" && os.Getenv("LOCAL") == "true" {
+		backend = STORAGE_BACKEND_LOCAL
+	}
+
+	switch backend {
+	case "", STORAGE_BACKEND_S3:
+	case STORAGE_BACKEND_LOCAL:
+		return backend, newLocalStorage(localStorageDir())
+	case STORAGE_BACKEND_DYNAMODB:
+		if STORAGE_TABLE_NAME != "" {
+			return backend, newDynamoDBStorage(dynamoDBClient, STORAGE_TABLE_NAME)
+		}
+		logger.error("Storage table name is missing, falling back to S3.", "backend", backend)
+	default:
+		logger.error("Storage backend is unknown, falling back to S3.", "backend", backend)
+	}
+	return STORAGE_BACKEND_S3, newS3Storage(newS3Uploader(s3Client), s3Client, S3_UPLOAD_PART_SIZE)
+}
+
+// isS3Storage reports whether objects are stored in S3. Steps which talk
+// to S3 directly, like existence checks, verification and presigning, are
+// skipped for the other backends.
+func isS3Storage() bool {
+	return STORAGE_BACKEND == STORAGE_BACKEND_S3
+}
+
+// localStorageDir returns the directory of the local storage or an empty
+// one to keep the objects in memory, as chosen by LOCAL_STORAGE_MODE.
+func localStorageDir() string {
+	if strings.ToLower(os.Getenv("LOCAL_STORAGE_MODE")) == LOCAL_STORAGE_MODE_MEMORY {
+		return ""
+	}
+	if dir := os.Getenv("LOCAL_STORAGE_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "objects")
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNewStorage(t *testing.T) {
+	tests := []struct {
+		name        string
+		backend     string
+		bucket      string
+		table       string
+		local       string
+		wantBackend string
+		wantType    string
+	}{
+		{
+			name:        "default is s3",
+			backend:     "",
+			bucket:      "bucket",
+			wantBackend: STORAGE_BACKEND_S3,
+			wantType:    "s3",
+		},
+		{
+			name:        "s3",
+			backend:     STORAGE_BACKEND_S3,
+			bucket:      "bucket",
+			wantBackend: STORAGE_BACKEND_S3,
+			wantType:    "s3",
+		},
+		{
+			name:        "local without bucket",
+			backend:     "",
+			local:       "true",
+			wantBackend: STORAGE_BACKEND_LOCAL,
+			wantType:    "local",
+		},
+		{
+			name:        "bucket wins over local run",
+			backend:     "",
+			bucket:      "bucket",
+			local:       "true",
+			wantBackend: STORAGE_BACKEND_S3,
+			wantType:    "s3",
+		},
+		{
+			name:        "local",
+			backend:     STORAGE_BACKEND_LOCAL,
+			bucket:      "bucket",
+			wantBackend: STORAGE_BACKEND_LOCAL,
+			wantType:    "local",
+		},
+		{
+			name:        "dynamodb",
+			backend:     STORAGE_BACKEND_DYNAMODB,
+			table:       "objects",
+			wantBackend: STORAGE_BACKEND_DYNAMODB,
+			wantType:    "dynamodb",
+		},
+		{
+			name:        "dynamodb without table falls back to s3",
+			backend:     STORAGE_BACKEND_DYNAMODB,
+			wantBackend: STORAGE_BACKEND_S3,
+			wantType:    "s3",
+		},
+		{
+			name:        "unknown falls back to s3",
+			backend:     "gcs",
+			wantBackend: STORAGE_BACKEND_S3,
+			wantType:    "s3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousBucket, previousTable := INPUT_S3_BUCKET_NAME, STORAGE_TABLE_NAME
+			t.Cleanup(func() { INPUT_S3_BUCKET_NAME, STORAGE_TABLE_NAME = previousBucket, previousTable })
+			INPUT_S3_BUCKET_NAME = tt.bucket
+			STORAGE_TABLE_NAME = tt.table
+			t.Setenv("LOCAL", tt.local)
+			t.Setenv("LOCAL_STORAGE_MODE", LOCAL_STORAGE_MODE_MEMORY)
+
+			backend, storage := newStorage(tt.backend)
+
+			if backend != tt.wantBackend {
+				t.Errorf("newStorage() backend = %q, want %q", backend, tt.wantBackend)
+			}
+			var gotType string
+			switch storage.(type) {
+			case *s3Storage:
+				gotType = "s3"
+			case *localStorage:
+				gotType = "local"
+			case *dynamoDBStorage:
+				gotType = "dynamodb"
+			}
+			if gotType != tt.wantType {
+				t.Errorf("newStorage() storage = %T, want %s", storage, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestIsS3Storage(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		want    bool
+	}{
+		{
+			name:    "s3",
+			backend: STORAGE_BACKEND_S3,
+			want:    true,
+		},
+		{
+			name:    "local",
+			backend: STORAGE_BACKEND_LOCAL,
+			want:    false,
+		},
+		{
+			name:    "dynamodb",
+			backend: STORAGE_BACKEND_DYNAMODB,
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := STORAGE_BACKEND
+			t.Cleanup(func() { STORAGE_BACKEND = previous })
+			STORAGE_BACKEND = tt.backend
+
+			if got := isS3Storage(); got != tt.want {
+				t.Errorf("isS3Storage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalStorageDir(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	tests := []struct {
+		name string
+		mode string
+		dir  string
+		want string
+	}{
+		{
+			name: "memory",
+			mode: "memory",
+			dir:  "/var/objects",
+			want: "",
+		},
+		{
+			name: "memory in upper case",
+			mode: "MEMORY",
+			want: "",
+		},
+		{
+			name: "configured directory",
+			dir:  "/var/objects",
+			want: "/var/objects",
+		},
+		{
+			name: "temporary directory",
+			want: filepath.Join(tempDir, "objects"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOCAL_STORAGE_MODE", tt.mode)
+			t.Setenv("LOCAL_STORAGE_DIR", tt.dir)
+
+			if got := localStorageDir(); got != tt.want {
+				t.Errorf("localStorageDir() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
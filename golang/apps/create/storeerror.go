@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+type StoreErrorKind string
+
+const (
+	STORE_ERROR_KIND_TIMEOUT       StoreErrorKind = "timeout"
+	STORE_ERROR_KIND_ACCESS_DENIED StoreErrorKind = "access_denied"
+	STORE_ERROR_KIND_THROTTLED     StoreErrorKind = "throttled"
+	STORE_ERROR_KIND_UNKNOWN       StoreErrorKind = "unknown"
+)
+
+// DEFAULT_STORE_ERROR_STATUS_CODES answers throttling with a 429, so that
+// clients back off instead of treating it as a failure of the function.
+// STORE_ERROR_STATUS_CODES overrides the codes per kind.
+var DEFAULT_STORE_ERROR_STATUS_CODES = map[StoreErrorKind]int{
+	STORE_ERROR_KIND_TIMEOUT:       408,
+	STORE_ERROR_KIND_ACCESS_DENIED: 403,
+	STORE_ERROR_KIND_THROTTLED:     429,
+	STORE_ERROR_KIND_UNKNOWN:       500,
+}
+
+// StoreError classifies a failed upload so that the handler can answer
+// with a meaningful status code instead of a generic 500. Attempts is the
+// number of uploads which have been tried, backends which do not retry
+// themselves leave it empty.
+type StoreError struct {
+	Kind     StoreErrorKind
+	Err      error
+	Attempts int
+}
+
+func (e *StoreError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+func newStoreError(
+	err error,
+) *StoreError {
+	return &StoreError{
+		Kind: classifyStoreError(err),
+		Err:  err,
+	}
+}
+
+// classifyStoreError maps the AWS error codes of failed uploads to their
+// kind.
+func classifyStoreError(
+	err error,
+) StoreErrorKind {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case "RequestTimeout", request.ErrCodeResponseTimeout:
+			return STORE_ERROR_KIND_TIMEOUT
+		case "AccessDenied", "AllAccessDisabled", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken":
+			return STORE_ERROR_KIND_ACCESS_DENIED
+		case "SlowDown", "Throttling", "ThrottlingException", "ProvisionedThroughputExceededException", "RequestLimitExceeded":
+			return STORE_ERROR_KIND_THROTTLED
+		}
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		switch reqErr.StatusCode() {
+		case 403:
+			return STORE_ERROR_KIND_ACCESS_DENIED
+		case 408:
+			return STORE_ERROR_KIND_TIMEOUT
+		case 429:
+			return STORE_ERROR_KIND_THROTTLED
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return STORE_ERROR_KIND_TIMEOUT
+	}
+	return STORE_ERROR_KIND_UNKNOWN
+}
+
+// parseStoreErrorStatusCodes overrides the default status codes with a
+// comma separated list of kind=code pairs, e.g. "throttled=429". Unknown
+// kinds and codes outside of 400-599 are ignored.
+func parseStoreErrorStatusCodes(
+	value string,
+) map[StoreErrorKind]int {
+	statusCodes := map[StoreErrorKind]int{}
+	for kind, statusCode := range DEFAULT_STORE_ERROR_STATUS_CODES {
+		statusCodes[kind] = statusCode
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		kind, code, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+
+		errorKind := StoreErrorKind(strings.ToLower(strings.TrimSpace(kind)))
+		statusCode, err := strconv.Atoi(strings.TrimSpace(code))
+		if _, known := statusCodes[errorKind]; !known || err != nil || statusCode < 400 || statusCode > 599 {
+			logger.warn("Store error status code mapping is invalid, ignoring.", "entry", entry)
+			continue
+		}
+		statusCodes[errorKind] = statusCode
+	}
+	return statusCodes
+}
+
+// storeErrorStatusCode returns the status code which answers a failed
+// upload as configured for its kind.
+func storeErrorStatusCode(
+	err error,
+) int {
+	var storeErr *StoreError
+	if !errors.As(err, &storeErr) {
+		return 500
+	}
+
+	statusCode, ok := STORE_ERROR_STATUS_CODES[storeErr.Kind]
+	if !ok {
+		return 500
+	}
+	return statusCode
+}
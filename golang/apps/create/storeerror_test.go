@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// timeoutError is a network error which has timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestClassifyStoreError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want StoreErrorKind
+	}{
+		{name: "request timeout", err: awserr.New("RequestTimeout", "", nil), want: STORE_ERROR_KIND_TIMEOUT},
+		{name: "response timeout", err: awserr.New(request.ErrCodeResponseTimeout, "", nil), want: STORE_ERROR_KIND_TIMEOUT},
+		{name: "access denied", err: awserr.New("AccessDenied", "", nil), want: STORE_ERROR_KIND_ACCESS_DENIED},
+		{name: "expired token", err: awserr.New("ExpiredToken", "", nil), want: STORE_ERROR_KIND_ACCESS_DENIED},
+		{name: "slow down", err: awserr.New("SlowDown", "", nil), want: STORE_ERROR_KIND_THROTTLED},
+		{name: "DynamoDB throughput", err: awserr.New("ProvisionedThroughputExceededException", "", nil), want: STORE_ERROR_KIND_THROTTLED},
+		{name: "forbidden without code", err: awserr.NewRequestFailure(awserr.New("Forbidden", "", nil), 403, "id"), want: STORE_ERROR_KIND_ACCESS_DENIED},
+		{name: "timeout status without code", err: awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 408, "id"), want: STORE_ERROR_KIND_TIMEOUT},
+		{name: "too many requests without code", err: awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 429, "id"), want: STORE_ERROR_KIND_THROTTLED},
+		{name: "network timeout", err: fmt.Errorf("put: %w", timeoutError{}), want: STORE_ERROR_KIND_TIMEOUT},
+		{name: "internal error", err: awserr.NewRequestFailure(awserr.New("InternalError", "", nil), 500, "id"), want: STORE_ERROR_KIND_UNKNOWN},
+		{name: "other error", err: errors.New("boom"), want: STORE_ERROR_KIND_UNKNOWN},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyStoreError(tt.err); got != tt.want {
+				t.Errorf("classifyStoreError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStoreErrorStatusCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[StoreErrorKind]int
+	}{
+		{
+			name:  "defaults",
+			value: "",
+			want:  DEFAULT_STORE_ERROR_STATUS_CODES,
+		},
+		{
+			name:  "overrides",
+			value: " Throttled = 503 ,timeout=504",
+			want: map[StoreErrorKind]int{
+				STORE_ERROR_KIND_TIMEOUT:       504,
+				STORE_ERROR_KIND_ACCESS_DENIED: 403,
+				STORE_ERROR_KIND_THROTTLED:     503,
+				STORE_ERROR_KIND_UNKNOWN:       500,
+			},
+		},
+		{
+			name:  "invalid entries are ignored",
+			value: "throttled,unknown_kind=500,timeout=200,access_denied=600,unknown=abc",
+			want:  DEFAULT_STORE_ERROR_STATUS_CODES,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseStoreErrorStatusCodes(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseStoreErrorStatusCodes(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	// The defaults are copied, not overridden
+	if DEFAULT_STORE_ERROR_STATUS_CODES[STORE_ERROR_KIND_THROTTLED] != 429 {
+		t.Errorf("default status code of throttling = %d, want 429", DEFAULT_STORE_ERROR_STATUS_CODES[STORE_ERROR_KIND_THROTTLED])
+	}
+}
+
+func TestStoreErrorStatusCode(t *testing.T) {
+	previous := STORE_ERROR_STATUS_CODES
+	t.Cleanup(func() { STORE_ERROR_STATUS_CODES = previous })
+	STORE_ERROR_STATUS_CODES = parseStoreErrorStatusCodes("throttled=503")
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "throttled", err: newStoreError(awserr.New("SlowDown", "", nil)), want: 503},
+		{name: "access denied", err: newStoreError(awserr.New("AccessDenied", "", nil)), want: 403},
+		{name: "wrapped store error", err: fmt.Errorf("upload: %w", newStoreError(timeoutError{})), want: 408},
+		{name: "unknown kind", err: &StoreError{Kind: "other", Err: errors.New("boom")}, want: 500},
+		{name: "not a store error", err: errors.New("boom"), want: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := storeErrorStatusCode(tt.err); got != tt.want {
+				t.Errorf("storeErrorStatusCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreErrorUnwrap(t *testing.T) {
+	cause := awserr.New("SlowDown", "Please reduce your request rate.", nil)
+	err := newStoreError(cause)
+
+	if !errors.Is(err, cause) {
+		t.Error("store error does not unwrap to its cause")
+	}
+	if err.Error() != cause.Error() {
+		t.Errorf("Error() = %q, want %q", err.Error(), cause.Error())
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	MAX_OBJECT_TAG_KEY_LENGTH   = 128
+	MAX_OBJECT_TAG_VALUE_LENGTH = 256
+)
+
+var (
+	errInvalidObjectTags = errors.New("object tags are invalid")
+)
+
+// parseObjectTags parses tags in the form env=prod,team=payments. S3 allows
+// up to 10 tags per object with unique keys of up to 128 and values of up
+// to 256 characters.
+func parseObjectTags(
+	value string,
+) (
+	[]commons.ObjectTag,
+	error,
+) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	keys := map[string]bool{}
+	tags := []commons.ObjectTag{}
+	for _, entry := range strings.Split(value, ",") {
+		key, tagValue, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		tagValue = strings.TrimSpace(tagValue)
+
+		switch {
+		case !ok || key == "":
+			return nil, fmt.Errorf("%w: %q is not in the form key=value", errInvalidObjectTags, entry)
+		case len(key) > MAX_OBJECT_TAG_KEY_LENGTH:
+			return nil, fmt.Errorf("%w: key %q is too long", errInvalidObjectTags, key)
+		case len(tagValue) > MAX_OBJECT_TAG_VALUE_LENGTH:
+			return nil, fmt.Errorf("%w: value of %q is too long", errInvalidObjectTags, key)
+		case keys[key]:
+			return nil, fmt.Errorf("%w: key %q is duplicated", errInvalidObjectTags, key)
+		}
+
+		keys[key] = true
+		tags = append(tags, commons.ObjectTag{Key: key, Value: tagValue})
+	}
+
+	if len(tags) > commons.MaxObjectTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", errInvalidObjectTags, commons.MaxObjectTags)
+	}
+	return tags, nil
+}
+
+// objectTags returns the configured tags together with the tags linking
+// the object to the service and the trace which has created it.
+func objectTags(
+	span trace.Span,
+) []commons.ObjectTag {
+	return commons.MergeObjectTags(S3_OBJECT_TAGS,
+		commons.TraceTags(OTEL_SERVICE_NAME, DEPLOYMENT_ENVIRONMENT, traceIDOf(span))...)
+}
+
+// objectTagging returns the encoded tagging of uploaded objects or nil
+// when there are no tags.
+func objectTagging(
+	tags []commons.ObjectTag,
+) *string {
+	if len(tags) == 0 {
+		return nil
+	}
+	tagging := commons.EncodeObjectTags(tags)
+	return &tagging
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+)
+
+func TestParseObjectTags(t *testing.T) {
+	tooMany := []string{}
+	for i := 0; i <= commons.MaxObjectTags; i++ {
+		tooMany = append(tooMany, "key"+string(rune('a'+i))+"=value")
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    []commons.ObjectTag
+		wantErr error
+	}{
+		{
+			name:  "empty",
+			value: " ",
+		},
+		{
+			name:  "tags are trimmed",
+			value: " env = prod ,team=payments",
+			want:  []commons.ObjectTag{{Key: "env", Value: "prod"}, {Key: "team", Value: "payments"}},
+		},
+		{
+			name:  "empty value",
+			value: "env=",
+			want:  []commons.ObjectTag{{Key: "env", Value: ""}},
+		},
+		{
+			name:    "missing separator",
+			value:   "env",
+			wantErr: errInvalidObjectTags,
+		},
+		{
+			name:    "missing key",
+			value:   "=prod",
+			wantErr: errInvalidObjectTags,
+		},
+		{
+			name:    "duplicated key",
+			value:   "env=prod,env=dev",
+			wantErr: errInvalidObjectTags,
+		},
+		{
+			name:    "key is too long",
+			value:   strings.Repeat("k", MAX_OBJECT_TAG_KEY_LENGTH+1) + "=prod",
+			wantErr: errInvalidObjectTags,
+		},
+		{
+			name:    "value is too long",
+			value:   "env=" + strings.Repeat("v", MAX_OBJECT_TAG_VALUE_LENGTH+1),
+			wantErr: errInvalidObjectTags,
+		},
+		{
+			name:    "too many tags",
+			value:   strings.Join(tooMany, ","),
+			wantErr: errInvalidObjectTags,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseObjectTags(tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseObjectTags(%q) error = %v, want %v", tt.value, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseObjectTags(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectTagging(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []commons.ObjectTag
+		want string
+	}{
+		{
+			name: "no tags",
+		},
+		{
+			name: "tags",
+			tags: []commons.ObjectTag{{Key: "env", Value: "prod"}, {Key: "team", Value: "a b"}},
+			want: "env=prod&team=a%20b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := objectTagging(tt.tags)
+			if (got == nil) != (tt.want == "") {
+				t.Fatalf("objectTagging() = %v, want %q", got, tt.want)
+			}
+			if got != nil && *got != tt.want {
+				t.Errorf("objectTagging() = %q, want %q", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectTags(t *testing.T) {
+	previousTags, previousService, previousEnvironment := S3_OBJECT_TAGS, OTEL_SERVICE_NAME, DEPLOYMENT_ENVIRONMENT
+	t.Cleanup(func() {
+		S3_OBJECT_TAGS, OTEL_SERVICE_NAME, DEPLOYMENT_ENVIRONMENT = previousTags, previousService, previousEnvironment
+	})
+	OTEL_SERVICE_NAME, DEPLOYMENT_ENVIRONMENT = "create", "prod"
+
+	tp, _ := newRecordingTracerProvider()
+	_, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+	defer span.End()
+	traceID := span.SpanContext().TraceID().String()
+
+	tests := []struct {
+		name       string
+		configured []commons.ObjectTag
+		want       []commons.ObjectTag
+	}{
+		{
+			name: "trace tags only",
+			want: []commons.ObjectTag{
+				{Key: commons.TraceTagKey, Value: traceID},
+				{Key: commons.ServiceTagKey, Value: "create"},
+				{Key: commons.EnvironmentTagKey, Value: "prod"},
+			},
+		},
+		{
+			name: "configured tags come first and are overridden",
+			configured: []commons.ObjectTag{
+				{Key: "team", Value: "payments"},
+				{Key: commons.ServiceTagKey, Value: "configured"},
+			},
+			want: []commons.ObjectTag{
+				{Key: "team", Value: "payments"},
+				{Key: commons.ServiceTagKey, Value: "create"},
+				{Key: commons.TraceTagKey, Value: traceID},
+				{Key: commons.EnvironmentTagKey, Value: "prod"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S3_OBJECT_TAGS = tt.configured
+			if got := objectTags(span); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("objectTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	lambdadetector "go.opentelemetry.io/contrib/detectors/aws/lambda"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/aggregation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setupTracerProvider creates the tracer provider and sets it globally.
+// With OTEL_SDK_DISABLED, the global tracer provider is a no-op one whose
+// spans are never recorded nor exported, and no provider is returned.
+func setupTracerProvider(
+	ctx context.Context,
+) (
+	*sdktrace.TracerProvider,
+	error,
+) {
+	if OTEL_SDK_DISABLED {
+		logger.info("OpenTelemetry SDK is disabled, no telemetry is exported.")
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		return nil, nil
+	}
+
+	tp, err := newTracerProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set global tracer provider
+	tracerProvider = tp
+	otel.SetTracerProvider(tp)
+	return tp, nil
+}
+
+// newTracerProvider creates the same tracer provider as
+// xrayconfig.NewTracerProvider but enriches the detected Lambda resource
+// with the configured service namespace and deployment environment.
+func newTracerProvider(
+	ctx context.Context,
+) (
+	*sdktrace.TracerProvider,
+	error,
+) {
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := newResource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(dryRunSpanProcessor{}),
+		sdktrace.WithSpanProcessor(newSpanProcessor(exporter)),
+		sdktrace.WithIDGenerator(xray.NewIDGenerator()),
+		sdktrace.WithSampler(newSampler()),
+		sdktrace.WithResource(res),
+		sdktrace.WithRawSpanLimits(newSpanLimits()),
+	), nil
+}
+
+// newSpanLimits takes the limits from OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT and
+// OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT with the defaults of the SDK. Like
+// in the SDK, a negative limit turns the limit off.
+func newSpanLimits() sdktrace.SpanLimits {
+	limits := sdktrace.NewSpanLimits()
+	limits.AttributeCountLimit = getEnvAsSpanLimit("OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT", sdktrace.DefaultAttributeCountLimit)
+	limits.AttributeValueLengthLimit = getEnvAsSpanLimit("OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT", sdktrace.DefaultAttributeValueLengthLimit)
+	return limits
+}
+
+// getEnvAsSpanLimit parses a span limit. Unlike getEnvAsInt, it keeps zero
+// and maps negative values to -1, i.e. no limit.
+func getEnvAsSpanLimit(
+	key string,
+	defaultValue int,
+) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	if value < 0 {
+		return -1
+	}
+	return value
+}
+
+// newMeterProvider creates a meter provider which sends the metrics to the
+// collector extension as well. As the Lambda may be frozen between
+// invocations, the metrics are flushed at the end of every request instead
+// of relying on the periodic export only.
+func newMeterProvider(
+	ctx context.Context,
+) (
+	*sdkmetric.MeterProvider,
+	error,
+) {
+	exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := newResource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(newHandlerDurationView()),
+	), nil
+}
+
+// newHandlerDurationView buckets the handler duration for latency SLOs. The
+// SDK version in use has no exponential histogram aggregation yet, so the
+// boundaries are spread exponentially by hand instead.
+func newHandlerDurationView() sdkmetric.View {
+	return sdkmetric.NewView(
+		sdkmetric.Instrument{
+			Name: "lambda.handler.duration_ms",
+		},
+		sdkmetric.Stream{
+			Aggregation: aggregation.ExplicitBucketHistogram{
+				Boundaries: []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000},
+			},
+		},
+	)
+}
+
+// newSpanProcessor creates the span processor chosen by
+// OTEL_SPAN_PROCESSOR. The simple processor exports every span as soon as
+// it ends which suits the short lifecycle of a Lambda, the batch processor
+// (default) can be tuned with OTEL_BSP_MAX_EXPORT_BATCH_SIZE and
+// OTEL_BSP_SCHEDULE_DELAY (in milliseconds).
+func newSpanProcessor(
+	exporter sdktrace.SpanExporter,
+) sdktrace.SpanProcessor {
+	if OTEL_SPAN_PROCESSOR == "simple" {
+		return sdktrace.NewSimpleSpanProcessor(exporter)
+	}
+
+	return sdktrace.NewBatchSpanProcessor(exporter,
+		sdktrace.WithMaxExportBatchSize(getEnvAsInt("OTEL_BSP_MAX_EXPORT_BATCH_SIZE", sdktrace.DefaultMaxExportBatchSize)),
+		sdktrace.WithBatchTimeout(time.Duration(getEnvAsInt("OTEL_BSP_SCHEDULE_DELAY", sdktrace.DefaultScheduleDelay))*time.Millisecond),
+	)
+}
+
+func newResource(
+	ctx context.Context,
+) (
+	*resource.Resource,
+	error,
+) {
+	lambdaResource, err := lambdadetector.NewResourceDetector().Detect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := []attribute.KeyValue{}
+	if SERVICE_NAMESPACE != "" {
+		attributes = append(attributes, semconv.ServiceNamespace(SERVICE_NAMESPACE))
+	}
+	if DEPLOYMENT_ENVIRONMENT != "" {
+		attributes = append(attributes, semconv.DeploymentEnvironment(DEPLOYMENT_ENVIRONMENT))
+	}
+
+	return resource.Merge(lambdaResource, resource.NewSchemaless(attributes...))
+}
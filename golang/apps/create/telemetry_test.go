@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetupTracerProviderDisabledExportsNoSpans(t *testing.T) {
+	withHealthyConfig(t)
+
+	previousProvider, previousLogger := otel.GetTracerProvider(), logger
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		logger = previousLogger
+	})
+
+	var logs bytes.Buffer
+	logger = newStructuredLogger(logLevelDebug, &logs)
+
+	// A recording provider which the disabled SDK has to replace
+	recordingProvider, recorder := newRecordingTracerProvider()
+	otel.SetTracerProvider(recordingProvider)
+
+	tp, err := setupTracerProvider(context.Background())
+	if err != nil {
+		t.Fatalf("setupTracerProvider() error = %v", err)
+	}
+	if tp != nil {
+		t.Fatal("setupTracerProvider() returned a tracer provider although the SDK is disabled")
+	}
+
+	logs.Reset()
+	result := serveRequest(context.Background(), nil, &Request{
+		Method:   "GET",
+		RouteKey: "GET /health",
+		Path:     "/health",
+	})
+	if result.StatusCode != 200 {
+		t.Fatalf("status code = %d, want 200: %s", result.StatusCode, result.Body)
+	}
+
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("%d spans are exported, want none", len(spans))
+	}
+
+	// Without a sampling decision the logs are not reduced
+	if !strings.Contains(logs.String(), `"level":"info"`) {
+		t.Error("info lines are dropped although the SDK is disabled")
+	}
+}
+
+func TestNewSpanLimitsTruncatesAttributeValues(t *testing.T) {
+	value := strings.Repeat("x", 8192)
+
+	tests := []struct {
+		name       string
+		limit      string
+		wantLength int
+	}{
+		{
+			name:       "unset keeps the SDK default",
+			wantLength: 8192,
+		},
+		{
+			name:       "configured limit",
+			limit:      "16",
+			wantLength: 16,
+		},
+		{
+			name:       "negative limit turns it off",
+			limit:      "-1",
+			wantLength: 8192,
+		},
+		{
+			name:       "invalid limit keeps the SDK default",
+			limit:      "many",
+			wantLength: 8192,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT", tt.limit)
+
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSpanProcessor(recorder),
+				sdktrace.WithRawSpanLimits(newSpanLimits()),
+			)
+
+			_, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "span")
+			span.SetAttributes(attribute.String("http.request.header.x_giant", value))
+			span.End()
+
+			attributes := recorder.Ended()[0].Attributes()
+			if len(attributes) != 1 || len(attributes[0].Value.AsString()) != tt.wantLength {
+				t.Errorf("attributes = %d, value length = %d, want a single value of length %d", len(attributes), len(attributes[0].Value.AsString()), tt.wantLength)
+			}
+		})
+	}
+}
+
+func TestGetEnvAsSpanLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  int
+	}{
+		{name: "unset", value: "", want: 128},
+		{name: "positive", value: "64", want: 64},
+		{name: "zero", value: "0", want: 0},
+		{name: "minus one", value: "-1", want: -1},
+		{name: "other negative", value: "-5", want: -1},
+		{name: "invalid", value: "x", want: 128},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT", tt.value)
+			if got := getEnvAsSpanLimit("OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT", 128); got != tt.want {
+				t.Errorf("getEnvAsSpanLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeRequestForceFlush(t *testing.T) {
+	withHealthyConfig(t)
+
+	tests := []struct {
+		name           string
+		forceFlush     bool
+		wantExported   bool
+		wantFlushEvent bool
+	}{
+		{
+			name: "spans are left to the batch processor",
+		},
+		{
+			name:           "spans are flushed per invocation",
+			forceFlush:     true,
+			wantExported:   true,
+			wantFlushEvent: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousGlobal, previousProvider, previousForceFlush := otel.GetTracerProvider(), tracerProvider, FORCE_FLUSH_PER_INVOCATION
+			t.Cleanup(func() {
+				otel.SetTracerProvider(previousGlobal)
+				tracerProvider, FORCE_FLUSH_PER_INVOCATION = previousProvider, previousForceFlush
+			})
+			FORCE_FLUSH_PER_INVOCATION = tt.forceFlush
+
+			// The batch processor would not export within the test on its own
+			exporter := tracetest.NewInMemoryExporter()
+			tracerProvider = sdktrace.NewTracerProvider(
+				sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(time.Hour)),
+			)
+			otel.SetTracerProvider(tracerProvider)
+			t.Cleanup(func() { tracerProvider.Shutdown(context.Background()) })
+
+			// The invocation span of the Lambda instrumentation
+			invocationProvider, invocationRecorder := newRecordingTracerProvider()
+			invocationCtx, invocationSpan := invocationProvider.Tracer("otellambda").Start(context.Background(), "create")
+
+			result := serveRequest(invocationCtx, nil, &Request{
+				Method:   "GET",
+				RouteKey: "GET /health",
+				Path:     "/health",
+			})
+			invocationSpan.End()
+			if result.StatusCode != 200 {
+				t.Fatalf("status code = %d, want 200: %s", result.StatusCode, result.Body)
+			}
+
+			// The server span is named after the route once it has ended
+			exported := false
+			for _, span := range exporter.GetSpans() {
+				if span.SpanKind == trace.SpanKindServer {
+					exported = true
+				}
+			}
+			if exported != tt.wantExported {
+				t.Errorf("server span exported = %v, want %v", exported, tt.wantExported)
+			}
+
+			flushEvent := false
+			for _, event := range invocationRecorder.Ended()[0].Events() {
+				if event.Name != "ForceFlush" {
+					continue
+				}
+				flushEvent = true
+				if len(event.Attributes) != 1 || event.Attributes[0].Key != "flush.duration_ms" {
+					t.Errorf("ForceFlush attributes = %v, want flush.duration_ms", event.Attributes)
+				}
+			}
+			if flushEvent != tt.wantFlushEvent {
+				t.Errorf("ForceFlush event = %v, want %v", flushEvent, tt.wantFlushEvent)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	errUnknownTenant      = errors.New("unknown tenant")
+	errTargetBucketDenied = errors.New("target bucket is not allowed")
+)
+
+// parseTenantBucketMap parses a mapping in the form
+// tenantA=bucket-a,tenantB=bucket-b. Malformed entries are skipped.
+func parseTenantBucketMap(
+	value string,
+) map[string]string {
+	tenantBuckets := map[string]string{}
+	for _, entry := range strings.Split(value, ",") {
+		tenantID, bucket, ok := strings.Cut(entry, "=")
+		tenantID = strings.TrimSpace(tenantID)
+		bucket = strings.TrimSpace(bucket)
+		if !ok || tenantID == "" || bucket == "" {
+			continue
+		}
+		tenantBuckets[tenantID] = bucket
+	}
+	return tenantBuckets
+}
+
+// resolveBucket selects the bucket of the tenant given in the X-Tenant-Id
+// header. Requests without a tenant are stored in the input bucket.
+func resolveBucket(
+	headers map[string]string,
+) (
+	string,
+	string,
+	error,
+) {
+	tenantID := strings.TrimSpace(getHeader(headers, "X-Tenant-Id"))
+	if tenantID == "" {
+		return "", INPUT_S3_BUCKET_NAME, nil
+	}
+
+	bucket, ok := TENANT_BUCKET_MAP[tenantID]
+	if !ok {
+		return tenantID, "", errUnknownTenant
+	}
+	return tenantID, bucket, nil
+}
+
+// parseBucketAllowlist parses the comma separated buckets which callers may
+// choose with the X-Target-Bucket header.
+func parseBucketAllowlist(
+	value string,
+) map[string]bool {
+	buckets := map[string]bool{}
+	for _, bucket := range strings.Split(value, ",") {
+		bucket = strings.TrimSpace(bucket)
+		if bucket != "" {
+			buckets[bucket] = true
+		}
+	}
+	return buckets
+}
+
+// resolveTargetBucket lets the X-Target-Bucket header override the resolved
+// bucket as long as the requested bucket is allowlisted.
+func resolveTargetBucket(
+	headers map[string]string,
+	bucket string,
+) (
+	string,
+	error,
+) {
+	targetBucket := strings.TrimSpace(getHeader(headers, "X-Target-Bucket"))
+	if targetBucket == "" {
+		return bucket, nil
+	}
+
+	if !TARGET_BUCKET_ALLOWLIST[targetBucket] {
+		return "", errTargetBucketDenied
+	}
+	return targetBucket, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseTenantBucketMap(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]string
+	}{
+		{
+			name:  "empty",
+			value: "",
+			want:  map[string]string{},
+		},
+		{
+			name:  "tenants",
+			value: "tenantA=bucket-a, tenantB = bucket-b",
+			want:  map[string]string{"tenantA": "bucket-a", "tenantB": "bucket-b"},
+		},
+		{
+			name:  "malformed entries are skipped",
+			value: "tenantA=bucket-a,tenantB,=bucket-c,tenantD=,",
+			want:  map[string]string{"tenantA": "bucket-a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseTenantBucketMap(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTenantBucketMap(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveBucket(t *testing.T) {
+	previousBucket, previousMap := INPUT_S3_BUCKET_NAME, TENANT_BUCKET_MAP
+	t.Cleanup(func() { INPUT_S3_BUCKET_NAME, TENANT_BUCKET_MAP = previousBucket, previousMap })
+	INPUT_S3_BUCKET_NAME = "input"
+	TENANT_BUCKET_MAP = parseTenantBucketMap("tenantA=bucket-a")
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantTenant string
+		wantBucket string
+		wantErr    error
+	}{
+		{
+			name:       "mapped tenant",
+			headers:    map[string]string{"x-tenant-id": "tenantA"},
+			wantTenant: "tenantA",
+			wantBucket: "bucket-a",
+		},
+		{
+			name:       "unmapped tenant",
+			headers:    map[string]string{"X-Tenant-Id": "tenantB"},
+			wantTenant: "tenantB",
+			wantErr:    errUnknownTenant,
+		},
+		{
+			name:       "default bucket without tenant",
+			headers:    map[string]string{},
+			wantBucket: "input",
+		},
+		{
+			name:       "blank tenant",
+			headers:    map[string]string{"X-Tenant-Id": "  "},
+			wantBucket: "input",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenantID, bucket, err := resolveBucket(tt.headers)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveBucket() error = %v, want %v", err, tt.wantErr)
+			}
+			if tenantID != tt.wantTenant || bucket != tt.wantBucket {
+				t.Errorf("resolveBucket() = %q, %q, want %q, %q", tenantID, bucket, tt.wantTenant, tt.wantBucket)
+			}
+		})
+	}
+}
+
+func TestParseBucketAllowlist(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]bool
+	}{
+		{name: "empty", value: "", want: map[string]bool{}},
+		{name: "buckets are trimmed", value: " archive , Reports,,", want: map[string]bool{"archive": true, "Reports": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseBucketAllowlist(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBucketAllowlist(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveTargetBucket(t *testing.T) {
+	previous := TARGET_BUCKET_ALLOWLIST
+	t.Cleanup(func() { TARGET_BUCKET_ALLOWLIST = previous })
+	TARGET_BUCKET_ALLOWLIST = parseBucketAllowlist("archive")
+
+	tests := []struct {
+		name         string
+		targetBucket string
+		want         string
+		wantErr      error
+	}{
+		{name: "no target bucket", targetBucket: "", want: "bucket"},
+		{name: "blank target bucket", targetBucket: "  ", want: "bucket"},
+		{name: "allowlisted target bucket", targetBucket: " archive ", want: "archive"},
+		{name: "other target bucket", targetBucket: "other", wantErr: errTargetBucketDenied},
+		{name: "allowlist is case-sensitive", targetBucket: "Archive", wantErr: errTargetBucketDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveTargetBucket(map[string]string{"x-target-bucket": tt.targetBucket}, "bucket")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveTargetBucket() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveTargetBucket() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newThrottleCounter creates the lambda.storage.throttles counter which
+// counts the requests answered as throttled by the storage.
+func newThrottleCounter(
+	meter metric.Meter,
+) (
+	metric.Int64Counter,
+	error,
+) {
+	return meter.Int64Counter("lambda.storage.throttles",
+		metric.WithDescription("Number of requests which are throttled by the storage backend."),
+		metric.WithUnit("{request}"),
+	)
+}
+
+// throttleRetryAfter returns the backoff which the next upload would have
+// waited for, so that clients back off as long as the function itself
+// would have. It is at least a second as Retry-After has no finer unit.
+func throttleRetryAfter(
+	attempts int,
+) time.Duration {
+	retryAfter := S3_UPLOAD_BASE_DELAY << attempts
+	if retryAfter <= 0 || retryAfter > S3_UPLOAD_MAX_DELAY {
+		retryAfter = S3_UPLOAD_MAX_DELAY
+	}
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return retryAfter
+}
+
+// failThrottled answers a write which the storage has throttled. The
+// parent span is only marked as failed once all attempts are used up, a
+// throttled request which has not been retried is backpressure and not a
+// failure of the function.
+func failThrottled(
+	parentSpan trace.Span,
+	err error,
+) *createResult {
+	var storeErr *StoreError
+	errors.As(err, &storeErr)
+
+	parentSpan.SetAttributes(attribute.String("error.type", "throttled"))
+	if storeErr.Attempts >= S3_UPLOAD_MAX_ATTEMPTS {
+		parentSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+	}
+
+	if throttleCounter != nil {
+		throttleCounter.Add(trace.ContextWithSpan(context.Background(), parentSpan), 1,
+			metric.WithAttributes(
+				attribute.String("storage.backend", STORAGE_BACKEND),
+			))
+	}
+
+	retryAfter := throttleRetryAfter(storeErr.Attempts)
+	logger.warn("Storing custom object is throttled.", "attempts", storeErr.Attempts, "retryAfter", retryAfter.String())
+
+	result := failRequest(parentSpan, storeErrorStatusCode(err), "Storing the object is throttled, retry later.")
+	result.Headers["Retry-After"] = strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	return result
+}
+
+// isThrottled reports whether the storage has throttled the write.
+func isThrottled(
+	err error,
+) bool {
+	var storeErr *StoreError
+	return errors.As(err, &storeErr) && storeErr.Kind == STORE_ERROR_KIND_THROTTLED
+}
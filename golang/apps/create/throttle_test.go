@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestThrottleRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		want     time.Duration
+	}{
+		{
+			name:     "at least a second",
+			attempts: 1,
+			want:     time.Second,
+		},
+		{
+			name:     "backoff",
+			attempts: 4,
+			want:     1600 * time.Millisecond,
+		},
+		{
+			name:     "capped",
+			attempts: 8,
+			want:     S3_UPLOAD_MAX_DELAY,
+		},
+		{
+			name:     "overflow",
+			attempts: 64,
+			want:     S3_UPLOAD_MAX_DELAY,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := S3_UPLOAD_BASE_DELAY
+			t.Cleanup(func() { S3_UPLOAD_BASE_DELAY = previous })
+			S3_UPLOAD_BASE_DELAY = 100 * time.Millisecond
+
+			if got := throttleRetryAfter(tt.attempts); got != tt.want {
+				t.Errorf("throttleRetryAfter(%d) = %v, want %v", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailThrottled(t *testing.T) {
+	tests := []struct {
+		name           string
+		attempts       int
+		wantRetryAfter string
+		wantFailed     bool
+	}{
+		{
+			name:           "not retried",
+			attempts:       1,
+			wantRetryAfter: "1",
+			wantFailed:     false,
+		},
+		{
+			name:           "attempts used up",
+			attempts:       3,
+			wantRetryAfter: "2",
+			wantFailed:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := withMetricReader(t)
+			previousAttempts, previousBase := S3_UPLOAD_MAX_ATTEMPTS, S3_UPLOAD_BASE_DELAY
+			previousCodes, previousBackend := STORE_ERROR_STATUS_CODES, STORAGE_BACKEND
+			t.Cleanup(func() {
+				S3_UPLOAD_MAX_ATTEMPTS, S3_UPLOAD_BASE_DELAY = previousAttempts, previousBase
+				STORE_ERROR_STATUS_CODES, STORAGE_BACKEND = previousCodes, previousBackend
+			})
+			S3_UPLOAD_MAX_ATTEMPTS = 3
+			S3_UPLOAD_BASE_DELAY = 200 * time.Millisecond
+			STORE_ERROR_STATUS_CODES = DEFAULT_STORE_ERROR_STATUS_CODES
+			STORAGE_BACKEND = STORAGE_BACKEND_S3
+
+			tp, recorder := newRecordingTracerProvider()
+			_, span := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "main.handler")
+			result := failThrottled(span, &StoreError{
+				Kind:     STORE_ERROR_KIND_THROTTLED,
+				Err:      errors.New("SlowDown: Please reduce your request rate."),
+				Attempts: tt.attempts,
+			})
+			span.End()
+
+			if result.StatusCode != http.StatusTooManyRequests {
+				t.Errorf("status code = %d, want %d", result.StatusCode, http.StatusTooManyRequests)
+			}
+			if got := result.Headers["Retry-After"]; got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+
+			ended := recorder.Ended()[0]
+			if got := spanAttribute(ended, "error.type").AsString(); got != "throttled" {
+				t.Errorf("error.type = %q, want %q", got, "throttled")
+			}
+			if failed := spanAttribute(ended, "otel.status_description").AsString() != ""; failed != tt.wantFailed {
+				t.Errorf("span failed = %v, want %v", failed, tt.wantFailed)
+			}
+
+			sum := collectMetric(t, reader, "lambda.storage.throttles").(metricdata.Sum[int64])
+			if len(sum.DataPoints) != 1 || sum.DataPoints[0].Value != 1 {
+				t.Errorf("lambda.storage.throttles = %+v, want 1", sum.DataPoints)
+			}
+		})
+	}
+}
+
+func TestIsThrottled(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "throttled",
+			err:  &StoreError{Kind: STORE_ERROR_KIND_THROTTLED, Err: errors.New("SlowDown")},
+			want: true,
+		},
+		{
+			name: "other kind",
+			err:  &StoreError{Kind: STORE_ERROR_KIND_ACCESS_DENIED, Err: errors.New("AccessDenied")},
+			want: false,
+		},
+		{
+			name: "not a store error",
+			err:  errors.New("SlowDown"),
+			want: false,
+		},
+		{
+			name: "no error",
+			err:  nil,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isThrottled(tt.err); got != tt.want {
+				t.Errorf("isThrottled(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
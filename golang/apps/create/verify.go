@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	VERIFICATION_FAILED_EVENT_NAME = "VerificationFailed"
+)
+
+var (
+	errVerificationFailed = errors.New("stored object does not match the uploaded bytes")
+)
+
+// verifyObjectInS3 reads the metadata of a freshly stored object back and
+// compares its length against the uploaded byte count. Compressed objects
+// are compared by the uncompressed size kept in their metadata. It shows a
+// read after write check within the trace and therefore costs an extra
+// call.
+func verifyObjectInS3(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucket string,
+	key string,
+	expectedLength int,
+) error {
+
+	output, err := headObjectInS3(ctx, parentSpan, bucket, key)
+	if err != nil {
+		parentSpan.SetAttributes(attribute.String("error.type", "verification_failed"))
+		countError(parentSpan, ERROR_TYPE_VERIFICATION)
+		return err
+	}
+
+	actualLength := int64(-1)
+	if output != nil {
+		actualLength = aws.Int64Value(output.ContentLength)
+		for name, value := range output.Metadata {
+			if strings.EqualFold(name, commons.UncompressedSizeMetadataKey) {
+				actualLength, _ = strconv.ParseInt(aws.StringValue(value), 10, 64)
+			}
+		}
+	}
+
+	verified := actualLength == int64(expectedLength)
+	parentSpan.SetAttributes(attribute.Bool("verified", verified))
+	if verified {
+		return nil
+	}
+
+	parentSpan.AddEvent(VERIFICATION_FAILED_EVENT_NAME,
+		trace.WithAttributes(
+			attribute.String("aws.s3.key", key),
+			attribute.Int("verification.expected_length", expectedLength),
+			attribute.Int64("verification.actual_length", actualLength),
+		))
+
+	parentSpan.SetAttributes([]attribute.KeyValue{
+		semconv.OtelStatusCodeError,
+		semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		attribute.String("error.type", "verification_failed"),
+	}...)
+	countError(parentSpan, ERROR_TYPE_VERIFICATION)
+
+	logger.error("Verifying custom object in S3 is failed.", "key", key, "expectedLength", expectedLength, "actualLength", actualLength)
+	return errVerificationFailed
+}
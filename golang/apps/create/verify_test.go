@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestVerifyObjectInS3(t *testing.T) {
+	tests := []struct {
+		name             string
+		status           int
+		contentLength    int
+		uncompressedSize string
+		expectedLength   int
+		wantErr          error
+		wantAnyErr       bool
+		wantVerified     bool
+		wantEvent        bool
+	}{
+		{
+			name:           "matching length",
+			status:         http.StatusOK,
+			contentLength:  12,
+			expectedLength: 12,
+			wantVerified:   true,
+		},
+		{
+			name:             "compressed object is compared by its uncompressed size",
+			status:           http.StatusOK,
+			contentLength:    4,
+			uncompressedSize: "12",
+			expectedLength:   12,
+			wantVerified:     true,
+		},
+		{
+			name:           "other length",
+			status:         http.StatusOK,
+			contentLength:  11,
+			expectedLength: 12,
+			wantErr:        errVerificationFailed,
+			wantAnyErr:     true,
+			wantEvent:      true,
+		},
+		{
+			name:           "missing object",
+			status:         http.StatusNotFound,
+			expectedLength: 12,
+			wantErr:        errVerificationFailed,
+			wantAnyErr:     true,
+			wantEvent:      true,
+		},
+		{
+			name:           "failed head",
+			status:         http.StatusForbidden,
+			expectedLength: 12,
+			wantAnyErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousClient := s3Client
+			t.Cleanup(func() { s3Client = previousClient })
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", strconv.Itoa(tt.contentLength))
+				if tt.uncompressedSize != "" {
+					w.Header().Set("X-Amz-Meta-Uncompressed-Size", tt.uncompressedSize)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			t.Cleanup(server.Close)
+			s3Client = newTestS3Client(server.URL, nil)
+
+			tp, recorder := newRecordingTracerProvider()
+			ctx, parentSpan := tp.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(context.Background(), "handler")
+
+			err := verifyObjectInS3(ctx, parentSpan, "bucket", "2026/01/01/id", tt.expectedLength)
+			parentSpan.End()
+
+			if (err != nil) != tt.wantAnyErr || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("verifyObjectInS3() error = %v, want %v", err, tt.wantErr)
+			}
+
+			spans := recorder.Ended()
+			handler := spans[len(spans)-1]
+			if got := spanAttribute(handler, "verified").AsBool(); got != tt.wantVerified {
+				t.Errorf("verified = %v, want %v", got, tt.wantVerified)
+			}
+			if tt.wantAnyErr && spanAttribute(handler, "error.type").AsString() != "verification_failed" {
+				t.Errorf("error.type = %q, want verification_failed", spanAttribute(handler, "error.type").AsString())
+			}
+
+			event := false
+			for _, e := range handler.Events() {
+				if e.Name == VERIFICATION_FAILED_EVENT_NAME {
+					event = true
+				}
+			}
+			if event != tt.wantEvent {
+				t.Errorf("%s event = %v, want %v", VERIFICATION_FAILED_EVENT_NAME, event, tt.wantEvent)
+			}
+		})
+	}
+}
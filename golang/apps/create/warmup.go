@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	WARMUP_HEADER = "X-Warmup"
+)
+
+// WarmerResponse answers the scheduled warmer events which are sent as raw
+// {"warmer": true} payloads.
+type WarmerResponse struct {
+	StatusCode int  `json:"statusCode"`
+	Warmer     bool `json:"warmer"`
+}
+
+// handleWarmer answers a raw warmer payload with a single span and never
+// touches S3.
+func handleWarmer(
+	ctx context.Context,
+) *WarmerResponse {
+	_, span := otel.Tracer(INSTRUMENTATION_SCOPE_NAME).Start(ctx, "main.warmup",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.Bool("warmup", true)))
+	span.End()
+
+	logger.debug("Warmer event is received.")
+	return &WarmerResponse{
+		StatusCode: 200,
+		Warmer:     true,
+	}
+}
+
+func isWarmupRequest(
+	req *Request,
+) bool {
+	return strings.EqualFold(strings.TrimSpace(getHeader(req.Headers, WARMUP_HEADER)), "true")
+}
+
+// warmupMiddleware answers HTTP requests carrying X-Warmup: true before any
+// validation, so that warmer requests never fail and never create objects.
+// Other values of the header are processed like any other request.
+func warmupMiddleware(
+	next Handler,
+) Handler {
+	return func(
+		ctx context.Context,
+		req *Request,
+	) *createResult {
+		if !isWarmupRequest(req) {
+			return next(ctx, req)
+		}
+
+		parentSpan := trace.SpanFromContext(ctx)
+		parentSpan.SetName("main.warmup")
+		parentSpan.SetAttributes(attribute.Bool("warmup", true))
+
+		logger.debug("Warmup request is received.")
+		return &createResult{
+			StatusCode: 200,
+			Headers:    map[string]string{},
+		}
+	}
+}
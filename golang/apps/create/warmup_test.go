@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWarmupMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantWarmup bool
+	}{
+		{
+			name:       "without header",
+			wantWarmup: false,
+		},
+		{
+			name:       "true",
+			headers:    map[string]string{"X-Warmup": "true"},
+			wantWarmup: true,
+		},
+		{
+			name:       "case insensitive",
+			headers:    map[string]string{"x-warmup": "TRUE"},
+			wantWarmup: true,
+		},
+		{
+			name:       "false",
+			headers:    map[string]string{"X-Warmup": "false"},
+			wantWarmup: false,
+		},
+		{
+			name:       "zero",
+			headers:    map[string]string{"X-Warmup": "0"},
+			wantWarmup: false,
+		},
+		{
+			name:       "empty",
+			headers:    map[string]string{"X-Warmup": ""},
+			wantWarmup: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed := false
+			handler := warmupMiddleware(func(context.Context, *Request) *createResult {
+				processed = true
+				return &createResult{StatusCode: 201}
+			})
+
+			result := handler(context.Background(), &Request{Method: "POST", Headers: tt.headers})
+
+			if processed == tt.wantWarmup {
+				t.Errorf("request processed = %v, want %v", processed, !tt.wantWarmup)
+			}
+			if tt.wantWarmup && result.StatusCode != 200 {
+				t.Errorf("status code = %d, want 200", result.StatusCode)
+			}
+		})
+	}
+}
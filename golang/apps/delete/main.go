@@ -25,6 +25,11 @@ import (
 const (
 	OTEL_STATUS_ERROR_DESCRIPTION = "Delete Lambda is failed."
 	CUSTOM_OTEL_SPAN_EVENT_NAME   = "LambdaDeleteEvent"
+
+	// The instrumentation scope names the code which creates the spans and
+	// stays the same across deployments. The service name belongs on the
+	// resource.
+	INSTRUMENTATION_SCOPE_NAME = "github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/delete"
 )
 
 var (
@@ -108,7 +113,7 @@ func startParentSpan(
 	trace.Span,
 ) {
 	// Create tracer
-	tracer := otel.Tracer(OTEL_SERVICE_NAME)
+	tracer := otel.Tracer(INSTRUMENTATION_SCOPE_NAME)
 
 	// Start parent span
 	return tracer.Start(ctx, "main.handler",
@@ -172,7 +177,7 @@ func startS3DeleteSpan(
 	trace.Span,
 ) {
 	// Start S3 put span
-	return parentSpan.TracerProvider().Tracer(OTEL_SERVICE_NAME).
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
 		Start(ctx, "S3.DeleteObjects",
 			trace.WithSpanKind(trace.SpanKindClient),
 			trace.WithAttributes([]attribute.KeyValue{
@@ -4,19 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
+	"net/http"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda/xrayconfig"
 	"go.opentelemetry.io/contrib/propagators/aws/xray"
@@ -30,6 +37,19 @@ const (
 	OTEL_STATUS_ERROR_DESCRIPTION = "Update Lambda is failed."
 	CUSTOM_OTEL_SPAN_EVENT_NAME   = "LambdaUpdateEvent"
 	SQS_MESSAGE_GROUP_ID          = "otel"
+
+	// The instrumentation scope names the code which creates the spans and
+	// stays the same across deployments. The service name belongs on the
+	// resource.
+	INSTRUMENTATION_SCOPE_NAME = "github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/update"
+)
+
+var (
+	errPreconditionFailed = errors.New("object has been modified concurrently")
+
+	// Objects are addressed by their full keys as the create Lambda returns
+	// them in the Location header, partition included.
+	objectKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]+(/[A-Za-z0-9._~-]+)*$`)
 )
 
 var (
@@ -39,7 +59,7 @@ var (
 	SQS_QUEUE_URL         string
 	SQS_QUEUE_NAME        string
 	uploader              *s3manager.Uploader
-	downloader            *s3manager.Downloader
+	s3Client              *s3.S3
 	sqsClient             *sqs.SQS
 )
 
@@ -57,10 +77,10 @@ func main() {
 	SQS_QUEUE_URL = os.Getenv("SQS_QUEUE_URL")
 	SQS_QUEUE_NAME = os.Getenv("SQS_QUEUE_NAME")
 
-	// Create a s3 downloader & uploader
+	// Create a s3 uploader
 	sess := session.Must(session.NewSession())
-	downloader = s3manager.NewDownloader(sess)
 	uploader = s3manager.NewUploader(sess)
+	s3Client = s3.New(sess)
 
 	// Create SQS client
 	sqsClient = sqs.New(sess)
@@ -88,11 +108,48 @@ func main() {
 	otel.SetTextMapPropagator(xray.Propagator{})
 
 	// Wrap handler & instrument
-	lambda.Start(otellambda.InstrumentHandler(handler, xrayconfig.WithRecommendedOptions(tp)...))
+	lambda.Start(otellambda.InstrumentHandler(eventHandler, xrayconfig.WithRecommendedOptions(tp)...))
+}
+
+// eventHandler dispatches S3 notifications to the pipeline handler and
+// API Gateway requests to the update handler.
+func eventHandler(
+	ctx context.Context,
+	payload json.RawMessage,
+) (
+	interface{},
+	error,
+) {
+	shape := struct {
+		Records json.RawMessage `json:"Records"`
+	}{}
+	if err := json.Unmarshal(payload, &shape); err != nil {
+		return nil, err
+	}
+
+	if len(shape.Records) > 0 {
+		s3Event := events.S3Event{}
+		if err := json.Unmarshal(payload, &s3Event); err != nil {
+			return nil, err
+		}
+		objectsStored := handler(s3Event)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int("objects.stored", objectsStored))
+		return nil, nil
+	}
+
+	req := events.APIGatewayProxyRequest{}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	return updateHandler(req)
 }
 
+// handler processes the S3 notifications and returns the number of
+// objects stored in the output S3.
 func handler(
 	s3Event events.S3Event,
+) (
+	objectsStored int,
 ) {
 
 	ctx := context.Background()
@@ -131,6 +188,7 @@ func handler(
 			enrichSpanWithEvent(parentSpan, false)
 			return
 		}
+		objectsStored++
 
 		// Send custom object to SQS
 		err = sendCustomObjectS3InfoToSqs(ctx, parentSpan, record)
@@ -141,6 +199,288 @@ func handler(
 
 		enrichSpanWithEvent(parentSpan, true)
 	}
+	return
+}
+
+// updateHandler flips the flags of an existing object in the output S3
+// in place. The object is written back only if its ETag has not changed
+// since it was read so that concurrent updates are not lost.
+func updateHandler(
+	req events.APIGatewayProxyRequest,
+) (
+	events.APIGatewayProxyResponse,
+	error,
+) {
+
+	ctx := context.Background()
+
+	// Start parent span
+	ctx, parentSpan := startUpdateParentSpan(ctx, req)
+	defer parentSpan.End()
+
+	key := req.PathParameters["id"]
+	if key == "" {
+		return failRequest(parentSpan, 400, "Object ID is missing."), nil
+	}
+	if !objectKeyPattern.MatchString(key) {
+		return failRequest(parentSpan, 400, "Object ID is invalid."), nil
+	}
+	parentSpan.SetAttributes(attribute.String("aws.s3.key", key))
+
+	// Read the object together with its ETag
+	customObjectAsBytes, eTag, err := getObjectWithETagFromS3(ctx, parentSpan, key)
+	if err != nil {
+		if isNotFound(err) {
+			return failRequest(parentSpan, 404, "Object is not found."), nil
+		}
+		return failRequest(parentSpan, 500, "Getting the object from S3 is failed."), nil
+	}
+
+	// Flip the flags of the custom object
+	customObject, err := parseCustomObject(parentSpan, customObjectAsBytes)
+	if err != nil {
+		return failRequest(parentSpan, 500, "Parsing the stored object is failed."), nil
+	}
+	customObject.IsUpdated = !customObject.IsUpdated
+	customObject.IsChecked = !customObject.IsChecked
+
+	// Convert updated custom object to bytes
+	customObjectUpdatedAsBytes, err := convertCustomObjectUpdatedIntoBytes(parentSpan, customObject)
+	if err != nil {
+		return failRequest(parentSpan, 500, "Creating the updated object is failed."), nil
+	}
+
+	// Write the object back only if nobody else has modified it
+	err = storeObjectWithETagInS3(ctx, parentSpan, key, eTag, customObjectUpdatedAsBytes)
+	if err != nil {
+		if errors.Is(err, errPreconditionFailed) {
+			return failRequest(parentSpan, 409, "Object has been modified concurrently."), nil
+		}
+		return failRequest(parentSpan, 500, "Storing the updated object in S3 is failed."), nil
+	}
+
+	parentSpan.SetAttributes(semconv.HTTPStatusCode(200))
+	enrichSpanWithEvent(parentSpan, true)
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(customObjectUpdatedAsBytes),
+	}, nil
+}
+
+// failRequest responds with RFC 7807 problem details like the create
+// Lambda does. The trace id is part of the body so that callers can report
+// the failed request.
+func failRequest(
+	parentSpan trace.Span,
+	statusCode int,
+	detail string,
+) events.APIGatewayProxyResponse {
+	parentSpan.SetAttributes(semconv.HTTPStatusCode(statusCode))
+	enrichSpanWithEvent(parentSpan, false)
+
+	problemAsBytes, err := json.Marshal(commons.NewProblem(statusCode, detail, traceIDOf(parentSpan)))
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode: statusCode,
+			Body:       http.StatusText(statusCode),
+		}
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": commons.ProblemContentType},
+		Body:       string(problemAsBytes),
+	}
+}
+
+func traceIDOf(
+	span trace.Span,
+) string {
+	spanContext := span.SpanContext()
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+func startUpdateParentSpan(
+	ctx context.Context,
+	req events.APIGatewayProxyRequest,
+) (
+	context.Context,
+	trace.Span,
+) {
+	// Create tracer
+	tracer := otel.Tracer(INSTRUMENTATION_SCOPE_NAME)
+
+	// Start parent span
+	return tracer.Start(ctx, "main.updateHandler",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes([]attribute.KeyValue{
+			semconv.FaaSTriggerHTTP,
+			semconv.NetTransportTCP,
+			semconv.HTTPMethod(req.HTTPMethod),
+			semconv.HTTPRoute(req.Resource),
+			semconv.HTTPTarget(req.Path),
+			semconv.HTTPUserAgent(req.Headers["User-Agent"]),
+			attribute.String("aws.s3.bucket", OUTPUT_S3_BUCKET_NAME),
+		}...))
+}
+
+func getObjectWithETagFromS3(
+	ctx context.Context,
+	parentSpan trace.Span,
+	key string,
+) (
+	[]byte,
+	string,
+	error,
+) {
+
+	fmt.Println("Getting custom object from the output S3...")
+
+	// Start S3 get span
+	ctx, s3GetSpan := startS3GetSpan(ctx, parentSpan)
+	defer s3GetSpan.End()
+
+	// Count the resends of the SDK
+	sdkRetries := newSDKRetryRecorder(s3GetSpan)
+	defer sdkRetries.record()
+
+	output, err := s3Client.GetObjectWithContext(ctx,
+		&s3.GetObjectInput{
+			Bucket: aws.String(OUTPUT_S3_BUCKET_NAME),
+			Key:    aws.String(key),
+		},
+		sdkRetries.requestOption())
+
+	var customObjectAsBytes []byte
+	if err == nil {
+		defer output.Body.Close()
+		customObjectAsBytes, err = io.ReadAll(output.Body)
+	}
+	if err == nil {
+		customObjectAsBytes, err = commons.DecodeObjectBody(aws.StringValue(output.ContentEncoding), customObjectAsBytes)
+	}
+
+	if err != nil {
+		msg := "Getting custom object from the output S3 is failed."
+
+		s3GetSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		s3GetSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+
+		fmt.Println(msg)
+		return nil, "", err
+	}
+
+	eTag := aws.StringValue(output.ETag)
+	s3GetSpan.SetAttributes(attribute.String("aws.s3.etag", eTag))
+
+	fmt.Println("Getting custom object from the output S3 is succeeded.")
+	return customObjectAsBytes, eTag, nil
+}
+
+func storeObjectWithETagInS3(
+	ctx context.Context,
+	parentSpan trace.Span,
+	key string,
+	eTag string,
+	customObjectUpdatedAsBytes []byte,
+) error {
+
+	fmt.Println("Storing custom object into output S3 conditionally...")
+
+	// Keep the tags, a put replaces them otherwise
+	tags := getObjectTagsFromS3(ctx, parentSpan, OUTPUT_S3_BUCKET_NAME, key)
+
+	// Start S3 put span
+	ctx, s3PutSpan := startS3PutSpan(ctx, parentSpan)
+	defer s3PutSpan.End()
+
+	s3PutSpan.SetAttributes(attribute.String("aws.s3.if_match", eTag))
+
+	// Count the resends of the SDK
+	sdkRetries := newSDKRetryRecorder(s3PutSpan)
+	defer sdkRetries.record()
+
+	// The SDK does not model conditional writes, so the precondition is
+	// added to the HTTP request directly.
+	_, err := s3Client.PutObjectWithContext(ctx,
+		&s3.PutObjectInput{
+			Bucket:      aws.String(OUTPUT_S3_BUCKET_NAME),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(customObjectUpdatedAsBytes),
+			ContentType: aws.String("application/json"),
+			Tagging:     updatedObjectTagging(s3PutSpan, tags),
+		},
+		func(r *request.Request) {
+			r.HTTPRequest.Header.Set("If-Match", eTag)
+		},
+		sdkRetries.requestOption())
+
+	if isPreconditionFailed(err) {
+		fmt.Println("Storing custom object into output S3 is rejected due to a concurrent modification.")
+
+		s3PutSpan.SetAttributes(attribute.Bool("aws.s3.precondition_failed", true))
+		s3PutSpan.AddEvent("S3PreconditionFailed",
+			trace.WithAttributes(
+				attribute.String("aws.s3.key", key),
+				attribute.String("aws.s3.if_match", eTag),
+			))
+
+		return errPreconditionFailed
+	}
+
+	if err != nil {
+		msg := "Storing custom object into output S3 is failed."
+
+		s3PutSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		s3PutSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+
+		fmt.Println(msg)
+		return err
+	}
+
+	fmt.Println("Storing custom object into output S3 is succeeded.")
+	return nil
+}
+
+// isPreconditionFailed reports whether S3 rejected a conditional write.
+// S3 answers with 412 if the ETag does not match and with 409 if a
+// concurrent conditional write is in flight.
+func isPreconditionFailed(
+	err error,
+) bool {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) {
+		return requestFailure.StatusCode() == 412 ||
+			requestFailure.Code() == "ConditionalRequestConflict"
+	}
+	return false
+}
+
+func isNotFound(
+	err error,
+) bool {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) {
+		return requestFailure.StatusCode() == 404
+	}
+	return false
 }
 
 func startParentSpan(
@@ -151,7 +491,7 @@ func startParentSpan(
 	trace.Span,
 ) {
 	// Create tracer
-	tracer := otel.Tracer(OTEL_SERVICE_NAME)
+	tracer := otel.Tracer(INSTRUMENTATION_SCOPE_NAME)
 
 	// Start parent span
 	return tracer.Start(ctx, "main.handler",
@@ -180,17 +520,33 @@ func getObjectFromS3(
 	ctx, s3GetSpan := startS3GetSpan(ctx, parentSpan)
 	defer s3GetSpan.End()
 
-	// Create a writer
-	buff := &aws.WriteAtBuffer{}
+	// Pin the version which triggered the event, a later write to the
+	// same key would be read otherwise. Unversioned buckets send none.
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(record.S3.Bucket.Name),
+		Key:    aws.String(record.S3.Object.Key),
+	}
+	if record.S3.Object.VersionID != "" {
+		input.VersionId = aws.String(record.S3.Object.VersionID)
+		s3GetSpan.SetAttributes(attribute.String("aws.s3.version_id", record.S3.Object.VersionID))
+	}
 
-	// Get object from input S3
-	_, err := downloader.DownloadWithContext(
-		ctx,
-		buff,
-		&s3.GetObjectInput{
-			Bucket: aws.String(record.S3.Bucket.Name),
-			Key:    aws.String(record.S3.Object.Key),
-		})
+	// Count the resends of the SDK
+	sdkRetries := newSDKRetryRecorder(s3GetSpan)
+	defer sdkRetries.record()
+
+	// Get object from input S3, large objects are stored compressed
+	output, err := s3Client.GetObjectWithContext(ctx, input, sdkRetries.requestOption())
+
+	var customObjectAsBytes []byte
+	if err == nil {
+		defer output.Body.Close()
+		customObjectAsBytes, err = io.ReadAll(output.Body)
+	}
+	if err == nil {
+		s3GetSpan.SetAttributes(attribute.String("aws.s3.content_encoding", aws.StringValue(output.ContentEncoding)))
+		customObjectAsBytes, err = commons.DecodeObjectBody(aws.StringValue(output.ContentEncoding), customObjectAsBytes)
+	}
 
 	if err != nil {
 		msg := "Getting custom object from the input S3 is failed."
@@ -209,7 +565,7 @@ func getObjectFromS3(
 	}
 
 	fmt.Println("Getting custom object from the input S3 is succeeded.")
-	return buff.Bytes(), err
+	return customObjectAsBytes, nil
 }
 
 func startS3GetSpan(
@@ -220,7 +576,7 @@ func startS3GetSpan(
 	trace.Span,
 ) {
 	// Start S3 get span
-	return parentSpan.TracerProvider().Tracer(OTEL_SERVICE_NAME).
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
 		Start(ctx, "S3.GetObject",
 			trace.WithSpanKind(trace.SpanKindClient),
 			trace.WithAttributes([]attribute.KeyValue{
@@ -234,6 +590,22 @@ func updateCustomObject(
 ) (
 	*CustomObject,
 	error,
+) {
+	customObject, err := parseCustomObject(parentSpan, customObjectAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	customObject.IsUpdated = true
+	return customObject, nil
+}
+
+func parseCustomObject(
+	parentSpan trace.Span,
+	customObjectAsBytes []byte,
+) (
+	*CustomObject,
+	error,
 ) {
 	customObject := &CustomObject{}
 	err := json.Unmarshal(customObjectAsBytes, customObject)
@@ -254,7 +626,6 @@ func updateCustomObject(
 		return nil, err
 	}
 
-	customObject.IsUpdated = true
 	return customObject, nil
 }
 
@@ -293,6 +664,9 @@ func storeCustomObjectInOutputS3(
 
 	fmt.Println("Storing custom object into output S3...")
 
+	// Carry the tags of the original object over
+	tags := getObjectTagsFromS3(ctx, parentSpan, record.S3.Bucket.Name, record.S3.Object.Key)
+
 	// Start S3 put span
 	ctx, s3PutSpan := startS3PutSpan(ctx, parentSpan)
 	defer s3PutSpan.End()
@@ -303,14 +677,20 @@ func storeCustomObjectInOutputS3(
 		bucketName = "wrong-bucket-name"
 	}
 
+	// Count the resends of the SDK
+	sdkRetries := newSDKRetryRecorder(s3PutSpan)
+	defer sdkRetries.record()
+
 	// Upload object to S3
 	_, err := uploader.UploadWithContext(
 		ctx,
 		&s3manager.UploadInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(record.S3.Object.Key),
-			Body:   bytes.NewReader(customObjectUpdatedAsBytes),
-		})
+			Bucket:  aws.String(bucketName),
+			Key:     aws.String(record.S3.Object.Key),
+			Body:    bytes.NewReader(customObjectUpdatedAsBytes),
+			Tagging: updatedObjectTagging(s3PutSpan, tags),
+		},
+		s3manager.WithUploaderRequestOptions(sdkRetries.requestOption()))
 
 	if err != nil {
 		msg := "Storing custom object into output S3 is failed."
@@ -340,7 +720,7 @@ func startS3PutSpan(
 	trace.Span,
 ) {
 	// Start S3 put span
-	return parentSpan.TracerProvider().Tracer(OTEL_SERVICE_NAME).
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
 		Start(ctx, "S3.PutObject",
 			trace.WithSpanKind(trace.SpanKindClient),
 			trace.WithAttributes([]attribute.KeyValue{
@@ -426,7 +806,7 @@ func startSqsSendSpan(
 ) {
 
 	// Start S3 put span
-	return parentSpan.TracerProvider().Tracer(OTEL_SERVICE_NAME).
+	return parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
 		Start(ctx, "SQS.SendMessage",
 			trace.WithSpanKind(trace.SpanKindProducer),
 			trace.WithAttributes([]attribute.KeyValue{
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestObjectKeyPattern(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{
+			name: "partitioned key",
+			key:  "2026/03/07/item-1",
+			want: true,
+		},
+		{
+			name: "partitioned key with prefix",
+			key:  "objects/2026/03/07/0123abcd",
+			want: true,
+		},
+		{
+			name: "bare id",
+			key:  "item-1",
+			want: true,
+		},
+		{
+			name: "leading slash",
+			key:  "/2026/03/07/item-1",
+			want: false,
+		},
+		{
+			name: "empty segment",
+			key:  "2026//07/item-1",
+			want: false,
+		},
+		{
+			name: "unsafe characters",
+			key:  "2026/03/07/item 1",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := objectKeyPattern.MatchString(tt.key); got != tt.want {
+				t.Errorf("objectKeyPattern.MatchString(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeOutputS3 answers the calls of the update handler with the scripted
+// status codes and records the object which is put.
+type fakeOutputS3 struct {
+	getStatus int
+	getBody   string
+	putStatus int
+
+	getQuery   url.Values
+	putIfMatch string
+	putBody    []byte
+}
+
+func (s *fakeOutputS3) ServeHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == "GET" && r.URL.Query().Has("tagging"):
+		io.WriteString(w, `<Tagging><TagSet></TagSet></Tagging>`)
+	case r.Method == "GET":
+		s.getQuery = r.URL.Query()
+		if s.getStatus != http.StatusOK {
+			w.WriteHeader(s.getStatus)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		io.WriteString(w, s.getBody)
+	case r.Method == "PUT":
+		s.putIfMatch = r.Header.Get("If-Match")
+		s.putBody = body
+		w.WriteHeader(s.putStatus)
+	}
+}
+
+func withFakeOutputS3(
+	t *testing.T,
+	fake *fakeOutputS3,
+) {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	previousClient, previousBucket := s3Client, OUTPUT_S3_BUCKET_NAME
+	t.Cleanup(func() { s3Client, OUTPUT_S3_BUCKET_NAME = previousClient, previousBucket })
+
+	s3Client = s3.New(session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("eu-west-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:       aws.Int(0),
+	})))
+	OUTPUT_S3_BUCKET_NAME = "output"
+}
+
+func TestUpdateHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             string
+		s3             *fakeOutputS3
+		wantStatusCode int
+		wantDetail     string
+		wantStored     CustomObject
+	}{
+		{
+			name:           "missing id",
+			wantStatusCode: 400,
+			wantDetail:     "Object ID is missing.",
+		},
+		{
+			name:           "invalid id",
+			id:             "2026/03/07/item 1",
+			wantStatusCode: 400,
+			wantDetail:     "Object ID is invalid.",
+		},
+		{
+			name:           "not found",
+			id:             "2026/03/07/item-1",
+			s3:             &fakeOutputS3{getStatus: 404},
+			wantStatusCode: 404,
+			wantDetail:     "Object is not found.",
+		},
+		{
+			name:           "get fails",
+			id:             "2026/03/07/item-1",
+			s3:             &fakeOutputS3{getStatus: 403},
+			wantStatusCode: 500,
+			wantDetail:     "Getting the object from S3 is failed.",
+		},
+		{
+			name:           "stored object is invalid",
+			id:             "2026/03/07/item-1",
+			s3:             &fakeOutputS3{getStatus: 200, getBody: `not json`},
+			wantStatusCode: 500,
+			wantDetail:     "Parsing the stored object is failed.",
+		},
+		{
+			name:           "modified concurrently",
+			id:             "2026/03/07/item-1",
+			s3:             &fakeOutputS3{getStatus: 200, getBody: `{"item":"a"}`, putStatus: 412},
+			wantStatusCode: 409,
+			wantDetail:     "Object has been modified concurrently.",
+		},
+		{
+			name:           "put fails",
+			id:             "2026/03/07/item-1",
+			s3:             &fakeOutputS3{getStatus: 200, getBody: `{"item":"a"}`, putStatus: 403},
+			wantStatusCode: 500,
+			wantDetail:     "Storing the updated object in S3 is failed.",
+		},
+		{
+			name:           "updated",
+			id:             "2026/03/07/item-1",
+			s3:             &fakeOutputS3{getStatus: 200, getBody: `{"item":"a"}`, putStatus: 200},
+			wantStatusCode: 200,
+			wantStored:     CustomObject{Item: "a", IsUpdated: true, IsChecked: true},
+		},
+		{
+			name:           "updated again",
+			id:             "2026/03/07/item-1",
+			s3:             &fakeOutputS3{getStatus: 200, getBody: `{"item":"a","isUpdated":true,"isChecked":true}`, putStatus: 200},
+			wantStatusCode: 200,
+			wantStored:     CustomObject{Item: "a", IsUpdated: false, IsChecked: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.s3 != nil {
+				withFakeOutputS3(t, tt.s3)
+			}
+
+			response, err := updateHandler(events.APIGatewayProxyRequest{
+				HTTPMethod:     "PATCH",
+				Resource:       "/items/{id+}",
+				PathParameters: map[string]string{"id": tt.id},
+			})
+			if err != nil {
+				t.Fatalf("updateHandler() error = %v", err)
+			}
+			if response.StatusCode != tt.wantStatusCode {
+				t.Fatalf("status code = %d, want %d: %s", response.StatusCode, tt.wantStatusCode, response.Body)
+			}
+			if tt.wantDetail == "" {
+				if tt.s3.putIfMatch != `"etag"` {
+					t.Errorf("If-Match = %q, want %q", tt.s3.putIfMatch, `"etag"`)
+				}
+				stored := &CustomObject{}
+				if err := json.Unmarshal(tt.s3.putBody, stored); err != nil {
+					t.Fatalf("stored body is no custom object: %v", err)
+				}
+				if *stored != tt.wantStored {
+					t.Errorf("stored object = %+v, want %+v", *stored, tt.wantStored)
+				}
+				return
+			}
+
+			if contentType := response.Headers["Content-Type"]; contentType != commons.ProblemContentType {
+				t.Errorf("Content-Type = %q, want %q", contentType, commons.ProblemContentType)
+			}
+			problem := &commons.Problem{}
+			if err := json.Unmarshal([]byte(response.Body), problem); err != nil {
+				t.Fatalf("body is no problem details: %v", err)
+			}
+			if problem.Status != tt.wantStatusCode || problem.Detail != tt.wantDetail || problem.Title != http.StatusText(tt.wantStatusCode) {
+				t.Errorf("problem = %+v, want status %d and detail %q", problem, tt.wantStatusCode, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestGetObjectFromS3(t *testing.T) {
+	tests := []struct {
+		name      string
+		versionID string
+	}{
+		{
+			name:      "versioned bucket",
+			versionID: "3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY",
+		},
+		{
+			name:      "unversioned bucket",
+			versionID: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeOutputS3{getStatus: 200, getBody: `{"item":"a"}`}
+			withFakeOutputS3(t, fake)
+
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			ctx, span := tp.Tracer("test").Start(context.Background(), "test")
+
+			record := events.S3EventRecord{}
+			record.S3.Bucket.Name = "input"
+			record.S3.Object.Key = "2026/03/07/item-1"
+			record.S3.Object.VersionID = tt.versionID
+
+			body, err := getObjectFromS3(ctx, span, record)
+			span.End()
+			if err != nil {
+				t.Fatalf("getObjectFromS3() error = %v", err)
+			}
+			if string(body) != `{"item":"a"}` {
+				t.Errorf("getObjectFromS3() = %s", body)
+			}
+
+			if got, sent := fake.getQuery["versionId"]; (tt.versionID != "") != sent || (sent && got[0] != tt.versionID) {
+				t.Errorf("versionId = %v, want %q", got, tt.versionID)
+			}
+
+			var versionID attribute.Value
+			for _, a := range recorder.Ended()[0].Attributes() {
+				if a.Key == "aws.s3.version_id" {
+					versionID = a.Value
+				}
+			}
+			switch {
+			case tt.versionID == "" && versionID.Type() != attribute.INVALID:
+				t.Errorf("aws.s3.version_id = %q, want none", versionID.AsString())
+			case tt.versionID != "" && versionID.AsString() != tt.versionID:
+				t.Errorf("aws.s3.version_id = %q, want %q", versionID.AsString(), tt.versionID)
+			}
+		})
+	}
+}
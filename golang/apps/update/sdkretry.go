@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sdkRetryRecorder counts the resends of the requests which the SDK sends
+// within a single S3 span, the uploader may send more than one request.
+type sdkRetryRecorder struct {
+	span    trace.Span
+	resends atomic.Int64
+}
+
+func newSDKRetryRecorder(
+	span trace.Span,
+) *sdkRetryRecorder {
+	return &sdkRetryRecorder{
+		span: span,
+	}
+}
+
+// requestOption adds an SDKRetry event for every resend. A request which
+// is resent has its error cleared by the retry handler, the error is
+// therefore captured before.
+func (r *sdkRetryRecorder) requestOption() request.Option {
+	return func(req *request.Request) {
+		var lastErr error
+		req.Handlers.AfterRetry.PushFront(func(req *request.Request) {
+			lastErr = req.Error
+		})
+		req.Handlers.AfterRetry.PushBack(func(req *request.Request) {
+			if lastErr == nil || req.Error != nil {
+				return
+			}
+			r.resends.Add(1)
+
+			attributes := []attribute.KeyValue{
+				attribute.Int("aws.request.resend_count", req.RetryCount),
+				semconv.ExceptionMessage(lastErr.Error()),
+			}
+			var awsErr awserr.Error
+			if errors.As(lastErr, &awsErr) {
+				attributes = append(attributes, attribute.String("aws.error.code", awsErr.Code()))
+			}
+			r.span.AddEvent("SDKRetry", trace.WithAttributes(attributes...))
+		})
+	}
+}
+
+func (r *sdkRetryRecorder) record() {
+	r.span.SetAttributes(attribute.Int64("aws.request.resend_count", r.resends.Load()))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// eventRecordingSpan keeps the events and attributes which are added to
+// it and ignores everything else.
+type eventRecordingSpan struct {
+	trace.Span
+
+	events     []string
+	attributes map[attribute.Key]attribute.Value
+}
+
+func (s *eventRecordingSpan) AddEvent(
+	name string,
+	_ ...trace.EventOption,
+) {
+	s.events = append(s.events, name)
+}
+
+func (s *eventRecordingSpan) SetAttributes(
+	kv ...attribute.KeyValue,
+) {
+	for _, attr := range kv {
+		s.attributes[attr.Key] = attr.Value
+	}
+}
+
+func TestSDKRetryRecorder(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int32
+		wantResends int64
+		wantErr     bool
+	}{
+		{
+			name:        "no resend",
+			failures:    0,
+			wantResends: 0,
+		},
+		{
+			name:        "resent",
+			failures:    2,
+			wantResends: 2,
+		},
+		{
+			name:        "resends used up",
+			failures:    10,
+			wantResends: 3,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= tt.failures {
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte(`<Error><Code>InternalError</Code><Message>We encountered an internal error</Message></Error>`))
+				}
+			}))
+			t.Cleanup(server.Close)
+
+			client := s3.New(session.Must(session.NewSession(&aws.Config{
+				Region:           aws.String("eu-west-1"),
+				Endpoint:         aws.String(server.URL),
+				S3ForcePathStyle: aws.Bool(true),
+				Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+				MaxRetries:       aws.Int(3),
+			})))
+
+			span := &eventRecordingSpan{
+				Span:       trace.SpanFromContext(context.Background()),
+				attributes: map[attribute.Key]attribute.Value{},
+			}
+			retries := newSDKRetryRecorder(span)
+
+			_, err := client.PutObjectWithContext(context.Background(), &s3.PutObjectInput{
+				Bucket: aws.String("output"),
+				Key:    aws.String("2026/03/07/item-1"),
+				Body:   bytes.NewReader([]byte(`{"item":"x"}`)),
+			}, retries.requestOption())
+			retries.record()
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PutObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := span.attributes["aws.request.resend_count"].AsInt64(); got != tt.wantResends {
+				t.Errorf("aws.request.resend_count = %d, want %d", got, tt.wantResends)
+			}
+			if int64(len(span.events)) != tt.wantResends {
+				t.Errorf("events = %v, want %d SDKRetry events", span.events, tt.wantResends)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// getObjectTagsFromS3 reads the tags of the original object. The update
+// does not depend on them, so a failure is recorded and no tags are
+// returned.
+func getObjectTagsFromS3(
+	ctx context.Context,
+	parentSpan trace.Span,
+	bucketName string,
+	keyName string,
+) []commons.ObjectTag {
+
+	// Start S3 get tagging span
+	ctx, s3GetTaggingSpan := parentSpan.TracerProvider().Tracer(INSTRUMENTATION_SCOPE_NAME).
+		Start(ctx, "S3.GetObjectTagging",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes([]attribute.KeyValue{
+				semconv.NetTransportTCP,
+			}...))
+	defer s3GetTaggingSpan.End()
+
+	output, err := s3Client.GetObjectTaggingWithContext(ctx,
+		&s3.GetObjectTaggingInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(keyName),
+		})
+	if err != nil {
+		s3GetTaggingSpan.SetAttributes([]attribute.KeyValue{
+			semconv.OtelStatusCodeError,
+			semconv.OtelStatusDescription(OTEL_STATUS_ERROR_DESCRIPTION),
+		}...)
+
+		s3GetTaggingSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(false),
+		))
+
+		fmt.Println("Getting tags of the custom object is failed.")
+		return nil
+	}
+
+	tags := []commons.ObjectTag{}
+	for _, tag := range output.TagSet {
+		tags = append(tags, commons.ObjectTag{
+			Key:   aws.StringValue(tag.Key),
+			Value: aws.StringValue(tag.Value),
+		})
+	}
+	s3GetTaggingSpan.SetAttributes(attribute.Int("aws.s3.tags.count", len(tags)))
+	return tags
+}
+
+// updatedObjectTagging keeps the tags of the original object, including
+// the trace which has created it, and adds the trace of the update.
+func updatedObjectTagging(
+	span trace.Span,
+	original []commons.ObjectTag,
+) *string {
+	tags := original
+	if span.SpanContext().HasTraceID() {
+		tags = commons.MergeObjectTags(original, commons.ObjectTag{
+			Key:   commons.UpdatedByTraceTagKey,
+			Value: span.SpanContext().TraceID().String(),
+		})
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return aws.String(commons.EncodeObjectTags(tags))
+}
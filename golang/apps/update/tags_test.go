@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/utr1903/monitoring-lambda-with-opentelemetry/golang/apps/commons"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestGetObjectTagsFromS3(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   []commons.ObjectTag
+	}{
+		{
+			name:   "tags of the original object",
+			status: http.StatusOK,
+			body:   `<Tagging><TagSet><Tag><Key>trace.id</Key><Value>trace</Value></Tag><Tag><Key>env</Key><Value>prod</Value></Tag></TagSet></Tagging>`,
+			want:   []commons.ObjectTag{{Key: "trace.id", Value: "trace"}, {Key: "env", Value: "prod"}},
+		},
+		{
+			name:   "no tags",
+			status: http.StatusOK,
+			body:   `<Tagging><TagSet></TagSet></Tagging>`,
+			want:   []commons.ObjectTag{},
+		},
+		{
+			name:   "failed call returns no tags",
+			status: http.StatusForbidden,
+			body:   `<Error><Code>AccessDenied</Code></Error>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !r.URL.Query().Has("tagging") {
+					t.Errorf("request = %s, want GetObjectTagging", r.URL)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			t.Cleanup(server.Close)
+
+			previousClient := s3Client
+			t.Cleanup(func() { s3Client = previousClient })
+			s3Client = s3.New(session.Must(session.NewSession(&aws.Config{
+				Region:           aws.String("eu-west-1"),
+				Endpoint:         aws.String(server.URL),
+				S3ForcePathStyle: aws.Bool(true),
+				Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+				MaxRetries:       aws.Int(0),
+			})))
+
+			span := trace.SpanFromContext(context.Background())
+			got := getObjectTagsFromS3(context.Background(), span, "output", "2026/03/07/item-1")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getObjectTagsFromS3() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdatedObjectTagging(t *testing.T) {
+	traced := trace.SpanFromContext(trace.ContextWithSpanContext(context.Background(),
+		trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+			SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		})))
+	untraced := trace.SpanFromContext(context.Background())
+
+	tests := []struct {
+		name     string
+		span     trace.Span
+		original []commons.ObjectTag
+		want     string
+	}{
+		{
+			name:     "trace of the update is added",
+			span:     traced,
+			original: []commons.ObjectTag{{Key: commons.TraceTagKey, Value: "trace"}},
+			want:     "trace.id=trace&updated_by.trace.id=4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:     "trace of an earlier update is replaced",
+			span:     traced,
+			original: []commons.ObjectTag{{Key: commons.UpdatedByTraceTagKey, Value: "earlier"}},
+			want:     "updated_by.trace.id=4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:     "original tags are kept without a trace",
+			span:     untraced,
+			original: []commons.ObjectTag{{Key: "env", Value: "prod"}},
+			want:     "env=prod",
+		},
+		{
+			name: "no tags without a trace",
+			span: untraced,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := updatedObjectTagging(tt.span, tt.original)
+			if aws.StringValue(got) != tt.want || (got == nil) != (tt.want == "") {
+				t.Errorf("updatedObjectTagging() = %v, want %q", aws.StringValue(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestInstrumentationScope(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<Tagging><TagSet></TagSet></Tagging>`)
+	}))
+	t.Cleanup(server.Close)
+
+	previousClient := s3Client
+	t.Cleanup(func() { s3Client = previousClient })
+	s3Client = s3.New(session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("eu-west-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:       aws.Int(0),
+	})))
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "test")
+	getObjectTagsFromS3(ctx, span, "output", "2026/03/07/item-1")
+	span.End()
+
+	got := recorder.Ended()[0]
+	if got.Name() != "S3.GetObjectTagging" {
+		t.Fatalf("span = %q, want S3.GetObjectTagging", got.Name())
+	}
+	if got.InstrumentationScope().Name != INSTRUMENTATION_SCOPE_NAME {
+		t.Errorf("instrumentation scope = %q, want %q", got.InstrumentationScope().Name, INSTRUMENTATION_SCOPE_NAME)
+	}
+}
@@ -1,8 +1,9 @@
 locals {
 
   # S3 Bucket
-  input_s3_bucket_name  = "utr1903-input-monitoring-lambda-with-opentelemetry-golang"
-  output_s3_bucket_name = "utr1903-output-monitoring-lambda-with-opentelemetry-golang"
+  input_s3_bucket_name    = "utr1903-input-monitoring-lambda-with-opentelemetry-golang"
+  output_s3_bucket_name   = "utr1903-output-monitoring-lambda-with-opentelemetry-golang"
+  manifest_s3_bucket_name = "utr1903-manifest-monitoring-lambda-with-opentelemetry-golang"
 
   # SQS
   sqs_queue_name = "golang-sqs-queue.fifo"
@@ -11,5 +11,13 @@ resource "aws_s3_bucket" "input" {
 resource "aws_s3_bucket" "output" {
   bucket = local.output_s3_bucket_name
 
+  force_destroy = true
+}
+
+# Manifest entries are kept apart from the input bucket, whose
+# notifications trigger the update Lambda
+resource "aws_s3_bucket" "manifest" {
+  bucket = local.manifest_s3_bucket_name
+
   force_destroy = true
 }
\ No newline at end of file
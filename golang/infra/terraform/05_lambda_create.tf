@@ -59,6 +59,9 @@ resource "aws_lambda_function" "create" {
       NEWRELIC_OTLP_ENDPOINT              = substr(var.NEWRELIC_LICENSE_KEY, 0, 2) == "eu" ? "otlp.eu01.nr-data.net:4317" : "otlp.nr-data.net:4317"
       NEWRELIC_LICENSE_KEY                = var.NEWRELIC_LICENSE_KEY
       INPUT_S3_BUCKET_NAME                = aws_s3_bucket.input.id
+      ALLOWED_METHODS                     = "POST,PUT"
+      MANIFEST_S3_BUCKET_NAME             = aws_s3_bucket.manifest.id
+      MANIFEST_KEY_PREFIX                 = "manifest"
     }
   }
 
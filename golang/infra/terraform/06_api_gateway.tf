@@ -57,6 +57,22 @@ resource "aws_apigatewayv2_route" "create" {
   target    = "integrations/${aws_apigatewayv2_integration.apigw_integration.id}"
 }
 
+# API gateway route for caller chosen keys
+resource "aws_apigatewayv2_route" "put_item" {
+  api_id = aws_apigatewayv2_api.apigw.id
+
+  route_key = "PUT /items/{id+}"
+  target    = "integrations/${aws_apigatewayv2_integration.apigw_integration.id}"
+}
+
+# API gateway route for load balancer and canary checks
+resource "aws_apigatewayv2_route" "health" {
+  api_id = aws_apigatewayv2_api.apigw.id
+
+  route_key = "GET /health"
+  target    = "integrations/${aws_apigatewayv2_integration.apigw_integration.id}"
+}
+
 # Lambda permission for API gateway to invoke
 resource "aws_lambda_permission" "allow_api_gateway_for_create" {
   statement_id  = "AllowExecutionFromAPIGateway"
@@ -98,3 +98,30 @@ resource "aws_s3_bucket_notification" "update_s3_trigger" {
     aws_lambda_permission.allow_s3_bucket_for_update
   ]
 }
+
+# API gateway integration for in place updates
+resource "aws_apigatewayv2_integration" "apigw_integration_update" {
+  api_id = aws_apigatewayv2_api.apigw.id
+
+  integration_uri    = aws_lambda_function.update.invoke_arn
+  integration_type   = "AWS_PROXY"
+  integration_method = "POST"
+}
+
+# API gateway route for in place updates
+resource "aws_apigatewayv2_route" "update_item" {
+  api_id = aws_apigatewayv2_api.apigw.id
+
+  route_key = "PATCH /items/{id+}"
+  target    = "integrations/${aws_apigatewayv2_integration.apigw_integration_update.id}"
+}
+
+# Lambda permission for API gateway to invoke
+resource "aws_lambda_permission" "allow_api_gateway_for_update" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.update.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "${aws_apigatewayv2_api.apigw.execution_arn}/*/*"
+}
@@ -75,6 +75,7 @@ resource "aws_lambda_function" "check" {
 
 # Lambda trigger for SQS
 resource "aws_lambda_event_source_mapping" "sqs_trigger_for_lambda" {
-  event_source_arn = aws_sqs_queue.queue.arn
-  function_name    = aws_lambda_function.check.arn
+  event_source_arn        = aws_sqs_queue.queue.arn
+  function_name           = aws_lambda_function.check.arn
+  function_response_types = ["ReportBatchItemFailures"]
 }